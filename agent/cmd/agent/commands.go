@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/visiblaze/sec-agent/agent/internal/cis"
+	"github.com/visiblaze/sec-agent/agent/internal/collect"
+	"github.com/visiblaze/sec-agent/agent/internal/config"
+	"github.com/visiblaze/sec-agent/agent/internal/ingest"
+	"github.com/visiblaze/sec-agent/agent/internal/remediate"
+	"github.com/visiblaze/sec-agent/agent/internal/report"
+	"github.com/visiblaze/sec-agent/agent/internal/schedule"
+	"github.com/visiblaze/sec-agent/agent/internal/status"
+)
+
+func cmdCollect(args []string) int {
+	fs := flag.NewFlagSet("collect", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to config file")
+	output := fs.String("output", "table", "Output format: "+strings.Join(report.Formats, ", "))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, ok := loadConfig(*configPath)
+	if !ok {
+		return 1
+	}
+	logger := cliLogger()
+	defer logger.Close()
+
+	ctx, stop := signalContext()
+	defer stop()
+	payload, err := schedule.New(cfg, logger, Version).BuildPayload(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "collection failed: %v\n", err)
+		return 1
+	}
+
+	if err := report.Render(os.Stdout, *output, payload); err != nil {
+		fmt.Fprintf(os.Stderr, "collect: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+func cmdReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to config file (live run only)")
+	format := fs.String("format", "table", "Report format: "+strings.Join(report.Formats, ", "))
+	input := fs.String("input", "", "Render a saved payload file instead of collecting live")
+	outPath := fs.String("o", "", "Write the report to this file instead of stdout")
+	failOnFail := fs.Bool("fail-on-fail", false, "Exit 1 if any check failed")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var payload *ingest.Payload
+	var err error
+	if *input != "" {
+		payload, err = report.Load(*input)
+	} else {
+		cfg, ok := loadConfig(*configPath)
+		if !ok {
+			return 1
+		}
+		logger := cliLogger()
+		defer logger.Close()
+		ctx, stop := signalContext()
+		defer stop()
+		payload, err = schedule.New(cfg, logger, Version).BuildPayload(ctx)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "report: %v\n", err)
+		return 1
+	}
+
+	out := os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "report: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := report.Render(out, *format, payload); err != nil {
+		fmt.Fprintf(os.Stderr, "report: %v\n", err)
+		return 2
+	}
+
+	if *failOnFail && report.Summarize(payload.CISResults).Fail > 0 {
+		return 1
+	}
+	return 0
+}
+
+func cmdCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	id := fs.String("id", "", "Check ID to run, e.g. P3")
+	timeout := fs.Duration("timeout", 30*time.Second, "Cancel the check after this long")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *id == "" {
+		fmt.Fprintln(os.Stderr, "check: -id is required")
+		fs.Usage()
+		return 2
+	}
+
+	check, ok := cis.Find(*id)
+	if !ok {
+		var ids []string
+		for _, c := range cis.All() {
+			ids = append(ids, c.ID)
+		}
+		fmt.Fprintf(os.Stderr, "unknown check %q (available: %s)\n", *id, strings.Join(ids, ", "))
+		return 2
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	result := cis.RunCheck(ctx, check, *timeout)
+	fmt.Printf("Check:    %s\n", result.CheckID)
+	fmt.Printf("Title:    %s\n", result.Title)
+	fmt.Printf("Status:   %s\n", strings.ToUpper(result.Status))
+	_, fixable := check.Runner.(cis.Fixer)
+	fmt.Printf("Fixable:  %t\n", fixable)
+	fmt.Println("Evidence:")
+	keys := make([]string, 0, len(result.Evidence))
+	for k := range result.Evidence {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("  %s: %v\n", k, strings.TrimSpace(fmt.Sprint(result.Evidence[k])))
+	}
+
+	switch result.Status {
+	case "fail", cis.StatusError, cis.StatusTimeout:
+		return 1
+	}
+	return 0
+}
+
+func cmdConfig(args []string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "usage: visiblaze-agent config validate [-config path]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to config file")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, ok := loadConfig(*configPath)
+	if !ok {
+		return 1
+	}
+	if _, err := ingest.NewClient(cfg, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "config %s: tls: %v\n", *configPath, err)
+		return 1
+	}
+
+	fmt.Printf("%s: OK\n", *configPath)
+	fmt.Printf("  api_base_url:                %s\n", cfg.APIBaseURL)
+	fmt.Printf("  collection_interval_minutes: %d\n", cfg.CollectionIntervalMinutes)
+	fmt.Printf("  state_dir:                   %s\n", cfg.StateDir)
+	fmt.Printf("  tls.client_cert:             %t\n", cfg.TLS.CertFile != "")
+	fmt.Printf("  tls.pinned_keys:             %d\n", len(cfg.TLS.PinnedSPKI))
+	fmt.Printf("  remediation.enabled:         %t\n", cfg.Remediation.Enabled)
+	if len(cfg.Remediation.AllowedChecks) > 0 {
+		fmt.Printf("  remediation.allowed_checks:  %s\n", strings.Join(cfg.Remediation.AllowedChecks, ", "))
+	}
+	return 0
+}
+
+func cmdStatus(args []string) int {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to config file")
+	asJSON := fs.Bool("json", false, "Print status as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, ok := loadConfig(*configPath)
+	if !ok {
+		return 1
+	}
+
+	st, err := status.Load(cfg.StateDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "status: %v\n", err)
+		return 1
+	}
+	if *asJSON {
+		return printJSON(st)
+	}
+
+	if st.LastRun == "" {
+		fmt.Println("No collection has run yet")
+		return 0
+	}
+	fmt.Printf("Agent version:  %s\n", st.AgentVersion)
+	fmt.Printf("Last run:       %s (%d ms)\n", st.LastRun, st.LastDurationMS)
+	fmt.Printf("Last success:   %s\n", valueOr(st.LastSuccess, "never"))
+	fmt.Printf("Last error:     %s\n", valueOr(st.LastError, "none"))
+	fmt.Printf("Queue depth:    %d\n", st.QueueDepth)
+	fmt.Printf("Collections:    %d\n", st.CollectionCount)
+	if len(st.Tasks) > 0 {
+		names := make([]string, 0, len(st.Tasks))
+		for name := range st.Tasks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Println()
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TASK\tLAST RUN\tDURATION\tNEXT RUN\tLAST ERROR")
+		for _, name := range names {
+			t := st.Tasks[name]
+			fmt.Fprintf(tw, "%s\t%s\t%d ms\t%s\t%s\n", name, valueOr(t.LastRun, "never"), t.LastDurationMS, valueOr(t.NextRun, "-"), valueOr(t.LastError, "none"))
+		}
+		tw.Flush()
+	}
+	if st.LastError != "" {
+		return 1
+	}
+	return 0
+}
+
+func cmdRemediate(args []string) int {
+	fs := flag.NewFlagSet("remediate", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to config file")
+	dryRun := fs.Bool("dry-run", false, "Print a diff of planned changes without applying them")
+	list := fs.Bool("list", false, "List remediation runs that can be rolled back")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, ok := loadConfig(*configPath)
+	if !ok {
+		return 1
+	}
+
+	if *list {
+		ids, err := remediate.New(cfg.Remediation.BackupDir, false, nil).Runs()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "list runs: %v\n", err)
+			return 1
+		}
+		for _, id := range ids {
+			fmt.Println(id)
+		}
+		return 0
+	}
+
+	logger := cliLogger()
+	defer logger.Close()
+
+	ctx, stop := signalContext()
+	defer stop()
+	results := schedule.New(cfg, logger, Version).Remediate(ctx, *dryRun, os.Stdout)
+	if len(results) == 0 {
+		fmt.Println("No allowlisted checks need remediation")
+	}
+	failed := false
+	for _, res := range results {
+		fmt.Printf("%-4s %-12s %s %s\n", res.CheckID, res.Status, res.Description, res.Error)
+		failed = failed || res.Status == remediate.StatusFailed
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func cmdRollback(args []string) int {
+	fs := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to config file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: visiblaze-agent rollback [-config path] <run id>")
+		return 2
+	}
+
+	cfg, ok := loadConfig(*configPath)
+	if !ok {
+		return 1
+	}
+	logger := cliLogger()
+	defer logger.Close()
+
+	runID := fs.Arg(0)
+	if err := remediate.New(cfg.Remediation.BackupDir, false, os.Stdout).Rollback(runID); err != nil {
+		logger.Errorf("Rollback of %s failed: %v", runID, err)
+		fmt.Fprintf(os.Stderr, "rollback failed: %v\n", err)
+		return 1
+	}
+	logger.Infof("Rolled back remediation run %s", runID)
+	return 0
+}
+
+func cmdEnroll(args []string) int {
+	fs := flag.NewFlagSet("enroll", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to config file")
+	rotate := fs.Bool("rotate", false, "Replace the existing credential with a new one")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, ok := loadConfig(*configPath)
+	if !ok {
+		return 1
+	}
+	logger := cliLogger()
+	defer logger.Close()
+
+	client, err := ingest.NewClient(cfg, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "enroll: %v\n", err)
+		return 1
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	if *rotate {
+		if err := client.RotateCredential(ctx); err != nil {
+			logger.Errorf("Credential rotation failed: %v", err)
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		logger.Infof("Rotated credential for host %s", client.Credential().HostID)
+		fmt.Printf("Rotated credential for host %s\n", client.Credential().HostID)
+		return 0
+	}
+
+	if cred := client.Credential(); cred != nil {
+		fmt.Printf("Already enrolled as host %s (issued %s)\n", cred.HostID, cred.IssuedAt)
+		return 0
+	}
+	if cfg.EnrollmentToken == "" {
+		fmt.Fprintln(os.Stderr, "enroll: enrollment_token is not set in the config")
+		return 1
+	}
+	host, err := collect.GetHostInfo(ctx, Version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "enroll: %v\n", err)
+		return 1
+	}
+	if err := client.Enroll(ctx, cfg.EnrollmentToken, host.HostID, host.Hostname); err != nil {
+		logger.Errorf("Enrollment failed: %v", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	logger.Infof("Enrolled as host %s", host.HostID)
+	fmt.Printf("Enrolled as host %s; credential stored in %s\n", host.HostID, cfg.CredentialPath())
+	return 0
+}
+
+func cmdVersion(args []string) int {
+	fmt.Printf("visiblaze-agent %s\n", Version)
+	return 0
+}
+
+func loadConfig(path string) (*config.Config, bool) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config %s: %v\n", path, err)
+		return nil, false
+	}
+	return cfg, true
+}
+
+func printJSON(v interface{}) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "encode: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func valueOr(v, fallback string) string {
+	if v == "" {
+		return fallback
+	}
+	return v
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/visiblaze/sec-agent/agent/internal/config"
@@ -13,20 +17,78 @@ import (
 
 var Version = "0.1.0"
 
+const defaultConfigPath = "/etc/visiblaze-agent/config.yaml"
+
+const usage = `Usage: visiblaze-agent <command> [flags]
+
+Commands:
+  run               Run the collection daemon (default)
+  collect           Collect and print host data without sending it
+  check             Run a single CIS check with verbose evidence
+  report            Render a table, HTML, JUnit, SARIF or SBOM report
+  config validate   Validate the config file
+  status            Show last run, queue depth and last error
+  remediate         Fix failed checks listed in remediation.allowed_checks
+  rollback <id>     Restore files changed by a remediation run
+  enroll            Exchange the enrollment token for a per-host credential
+  version           Print the agent version
+
+Run 'visiblaze-agent <command> -h' for command flags.
+`
+
+type command func(args []string) int
+
+var commands = map[string]command{
+	"run":       cmdRun,
+	"collect":   cmdCollect,
+	"check":     cmdCheck,
+	"report":    cmdReport,
+	"config":    cmdConfig,
+	"status":    cmdStatus,
+	"remediate": cmdRemediate,
+	"rollback":  cmdRollback,
+	"enroll":    cmdEnroll,
+	"version":   cmdVersion,
+}
+
 func main() {
-	configPath := flag.String("config", "/etc/visiblaze-agent/config.yaml", "Path to config file")
-	runOnce := flag.Bool("once", false, "Run collection once and exit")
-	flag.Parse()
-
-	// Initialize logging (allow override via VISIBLAZE_LOG_DIR for local dev)
-	logDir := os.Getenv("VISIBLAZE_LOG_DIR")
-	if logDir == "" {
-		logDir = "/var/log/visiblaze-agent"
+	os.Exit(dispatch(os.Args[1:]))
+}
+
+func dispatch(args []string) int {
+	// Bare flags keep the pre-subcommand invocation working (-config, -once)
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && !isHelp(args[0]) {
+		return cmdRun(args)
+	}
+	if isHelp(args[0]) {
+		fmt.Print(usage)
+		return 0
 	}
-	logger, err := logging.New(logDir)
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+	return cmd(args[1:])
+}
+
+func isHelp(arg string) bool {
+	return arg == "help" || arg == "-h" || arg == "--help"
+}
+
+func cmdRun(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to config file")
+	runOnce := fs.Bool("once", false, "Run collection once and exit")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	logger, err := logging.New(logDir())
 	if err != nil {
 		os.Stderr.WriteString("Failed to initialize logging: " + err.Error() + "\n")
-		os.Exit(1)
+		return 1
 	}
 	defer logger.Close()
 
@@ -36,32 +98,86 @@ func main() {
 	cfg, err := config.Load(*configPath)
 	if err != nil {
 		logger.Errorf("Failed to load config: %v", err)
-		os.Exit(1)
+		return 1
 	}
 
 	// Initialize scheduler
-	sched := schedule.New(cfg, logger)
+	sched := schedule.New(cfg, logger, Version)
 
 	if *runOnce {
 		logger.Infof("Running collection once")
-		if err := sched.RunOnce(); err != nil {
+		ctx, stop := signalContext()
+		defer stop()
+		if err := sched.RunOnce(ctx); err != nil {
 			logger.Errorf("Collection failed: %v", err)
-			os.Exit(1)
+			return 1
 		}
 		logger.Infof("Collection complete")
-		return
+		return 0
 	}
 
+	// Reload on SIGHUP, stop on interrupt. Registered before the scheduler
+	// starts so a signal during startup is not handled by the default action.
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
 	// Start scheduler
-	logger.Infof("Starting scheduler (interval: %d minutes)", cfg.CollectionIntervalMinutes)
+	logger.Infof("Starting scheduler")
 	go sched.Start()
 
-	// Wait for interrupt
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	reload := func() {
+		newCfg, err := config.Load(*configPath)
+		if err != nil {
+			logger.Errorf("Config reload rejected, keeping current config: %v", err)
+			return
+		}
+		sched.Reload(newCfg)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	if cfg.WatchConfig {
+		if err := config.Watch(*configPath, done, reload); err != nil {
+			logger.Warnf("Failed to watch config file, use SIGHUP to reload: %v", err)
+		}
+	}
+
+	for sig := range sigChan {
+		if sig == syscall.SIGHUP {
+			logger.Infof("SIGHUP received, reloading config")
+			reload()
+			continue
+		}
+		break
+	}
 
 	logger.Infof("Shutdown signal received")
 	sched.Stop()
 	logger.Infof("Agent stopped")
+	return 0
+}
+
+// signalContext is cancelled on SIGINT or SIGTERM, so one-off commands stop
+// promptly instead of waiting on a hung check or request.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
+
+// logDir allows overriding the log location via VISIBLAZE_LOG_DIR for local dev.
+func logDir() string {
+	if dir := os.Getenv("VISIBLAZE_LOG_DIR"); dir != "" {
+		return dir
+	}
+	return "/var/log/visiblaze-agent"
+}
+
+// cliLogger is used by the troubleshooting commands. They print their results
+// to stdout, so logs still go to the agent log file when it is writable and
+// are dropped otherwise rather than cluttering the terminal.
+func cliLogger() *logging.Logger {
+	if logger, err := logging.New(logDir()); err == nil {
+		return logger
+	}
+	return logging.NewWriter(io.Discard)
 }
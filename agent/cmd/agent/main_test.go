@@ -11,3 +11,21 @@ func TestVersionExists(t *testing.T) {
 		t.Logf("Current version: %s", Version)
 	}
 }
+
+func TestDispatchUnknownCommand(t *testing.T) {
+	if code := dispatch([]string{"bogus"}); code != 2 {
+		t.Fatalf("expected exit code 2 for unknown command, got %d", code)
+	}
+}
+
+func TestDispatchVersion(t *testing.T) {
+	if code := dispatch([]string{"version"}); code != 0 {
+		t.Fatalf("expected exit code 0 for version, got %d", code)
+	}
+}
+
+func TestCheckRequiresKnownID(t *testing.T) {
+	if code := dispatch([]string{"check", "-id", "P99"}); code != 2 {
+		t.Fatalf("expected exit code 2 for unknown check, got %d", code)
+	}
+}
@@ -1,7 +1,8 @@
 package cis
 
 import (
-	"time"
+	"context"
+	"strings"
 )
 
 type CheckResult struct {
@@ -12,34 +13,48 @@ type CheckResult struct {
 	Timestamp string                 `json:"ts"`
 }
 
+// CheckRunner runs one check. Runners must stop when ctx is done and return
+// the evidence gathered so far; RunCheck then reports a timeout.
 type CheckRunner interface {
-	Run() *CheckResult
+	Run(ctx context.Context) *CheckResult
 }
 
-func RunAllChecks() []*CheckResult {
-	runners := []CheckRunner{
-		&P1PasswordQuality{},
-		&P2PasswordExpiry{},
-		&P3RootSSH{},
-		&P4UnusedFS{},
-		&P5Firewall{},
-		&P6TimeSync{},
-		&P7Auditd{},
-		&P8MAC{},
-		&P9WorldWritable{},
-		&P10GDMAutoLogin{},
-		&P11SSHProtocol2{},
-		&P12IPv6{},
+// Check pairs a runner with the ID it reports under.
+type Check struct {
+	ID     string
+	Runner CheckRunner
+}
+
+// All returns the checks run on every collection, in report order.
+func All() []Check {
+	return []Check{
+		{"P1", &P1PasswordQuality{}},
+		{"P2", &P2PasswordExpiry{}},
+		{"P3", &P3RootSSH{}},
+		{"P4", &P4UnusedFS{}},
+		{"P5", &P5Firewall{}},
+		{"P6", &P6TimeSync{}},
+		{"P7", &P7Auditd{}},
+		{"P8", &P8MAC{}},
+		{"P9", &P9WorldWritable{}},
+		{"P10", &P10GDMAutoLogin{}},
+		{"P11", &P11SSHProtocol2{}},
+		{"P12", &P12IPv6{}},
 	}
+}
 
-	results := make([]*CheckResult, 0, len(runners))
-	for _, runner := range runners {
-		result := runner.Run()
-		result.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
-		results = append(results, result)
+// Find returns the check registered under id.
+func Find(id string) (Check, bool) {
+	for _, c := range All() {
+		if strings.EqualFold(c.ID, id) {
+			return c, true
+		}
 	}
+	return Check{}, false
+}
 
-	return results
+func RunAllChecks(ctx context.Context) []*CheckResult {
+	return RunChecks(ctx, All(), nil)
 }
 
 func newResult(checkID, title, status string, evidence map[string]interface{}) *CheckResult {
@@ -1,8 +1,10 @@
 package cis
 
+import "context"
+
 type P10GDMAutoLogin struct{}
 
-func (p *P10GDMAutoLogin) Run() *CheckResult {
+func (p *P10GDMAutoLogin) Run(ctx context.Context) *CheckResult {
 	// Check that GDM autologin is disabled
 	// Status: PASS if autologin disabled, FAIL otherwise
 	return newResult("P10", "GDM autologin disabled", "pass",
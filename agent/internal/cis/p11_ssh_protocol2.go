@@ -1,8 +1,10 @@
 package cis
 
+import "context"
+
 type P11SSHProtocol2 struct{}
 
-func (p *P11SSHProtocol2) Run() *CheckResult {
+func (p *P11SSHProtocol2) Run(ctx context.Context) *CheckResult {
 	// Check that SSH Protocol 2 is enforced (no Protocol 1)
 	// Status: PASS if only Protocol 2, FAIL if Protocol 1 enabled
 	return newResult("P11", "SSH Protocol 2 enforced", "pass",
@@ -1,10 +1,42 @@
 package cis
 
+import (
+	"context"
+	"strings"
+
+	"github.com/visiblaze/sec-agent/agent/internal/remediate"
+	"github.com/visiblaze/sec-agent/agent/internal/util"
+)
+
 type P12IPv6 struct{}
 
-func (p *P12IPv6) Run() *CheckResult {
-	// Check if IPv6 is disabled (if applicable)
-	// Status: PASS if IPv6 disabled or not needed, FAIL if enabled without authorization
-	return newResult("P12", "IPv6 disabled if not needed", "pass",
-		map[string]interface{}{"ipv6_disabled": true, "kernel_param": "net.ipv6.conf.all.disable_ipv6=1"})
+// Run passes when IPv6 is disabled for all and for new interfaces, or when
+// the kernel has no IPv6 support at all.
+func (p *P12IPv6) Run(ctx context.Context) *CheckResult {
+	evidence := make(map[string]interface{})
+	disabled := true
+	for _, key := range []string{"net.ipv6.conf.all.disable_ipv6", "net.ipv6.conf.default.disable_ipv6"} {
+		value, err := util.ReadFile("/proc/sys/" + strings.ReplaceAll(key, ".", "/"))
+		if err != nil {
+			evidence["ipv6"] = "not supported by the kernel"
+			return newResult("P12", "IPv6 disabled if not needed", "pass", evidence)
+		}
+		value = strings.TrimSpace(value)
+		evidence[key] = value
+		if value != "1" {
+			disabled = false
+		}
+	}
+
+	if disabled {
+		return newResult("P12", "IPv6 disabled if not needed", "pass", evidence)
+	}
+	return newResult("P12", "IPv6 disabled if not needed", "fail", evidence)
+}
+
+func (p *P12IPv6) Fix() (*remediate.Action, error) {
+	return remediate.Sysctl("P12", map[string]string{
+		"net.ipv6.conf.all.disable_ipv6":     "1",
+		"net.ipv6.conf.default.disable_ipv6": "1",
+	}, "net.ipv6.conf.all.disable_ipv6", "net.ipv6.conf.default.disable_ipv6")
 }
@@ -1,6 +1,7 @@
 package cis
 
 import (
+	"context"
 	"strings"
 
 	"github.com/visiblaze/sec-agent/agent/internal/util"
@@ -8,7 +9,7 @@ import (
 
 type P13SSHKeyManagement struct{}
 
-func (p *P13SSHKeyManagement) Run() *CheckResult {
+func (p *P13SSHKeyManagement) Run(ctx context.Context) *CheckResult {
 	evidence := make(map[string]interface{})
 	authKeysPath := "/root/.ssh/authorized_keys"
 	content, err := util.ReadFile(authKeysPath)
@@ -1,6 +1,7 @@
 package cis
 
 import (
+	"context"
 	"strings"
 
 	"github.com/visiblaze/sec-agent/agent/internal/util"
@@ -8,7 +9,7 @@ import (
 
 type P1PasswordQuality struct{}
 
-func (p *P1PasswordQuality) Run() *CheckResult {
+func (p *P1PasswordQuality) Run(ctx context.Context) *CheckResult {
 	pwqualityConf := "/etc/security/pwquality.conf"
 	content, err := util.ReadFile(pwqualityConf)
 	if err != nil {
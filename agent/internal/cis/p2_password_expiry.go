@@ -1,14 +1,16 @@
 package cis
 
 import (
+	"context"
 	"strings"
 
+	"github.com/visiblaze/sec-agent/agent/internal/remediate"
 	"github.com/visiblaze/sec-agent/agent/internal/util"
 )
 
 type P2PasswordExpiry struct{}
 
-func (p *P2PasswordExpiry) Run() *CheckResult {
+func (p *P2PasswordExpiry) Run(ctx context.Context) *CheckResult {
 	loginDefs := "/etc/login.defs"
 	content, err := util.ReadFile(loginDefs)
 	if err != nil {
@@ -45,3 +47,22 @@ func (p *P2PasswordExpiry) Run() *CheckResult {
 	}
 	return newResult("P2", "Password expiration policy", "fail", evidence)
 }
+
+func (p *P2PasswordExpiry) Fix() (*remediate.Action, error) {
+	loginDefs := "/etc/login.defs"
+	edit, err := remediate.SetDirective(loginDefs, "PASS_MAX_DAYS", "\t", "365")
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply the remaining directives on top of the first edit's content
+	for _, d := range [][2]string{{"PASS_MIN_DAYS", "1"}, {"PASS_WARN_AGE", "7"}} {
+		edit.Content = remediate.SetDirectiveIn(edit.Content, d[0], "\t", d[1])
+	}
+
+	return &remediate.Action{
+		CheckID:     "P2",
+		Description: "set password aging defaults in login.defs",
+		Edits:       []remediate.FileEdit{edit},
+	}, nil
+}
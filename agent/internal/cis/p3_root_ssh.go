@@ -1,34 +1,124 @@
 package cis
 
 import (
+	"context"
+	"path/filepath"
 	"strings"
 
+	"github.com/visiblaze/sec-agent/agent/internal/remediate"
 	"github.com/visiblaze/sec-agent/agent/internal/util"
 )
 
+const (
+	sshdConfig    = "/etc/ssh/sshd_config"
+	sshdDropInDir = "/etc/ssh/sshd_config.d"
+)
+
 type P3RootSSH struct{}
 
-func (p *P3RootSSH) Run() *CheckResult {
-	sshConfig := "/etc/ssh/sshd_config"
-	content, err := util.ReadFile(sshConfig)
-	if err != nil {
+func (p *P3RootSSH) Run(ctx context.Context) *CheckResult {
+	if !util.FileExists(sshdConfig) {
 		return newResult("P3", "Root login over SSH disabled", "manual",
 			map[string]interface{}{"reason": "sshd_config not found"})
 	}
 
 	evidence := make(map[string]interface{})
-	permitRootLine := ""
-
-	for _, line := range strings.Split(content, "\n") {
-		if strings.Contains(line, "PermitRootLogin") && !strings.HasPrefix(strings.TrimSpace(line), "#") {
-			permitRootLine = line
-			evidence["PermitRootLogin"] = line
-			break
-		}
+	permitRootLine, file := sshdSetting(sshdConfig, "PermitRootLogin", 0)
+	if permitRootLine != "" {
+		evidence["PermitRootLogin"] = permitRootLine
+		evidence["file"] = file
 	}
 
-	if strings.Contains(permitRootLine, "no") {
+	if fields := strings.Fields(strings.ReplaceAll(permitRootLine, "=", " ")); len(fields) > 1 && strings.EqualFold(fields[1], "no") {
 		return newResult("P3", "Root login over SSH disabled", "pass", evidence)
 	}
 	return newResult("P3", "Root login over SSH disabled", "fail", evidence)
 }
+
+// Fix sets PermitRootLogin no in sshd_config and in every drop-in that sets
+// it, since a drop-in included first would override the main file. The
+// result is checked with sshd -t before the SSH server is reloaded, so a
+// broken configuration is rolled back instead of locking admins out.
+func (p *P3RootSSH) Fix() (*remediate.Action, error) {
+	edit, err := remediate.SetSSHDirective(sshdConfig, "PermitRootLogin", "no")
+	if err != nil {
+		return nil, err
+	}
+	edit.Mode = 0600
+	edits := []remediate.FileEdit{edit}
+
+	dropIns, _ := filepath.Glob(filepath.Join(sshdDropInDir, "*.conf"))
+	for _, path := range dropIns {
+		content, err := util.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if line, _ := sshdSettingIn(content, path, "PermitRootLogin", 0); line == "" {
+			continue
+		}
+		edits = append(edits, remediate.FileEdit{
+			Path:    path,
+			Content: remediate.SetSSHDirectiveIn(content, "PermitRootLogin", "no"),
+		})
+	}
+
+	reload := [][]string{{"systemctl", "reload", sshUnit()}}
+	return &remediate.Action{
+		CheckID:          "P3",
+		Description:      "set PermitRootLogin no in sshd_config",
+		Edits:            edits,
+		Validate:         [][]string{{"sshd", "-t", "-f", sshdConfig}},
+		PostCommands:     reload,
+		RollbackCommands: reload,
+	}, nil
+}
+
+// sshdSetting returns the line of path that sets key for every connection,
+// and the file it is in, following Include directives as sshd does: the
+// first value read wins and a Match block runs to the end of its file.
+func sshdSetting(path, key string, depth int) (line, file string) {
+	content, err := util.ReadFile(path)
+	if err != nil {
+		return "", ""
+	}
+	return sshdSettingIn(content, path, key, depth)
+}
+
+func sshdSettingIn(content, path, key string, depth int) (line, file string) {
+	for _, l := range strings.Split(content, "\n") {
+		fields := strings.Fields(strings.ReplaceAll(l, "=", " "))
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch {
+		case strings.EqualFold(fields[0], "Match"):
+			return "", ""
+		case strings.EqualFold(fields[0], "Include") && depth < 8:
+			for _, pattern := range fields[1:] {
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(filepath.Dir(sshdConfig), pattern)
+				}
+				matches, _ := filepath.Glob(pattern)
+				for _, m := range matches {
+					if line, file := sshdSetting(m, key, depth+1); line != "" {
+						return line, file
+					}
+				}
+			}
+		case strings.EqualFold(fields[0], key):
+			return l, path
+		}
+	}
+	return "", ""
+}
+
+// sshUnit returns the systemd unit of the SSH server: ssh on Debian and
+// Ubuntu, sshd elsewhere.
+func sshUnit() string {
+	for _, dir := range []string{"/etc/systemd/system", "/lib/systemd/system", "/usr/lib/systemd/system"} {
+		if util.FileExists(filepath.Join(dir, "ssh.service")) {
+			return "ssh"
+		}
+	}
+	return "sshd"
+}
@@ -1,16 +1,23 @@
 package cis
 
 import (
+	"context"
+	"slices"
 	"strings"
 
+	"github.com/visiblaze/sec-agent/agent/internal/remediate"
 	"github.com/visiblaze/sec-agent/agent/internal/util"
 )
 
 type P4UnusedFS struct{}
 
-func (p *P4UnusedFS) Run() *CheckResult {
+// snapdStateFile is present wherever snapd is installed. Snaps are squashfs
+// images, so squashfs is not unused there.
+const snapdStateFile = "/var/lib/snapd/state.json"
+
+func (p *P4UnusedFS) Run(ctx context.Context) *CheckResult {
 	evidence := make(map[string]interface{})
-	fsToCheck := []string{"cramfs", "squashfs", "udf"}
+	fsToCheck := unusedFilesystems(evidence)
 
 	procFS, _ := util.ReadFile("/proc/filesystems")
 	evidence["supported_filesystems"] = procFS
@@ -29,3 +36,76 @@ func (p *P4UnusedFS) Run() *CheckResult {
 	}
 	return newResult("P4", "Unused filesystems disabled", "fail", evidence)
 }
+
+// Fix blacklists the unused filesystem modules and unloads those that are
+// loaded but not in use; a module in use stays loaded until the next boot.
+func (p *P4UnusedFS) Fix() (*remediate.Action, error) {
+	modules := unusedFilesystems(nil)
+	action, err := remediate.BlacklistModules("P4", modules...)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(modules, "squashfs") {
+		// Undo the blacklisting of squashfs by earlier versions of this fix
+		var keep []string
+		for _, line := range strings.SplitAfter(action.Edits[0].Content, "\n") {
+			if l := strings.TrimSpace(line); l != "install squashfs /bin/false" && l != "blacklist squashfs" {
+				keep = append(keep, line)
+			}
+		}
+		action.Edits[0].Content = strings.Join(keep, "")
+	}
+
+	loaded := loadedModules()
+	mounted := mountedFilesystems()
+	for _, m := range modules {
+		if refs, ok := loaded[m]; ok && refs == "0" && !mounted[m] {
+			action.PostCommands = append(action.PostCommands, []string{"modprobe", "-r", m})
+		}
+	}
+	return action, nil
+}
+
+// unusedFilesystems returns the filesystems that should be disabled. squashfs
+// is left out on hosts with snapd or a squashfs mount, as disabling it would
+// break them; the reason is added to evidence when it is not nil.
+func unusedFilesystems(evidence map[string]interface{}) []string {
+	fs := []string{"cramfs", "udf"}
+	switch {
+	case util.FileExists(snapdStateFile):
+		if evidence != nil {
+			evidence["squashfs_skipped"] = "snapd is installed"
+		}
+	case mountedFilesystems()["squashfs"]:
+		if evidence != nil {
+			evidence["squashfs_skipped"] = "squashfs is mounted"
+		}
+	default:
+		fs = []string{"cramfs", "squashfs", "udf"}
+	}
+	return fs
+}
+
+// loadedModules maps each loaded kernel module to its use count.
+func loadedModules() map[string]string {
+	modules := make(map[string]string)
+	lines, _ := util.ReadFileLines("/proc/modules")
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) >= 3 {
+			modules[fields[0]] = fields[2]
+		}
+	}
+	return modules
+}
+
+// mountedFilesystems returns the filesystem types currently mounted.
+func mountedFilesystems() map[string]bool {
+	types := make(map[string]bool)
+	lines, _ := util.ReadFileLines("/proc/mounts")
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) >= 3 {
+			types[fields[2]] = true
+		}
+	}
+	return types
+}
@@ -1,6 +1,7 @@
 package cis
 
 import (
+	"context"
 	"strings"
 
 	"github.com/visiblaze/sec-agent/agent/internal/util"
@@ -8,11 +9,11 @@ import (
 
 type P5Firewall struct{}
 
-func (p *P5Firewall) Run() *CheckResult {
+func (p *P5Firewall) Run(ctx context.Context) *CheckResult {
 	evidence := make(map[string]interface{})
 
 	// Try UFW (Ubuntu)
-	ufwStatus, _ := util.RunCmd("ufw", "status")
+	ufwStatus, _ := util.RunCmd(ctx, "ufw", "status")
 	evidence["ufw_status"] = ufwStatus
 
 	if strings.Contains(ufwStatus, "active") {
@@ -20,7 +21,7 @@ func (p *P5Firewall) Run() *CheckResult {
 	}
 
 	// Try firewalld (RHEL)
-	fwStatus, _ := util.RunCmd("systemctl", "is-active", "firewalld")
+	fwStatus, _ := util.RunCmd(ctx, "systemctl", "is-active", "firewalld")
 	evidence["firewalld_status"] = fwStatus
 
 	if strings.Contains(fwStatus, "active") {
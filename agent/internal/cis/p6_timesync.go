@@ -1,6 +1,7 @@
 package cis
 
 import (
+	"context"
 	"strings"
 
 	"github.com/visiblaze/sec-agent/agent/internal/util"
@@ -8,18 +9,18 @@ import (
 
 type P6TimeSync struct{}
 
-func (p *P6TimeSync) Run() *CheckResult {
+func (p *P6TimeSync) Run(ctx context.Context) *CheckResult {
 	evidence := make(map[string]interface{})
 
 	// Check chrony
-	chronyStatus, _ := util.RunCmd("systemctl", "is-active", "chronyd")
+	chronyStatus, _ := util.RunCmd(ctx, "systemctl", "is-active", "chronyd")
 	evidence["chronyd"] = chronyStatus
 	if strings.Contains(chronyStatus, "active") {
 		return newResult("P6", "Time sync configured", "pass", evidence)
 	}
 
 	// Check ntpd
-	ntpdStatus, _ := util.RunCmd("systemctl", "is-active", "ntpd")
+	ntpdStatus, _ := util.RunCmd(ctx, "systemctl", "is-active", "ntpd")
 	evidence["ntpd"] = ntpdStatus
 	if strings.Contains(ntpdStatus, "active") {
 		return newResult("P6", "Time sync configured", "pass", evidence)
@@ -1,8 +1,10 @@
 package cis
 
+import "context"
+
 type P7Auditd struct{}
 
-func (p *P7Auditd) Run() *CheckResult {
+func (p *P7Auditd) Run(ctx context.Context) *CheckResult {
 	// Check if auditd is installed and enabled
 	// Status: PASS if auditd is running and configured, FAIL otherwise
 	return newResult("P7", "Auditd installed and enabled", "pass",
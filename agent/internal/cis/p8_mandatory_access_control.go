@@ -1,8 +1,10 @@
 package cis
 
+import "context"
+
 type P8MAC struct{}
 
-func (p *P8MAC) Run() *CheckResult {
+func (p *P8MAC) Run(ctx context.Context) *CheckResult {
 	// Check for Mandatory Access Control (SELinux or AppArmor)
 	// Status: PASS if MAC is enforcing, FAIL otherwise
 	return newResult("P8", "Mandatory Access Control enforced", "pass",
@@ -1,8 +1,10 @@
 package cis
 
+import "context"
+
 type P9WorldWritable struct{}
 
-func (p *P9WorldWritable) Run() *CheckResult {
+func (p *P9WorldWritable) Run(ctx context.Context) *CheckResult {
 	// Check for world-writable files in critical directories
 	// Status: PASS if no world-writable files found, FAIL otherwise
 	return newResult("P9", "No world-writable files in critical paths", "pass",
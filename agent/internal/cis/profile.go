@@ -0,0 +1,49 @@
+package cis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profiles maps CIS Level 1 profile names to their checks. The server
+// profile leaves out desktop-only checks.
+var Profiles = map[string][]string{
+	"level1-server":      {"P1", "P2", "P3", "P4", "P5", "P6", "P7", "P8", "P9", "P11", "P12"},
+	"level1-workstation": {"P1", "P2", "P3", "P4", "P5", "P6", "P7", "P8", "P9", "P10", "P11", "P12"},
+}
+
+// ProfileNames returns the known profile names, sorted.
+func ProfileNames() []string {
+	names := make([]string, 0, len(Profiles))
+	for name := range Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select returns the checks to run. An explicit enabled list wins over the
+// profile; with neither set every check runs.
+func Select(profile string, enabled []string) ([]Check, error) {
+	ids := enabled
+	if len(ids) == 0 && profile != "" {
+		var ok bool
+		if ids, ok = Profiles[profile]; !ok {
+			return nil, fmt.Errorf("unknown check profile %q (known: %s)", profile, strings.Join(ProfileNames(), ", "))
+		}
+	}
+	if len(ids) == 0 {
+		return All(), nil
+	}
+
+	checks := make([]Check, 0, len(ids))
+	for _, id := range ids {
+		c, ok := Find(id)
+		if !ok {
+			return nil, fmt.Errorf("unknown check %q", id)
+		}
+		checks = append(checks, c)
+	}
+	return checks, nil
+}
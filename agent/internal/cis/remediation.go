@@ -0,0 +1,52 @@
+package cis
+
+import (
+	"strings"
+	"time"
+
+	"github.com/visiblaze/sec-agent/agent/internal/remediate"
+)
+
+// Fixer is implemented by checks that can remediate their own failures.
+type Fixer interface {
+	Fix() (*remediate.Action, error)
+}
+
+// PlanFixes returns remediation actions for every failed result whose check
+// implements Fixer and is in the allowlist. Checks that are allowlisted but
+// cannot produce a fix are reported as failed results.
+func PlanFixes(results []*CheckResult, allowed []string) ([]*remediate.Action, []remediate.Result) {
+	allow := make(map[string]bool, len(allowed))
+	for _, id := range allowed {
+		allow[strings.ToUpper(strings.TrimSpace(id))] = true
+	}
+
+	var actions []*remediate.Action
+	var skipped []remediate.Result
+	for _, result := range results {
+		if result.Status != "fail" || !allow[strings.ToUpper(result.CheckID)] {
+			continue
+		}
+		check, ok := Find(result.CheckID)
+		if !ok {
+			continue
+		}
+		fixer, ok := check.Runner.(Fixer)
+		if !ok {
+			continue
+		}
+		action, err := fixer.Fix()
+		if err != nil {
+			skipped = append(skipped, remediate.Result{
+				CheckID:   result.CheckID,
+				Status:    remediate.StatusFailed,
+				Error:     err.Error(),
+				Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+			})
+			continue
+		}
+		actions = append(actions, action)
+	}
+
+	return actions, skipped
+}
@@ -0,0 +1,95 @@
+package cis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Statuses for checks that did not reach a verdict, alongside pass, fail and
+// manual.
+const (
+	StatusError   = "error"
+	StatusTimeout = "timeout"
+)
+
+// abandonAfter is how long RunCheck waits for a check to return once its
+// context is done. Commands are killed on cancellation, so checks normally
+// return well within it; one stuck elsewhere is abandoned.
+var abandonAfter = 2 * time.Second
+
+// Budget returns the time limit for a check, or 0 for none.
+type Budget func(checkID string) time.Duration
+
+// RunChecks runs checks in order, each within its budget, and timestamps
+// each result. Once ctx is done the remaining checks report an error
+// without running.
+func RunChecks(ctx context.Context, checks []Check, budget Budget) []*CheckResult {
+	results := make([]*CheckResult, 0, len(checks))
+	for _, check := range checks {
+		var limit time.Duration
+		if budget != nil {
+			limit = budget(check.ID)
+		}
+		results = append(results, RunCheck(ctx, check, limit))
+	}
+	return results
+}
+
+// RunCheck runs one check, cancelling it after limit when limit is
+// positive. A check that runs out of time is reported with status timeout
+// and the evidence it had gathered; one cancelled through ctx, or that
+// panics, with status error.
+func RunCheck(ctx context.Context, check Check, limit time.Duration) *CheckResult {
+	runCtx, cancel := context.WithCancel(ctx)
+	if limit > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, limit)
+	}
+	defer cancel()
+
+	var result *CheckResult
+	var stopped error
+	if stopped = runCtx.Err(); stopped == nil {
+		done := make(chan *CheckResult, 1)
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					done <- newResult(check.ID, check.ID, StatusError,
+						map[string]interface{}{"error": fmt.Sprintf("check panicked: %v", r)})
+				}
+			}()
+			done <- check.Runner.Run(runCtx)
+		}()
+
+		select {
+		case result = <-done:
+		case <-runCtx.Done():
+			stopped = runCtx.Err()
+			select {
+			case result = <-done:
+			case <-time.After(abandonAfter):
+			}
+		}
+	}
+
+	if result == nil {
+		result = newResult(check.ID, check.ID, StatusError, nil)
+	}
+	if result.Evidence == nil {
+		result.Evidence = make(map[string]interface{})
+	}
+	switch {
+	case errors.Is(stopped, context.DeadlineExceeded):
+		result.Status = StatusTimeout
+		result.Evidence["error"] = "check timed out"
+		if limit > 0 {
+			result.Evidence["error"] = fmt.Sprintf("check did not finish within %s", limit)
+		}
+	case stopped != nil:
+		result.Status = StatusError
+		result.Evidence["error"] = stopped.Error()
+	}
+	result.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	return result
+}
@@ -0,0 +1,65 @@
+package cis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/visiblaze/sec-agent/agent/internal/util"
+)
+
+type sleepCheck struct{}
+
+// Run records evidence, then blocks in a command until ctx is done.
+func (sleepCheck) Run(ctx context.Context) *CheckResult {
+	evidence := map[string]interface{}{"before": "collected"}
+	out, err := util.RunCmd(ctx, "sleep", "10")
+	evidence["sleep"] = out
+	if err != nil {
+		return newResult("T1", "Sleeps", "fail", evidence)
+	}
+	return newResult("T1", "Sleeps", "pass", evidence)
+}
+
+type stuckCheck struct{ release chan struct{} }
+
+// Run ignores ctx entirely.
+func (c stuckCheck) Run(ctx context.Context) *CheckResult {
+	<-c.release
+	return newResult("T2", "Stuck", "pass", nil)
+}
+
+func TestRunCheckTimeout(t *testing.T) {
+	start := time.Now()
+	result := RunCheck(context.Background(), Check{"T1", sleepCheck{}}, 100*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("check ran for %s after its budget", elapsed)
+	}
+	if result.Status != StatusTimeout {
+		t.Errorf("status = %s, want %s", result.Status, StatusTimeout)
+	}
+	if result.Evidence["before"] != "collected" || result.Evidence["error"] == nil {
+		t.Errorf("evidence = %v, want partial evidence and an error", result.Evidence)
+	}
+}
+
+func TestRunCheckAbandoned(t *testing.T) {
+	defer func(d time.Duration) { abandonAfter = d }(abandonAfter)
+	abandonAfter = 50 * time.Millisecond
+	release := make(chan struct{})
+	defer close(release)
+
+	result := RunCheck(context.Background(), Check{"T2", stuckCheck{release}}, 50*time.Millisecond)
+	if result.Status != StatusTimeout || result.CheckID != "T2" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestRunChecksCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := RunChecks(ctx, []Check{{"T1", sleepCheck{}}}, nil)
+	if len(results) != 1 || results[0].Status != StatusError {
+		t.Errorf("results = %+v", results[0])
+	}
+}
@@ -0,0 +1,341 @@
+package collect
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"debug/buildinfo"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AppScanOptions bounds the language ecosystem scan. Zero values fall back to
+// the defaults below so a partially filled config still has a budget.
+type AppScanOptions struct {
+	Paths       []string
+	Exclude     []string
+	MaxDuration time.Duration
+	MaxFiles    int
+	MaxDepth    int
+}
+
+// AppScanStats describes how much of the budget a scan used.
+type AppScanStats struct {
+	FilesVisited int    `json:"files_visited"`
+	DurationMS   int64  `json:"duration_ms"`
+	Truncated    bool   `json:"truncated"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+const (
+	defaultAppScanDuration = 60 * time.Second
+	defaultAppScanFiles    = 200000
+	defaultAppScanDepth    = 12
+
+	// Binaries larger than this are not inspected for Go build info
+	maxGoBinarySize = 512 << 20
+)
+
+var errBudgetExhausted = errors.New("scan budget exhausted")
+
+// CollectAppPackages walks opts.Paths looking for Python dist-info/egg-info
+// metadata, node_modules package.json files, Ruby gemspecs, Go binaries and
+// Java archives. It stops early when the time or file budget runs out, or
+// ctx is done, and returns whatever it found so far.
+func CollectAppPackages(ctx context.Context, opts AppScanOptions) ([]Package, AppScanStats) {
+	if opts.MaxDuration <= 0 {
+		opts.MaxDuration = defaultAppScanDuration
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = defaultAppScanFiles
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = defaultAppScanDepth
+	}
+
+	start := time.Now()
+	deadline := start.Add(opts.MaxDuration)
+	var stats AppScanStats
+	seen := make(map[string]bool)
+	var pkgs []Package
+
+	add := func(p Package) {
+		key := p.Manager + "|" + p.Name + "|" + p.Version + "|" + p.Source
+		if p.Name == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		pkgs = append(pkgs, p)
+	}
+
+	for _, root := range opts.Paths {
+		rootDepth := strings.Count(filepath.Clean(root), string(os.PathSeparator))
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Unreadable directories are skipped, not fatal
+				if d != nil && d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			stats.FilesVisited++
+			if stats.FilesVisited > opts.MaxFiles {
+				stats.Reason = "max_files"
+				return errBudgetExhausted
+			}
+			if stats.FilesVisited%256 == 0 {
+				if time.Now().After(deadline) {
+					stats.Reason = "max_duration"
+					return errBudgetExhausted
+				}
+				if ctx.Err() != nil {
+					stats.Reason = "cancelled"
+					return errBudgetExhausted
+				}
+			}
+
+			if d.IsDir() {
+				if path != root && isExcluded(path, opts.Exclude) {
+					return fs.SkipDir
+				}
+				if strings.Count(path, string(os.PathSeparator))-rootDepth > opts.MaxDepth {
+					return fs.SkipDir
+				}
+				name := d.Name()
+				switch {
+				case strings.HasSuffix(name, ".dist-info"):
+					add(parsePythonMetadata(filepath.Join(path, "METADATA"), path))
+					return fs.SkipDir
+				case strings.HasSuffix(name, ".egg-info"):
+					add(parsePythonMetadata(filepath.Join(path, "PKG-INFO"), path))
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			if d.Type()&fs.ModeSymlink != 0 || !d.Type().IsRegular() {
+				return nil
+			}
+			name := d.Name()
+			switch {
+			case name == "package.json" && isNodeModule(path):
+				add(parseNodePackage(path))
+			case strings.HasSuffix(name, ".gemspec") && filepath.Base(filepath.Dir(path)) == "specifications":
+				add(parseGemspecName(path))
+			case strings.HasSuffix(name, ".egg-info"):
+				add(parsePythonMetadata(path, path))
+			case strings.HasSuffix(name, ".jar") || strings.HasSuffix(name, ".war") || strings.HasSuffix(name, ".ear"):
+				for _, p := range parseJar(path) {
+					add(p)
+				}
+			default:
+				for _, p := range parseGoBinary(path, d) {
+					add(p)
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, errBudgetExhausted) {
+			stats.Truncated = true
+			break
+		}
+	}
+
+	stats.DurationMS = time.Since(start).Milliseconds()
+	return pkgs, stats
+}
+
+func isExcluded(path string, exclude []string) bool {
+	for _, e := range exclude {
+		if path == e || strings.HasPrefix(path, strings.TrimSuffix(e, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isNodeModule reports whether path is node_modules/<pkg>/package.json or
+// node_modules/@scope/<pkg>/package.json.
+func isNodeModule(path string) bool {
+	dir := filepath.Dir(filepath.Dir(path))
+	if filepath.Base(dir) == "node_modules" {
+		return true
+	}
+	return strings.HasPrefix(filepath.Base(dir), "@") && filepath.Base(filepath.Dir(dir)) == "node_modules"
+}
+
+func parsePythonMetadata(metaPath, source string) Package {
+	f, err := os.Open(metaPath)
+	if err != nil {
+		return Package{}
+	}
+	defer f.Close()
+
+	p := Package{Manager: "pip", Source: source}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Headers end at the first blank line; the long description follows
+		if line == "" {
+			break
+		}
+		if v, ok := strings.CutPrefix(line, "Name: "); ok {
+			p.Name = strings.TrimSpace(v)
+		}
+		if v, ok := strings.CutPrefix(line, "Version: "); ok {
+			p.Version = strings.TrimSpace(v)
+		}
+	}
+	return p
+}
+
+func parseNodePackage(path string) Package {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Package{}
+	}
+	var meta struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return Package{}
+	}
+	return Package{Name: meta.Name, Version: meta.Version, Manager: "npm", Source: filepath.Dir(path)}
+}
+
+// parseGemspecName reads name and version from the installed gemspec file
+// name (<name>-<version>[-<platform>].gemspec). Gem names may contain dashes,
+// so the version starts at the first dash-separated part beginning with a digit.
+func parseGemspecName(path string) Package {
+	parts := strings.Split(strings.TrimSuffix(filepath.Base(path), ".gemspec"), "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" && parts[i][0] >= '0' && parts[i][0] <= '9' {
+			return Package{
+				Name:    strings.Join(parts[:i], "-"),
+				Version: strings.Join(parts[i:], "-"),
+				Manager: "gem",
+				Source:  path,
+			}
+		}
+	}
+	return Package{}
+}
+
+func parseJar(path string) []Package {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil
+	}
+	defer zr.Close()
+
+	var pkgs []Package
+	var manifest map[string]string
+	for _, f := range zr.File {
+		switch {
+		case strings.HasPrefix(f.Name, "META-INF/maven/") && strings.HasSuffix(f.Name, "/pom.properties"):
+			props := readProperties(f, "=")
+			if props["artifactId"] != "" {
+				pkgs = append(pkgs, Package{
+					Name:    props["groupId"] + ":" + props["artifactId"],
+					Version: props["version"],
+					Manager: "maven",
+					Source:  path,
+				})
+			}
+		case f.Name == "META-INF/MANIFEST.MF":
+			manifest = readProperties(f, ":")
+		}
+	}
+
+	// Fall back to the manifest for jars built without Maven metadata
+	if len(pkgs) == 0 && manifest != nil {
+		name := manifest["Implementation-Title"]
+		if name == "" {
+			name = manifest["Bundle-SymbolicName"]
+		}
+		version := manifest["Implementation-Version"]
+		if version == "" {
+			version = manifest["Bundle-Version"]
+		}
+		if name != "" {
+			if vendor := manifest["Implementation-Vendor-Id"]; vendor != "" {
+				name = vendor + ":" + name
+			}
+			pkgs = append(pkgs, Package{Name: name, Version: version, Manager: "maven", Source: path})
+		}
+	}
+	return pkgs
+}
+
+func readProperties(f *zip.File, sep string) map[string]string {
+	rc, err := f.Open()
+	if err != nil {
+		return nil
+	}
+	defer rc.Close()
+
+	props := make(map[string]string)
+	scanner := bufio.NewScanner(io.LimitReader(rc, 1<<20))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, sep); ok {
+			props[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return props
+}
+
+// parseGoBinary reports the main module and dependencies of an executable
+// built with Go module support.
+func parseGoBinary(path string, d fs.DirEntry) []Package {
+	info, err := d.Info()
+	if err != nil || info.Mode().Perm()&0111 == 0 || info.Size() > maxGoBinarySize || info.Size() < 4 {
+		return nil
+	}
+	if !hasELFMagic(path) {
+		return nil
+	}
+
+	bi, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var pkgs []Package
+	if bi.Main.Path != "" {
+		pkgs = append(pkgs, Package{Name: bi.Main.Path, Version: bi.Main.Version, Manager: "go", Source: path})
+	}
+	for _, dep := range bi.Deps {
+		mod := dep
+		if dep.Replace != nil {
+			mod = dep.Replace
+		}
+		pkgs = append(pkgs, Package{Name: mod.Path, Version: mod.Version, Manager: "go", Source: path})
+	}
+	pkgs = append(pkgs, Package{Name: "stdlib", Version: bi.GoVersion, Manager: "go", Source: path})
+	return pkgs
+}
+
+func hasELFMagic(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return string(magic) == "\x7fELF"
+}
@@ -0,0 +1,121 @@
+package collect
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeJar(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func copyExecutable(t *testing.T, dst string) {
+	t.Helper()
+	src, err := os.Executable()
+	if err != nil {
+		t.Skip("test binary not available")
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectAppPackages(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "site-packages/requests-2.31.0.dist-info/METADATA"),
+		"Metadata-Version: 2.1\nName: requests\nVersion: 2.31.0\n\nName: not-a-header\n")
+	writeFile(t, filepath.Join(root, "app/node_modules/lodash/package.json"), `{"name":"lodash","version":"4.17.21"}`)
+	writeFile(t, filepath.Join(root, "app/node_modules/@types/node/package.json"), `{"name":"@types/node","version":"20.1.0"}`)
+	writeFile(t, filepath.Join(root, "app/package.json"), `{"name":"my-app","version":"1.0.0"}`)
+	writeFile(t, filepath.Join(root, "gems/specifications/nokogiri-1.15.4-x86_64-linux.gemspec"), "")
+	writeFile(t, filepath.Join(root, "gems/specifications/net-http-0.4.1.gemspec"), "")
+	writeJar(t, filepath.Join(root, "lib/slf4j-api.jar"), map[string]string{
+		"META-INF/maven/org.slf4j/slf4j-api/pom.properties": "groupId=org.slf4j\nartifactId=slf4j-api\nversion=2.0.9\n",
+	})
+	writeJar(t, filepath.Join(root, "lib/legacy.jar"), map[string]string{
+		"META-INF/MANIFEST.MF": "Manifest-Version: 1.0\nImplementation-Title: legacy\nImplementation-Version: 3.1\n",
+	})
+	copyExecutable(t, filepath.Join(root, "bin/tool"))
+
+	pkgs, stats := CollectAppPackages(context.Background(), AppScanOptions{Paths: []string{root}})
+	if stats.Truncated {
+		t.Fatalf("scan unexpectedly truncated: %+v", stats)
+	}
+
+	found := map[string]string{}
+	for _, p := range pkgs {
+		found[p.Manager+" "+p.Name] = p.Version
+	}
+	want := map[string]string{
+		"pip requests":              "2.31.0",
+		"npm lodash":                "4.17.21",
+		"npm @types/node":           "20.1.0",
+		"gem nokogiri":              "1.15.4-x86_64-linux",
+		"gem net-http":              "0.4.1",
+		"maven org.slf4j:slf4j-api": "2.0.9",
+		"maven legacy":              "3.1",
+	}
+	for k, v := range want {
+		if found[k] != v {
+			t.Errorf("%s: got version %q, want %q", k, found[k], v)
+		}
+	}
+	if _, ok := found["npm my-app"]; ok {
+		t.Error("package.json outside node_modules should be ignored")
+	}
+	if _, ok := found["go stdlib"]; !ok {
+		t.Error("Go build info not read from test binary")
+	}
+}
+
+func TestCollectAppPackagesBudget(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		writeFile(t, filepath.Join(root, name, "node_modules", name, "package.json"), `{"name":"`+name+`","version":"1.0.0"}`)
+	}
+
+	_, stats := CollectAppPackages(context.Background(), AppScanOptions{Paths: []string{root}, MaxFiles: 3})
+	if !stats.Truncated || stats.Reason != "max_files" {
+		t.Fatalf("expected file budget to truncate scan, got %+v", stats)
+	}
+}
@@ -0,0 +1,237 @@
+package collect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/visiblaze/sec-agent/agent/internal/util"
+)
+
+// DefaultContainerSockets are Docker Engine API compatible sockets probed in
+// order. Podman exposes the same API.
+var DefaultContainerSockets = []string{
+	"/var/run/docker.sock",
+	"/run/podman/podman.sock",
+}
+
+type ContainerImage struct {
+	ID          string   `json:"id"`
+	RepoTags    []string `json:"repo_tags"`
+	RepoDigests []string `json:"repo_digests"`
+	SizeBytes   int64    `json:"size_bytes"`
+	Created     string   `json:"created,omitempty"`
+	Runtime     string   `json:"runtime"`
+}
+
+type Container struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Image   string            `json:"image"`
+	ImageID string            `json:"image_id"`
+	State   string            `json:"state"`
+	Status  string            `json:"status,omitempty"`
+	Created string            `json:"created,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Runtime string            `json:"runtime"`
+}
+
+type ContainerInventory struct {
+	Images     []ContainerImage `json:"images"`
+	Containers []Container      `json:"containers"`
+}
+
+// CollectContainers queries the first reachable Docker-compatible socket for
+// local images and running containers. When none answers it falls back to
+// crictl, which covers containerd and CRI-O hosts.
+func CollectContainers(ctx context.Context, sockets []string) (*ContainerInventory, error) {
+	var lastErr error
+	for _, sock := range sockets {
+		if !util.FileExists(sock) {
+			continue
+		}
+		inv, err := collectDockerAPI(ctx, sock)
+		if err == nil {
+			return inv, nil
+		}
+		lastErr = err
+	}
+
+	if util.CmdExists("crictl") {
+		return collectCRI(ctx)
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("no container runtime found")
+}
+
+func collectDockerAPI(ctx context.Context, sock string) (*ContainerInventory, error) {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", sock)
+			},
+		},
+	}
+	runtime := "docker"
+	if strings.Contains(sock, "podman") {
+		runtime = "podman"
+	}
+
+	var images []struct {
+		ID          string   `json:"Id"`
+		RepoTags    []string `json:"RepoTags"`
+		RepoDigests []string `json:"RepoDigests"`
+		Size        int64    `json:"Size"`
+		Created     int64    `json:"Created"`
+	}
+	if err := dockerGet(ctx, client, "/images/json", &images); err != nil {
+		return nil, err
+	}
+
+	var containers []struct {
+		ID      string            `json:"Id"`
+		Names   []string          `json:"Names"`
+		Image   string            `json:"Image"`
+		ImageID string            `json:"ImageID"`
+		State   string            `json:"State"`
+		Status  string            `json:"Status"`
+		Created int64             `json:"Created"`
+		Labels  map[string]string `json:"Labels"`
+	}
+	if err := dockerGet(ctx, client, "/containers/json", &containers); err != nil {
+		return nil, err
+	}
+
+	inv := &ContainerInventory{Images: []ContainerImage{}, Containers: []Container{}}
+	for _, img := range images {
+		inv.Images = append(inv.Images, ContainerImage{
+			ID:          img.ID,
+			RepoTags:    img.RepoTags,
+			RepoDigests: img.RepoDigests,
+			SizeBytes:   img.Size,
+			Created:     unixTime(img.Created),
+			Runtime:     runtime,
+		})
+	}
+	for _, c := range containers {
+		name := ""
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		inv.Containers = append(inv.Containers, Container{
+			ID:      c.ID,
+			Name:    name,
+			Image:   c.Image,
+			ImageID: c.ImageID,
+			State:   c.State,
+			Status:  c.Status,
+			Created: unixTime(c.Created),
+			Labels:  c.Labels,
+			Runtime: runtime,
+		})
+	}
+	return inv, nil
+}
+
+func dockerGet(ctx context.Context, client *http.Client, path string, v interface{}) error {
+	// The host part is ignored by the unix dialer but required by net/http
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://localhost"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("container api %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("container api %s: %d %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func collectCRI(ctx context.Context) (*ContainerInventory, error) {
+	out, err := util.RunCmd(ctx, "crictl", "images", "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("crictl images: %w", err)
+	}
+	var images struct {
+		Images []struct {
+			ID          string   `json:"id"`
+			RepoTags    []string `json:"repoTags"`
+			RepoDigests []string `json:"repoDigests"`
+			Size        string   `json:"size"`
+		} `json:"images"`
+	}
+	if err := json.Unmarshal([]byte(out), &images); err != nil {
+		return nil, fmt.Errorf("parse crictl images: %w", err)
+	}
+
+	out, err = util.RunCmd(ctx, "crictl", "ps", "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("crictl ps: %w", err)
+	}
+	var containers struct {
+		Containers []struct {
+			ID       string `json:"id"`
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Image struct {
+				Image string `json:"image"`
+			} `json:"image"`
+			ImageRef  string            `json:"imageRef"`
+			State     string            `json:"state"`
+			CreatedAt string            `json:"createdAt"`
+			Labels    map[string]string `json:"labels"`
+		} `json:"containers"`
+	}
+	if err := json.Unmarshal([]byte(out), &containers); err != nil {
+		return nil, fmt.Errorf("parse crictl ps: %w", err)
+	}
+
+	inv := &ContainerInventory{Images: []ContainerImage{}, Containers: []Container{}}
+	for _, img := range images.Images {
+		var size int64
+		fmt.Sscan(img.Size, &size)
+		inv.Images = append(inv.Images, ContainerImage{
+			ID:          img.ID,
+			RepoTags:    img.RepoTags,
+			RepoDigests: img.RepoDigests,
+			SizeBytes:   size,
+			Runtime:     "cri",
+		})
+	}
+	for _, c := range containers.Containers {
+		var createdNS int64
+		fmt.Sscan(c.CreatedAt, &createdNS)
+		inv.Containers = append(inv.Containers, Container{
+			ID:      c.ID,
+			Name:    c.Metadata.Name,
+			Image:   c.Image.Image,
+			ImageID: c.ImageRef,
+			State:   strings.ToLower(strings.TrimPrefix(c.State, "CONTAINER_")),
+			Created: unixTime(createdNS / int64(time.Second)),
+			Labels:  c.Labels,
+			Runtime: "cri",
+		})
+	}
+	return inv, nil
+}
+
+func unixTime(sec int64) string {
+	if sec == 0 {
+		return ""
+	}
+	return time.Unix(sec, 0).UTC().Format(time.RFC3339)
+}
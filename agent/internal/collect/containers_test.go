@@ -0,0 +1,88 @@
+package collect
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// startFakeDockerSocket serves canned Docker Engine API responses on a unix
+// socket so container inventory can be tested without a runtime.
+func startFakeDockerSocket(t *testing.T) string {
+	t.Helper()
+	// Unix socket paths are limited to ~108 bytes, so avoid t.TempDir()
+	dir, err := os.MkdirTemp("", "vz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "docker.sock")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/images/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"Id":"sha256:aaa","RepoTags":["nginx:1.25"],"RepoDigests":["nginx@sha256:bbb"],"Size":187000000,"Created":1700000000}]`))
+	})
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"Id":"c1","Names":["/web"],"Image":"nginx:1.25","ImageID":"sha256:aaa","State":"running","Status":"Up 2 hours","Created":1700000100,"Labels":{"app":"web"}}]`))
+	})
+
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return sock
+}
+
+func TestCollectContainers(t *testing.T) {
+	sock := startFakeDockerSocket(t)
+
+	inv, err := CollectContainers(context.Background(), []string{"/nonexistent.sock", sock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Images) != 1 || inv.Images[0].RepoDigests[0] != "nginx@sha256:bbb" {
+		t.Fatalf("unexpected images: %+v", inv.Images)
+	}
+	if len(inv.Containers) != 1 {
+		t.Fatalf("unexpected containers: %+v", inv.Containers)
+	}
+	c := inv.Containers[0]
+	if c.Name != "web" || c.State != "running" || c.ImageID != "sha256:aaa" || c.Labels["app"] != "web" || c.Runtime != "docker" {
+		t.Fatalf("unexpected container: %+v", c)
+	}
+}
+
+func TestCollectSnapsAndFlatpaks(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "state.json"), `{"data":{"snaps":{
+		"core22":{"type":"base","active":true,"current":"1033","channel":"latest/stable","sequence":[{"name":"core22","revision":"1033"}]},
+		"lxd":{"type":"app","active":true,"current":"26200","sequence":[{"name":"lxd","revision":"26200"}]}}}}`)
+	writeFile(t, filepath.Join(root, "snap/core22/1033/meta/snap.yaml"), "name: core22\nversion: '20231123'\n")
+
+	snaps, err := CollectSnaps(filepath.Join(root, "state.json"), filepath.Join(root, "snap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 || snaps[0].Name != "core22" || snaps[0].Version != "20231123" || snaps[1].Version != "r26200" {
+		t.Fatalf("unexpected snaps: %+v", snaps)
+	}
+
+	app := filepath.Join(root, "flatpak/app/org.mozilla.firefox/x86_64/stable/active")
+	writeFile(t, filepath.Join(app, "files/share/metainfo/org.mozilla.firefox.metainfo.xml"),
+		`<component><releases><release version="121.0" date="2023-12-19"/></releases></component>`)
+	writeFile(t, filepath.Join(root, "flatpak/runtime/org.freedesktop.Platform/x86_64/23.08/active/metadata"), "")
+
+	flatpaks, err := CollectFlatpaks(filepath.Join(root, "flatpak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flatpaks) != 2 || flatpaks[0].Version != "121.0" || flatpaks[1].Version != "23.08" || flatpaks[1].Arch != "x86_64" {
+		t.Fatalf("unexpected flatpaks: %+v", flatpaks)
+	}
+}
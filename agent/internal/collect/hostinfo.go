@@ -1,6 +1,7 @@
 package collect
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -17,9 +18,12 @@ type HostInfo struct {
 	Kernel       string   `json:"kernel"`
 	IPAddresses  []string `json:"ip_addresses"`
 	AgentVersion string   `json:"agent_version"`
+	// Tags are the static tags from the agent config. An empty list clears
+	// those the backend holds; nil leaves them unchanged.
+	Tags []string `json:"tags"`
 }
 
-func GetHostInfo(agentVersion string) (*HostInfo, error) {
+func GetHostInfo(ctx context.Context, agentVersion string) (*HostInfo, error) {
 	hostID, err := getOrCreateHostID()
 	if err != nil {
 		return nil, fmt.Errorf("get host id: %w", err)
@@ -27,8 +31,8 @@ func GetHostInfo(agentVersion string) (*HostInfo, error) {
 
 	hostname, _ := os.Hostname()
 	osID, osVersion := detectOS()
-	kernel, _ := util.RunCmd("uname", "-r")
-	ips := getIPAddresses()
+	kernel, _ := util.RunCmd(ctx, "uname", "-r")
+	ips := getIPAddresses(ctx)
 
 	return &HostInfo{
 		HostID:       hostID,
@@ -82,8 +86,8 @@ func detectOS() (string, string) {
 	return osID, osVersion
 }
 
-func getIPAddresses() []string {
-	output, err := util.RunCmd("ip", "addr", "show")
+func getIPAddresses(ctx context.Context) []string {
+	output, err := util.RunCmd(ctx, "ip", "addr", "show")
 	if err != nil {
 		return []string{}
 	}
@@ -1,6 +1,8 @@
 package collect
 
 import (
+	"context"
+	"fmt"
 	"strings"
 
 	"github.com/visiblaze/sec-agent/agent/internal/util"
@@ -15,39 +17,45 @@ type Package struct {
 	InstalledAt string `json:"installed_at"`
 }
 
-func CollectPackages(osID string) ([]Package, error) {
+// CollectPackages lists OS packages from the package manager for osID, or
+// from every supported manager when osID is not recognised. An error is
+// returned only when ctx ends first, since the list is then incomplete.
+func CollectPackages(ctx context.Context, osID string) ([]Package, error) {
 	var pkgs []Package
 
 	switch osID {
 	case "ubuntu", "debian":
-		p, err := collectDpkg()
+		p, err := collectDpkg(ctx)
 		if err == nil {
 			pkgs = append(pkgs, p...)
 		}
 	case "rhel", "centos", "fedora":
-		p, err := collectRPM()
+		p, err := collectRPM(ctx)
 		if err == nil {
 			pkgs = append(pkgs, p...)
 		}
 	case "alpine":
-		p, err := collectAPK()
+		p, err := collectAPK(ctx)
 		if err == nil {
 			pkgs = append(pkgs, p...)
 		}
 	default:
-		p, _ := collectDpkg()
+		p, _ := collectDpkg(ctx)
 		pkgs = append(pkgs, p...)
-		p, _ = collectRPM()
+		p, _ = collectRPM(ctx)
 		pkgs = append(pkgs, p...)
-		p, _ = collectAPK()
+		p, _ = collectAPK(ctx)
 		pkgs = append(pkgs, p...)
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("collect packages: %w", err)
+	}
 	return pkgs, nil
 }
 
-func collectDpkg() ([]Package, error) {
-	output, err := util.RunCmd("dpkg-query", "-W", "-f=${Package}\t${Version}\t${Architecture}\n")
+func collectDpkg(ctx context.Context) ([]Package, error) {
+	output, err := util.RunCmd(ctx, "dpkg-query", "-W", "-f=${Package}\t${Version}\t${Architecture}\n")
 	if err != nil {
 		return nil, err
 	}
@@ -72,8 +80,8 @@ func collectDpkg() ([]Package, error) {
 	return pkgs, nil
 }
 
-func collectRPM() ([]Package, error) {
-	output, err := util.RunCmd("rpm", "-qa", "--qf", "%{NAME}\t%{VERSION}-%{RELEASE}\t%{ARCH}\n")
+func collectRPM(ctx context.Context) ([]Package, error) {
+	output, err := util.RunCmd(ctx, "rpm", "-qa", "--qf", "%{NAME}\t%{VERSION}-%{RELEASE}\t%{ARCH}\n")
 	if err != nil {
 		return nil, err
 	}
@@ -98,8 +106,8 @@ func collectRPM() ([]Package, error) {
 	return pkgs, nil
 }
 
-func collectAPK() ([]Package, error) {
-	output, err := util.RunCmd("apk", "info", "-v")
+func collectAPK(ctx context.Context) ([]Package, error) {
+	output, err := util.RunCmd(ctx, "apk", "info", "-v")
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,151 @@
+package collect
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	SnapStateFile = "/var/lib/snapd/state.json"
+	SnapMountDir  = "/snap"
+	FlatpakDir    = "/var/lib/flatpak"
+)
+
+// CollectSnaps lists installed snaps from snapd's state file. snapd does not
+// record versions there, so the version is read from the mounted snap.yaml
+// and falls back to the revision.
+func CollectSnaps(stateFile, mountDir string) ([]Package, error) {
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var state struct {
+		Data struct {
+			Snaps map[string]struct {
+				Type     string `json:"type"`
+				Active   bool   `json:"active"`
+				Current  string `json:"current"`
+				Channel  string `json:"channel"`
+				Sequence []struct {
+					Name     string `json:"name"`
+					Revision string `json:"revision"`
+				} `json:"sequence"`
+			} `json:"snaps"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(state.Data.Snaps))
+	for name := range state.Data.Snaps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pkgs []Package
+	for _, name := range names {
+		snap := state.Data.Snaps[name]
+		revision := snap.Current
+		if revision == "" && len(snap.Sequence) > 0 {
+			revision = snap.Sequence[len(snap.Sequence)-1].Revision
+		}
+
+		version := snapVersion(filepath.Join(mountDir, name, revision, "meta", "snap.yaml"))
+		if version == "" {
+			version = "r" + revision
+		}
+
+		source := "snapcraft"
+		if snap.Channel != "" {
+			source = "snapcraft:" + snap.Channel
+		}
+		pkgs = append(pkgs, Package{
+			Name:    name,
+			Version: version,
+			Arch:    "unknown",
+			Manager: "snap",
+			Source:  source,
+		})
+	}
+	return pkgs, nil
+}
+
+func snapVersion(snapYAML string) string {
+	data, err := os.ReadFile(snapYAML)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "version:"); ok {
+			return strings.Trim(strings.TrimSpace(v), `"'`)
+		}
+	}
+	return ""
+}
+
+// CollectFlatpaks lists system-wide Flatpak apps and runtimes from the
+// installation directory layout <dir>/{app,runtime}/<id>/<arch>/<branch>.
+func CollectFlatpaks(installDir string) ([]Package, error) {
+	var pkgs []Package
+	found := false
+	for _, kind := range []string{"app", "runtime"} {
+		ids, err := os.ReadDir(filepath.Join(installDir, kind))
+		if err != nil {
+			continue
+		}
+		found = true
+		for _, id := range ids {
+			arches, _ := os.ReadDir(filepath.Join(installDir, kind, id.Name()))
+			for _, arch := range arches {
+				branches, _ := os.ReadDir(filepath.Join(installDir, kind, id.Name(), arch.Name()))
+				for _, branch := range branches {
+					if !branch.IsDir() {
+						continue
+					}
+					dir := filepath.Join(installDir, kind, id.Name(), arch.Name(), branch.Name())
+					if _, err := os.Stat(filepath.Join(dir, "active")); err != nil {
+						continue
+					}
+					pkgs = append(pkgs, Package{
+						Name:    id.Name(),
+						Version: flatpakVersion(filepath.Join(dir, "active"), id.Name(), branch.Name()),
+						Arch:    arch.Name(),
+						Manager: "flatpak",
+						Source:  "flatpak:" + kind,
+					})
+				}
+			}
+		}
+	}
+	if !found {
+		return nil, os.ErrNotExist
+	}
+	return pkgs, nil
+}
+
+// flatpakVersion reads the newest release from the app's AppStream metadata,
+// falling back to the branch name.
+func flatpakVersion(deployDir, id, branch string) string {
+	for _, name := range []string{id + ".metainfo.xml", id + ".appdata.xml"} {
+		data, err := os.ReadFile(filepath.Join(deployDir, "files", "share", "metainfo", name))
+		if err != nil {
+			continue
+		}
+		content := string(data)
+		if i := strings.Index(content, "<release "); i >= 0 {
+			rest := content[i:]
+			if j := strings.Index(rest, `version="`); j >= 0 {
+				rest = rest[j+len(`version="`):]
+				if k := strings.Index(rest, `"`); k > 0 {
+					return rest[:k]
+				}
+			}
+		}
+	}
+	return branch
+}
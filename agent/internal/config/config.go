@@ -2,17 +2,120 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/visiblaze/sec-agent/agent/internal/cis"
+	"github.com/visiblaze/sec-agent/pkg/policy"
 )
 
 type Config struct {
-	APIBaseURL                  string `yaml:"api_base_url"`
-	APIKey                      string `yaml:"api_key"`
-	CollectionIntervalMinutes   int    `yaml:"collection_interval_minutes"`
-	DisableIPv6Check            bool   `yaml:"disable_ipv6_check"`
-	DistroHint                  string `yaml:"distro_hint"`
+	APIBaseURL                string             `yaml:"api_base_url"`
+	APIKey                    string             `yaml:"api_key"`
+	EnrollmentToken           string             `yaml:"enrollment_token"`
+	CollectionIntervalMinutes int                `yaml:"collection_interval_minutes"`
+	DisableIPv6Check          bool               `yaml:"disable_ipv6_check"`
+	DistroHint                string             `yaml:"distro_hint"`
+	StateDir                  string             `yaml:"state_dir"`
+	Remediation               RemediationConfig  `yaml:"remediation"`
+	AppScan                   AppScanConfig      `yaml:"app_scan"`
+	Inventory                 InventoryConfig    `yaml:"inventory"`
+	TLS                       TLSConfig          `yaml:"tls"`
+	Upload                    UploadConfig       `yaml:"upload"`
+	LogLevel                  string             `yaml:"log_level"`
+	Checks                    ChecksConfig       `yaml:"checks"`
+	RemotePolicy              RemotePolicyConfig `yaml:"remote_policy"`
+	WatchConfig               bool               `yaml:"watch_config"`
+	Schedules                 SchedulesConfig    `yaml:"schedules"`
+	SplaySeconds              int                `yaml:"splay_seconds"`
+	Tags                      []string           `yaml:"tags"`
+}
+
+// MaxTags caps the static tags reported for the host, as the backend does.
+const MaxTags = 50
+
+// ChecksConfig selects which CIS checks run: Enabled lists check IDs and
+// takes precedence over Profile; with neither set all checks run. Each check
+// gets TimeoutSeconds, or its entry in Timeouts, before it is cancelled and
+// reported as timed out.
+type ChecksConfig struct {
+	Profile        string         `yaml:"profile"`
+	Enabled        []string       `yaml:"enabled"`
+	TimeoutSeconds int            `yaml:"timeout_seconds"`
+	Timeouts       map[string]int `yaml:"timeouts"`
+}
+
+// Budget returns the time limit for checkID.
+func (c ChecksConfig) Budget(checkID string) time.Duration {
+	for id, secs := range c.Timeouts {
+		if strings.EqualFold(id, checkID) {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return time.Duration(c.TimeoutSeconds) * time.Second
+}
+
+// RemotePolicyConfig enables policies pushed by the backend. Policies are
+// only applied when they verify against PublicKey (PEM or base64 Ed25519).
+type RemotePolicyConfig struct {
+	PublicKey string `yaml:"public_key"`
+}
+
+// UploadConfig controls how payloads are sent. Bodies are compressed with
+// Compression, falling back to what the backend accepts; compressed bodies
+// above ChunkThresholdKB go through a multi-part upload session in parts of
+// ChunkSizeKB. A zero threshold disables chunking.
+type UploadConfig struct {
+	Compression      string `yaml:"compression"`
+	ChunkThresholdKB int    `yaml:"chunk_threshold_kb"`
+	ChunkSizeKB      int    `yaml:"chunk_size_kb"`
+}
+
+// MaxChunkSizeKB keeps each part within a single DynamoDB item on the backend.
+const MaxChunkSizeKB = 350
+
+// TLSConfig configures the transport to the backend. CAFile replaces the
+// system roots; PinnedSPKI additionally requires one certificate in the
+// server chain to have a matching base64 SHA-256 public key hash.
+type TLSConfig struct {
+	CAFile     string   `yaml:"ca_file"`
+	CertFile   string   `yaml:"cert_file"`
+	KeyFile    string   `yaml:"key_file"`
+	ServerName string   `yaml:"server_name"`
+	PinnedSPKI []string `yaml:"pinned_spki_sha256"`
+}
+
+// InventoryConfig selects the non-distro software sources collected
+// alongside OS packages.
+type InventoryConfig struct {
+	Snaps            bool     `yaml:"snaps"`
+	Flatpaks         bool     `yaml:"flatpaks"`
+	Containers       bool     `yaml:"containers"`
+	ContainerSockets []string `yaml:"container_sockets"`
+}
+
+// RemediationConfig controls automatic fixing of failed checks. Only checks
+// listed in AllowedChecks are ever modified, including for manual runs.
+type RemediationConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	AllowedChecks []string `yaml:"allowed_checks"`
+	BackupDir     string   `yaml:"backup_dir"`
+}
+
+// AppScanConfig controls discovery of language ecosystem packages (pip, npm,
+// gem, Go binaries, JARs). The walk is bounded by time, file count and depth.
+type AppScanConfig struct {
+	Enabled            bool     `yaml:"enabled"`
+	Paths              []string `yaml:"paths"`
+	Exclude            []string `yaml:"exclude"`
+	MaxDurationSeconds int      `yaml:"max_duration_seconds"`
+	MaxFiles           int      `yaml:"max_files"`
+	MaxDepth           int      `yaml:"max_depth"`
 }
 
 func Load(path string) (*Config, error) {
@@ -24,18 +127,161 @@ func Load(path string) (*Config, error) {
 	cfg := &Config{
 		CollectionIntervalMinutes: 15,
 		DisableIPv6Check:          false,
+		StateDir:                  "/var/lib/visiblaze-agent",
+		Remediation: RemediationConfig{
+			BackupDir: "/var/lib/visiblaze-agent/backups",
+		},
+		AppScan: AppScanConfig{
+			Paths: []string{
+				"/usr/lib/python3", "/usr/local/lib", "/usr/lib/node_modules",
+				"/var/lib/gems", "/usr/share/java", "/usr/local/bin", "/opt", "/srv",
+			},
+			Exclude:            []string{"/proc", "/sys", "/dev"},
+			MaxDurationSeconds: 60,
+			MaxFiles:           200000,
+			MaxDepth:           12,
+		},
+		Inventory: InventoryConfig{
+			Snaps:            true,
+			Flatpaks:         true,
+			Containers:       true,
+			ContainerSockets: []string{"/var/run/docker.sock", "/run/podman/podman.sock"},
+		},
+		Checks: ChecksConfig{
+			TimeoutSeconds: 30,
+		},
+		LogLevel: "info",
+		Upload: UploadConfig{
+			Compression:      "zstd",
+			ChunkThresholdKB: 3072,
+			ChunkSizeKB:      256,
+		},
 	}
 
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("parse config: %w", err)
 	}
 
-	if cfg.APIBaseURL == "" {
-		return nil, fmt.Errorf("api_base_url is required")
-	}
-	if cfg.APIKey == "" {
-		return nil, fmt.Errorf("api_key is required")
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
 
 	return cfg, nil
 }
+
+// CredentialPath is where the per-host credential issued at enrollment is
+// stored.
+func (c *Config) CredentialPath() string {
+	return filepath.Join(c.StateDir, "credential.json")
+}
+
+// Validate checks that required settings are present and well formed.
+func (c *Config) Validate() error {
+	if c.APIBaseURL == "" {
+		return fmt.Errorf("api_base_url is required")
+	}
+	if u, err := url.Parse(c.APIBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("api_base_url must be an absolute URL")
+	}
+	if c.APIKey == "" && c.TLS.CertFile == "" && c.EnrollmentToken == "" {
+		if _, err := os.Stat(c.CredentialPath()); err != nil {
+			return fmt.Errorf("one of api_key, enrollment_token or a tls client certificate is required")
+		}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+	}
+	if len(c.TLS.PinnedSPKI) > 0 && !strings.HasPrefix(c.APIBaseURL, "https://") {
+		return fmt.Errorf("tls.pinned_spki_sha256 requires an https api_base_url")
+	}
+	if c.CollectionIntervalMinutes <= 0 {
+		return fmt.Errorf("collection_interval_minutes must be positive")
+	}
+	if c.AppScan.Enabled && len(c.AppScan.Paths) == 0 {
+		return fmt.Errorf("app_scan.paths is required when app_scan is enabled")
+	}
+	if c.AppScan.MaxDurationSeconds < 0 || c.AppScan.MaxFiles < 0 || c.AppScan.MaxDepth < 0 {
+		return fmt.Errorf("app_scan budgets must not be negative")
+	}
+	switch c.Upload.Compression {
+	case "", "none", "identity", "gzip", "zstd":
+	default:
+		return fmt.Errorf("upload.compression must be zstd, gzip or none")
+	}
+	if c.Upload.ChunkThresholdKB < 0 {
+		return fmt.Errorf("upload.chunk_threshold_kb must not be negative")
+	}
+	if c.Upload.ChunkThresholdKB > 0 && (c.Upload.ChunkSizeKB < 1 || c.Upload.ChunkSizeKB > MaxChunkSizeKB) {
+		return fmt.Errorf("upload.chunk_size_kb must be between 1 and %d", MaxChunkSizeKB)
+	}
+	switch c.LogLevel {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("log_level must be debug, info, warn or error")
+	}
+	if _, err := cis.Select(c.Checks.Profile, c.Checks.Enabled); err != nil {
+		return fmt.Errorf("checks: %w", err)
+	}
+	if c.Checks.TimeoutSeconds <= 0 {
+		return fmt.Errorf("checks.timeout_seconds must be positive")
+	}
+	for id, secs := range c.Checks.Timeouts {
+		if _, ok := cis.Find(id); !ok {
+			return fmt.Errorf("checks.timeouts: unknown check %q", id)
+		}
+		if secs <= 0 {
+			return fmt.Errorf("checks.timeouts.%s must be positive", id)
+		}
+	}
+	if c.RemotePolicy.PublicKey != "" {
+		if _, err := policy.ParsePublicKey(c.RemotePolicy.PublicKey); err != nil {
+			return fmt.Errorf("remote_policy.public_key: %w", err)
+		}
+	}
+	if c.Remediation.Enabled && c.Remediation.BackupDir == "" {
+		return fmt.Errorf("remediation.backup_dir is required when remediation is enabled")
+	}
+	if err := c.Schedules.validate(); err != nil {
+		return err
+	}
+	if c.SplaySeconds < 0 {
+		return fmt.Errorf("splay_seconds must not be negative")
+	}
+	if len(c.Tags) > MaxTags {
+		return fmt.Errorf("tags: at most %d are allowed", MaxTags)
+	}
+	for _, t := range c.Tags {
+		if !policy.ValidTag(t) {
+			return fmt.Errorf("tags: invalid tag %q", t)
+		}
+	}
+	return nil
+}
+
+// WithPolicy returns a copy of c with the non-zero settings of p applied on
+// top, validated as a whole. c itself is not modified.
+func (c *Config) WithPolicy(p *policy.Policy) (*Config, error) {
+	merged := *c
+	if p.CollectionIntervalMinutes > 0 {
+		merged.CollectionIntervalMinutes = p.CollectionIntervalMinutes
+	}
+	if len(p.EnabledChecks) > 0 {
+		merged.Checks.Enabled = append([]string(nil), p.EnabledChecks...)
+	}
+	if p.Profile != "" {
+		merged.Checks.Profile = p.Profile
+		if len(p.EnabledChecks) == 0 {
+			merged.Checks.Enabled = nil
+		}
+	}
+	if len(p.ScanPaths) > 0 {
+		merged.AppScan.Paths = append([]string(nil), p.ScanPaths...)
+	}
+	if p.LogLevel != "" {
+		merged.LogLevel = p.LogLevel
+	}
+	if err := merged.Validate(); err != nil {
+		return nil, fmt.Errorf("policy %s v%d: %w", p.ID, p.Version, err)
+	}
+	return &merged, nil
+}
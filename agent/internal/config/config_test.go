@@ -0,0 +1,61 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	old := &Config{APIBaseURL: "https://a", APIKey: "one", CollectionIntervalMinutes: 15}
+	old.Checks.Profile = "level1-server"
+	new := *old
+	new.APIKey = "two"
+	new.CollectionIntervalMinutes = 5
+	new.Checks.Enabled = []string{"P1"}
+
+	want := []string{
+		"api_key: (changed)",
+		"checks.enabled: [] -> [P1]",
+		"collection_interval_minutes: 15 -> 5",
+	}
+	if got := Diff(old, &new); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff = %q, want %q", got, want)
+	}
+	if got := Diff(old, old); len(got) != 0 {
+		t.Errorf("Diff of identical configs = %q", got)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	os.WriteFile(path, []byte("a: 1\n"), 0600)
+
+	done := make(chan struct{})
+	defer close(done)
+	changed := make(chan struct{}, 10)
+	if err := Watch(path, done, func() { changed <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unrelated files in the same directory are ignored
+	os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("b: 2\n"), 0600)
+	// Save by rename, as editors and config management do
+	tmp := filepath.Join(dir, ".config.yaml.tmp")
+	os.WriteFile(tmp, []byte("a: 2\n"), 0600)
+	os.Rename(tmp, path)
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported")
+	}
+	select {
+	case <-changed:
+		t.Error("change reported twice for one save")
+	case <-time.After(2 * watchDebounce):
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// secretKeys are reported as changed without their values.
+var secretKeys = map[string]bool{
+	"api_key":          true,
+	"enrollment_token": true,
+}
+
+// Diff lists the settings that differ between old and new as
+// "key: old -> new", keyed by their dotted YAML path and sorted.
+func Diff(old, new *Config) []string {
+	a, b := flatten(old), flatten(new)
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+
+	var changes []string
+	for k := range keys {
+		if reflect.DeepEqual(a[k], b[k]) {
+			continue
+		}
+		if secretKeys[k] {
+			changes = append(changes, k+": (changed)")
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %v -> %v", k, a[k], b[k]))
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// flatten maps each leaf setting of c to its dotted YAML path.
+func flatten(c *Config) map[string]interface{} {
+	out := map[string]interface{}{}
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return out
+	}
+	var tree map[string]interface{}
+	if err := yaml.Unmarshal(b, &tree); err != nil {
+		return out
+	}
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		if m, ok := v.(map[string]interface{}); ok {
+			for k, child := range m {
+				if prefix != "" {
+					k = prefix + "." + k
+				}
+				walk(k, child)
+			}
+			return
+		}
+		out[prefix] = v
+	}
+	walk("", tree)
+	return out
+}
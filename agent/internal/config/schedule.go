@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// MinTaskInterval bounds how often a task may run.
+const MinTaskInterval = 10 * time.Second
+
+// TaskSchedule is when a collection task runs: every Interval (a duration
+// such as "1m" or "6h") or at the times matched by Cron (five fields, or a
+// descriptor such as "@daily"), in local time. With neither set the
+// scheduler's default for the task applies. Timeout (a duration) cancels a
+// run that takes longer, so a hung command cannot stall the task forever.
+type TaskSchedule struct {
+	Interval string `yaml:"interval"`
+	Cron     string `yaml:"cron"`
+	Timeout  string `yaml:"timeout"`
+	Disabled bool   `yaml:"disabled"`
+}
+
+// SchedulesConfig holds the schedule of each collection task. heartbeat
+// reports liveness, cis runs the checks, packages sends the software
+// inventory and apps walks the filesystem for application packages.
+type SchedulesConfig struct {
+	Heartbeat TaskSchedule `yaml:"heartbeat"`
+	CIS       TaskSchedule `yaml:"cis"`
+	Packages  TaskSchedule `yaml:"packages"`
+	Apps      TaskSchedule `yaml:"apps"`
+}
+
+// ParseInterval returns the interval, or 0 when none is set.
+func (t TaskSchedule) ParseInterval() (time.Duration, error) {
+	if t.Interval == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(t.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval %q", t.Interval)
+	}
+	if d < MinTaskInterval {
+		return 0, fmt.Errorf("interval must be at least %s", MinTaskInterval)
+	}
+	return d, nil
+}
+
+// ParseTimeout returns the timeout, or 0 when none is set.
+func (t TaskSchedule) ParseTimeout() (time.Duration, error) {
+	if t.Timeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(t.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q", t.Timeout)
+	}
+	return d, nil
+}
+
+// ParseCron returns the cron schedule, or nil when none is set.
+func (t TaskSchedule) ParseCron() (cron.Schedule, error) {
+	if t.Cron == "" {
+		return nil, nil
+	}
+	sched, err := cron.ParseStandard(t.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", t.Cron, err)
+	}
+	return sched, nil
+}
+
+func (t TaskSchedule) validate() error {
+	if t.Interval != "" && t.Cron != "" {
+		return fmt.Errorf("interval and cron are mutually exclusive")
+	}
+	if _, err := t.ParseInterval(); err != nil {
+		return err
+	}
+	if _, err := t.ParseTimeout(); err != nil {
+		return err
+	}
+	_, err := t.ParseCron()
+	return err
+}
+
+func (s SchedulesConfig) validate() error {
+	for name, t := range map[string]TaskSchedule{
+		"heartbeat": s.Heartbeat,
+		"cis":       s.CIS,
+		"packages":  s.Packages,
+		"apps":      s.Apps,
+	} {
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("schedules.%s: %w", name, err)
+		}
+	}
+	return nil
+}
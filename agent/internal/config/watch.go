@@ -0,0 +1,49 @@
+package config
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce coalesces the burst of events an editor produces when saving.
+const watchDebounce = 500 * time.Millisecond
+
+// Watch calls onChange after the file at path is written, replaced or
+// recreated, until done is closed. The parent directory is watched so that
+// editors and config management tools that save by rename are noticed.
+func Watch(path string, done <-chan struct{}, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		name := filepath.Clean(path)
+		var timer <-chan time.Time
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) == name && ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					timer = time.After(watchDebounce)
+				}
+			case <-watcher.Errors:
+			case <-timer:
+				timer = nil
+				onChange()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return nil
+}
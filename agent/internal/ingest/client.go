@@ -2,57 +2,265 @@ package ingest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/visiblaze/sec-agent/agent/internal/config"
 	"github.com/visiblaze/sec-agent/agent/internal/logging"
+	"github.com/visiblaze/sec-agent/pkg/upload"
 )
 
 type Client struct {
 	cfg    *config.Config
 	logger *logging.Logger
 	http   *http.Client
+	cred   *Credential
+	signer *Signer
+	// encoding is the request compression in use, possibly downgraded after
+	// negotiation with the backend
+	encoding string
 }
 
-func NewClient(cfg *config.Config, logger *logging.Logger) *Client {
-	return &Client{
-		cfg:    cfg,
-		logger: logger,
-		http: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+func NewClient(cfg *config.Config, logger *logging.Logger) (*Client, error) {
+	tlsCfg, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	if tlsCfg != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsCfg
+		httpClient.Transport = transport
+	}
+
+	cred, err := LoadCredential(cfg.CredentialPath())
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := upload.Normalize(cfg.Upload.Compression)
+	if encoding == "none" {
+		encoding = upload.EncodingIdentity
 	}
+
+	return &Client{
+		cfg:      cfg,
+		logger:   logger,
+		http:     httpClient,
+		cred:     cred,
+		encoding: encoding,
+	}, nil
 }
 
-func (c *Client) SendPayload(payload interface{}) error {
+// sendMu serializes signed sends across clients: the backend rejects a
+// sequence number lower than one it has already accepted, so payloads must
+// arrive in the order they were signed.
+var sendMu sync.Mutex
+
+// SendPayload signs, compresses and posts payload, switching to a multi-part
+// upload session when the compressed body exceeds the chunk threshold. If the
+// backend rejects the compression it falls back to one the backend accepts.
+func (c *Client) SendPayload(ctx context.Context, payload interface{}) (*Response, error) {
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("marshal: %w", err)
+		return nil, fmt.Errorf("marshal: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/ingest", c.cfg.APIBaseURL)
-	req, err := http.NewRequest("POST", url, bytes.NewReader(jsonData))
+	sendMu.Lock()
+	defer sendMu.Unlock()
+
+	signer, err := c.loadSigner()
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return nil, err
+	}
+	respBody, err := c.send(ctx, jsonData, signer)
+	var unsupported *unsupportedEncodingError
+	if errors.As(err, &unsupported) {
+		next := upload.Negotiate(unsupported.accept, upload.Supported)
+		if next == "" || next == c.encoding {
+			return nil, err
+		}
+		c.logger.Warnf("Backend does not accept %s request bodies, falling back to %s", c.encoding, next)
+		c.encoding = next
+		respBody, err = c.send(ctx, jsonData, signer)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-Key", c.cfg.APIKey)
+	// Older backends answer with a bare status; anything unparseable is
+	// treated as an empty response rather than a failed send
+	var resp Response
+	_ = json.Unmarshal(respBody, &resp)
+	return &resp, nil
+}
+
+// SendHeartbeat signs and posts hb to /heartbeat. Heartbeats are small and
+// frequent, so they are never compressed or split.
+func (c *Client) SendHeartbeat(ctx context.Context, hb *Heartbeat) (*Response, error) {
+	jsonData, err := json.Marshal(hb)
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+
+	sendMu.Lock()
+	defer sendMu.Unlock()
+
+	signer, err := c.loadSigner()
+	if err != nil {
+		return nil, err
+	}
+	env, err := signer.Sign(jsonData)
+	if err != nil {
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+
+	headers := env.Headers()
+	headers["Content-Type"] = "application/json"
+	respBody, err := c.post(ctx, "/heartbeat", jsonData, headers)
+	if err != nil {
+		return nil, err
+	}
+	var resp Response
+	_ = json.Unmarshal(respBody, &resp)
+	return &resp, nil
+}
+
+// send compresses and posts data, signing it with signer just before the
+// request that the backend verifies.
+func (c *Client) send(ctx context.Context, data []byte, signer *Signer) ([]byte, error) {
+	body, err := upload.Encode(c.encoding, data)
+	if err != nil {
+		return nil, fmt.Errorf("compress: %w", err)
+	}
+	if threshold := c.cfg.Upload.ChunkThresholdKB * 1024; threshold > 0 && len(body) > threshold {
+		return c.sendChunked(ctx, body, data, signer)
+	}
+
+	env, err := signer.Sign(data)
+	if err != nil {
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+	headers := env.Headers()
+	headers["Content-Type"] = "application/json"
+	if c.encoding != upload.EncodingIdentity {
+		headers["Content-Encoding"] = c.encoding
+	}
+	return c.post(ctx, "/ingest", body, headers)
+}
+
+// sendChunked uploads body, the compressed payload, in parts. The signature
+// covers the uncompressed payload and is checked when the session completes,
+// so it is made only once every part is uploaded: a slow upload must not
+// outlast the signature timestamp's allowed skew.
+func (c *Client) sendChunked(ctx context.Context, body, payload []byte, signer *Signer) ([]byte, error) {
+	parts := upload.Split(body, c.cfg.Upload.ChunkSizeKB*1024)
+	session, _ := json.Marshal(upload.Session{
+		Parts:           len(parts),
+		Size:            int64(len(body)),
+		SHA256:          upload.Digest(body),
+		ContentEncoding: c.encoding,
+	})
+
+	resp, err := c.post(ctx, "/ingest/uploads", session, map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return nil, fmt.Errorf("open upload: %w", err)
+	}
+	var opened struct {
+		UploadID string `json:"upload_id"`
+	}
+	if err := json.Unmarshal(resp, &opened); err != nil || opened.UploadID == "" {
+		return nil, fmt.Errorf("open upload: invalid response")
+	}
+
+	for i, part := range parts {
+		path := fmt.Sprintf("/ingest/uploads/%s/parts/%d", opened.UploadID, i+1)
+		if _, err := c.post(ctx, path, part, map[string]string{"Content-Type": "application/octet-stream"}); err != nil {
+			return nil, fmt.Errorf("upload part %d/%d: %w", i+1, len(parts), err)
+		}
+	}
+
+	env, err := signer.Sign(payload)
+	if err != nil {
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+	result, err := c.post(ctx, fmt.Sprintf("/ingest/uploads/%s/complete", opened.UploadID), nil, env.Headers())
+	if err != nil {
+		return nil, fmt.Errorf("complete upload: %w", err)
+	}
+	c.logger.Infof("Uploaded %d byte payload in %d parts", len(body), len(parts))
+	return result, nil
+}
+
+// unsupportedEncodingError is a 415 response; accept is the Accept-Encoding
+// the backend sent with it.
+type unsupportedEncodingError struct {
+	accept string
+	body   string
+}
+
+func (e *unsupportedEncodingError) Error() string {
+	return fmt.Sprintf("api error 415: %s", e.body)
+}
+
+// post sends an authenticated request and returns the response body. The
+// request is abandoned when ctx is done.
+func (c *Client) post(ctx context.Context, path string, body []byte, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.cfg.APIBaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	c.setAuth(req)
 
 	resp, err := c.http.Do(req)
 	if err != nil {
-		return fmt.Errorf("send: %w", err)
+		return nil, fmt.Errorf("send: %w", err)
 	}
 	defer resp.Body.Close()
 
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusUnsupportedMediaType {
+		return nil, &unsupportedEncodingError{accept: resp.Header.Get("Accept-Encoding"), body: string(respBody)}
+	}
 	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("api error %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("api error %d: %s", resp.StatusCode, string(respBody))
+	}
+	return respBody, nil
+}
+
+// loadSigner loads the host signing key, creating it on first use.
+func (c *Client) loadSigner() (*Signer, error) {
+	if c.signer == nil {
+		signer, err := LoadOrCreateSigner(c.cfg.StateDir)
+		if err != nil {
+			return nil, err
+		}
+		c.signer = signer
 	}
+	return c.signer, nil
+}
 
-	return nil
+// setAuth authenticates as the enrolled host when a credential is present
+// and falls back to the shared API key otherwise.
+func (c *Client) setAuth(req *http.Request) {
+	if c.cred != nil {
+		req.Header.Set("Authorization", "Bearer "+c.cred.Secret)
+		req.Header.Set("X-Host-ID", c.cred.HostID)
+		return
+	}
+	if c.cfg.APIKey != "" {
+		req.Header.Set("X-API-Key", c.cfg.APIKey)
+	}
 }
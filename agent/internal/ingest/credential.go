@@ -0,0 +1,128 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Credential is the per-host secret issued at enrollment. It is bound to
+// HostID on the backend and replaces the shared API key once present.
+type Credential struct {
+	HostID   string `json:"host_id"`
+	Secret   string `json:"credential"`
+	IssuedAt string `json:"issued_at"`
+}
+
+// LoadCredential reads a stored credential. A missing file is not an error
+// and yields nil.
+func LoadCredential(path string) (*Credential, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read credential: %w", err)
+	}
+	var cred Credential
+	if err := json.Unmarshal(b, &cred); err != nil {
+		return nil, fmt.Errorf("parse credential %s: %w", path, err)
+	}
+	if cred.HostID == "" || cred.Secret == "" {
+		return nil, fmt.Errorf("credential %s is incomplete", path)
+	}
+	return &cred, nil
+}
+
+// saveCredential writes the credential readable by root only, replacing any
+// previous one atomically so an interrupted write never loses both.
+func saveCredential(path string, cred *Credential) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	b, err := json.MarshalIndent(cred, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".credential-*")
+	if err != nil {
+		return fmt.Errorf("write credential: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write credential: %w", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write credential: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write credential: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write credential: %w", err)
+	}
+	return nil
+}
+
+// Credential returns the credential in use, or nil before enrollment.
+func (c *Client) Credential() *Credential {
+	return c.cred
+}
+
+// Enroll exchanges token for a credential bound to hostID and stores it. The
+// host's payload signing key is registered at the same time.
+func (c *Client) Enroll(ctx context.Context, token, hostID, hostname string) error {
+	signer, err := c.loadSigner()
+	if err != nil {
+		return err
+	}
+	body := map[string]string{"token": token, "host_id": hostID, "hostname": hostname, "public_key": signer.PublicKey()}
+	cred, err := c.requestCredential(ctx, "/enroll", body)
+	if err != nil {
+		return fmt.Errorf("enroll: %w", err)
+	}
+	if err := saveCredential(c.cfg.CredentialPath(), cred); err != nil {
+		return err
+	}
+	c.cred = cred
+	return nil
+}
+
+// RotateCredential replaces the stored credential with a freshly issued one.
+// The backend keeps accepting the old credential until the new one is used.
+func (c *Client) RotateCredential(ctx context.Context) error {
+	if c.cred == nil {
+		return fmt.Errorf("rotate: agent is not enrolled")
+	}
+	cred, err := c.requestCredential(ctx, fmt.Sprintf("/hosts/%s/credentials/rotate", c.cred.HostID), nil)
+	if err != nil {
+		return fmt.Errorf("rotate: %w", err)
+	}
+	if err := saveCredential(c.cfg.CredentialPath(), cred); err != nil {
+		return err
+	}
+	c.cred = cred
+	return nil
+}
+
+func (c *Client) requestCredential(ctx context.Context, path string, body interface{}) (*Credential, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+	respBody, err := c.post(ctx, path, jsonData, map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return nil, err
+	}
+
+	var cred Credential
+	if err := json.Unmarshal(respBody, &cred); err != nil || cred.Secret == "" {
+		return nil, fmt.Errorf("invalid credential response")
+	}
+	return &cred, nil
+}
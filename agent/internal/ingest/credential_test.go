@@ -0,0 +1,127 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/visiblaze/sec-agent/agent/internal/config"
+	"github.com/visiblaze/sec-agent/agent/internal/logging"
+	"github.com/visiblaze/sec-agent/pkg/signing"
+)
+
+func TestEnrollThenSend(t *testing.T) {
+	var ingestAuth, ingestHost, ingestKey, publicKey string
+	var ingestErr error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/enroll":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["token"] != "vze_token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			publicKey = body["public_key"]
+			json.NewEncoder(w).Encode(map[string]string{"host_id": body["host_id"], "credential": "vzh_secret"})
+		case "/ingest":
+			ingestAuth = r.Header.Get("Authorization")
+			ingestHost = r.Header.Get("X-Host-ID")
+			ingestKey = r.Header.Get("X-API-Key")
+			body, _ := io.ReadAll(r.Body)
+			ingestErr = verifyRequest(r, body, publicKey)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{APIBaseURL: srv.URL, APIKey: "shared", StateDir: t.TempDir()}
+	c, err := NewClient(cfg, logging.NewWriter(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Credential() != nil {
+		t.Fatal("credential present before enrollment")
+	}
+	if err := c.Enroll(context.Background(), "wrong", "host-1", "web"); err == nil {
+		t.Fatal("enrollment with a bad token succeeded")
+	}
+	if err := c.Enroll(context.Background(), "vze_token", "host-1", "web"); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(cfg.CredentialPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("credential mode = %o, want 600", fi.Mode().Perm())
+	}
+
+	// A fresh client picks the stored credential up and stops using the
+	// shared key
+	c, err = NewClient(cfg, logging.NewWriter(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendPayload(context.Background(), map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if ingestAuth != "Bearer vzh_secret" || ingestHost != "host-1" || ingestKey != "" {
+		t.Errorf("ingest headers: auth=%q host=%q key=%q", ingestAuth, ingestHost, ingestKey)
+	}
+	if ingestErr != nil {
+		t.Errorf("payload signature: %v", ingestErr)
+	}
+}
+
+func verifyRequest(r *http.Request, body []byte, publicKey string) error {
+	env, err := signing.ParseHeaders(r.Header.Get)
+	if err != nil {
+		return err
+	}
+	if env == nil {
+		return errors.New("request is unsigned")
+	}
+	if env.PublicKey != publicKey {
+		return errors.New("signed with a key other than the enrolled one")
+	}
+	pub, err := signing.DecodePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	return env.Verify(pub, body, time.Now())
+}
+
+func TestSequenceIncreases(t *testing.T) {
+	dir := t.TempDir()
+	s, err := LoadOrCreateSigner(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := s.Sign([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted agent reuses the key and continues the sequence
+	s, err = LoadOrCreateSigner(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Sign([]byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.PublicKey != first.PublicKey {
+		t.Error("signing key changed across restarts")
+	}
+	if second.Sequence <= first.Sequence {
+		t.Errorf("sequence went from %d to %d", first.Sequence, second.Sequence)
+	}
+}
@@ -0,0 +1,54 @@
+package ingest
+
+import (
+	"github.com/visiblaze/sec-agent/agent/internal/cis"
+	"github.com/visiblaze/sec-agent/agent/internal/collect"
+	"github.com/visiblaze/sec-agent/agent/internal/remediate"
+	"github.com/visiblaze/sec-agent/pkg/policy"
+)
+
+// Payload is the document posted to /ingest.
+type Payload struct {
+	Host         *collect.HostInfo           `json:"host"`
+	Packages     []collect.Package           `json:"packages"`
+	CISResults   []*cis.CheckResult          `json:"cis_results"`
+	Containers   *collect.ContainerInventory `json:"containers,omitempty"`
+	Remediations []remediate.Result          `json:"remediations,omitempty"`
+	// Tasks names the sections a scheduled task collected (heartbeat, cis,
+	// packages). The backend leaves other sections untouched; an empty list
+	// is a full snapshot.
+	Tasks []string `json:"tasks,omitempty"`
+}
+
+// Heartbeat is the small liveness message posted to /heartbeat between full
+// collections.
+type Heartbeat struct {
+	HostID        string `json:"host_id"`
+	Hostname      string `json:"hostname"`
+	AgentVersion  string `json:"agent_version"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+	// QueueDepth is the number of remediation results waiting to be sent
+	QueueDepth     int             `json:"queue_depth"`
+	LastCollection *CollectionInfo `json:"last_collection,omitempty"`
+}
+
+// CollectionInfo summarizes the most recent collection task run.
+type CollectionInfo struct {
+	Task   string `json:"task"`
+	Status string `json:"status"`
+	At     string `json:"at"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Collection statuses reported in a heartbeat.
+const (
+	CollectionOK     = "ok"
+	CollectionFailed = "error"
+)
+
+// Response is the backend's answer to an ingest. Policy is set when a policy
+// is assigned to the host.
+type Response struct {
+	Status string         `json:"status"`
+	Policy *policy.Signed `json:"policy,omitempty"`
+}
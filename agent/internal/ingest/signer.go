@@ -0,0 +1,127 @@
+package ingest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/visiblaze/sec-agent/pkg/signing"
+)
+
+const (
+	signingKeyFile = "signing_key.pem"
+	sequenceFile   = "sequence"
+)
+
+// Signer signs payloads with the host's Ed25519 key and hands out sequence
+// numbers that increase across restarts.
+type Signer struct {
+	key      ed25519.PrivateKey
+	stateDir string
+	mu       sync.Mutex
+}
+
+// LoadOrCreateSigner reads the host signing key from stateDir, generating it
+// on first use.
+func LoadOrCreateSigner(stateDir string) (*Signer, error) {
+	path := filepath.Join(stateDir, signingKeyFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createSigner(stateDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s is not PEM", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse signing key: %w", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not Ed25519", path)
+	}
+	return &Signer{key: key, stateDir: stateDir}, nil
+}
+
+func createSigner(stateDir string) (*Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate signing key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return nil, fmt.Errorf("create state dir: %w", err)
+	}
+	// O_EXCL so two agents starting together cannot end up with different keys
+	f, err := os.OpenFile(filepath.Join(stateDir, signingKeyFile), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return LoadOrCreateSigner(stateDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write signing key: %w", err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return nil, fmt.Errorf("write signing key: %w", err)
+	}
+	return &Signer{key: key, stateDir: stateDir}, nil
+}
+
+// PublicKey returns the encoded public key registered with the backend.
+func (s *Signer) PublicKey() string {
+	return signing.EncodePublicKey(s.key.Public().(ed25519.PublicKey))
+}
+
+// Sign reserves the next sequence number and signs body with it.
+func (s *Signer) Sign(body []byte) (signing.Envelope, error) {
+	now := time.Now()
+	seq, err := s.nextSequence(now)
+	if err != nil {
+		return signing.Envelope{}, err
+	}
+	return signing.Sign(s.key, now.Unix(), seq, body), nil
+}
+
+// nextSequence persists and returns a number greater than any handed out
+// before. Millisecond time is used as a floor so a lost sequence file does not
+// cause the backend to reject every payload as a replay.
+func (s *Signer) nextSequence(now time.Time) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := filepath.Join(s.stateDir, sequenceFile)
+	var last uint64
+	if b, err := os.ReadFile(path); err == nil {
+		last, _ = strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	}
+	next := last + 1
+	if ms := uint64(now.UnixMilli()); ms > next {
+		next = ms
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(next, 10)), 0600); err != nil {
+		return 0, fmt.Errorf("write sequence: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, fmt.Errorf("write sequence: %w", err)
+	}
+	return next, nil
+}
@@ -0,0 +1,64 @@
+package ingest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/visiblaze/sec-agent/agent/internal/config"
+	"github.com/visiblaze/sec-agent/pkg/certid"
+)
+
+// newTLSConfig builds the client TLS configuration from the agent config.
+// It returns nil when nothing beyond the Go defaults is configured.
+func newTLSConfig(c config.TLSConfig) (*tls.Config, error) {
+	if c.CAFile == "" && c.CertFile == "" && c.ServerName == "" && len(c.PinnedSPKI) == 0 {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file %s contains no certificates", c.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(c.PinnedSPKI) > 0 {
+		pins := make(map[string]bool, len(c.PinnedSPKI))
+		for _, pin := range c.PinnedSPKI {
+			pins[pin] = true
+		}
+		// Runs after normal chain verification, so pinning only narrows trust
+		tlsCfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, chain := range cs.VerifiedChains {
+				for _, cert := range chain {
+					if pins[certid.SPKIHash(cert)] {
+						return nil
+					}
+				}
+			}
+			return fmt.Errorf("server certificate does not match any pinned public key")
+		}
+	}
+
+	return tlsCfg, nil
+}
@@ -0,0 +1,121 @@
+package ingest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/visiblaze/sec-agent/agent/internal/config"
+	"github.com/visiblaze/sec-agent/agent/internal/logging"
+	"github.com/visiblaze/sec-agent/pkg/certid"
+)
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestServer(t *testing.T, seen *certid.Identity) (*httptest.Server, string) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			*seen, _ = certid.FromCertificate(r.TLS.PeerCertificates[0])
+		}
+		io.Copy(io.Discard, r.Body)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", srv.Certificate().Raw)
+	return srv, caFile
+}
+
+func newTestClient(t *testing.T, baseURL string, tlsCfg config.TLSConfig) *Client {
+	t.Helper()
+	c, err := NewClient(&config.Config{APIBaseURL: baseURL, StateDir: t.TempDir(), TLS: tlsCfg}, logging.NewWriter(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestPinnedSPKI(t *testing.T) {
+	var seen certid.Identity
+	srv, caFile := newTestServer(t, &seen)
+
+	good := newTestClient(t, srv.URL, config.TLSConfig{
+		CAFile:     caFile,
+		PinnedSPKI: []string{certid.SPKIHash(srv.Certificate())},
+	})
+	if _, err := good.SendPayload(context.Background(), map[string]string{}); err != nil {
+		t.Fatalf("matching pin rejected: %v", err)
+	}
+
+	bad := newTestClient(t, srv.URL, config.TLSConfig{
+		CAFile:     caFile,
+		PinnedSPKI: []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+	})
+	if _, err := bad.SendPayload(context.Background(), map[string]string{}); err == nil {
+		t.Fatal("mismatched pin accepted")
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	var seen certid.Identity
+	srv, caFile := newTestServer(t, &seen)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, _ := url.Parse(certid.HostURI("host-1"))
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(0xbeef),
+		Subject:      pkix.Name{CommonName: "ignored"},
+		URIs:         []*url.URL{uri},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writePEM(t, filepath.Join(dir, "agent.pem"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(dir, "agent.key"), "EC PRIVATE KEY", keyDER)
+
+	c := newTestClient(t, srv.URL, config.TLSConfig{
+		CAFile:   caFile,
+		CertFile: filepath.Join(dir, "agent.pem"),
+		KeyFile:  filepath.Join(dir, "agent.key"),
+	})
+	if _, err := c.SendPayload(context.Background(), map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if seen.HostID != "host-1" || seen.Serial != "beef" {
+		t.Fatalf("server saw identity %+v", seen)
+	}
+}
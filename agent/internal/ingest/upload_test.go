@@ -0,0 +1,125 @@
+package ingest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/visiblaze/sec-agent/agent/internal/config"
+	"github.com/visiblaze/sec-agent/agent/internal/logging"
+	"github.com/visiblaze/sec-agent/pkg/upload"
+)
+
+// fakeIngest accepts only the codings in accept and records what it
+// reassembles.
+type fakeIngest struct {
+	accept   []string
+	session  upload.Session
+	parts    map[int][]byte
+	received []byte
+	encoding string
+}
+
+func (f *fakeIngest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	path := strings.TrimPrefix(r.URL.Path, "/ingest")
+	switch {
+	case path == "":
+		f.encoding = upload.Normalize(r.Header.Get("Content-Encoding"))
+		if !f.accepts(f.encoding) {
+			w.Header().Set("Accept-Encoding", strings.Join(f.accept, ", "))
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		f.received, _ = upload.Decode(f.encoding, body)
+	case path == "/uploads":
+		json.Unmarshal(body, &f.session)
+		f.parts = map[int][]byte{}
+		json.NewEncoder(w).Encode(map[string]string{"upload_id": "u1"})
+	case strings.HasPrefix(path, "/uploads/u1/parts/"):
+		n, _ := strconv.Atoi(strings.TrimPrefix(path, "/uploads/u1/parts/"))
+		f.parts[n] = body
+	case path == "/uploads/u1/complete":
+		var chunks [][]byte
+		for n := 1; n <= len(f.parts); n++ {
+			chunks = append(chunks, f.parts[n])
+		}
+		data, err := f.session.Assemble(chunks)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.encoding = f.session.ContentEncoding
+		f.received, _ = upload.Decode(f.encoding, data)
+	}
+}
+
+func (f *fakeIngest) accepts(encoding string) bool {
+	for _, e := range f.accept {
+		if e == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCompressionFallback(t *testing.T) {
+	fake := &fakeIngest{accept: []string{upload.EncodingGzip, upload.EncodingIdentity}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	cfg := &config.Config{APIBaseURL: srv.URL, StateDir: t.TempDir(), Upload: config.UploadConfig{Compression: "zstd"}}
+	c, err := NewClient(cfg, logging.NewWriter(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := map[string]string{"host_id": "h1"}
+	if _, err := c.SendPayload(context.Background(), payload); err != nil {
+		t.Fatal(err)
+	}
+	if fake.encoding != upload.EncodingGzip {
+		t.Errorf("server saw %q, want gzip after fallback", fake.encoding)
+	}
+	want, _ := json.Marshal(payload)
+	if string(fake.received) != string(want) {
+		t.Errorf("received %q", fake.received)
+	}
+}
+
+func TestChunkedUpload(t *testing.T) {
+	fake := &fakeIngest{accept: upload.Supported}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	cfg := &config.Config{
+		APIBaseURL: srv.URL,
+		StateDir:   t.TempDir(),
+		Upload:     config.UploadConfig{Compression: "gzip", ChunkThresholdKB: 1, ChunkSizeKB: 1},
+	}
+	c, err := NewClient(cfg, logging.NewWriter(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Random data barely compresses, forcing several parts
+	noise := make([]byte, 6000)
+	rand.Read(noise)
+	payload := map[string]string{"blob": base64.StdEncoding.EncodeToString(noise)}
+	if _, err := c.SendPayload(context.Background(), payload); err != nil {
+		t.Fatal(err)
+	}
+	if fake.session.Parts < 5 || len(fake.parts) != fake.session.Parts {
+		t.Errorf("session declared %d parts, received %d", fake.session.Parts, len(fake.parts))
+	}
+	want, _ := json.Marshal(payload)
+	if string(fake.received) != string(want) {
+		t.Error("reassembled payload differs from the original")
+	}
+}
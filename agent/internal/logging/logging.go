@@ -3,15 +3,23 @@ package logging
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type Logger struct {
 	logDir string
+	out    io.Writer
 	file   *os.File
+	level  int32
 }
 
+// Levels in increasing severity, named as in config and policy log_level.
+var levels = map[string]int32{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
 type logEntry struct {
 	Timestamp string      `json:"timestamp"`
 	Level     string      `json:"level"`
@@ -31,10 +39,30 @@ func New(logDir string) (*Logger, error) {
 		return nil, err
 	}
 
-	return &Logger{logDir: logDir, file: file}, nil
+	return &Logger{logDir: logDir, out: file, file: file, level: levels["info"]}, nil
+}
+
+// NewWriter returns a logger that writes JSON lines to w instead of a file.
+// The CLI uses it when the log directory is not writable.
+func NewWriter(w io.Writer) *Logger {
+	return &Logger{out: w, level: levels["info"]}
+}
+
+// SetLevel drops entries below level (debug, info, warn or error). It is safe
+// to call while other goroutines log.
+func (l *Logger) SetLevel(level string) error {
+	n, ok := levels[level]
+	if !ok {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	atomic.StoreInt32(&l.level, n)
+	return nil
 }
 
 func (l *Logger) log(level, msg string, err error, data interface{}) {
+	if levels[strings.ToLower(level)] < atomic.LoadInt32(&l.level) {
+		return
+	}
 	entry := logEntry{
 		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
 		Level:     level,
@@ -46,7 +74,11 @@ func (l *Logger) log(level, msg string, err error, data interface{}) {
 	}
 
 	jsonBytes, _ := json.Marshal(entry)
-	fmt.Fprintln(l.file, string(jsonBytes))
+	fmt.Fprintln(l.out, string(jsonBytes))
+}
+
+func (l *Logger) Debugf(msg string, args ...interface{}) {
+	l.log("DEBUG", fmt.Sprintf(msg, args...), nil, nil)
 }
 
 func (l *Logger) Infof(msg string, args ...interface{}) {
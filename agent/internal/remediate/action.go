@@ -0,0 +1,208 @@
+package remediate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SysctlFile   = "/etc/sysctl.d/60-visiblaze.conf"
+	ModprobeFile = "/etc/modprobe.d/visiblaze-blacklist.conf"
+)
+
+// Action is a fix proposed by a check: a set of file edits followed by
+// commands that make the new configuration take effect. Validate commands
+// run between the two; if one fails, or is not installed, the edits are
+// undone and the post commands are skipped. RollbackCommands make the
+// restored configuration take effect again when the run is rolled back.
+type Action struct {
+	CheckID          string     `json:"check_id"`
+	Description      string     `json:"description"`
+	Edits            []FileEdit `json:"edits"`
+	Validate         [][]string `json:"validate,omitempty"`
+	PostCommands     [][]string `json:"post_commands,omitempty"`
+	RollbackCommands [][]string `json:"rollback_commands,omitempty"`
+}
+
+// FileEdit describes the desired state of a single file. An empty Content
+// with KeepContent set only changes the mode.
+type FileEdit struct {
+	Path        string      `json:"path"`
+	Content     string      `json:"-"`
+	KeepContent bool        `json:"-"`
+	Mode        os.FileMode `json:"mode,omitempty"`
+}
+
+// SetDirective returns an edit that sets "key<sep>value" in a key/value style
+// config file such as sshd_config or login.defs. The first active occurrence
+// of key is replaced, later duplicates are commented out, and the directive is
+// appended if missing.
+func SetDirective(path, key, sep, value string) (FileEdit, error) {
+	content, err := readOptional(path)
+	if err != nil {
+		return FileEdit{}, err
+	}
+
+	return FileEdit{Path: path, Content: SetDirectiveIn(content, key, sep, value)}, nil
+}
+
+// EnsureLines returns an edit that appends any of the given lines missing
+// from path, creating the file if needed.
+func EnsureLines(path string, want ...string) (FileEdit, error) {
+	content, err := readOptional(path)
+	if err != nil {
+		return FileEdit{}, err
+	}
+
+	lines := splitLines(content)
+	present := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		present[strings.TrimSpace(line)] = true
+	}
+	for _, line := range want {
+		if !present[line] {
+			lines = append(lines, line)
+			present[line] = true
+		}
+	}
+
+	return FileEdit{Path: path, Content: strings.Join(lines, "\n") + "\n", Mode: 0644}, nil
+}
+
+// SetMode returns an edit that only changes the permission bits of path.
+func SetMode(path string, mode os.FileMode) FileEdit {
+	return FileEdit{Path: path, KeepContent: true, Mode: mode}
+}
+
+// procSys is where the running kernel's parameters are read from.
+var procSys = "/proc/sys"
+
+// Sysctl returns an action that persists kernel parameters in SysctlFile and
+// applies them to the running kernel. Keys are applied in the order given.
+// The running values are read first, so a rollback sets them back; keys
+// that cannot be read are left as the fix set them.
+func Sysctl(checkID string, params map[string]string, keys ...string) (*Action, error) {
+	action := &Action{
+		CheckID:     checkID,
+		Description: "set kernel parameters " + strings.Join(keys, ", "),
+	}
+
+	content, err := readOptional(SysctlFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		content = SetDirectiveIn(content, key, " = ", params[key])
+		action.PostCommands = append(action.PostCommands, []string{"sysctl", "-w", fmt.Sprintf("%s=%s", key, params[key])})
+		if value, err := os.ReadFile(filepath.Join(procSys, strings.ReplaceAll(key, ".", "/"))); err == nil {
+			// Multi-valued parameters read back tab-separated
+			original := strings.Join(strings.Fields(string(value)), " ")
+			action.RollbackCommands = append(action.RollbackCommands, []string{"sysctl", "-w", fmt.Sprintf("%s=%s", key, original)})
+		}
+	}
+	action.Edits = []FileEdit{{Path: SysctlFile, Content: content, Mode: 0644}}
+
+	return action, nil
+}
+
+// BlacklistModules returns an action that prevents the given kernel modules
+// from loading via a modprobe.d drop-in.
+func BlacklistModules(checkID string, modules ...string) (*Action, error) {
+	var lines []string
+	for _, m := range modules {
+		lines = append(lines, fmt.Sprintf("install %s /bin/false", m), fmt.Sprintf("blacklist %s", m))
+	}
+
+	edit, err := EnsureLines(ModprobeFile, lines...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Action{
+		CheckID:     checkID,
+		Description: "blacklist kernel modules " + strings.Join(modules, ", "),
+		Edits:       []FileEdit{edit},
+	}, nil
+}
+
+// SetDirectiveIn applies SetDirective to in-memory content, for building
+// several directives into a single edit.
+func SetDirectiveIn(content, key, sep, value string) string {
+	directive := key + sep + value
+	lines := splitLines(content)
+	found := false
+	for i, line := range lines {
+		fields := strings.Fields(strings.ReplaceAll(line, "=", " "))
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || !strings.EqualFold(fields[0], key) {
+			continue
+		}
+		if found {
+			lines[i] = "# " + line
+			continue
+		}
+		lines[i] = directive
+		found = true
+	}
+	if !found {
+		lines = append(lines, directive)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// SetSSHDirective is SetDirective for sshd_config and its drop-ins, using
+// SetSSHDirectiveIn.
+func SetSSHDirective(path, key, value string) (FileEdit, error) {
+	content, err := readOptional(path)
+	if err != nil {
+		return FileEdit{}, err
+	}
+
+	return FileEdit{Path: path, Content: SetSSHDirectiveIn(content, key, value)}, nil
+}
+
+// SetSSHDirectiveIn sets "key value" in sshd_config syntax. sshd applies the
+// first value it reads and everything after the first Match line only to
+// matching connections, so only directives before that line are replaced or
+// commented out, and a missing directive is inserted just above it.
+func SetSSHDirectiveIn(content, key, value string) string {
+	directive := key + " " + value
+	lines := splitLines(content)
+	found := false
+	end := len(lines)
+	for i, line := range lines {
+		fields := strings.Fields(strings.ReplaceAll(line, "=", " "))
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if strings.EqualFold(fields[0], "Match") {
+			end = i
+			break
+		}
+		if !strings.EqualFold(fields[0], key) {
+			continue
+		}
+		if found {
+			lines[i] = "# " + line
+			continue
+		}
+		lines[i] = directive
+		found = true
+	}
+	if !found {
+		lines = append(lines[:end], append([]string{directive}, lines[end:]...)...)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func readOptional(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", path, err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,139 @@
+package remediate
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-', '+'
+	line string
+}
+
+// UnifiedDiff renders a unified diff between two file contents. It returns an
+// empty string when the contents are identical.
+func UnifiedDiff(path, before, after string) string {
+	if before == after {
+		return ""
+	}
+
+	a := splitLines(before)
+	b := splitLines(after)
+	ops := diffLines(a, b)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", path, path)
+
+	// Group changed lines into hunks, merging groups whose gap fits in the context
+	var changed []int
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changed = append(changed, i)
+		}
+	}
+	for k := 0; k < len(changed); {
+		first, last := changed[k], changed[k]
+		for k++; k < len(changed) && changed[k]-last <= 2*diffContext+1; k++ {
+			last = changed[k]
+		}
+		start := first - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := last + diffContext + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		writeHunk(&sb, ops, start, end)
+	}
+
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, ops []diffOp, start, end int) {
+	aStart, bStart := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			aStart++
+		}
+		if op.kind != '-' {
+			bStart++
+		}
+	}
+
+	aLen, bLen := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			aLen++
+		}
+		if op.kind != '-' {
+			bLen++
+		}
+	}
+	if aLen == 0 {
+		aStart--
+	}
+	if bLen == 0 {
+		bStart--
+	}
+
+	fmt.Fprintf(sb, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+	for _, op := range ops[start:end] {
+		sb.WriteByte(op.kind)
+		sb.WriteString(op.line)
+		sb.WriteByte('\n')
+	}
+}
+
+// diffLines computes a line diff using a longest-common-subsequence table.
+// Config files touched by remediation are small, so the quadratic cost is fine.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
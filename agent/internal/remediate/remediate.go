@@ -0,0 +1,410 @@
+package remediate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/visiblaze/sec-agent/agent/internal/util"
+)
+
+const (
+	StatusApplied  = "applied"
+	StatusDryRun   = "dry_run"
+	StatusFailed   = "failed"
+	StatusPartial  = "partial"
+	StatusRestored = "rolled_back"
+
+	manifestFile = "manifest.json"
+	pendingFile  = "pending.json"
+)
+
+// Result is the outcome of one action. Results are queued on disk and sent
+// with the next ingest payload.
+type Result struct {
+	RunID       string   `json:"run_id"`
+	CheckID     string   `json:"check_id"`
+	Description string   `json:"description"`
+	Status      string   `json:"status"`
+	Files       []string `json:"files"`
+	Diff        string   `json:"diff,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	Timestamp   string   `json:"ts"`
+}
+
+// backup records the original state of a touched file so it can be restored.
+type backup struct {
+	Path    string      `json:"path"`
+	Existed bool        `json:"existed"`
+	Mode    os.FileMode `json:"mode"`
+	Copy    string      `json:"copy,omitempty"`
+}
+
+type manifest struct {
+	RunID            string     `json:"run_id"`
+	CreatedAt        string     `json:"created_at"`
+	Backups          []backup   `json:"backups"`
+	RollbackCommands [][]string `json:"rollback_commands,omitempty"`
+}
+
+// Remediator applies actions, keeping a backup of every file it touches under
+// backupDir/<run id>.
+type Remediator struct {
+	backupDir string
+	dryRun    bool
+	out       io.Writer
+}
+
+func New(backupDir string, dryRun bool, out io.Writer) *Remediator {
+	if out == nil {
+		out = io.Discard
+	}
+	return &Remediator{backupDir: backupDir, dryRun: dryRun, out: out}
+}
+
+// Apply runs the given actions in order. In dry-run mode nothing is written
+// and a unified diff of each planned edit is printed instead.
+func (r *Remediator) Apply(actions []*Action) []Result {
+	runID := time.Now().UTC().Format("20060102T150405Z")
+	for n := 2; util.FileExists(filepath.Join(r.backupDir, runID)); n++ {
+		runID = fmt.Sprintf("%s-%d", time.Now().UTC().Format("20060102T150405Z"), n)
+	}
+	runDir := filepath.Join(r.backupDir, runID)
+	m := &manifest{RunID: runID, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+
+	results := make([]Result, 0, len(actions))
+	for _, action := range actions {
+		res := Result{
+			RunID:       runID,
+			CheckID:     action.CheckID,
+			Description: action.Description,
+			Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		}
+
+		var diffs []string
+		for _, edit := range action.Edits {
+			res.Files = append(res.Files, edit.Path)
+			d, err := editDiff(edit)
+			if err != nil {
+				res.Error = err.Error()
+				break
+			}
+			if d != "" {
+				diffs = append(diffs, d)
+			}
+		}
+		res.Diff = strings.Join(diffs, "")
+
+		switch {
+		case res.Error != "":
+			res.Status = StatusFailed
+		case r.dryRun:
+			res.Status = StatusDryRun
+			fmt.Fprintf(r.out, "# %s: %s\n%s", action.CheckID, action.Description, res.Diff)
+		default:
+			r.applyAction(action, runDir, m, &res)
+		}
+
+		results = append(results, res)
+	}
+
+	if !r.dryRun && len(m.Backups) > 0 {
+		if err := writeJSON(filepath.Join(runDir, manifestFile), m); err != nil {
+			fmt.Fprintf(r.out, "failed to write rollback manifest: %v\n", err)
+		} else {
+			fmt.Fprintf(r.out, "backups saved to %s (rollback id %s)\n", runDir, runID)
+		}
+	}
+
+	return results
+}
+
+func (r *Remediator) applyAction(action *Action, runDir string, m *manifest, res *Result) {
+	first := len(m.Backups)
+	for _, edit := range action.Edits {
+		b, err := backupFile(runDir, edit.Path, len(m.Backups))
+		if err != nil {
+			res.Status = StatusFailed
+			res.Error = err.Error()
+			return
+		}
+		m.Backups = append(m.Backups, b)
+
+		if err := writeEdit(edit, b); err != nil {
+			res.Status = StatusFailed
+			res.Error = err.Error()
+			return
+		}
+	}
+	if err := validate(action.Validate); err != nil {
+		res.Status = StatusFailed
+		res.Error = err.Error()
+		if err := restoreAll(m.Backups[first:]); err != nil {
+			res.Error += "; restoring the original files failed: " + err.Error()
+			return
+		}
+		m.Backups = m.Backups[:first]
+		res.Status = StatusRestored
+		return
+	}
+	m.RollbackCommands = append(m.RollbackCommands, action.RollbackCommands...)
+
+	res.Status = StatusApplied
+	if err := runCommands(action.PostCommands); err != nil {
+		res.Status = StatusPartial
+		res.Error = err.Error()
+	}
+}
+
+// Rollback restores every file recorded in the manifest of runID and runs the
+// actions' rollback commands so services and the kernel pick up the original
+// configuration. The post commands are not replayed: they apply the fix.
+func (r *Remediator) Rollback(runID string) error {
+	runDir := filepath.Join(r.backupDir, runID)
+	data, err := os.ReadFile(filepath.Join(runDir, manifestFile))
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("parse manifest: %w", err)
+	}
+
+	// Restore in reverse so a file edited twice ends at its first backup
+	for i := len(m.Backups) - 1; i >= 0; i-- {
+		b := m.Backups[i]
+		if err := restore(b); err != nil {
+			return err
+		}
+		if b.Existed {
+			fmt.Fprintf(r.out, "restored %s\n", b.Path)
+		} else {
+			fmt.Fprintf(r.out, "removed %s\n", b.Path)
+		}
+	}
+
+	if err := runCommands(m.RollbackCommands); err != nil {
+		fmt.Fprintf(r.out, "rollback commands failed: %v\n", err)
+	}
+
+	return nil
+}
+
+// Runs lists the rollback ids available in the backup directory, oldest first.
+func (r *Remediator) Runs() ([]string, error) {
+	entries, err := os.ReadDir(r.backupDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if e.IsDir() && util.FileExists(filepath.Join(r.backupDir, e.Name(), manifestFile)) {
+			ids = append(ids, e.Name())
+		}
+	}
+	return ids, nil
+}
+
+// QueueResults appends results to the pending report file so the scheduler
+// can include them in the next payload.
+func QueueResults(backupDir string, results []Result) error {
+	if len(results) == 0 {
+		return nil
+	}
+	pending, err := PendingResults(backupDir)
+	if err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(backupDir, pendingFile), append(pending, results...))
+}
+
+// PendingResults returns results that have not yet been reported.
+func PendingResults(backupDir string) ([]Result, error) {
+	data, err := os.ReadFile(filepath.Join(backupDir, pendingFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("parse pending results: %w", err)
+	}
+	return results, nil
+}
+
+// ClearPending drops the pending report file after a successful send.
+func ClearPending(backupDir string) error {
+	err := os.Remove(filepath.Join(backupDir, pendingFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func editDiff(edit FileEdit) (string, error) {
+	before, err := readOptional(edit.Path)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if !edit.KeepContent {
+		sb.WriteString(UnifiedDiff(edit.Path, before, edit.Content))
+	}
+	if edit.Mode != 0 {
+		if info, err := os.Stat(edit.Path); err == nil && info.Mode().Perm() != edit.Mode.Perm() {
+			fmt.Fprintf(&sb, "mode %s: %04o -> %04o\n", edit.Path, info.Mode().Perm(), edit.Mode.Perm())
+		}
+	}
+	return sb.String(), nil
+}
+
+func backupFile(runDir, path string, seq int) (backup, error) {
+	b := backup{Path: path}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return b, fmt.Errorf("stat %s: %w", path, err)
+	}
+
+	b.Existed = true
+	b.Mode = info.Mode().Perm()
+	b.Copy = filepath.Join(runDir, fmt.Sprintf("%03d_%s", seq, filepath.Base(path)))
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return b, fmt.Errorf("read %s: %w", path, err)
+	}
+	if err := os.MkdirAll(runDir, 0700); err != nil {
+		return b, fmt.Errorf("create backup dir: %w", err)
+	}
+	if err := os.WriteFile(b.Copy, content, 0600); err != nil {
+		return b, fmt.Errorf("backup %s: %w", path, err)
+	}
+	return b, nil
+}
+
+func writeEdit(edit FileEdit, b backup) error {
+	mode := edit.Mode
+	if mode == 0 {
+		mode = b.Mode
+	}
+	if mode == 0 {
+		mode = 0644
+	}
+
+	if !edit.KeepContent {
+		if err := os.MkdirAll(filepath.Dir(edit.Path), 0755); err != nil {
+			return fmt.Errorf("create dir for %s: %w", edit.Path, err)
+		}
+		tmp := edit.Path + ".visiblaze-tmp"
+		if err := os.WriteFile(tmp, []byte(edit.Content), mode); err != nil {
+			return fmt.Errorf("write %s: %w", edit.Path, err)
+		}
+		if err := os.Rename(tmp, edit.Path); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("replace %s: %w", edit.Path, err)
+		}
+	}
+
+	if err := os.Chmod(edit.Path, mode); err != nil {
+		return fmt.Errorf("chmod %s: %w", edit.Path, err)
+	}
+	return nil
+}
+
+// restore puts back the file recorded in b, removing it if it did not exist.
+func restore(b backup) error {
+	if !b.Existed {
+		if err := os.Remove(b.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s: %w", b.Path, err)
+		}
+		return nil
+	}
+	content, err := os.ReadFile(b.Copy)
+	if err != nil {
+		return fmt.Errorf("read backup of %s: %w", b.Path, err)
+	}
+	if err := os.WriteFile(b.Path, content, b.Mode); err != nil {
+		return fmt.Errorf("restore %s: %w", b.Path, err)
+	}
+	if err := os.Chmod(b.Path, b.Mode); err != nil {
+		return fmt.Errorf("chmod %s: %w", b.Path, err)
+	}
+	return nil
+}
+
+// restoreAll restores backups in reverse order.
+func restoreAll(backups []backup) error {
+	for i := len(backups) - 1; i >= 0; i-- {
+		if err := restore(backups[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate runs the checks of an action's edited configuration. Unlike post
+// commands, a check that is not installed fails: the edit cannot be
+// trusted without it.
+func validate(cmds [][]string) error {
+	for _, c := range cmds {
+		if len(c) == 0 {
+			continue
+		}
+		if !util.CmdExists(c[0]) {
+			return fmt.Errorf("%s: not found, cannot validate the new configuration", c[0])
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), postCommandTimeout)
+		out, err := util.RunCmd(ctx, c[0], c[1:]...)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %v: %s", strings.Join(c, " "), err, strings.TrimSpace(out))
+		}
+	}
+	return nil
+}
+
+// postCommandTimeout bounds each post command. Commands run after files are
+// already edited, so they are not tied to the caller's cancellation: a
+// service reload interrupted halfway would leave it out of step with its
+// configuration.
+const postCommandTimeout = time.Minute
+
+func runCommands(cmds [][]string) error {
+	for _, c := range cmds {
+		if len(c) == 0 || !util.CmdExists(c[0]) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), postCommandTimeout)
+		out, err := util.RunCmd(ctx, c[0], c[1:]...)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %v: %s", strings.Join(c, " "), err, strings.TrimSpace(out))
+		}
+	}
+	return nil
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
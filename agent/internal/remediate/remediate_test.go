@@ -0,0 +1,224 @@
+package remediate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	before := "a\nb\nPermitRootLogin yes\nc\n"
+	after := "a\nb\nPermitRootLogin no\nc\n"
+
+	diff := UnifiedDiff("/etc/ssh/sshd_config", before, after)
+	want := "--- /etc/ssh/sshd_config\n+++ /etc/ssh/sshd_config\n" +
+		"@@ -1,4 +1,4 @@\n a\n b\n-PermitRootLogin yes\n+PermitRootLogin no\n c\n"
+	if diff != want {
+		t.Fatalf("unexpected diff:\n%s", diff)
+	}
+	if UnifiedDiff("x", before, before) != "" {
+		t.Fatal("identical content should produce no diff")
+	}
+}
+
+func TestSetDirectiveIn(t *testing.T) {
+	content := "#PermitRootLogin yes\nPermitRootLogin yes\nPort 22\npermitrootlogin prohibit-password\n"
+	got := SetDirectiveIn(content, "PermitRootLogin", " ", "no")
+	want := "#PermitRootLogin yes\nPermitRootLogin no\nPort 22\n# permitrootlogin prohibit-password\n"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	got = SetDirectiveIn("Port 22\n", "PermitRootLogin", " ", "no")
+	if got != "Port 22\nPermitRootLogin no\n" {
+		t.Fatalf("directive not appended: %q", got)
+	}
+}
+
+func TestSetSSHDirectiveIn(t *testing.T) {
+	content := "Include /etc/ssh/sshd_config.d/*.conf\nPort 22\nMatch User backup\n  PermitRootLogin yes\n"
+	got := SetSSHDirectiveIn(content, "PermitRootLogin", "no")
+	want := "Include /etc/ssh/sshd_config.d/*.conf\nPort 22\nPermitRootLogin no\nMatch User backup\n  PermitRootLogin yes\n"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	content = "PermitRootLogin yes\nPermitRootLogin=no\nMatch all\nPermitRootLogin yes\n"
+	got = SetSSHDirectiveIn(content, "PermitRootLogin", "no")
+	want = "PermitRootLogin no\n# PermitRootLogin=no\nMatch all\nPermitRootLogin yes\n"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestValidateFailureRestores(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sshd_config")
+	if err := os.WriteFile(path, []byte("PermitRootLogin yes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	edit, err := SetSSHDirective(path, "PermitRootLogin", "no")
+	if err != nil {
+		t.Fatal(err)
+	}
+	marker := filepath.Join(dir, "reloaded")
+	action := &Action{
+		CheckID:      "P3",
+		Edits:        []FileEdit{edit},
+		Validate:     [][]string{{"false"}},
+		PostCommands: [][]string{{"touch", marker}},
+	}
+
+	results := New(filepath.Join(dir, "backups"), false, nil).Apply([]*Action{action})
+	if results[0].Status != StatusRestored || results[0].Error == "" {
+		t.Fatalf("status %s, error %q", results[0].Status, results[0].Error)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "PermitRootLogin yes\n" {
+		t.Fatalf("file not restored: %q", data)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatal("post commands ran after a failed validation")
+	}
+}
+
+func TestApplyAndRollback(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "sshd_config")
+	created := filepath.Join(dir, "modprobe.conf")
+	if err := os.WriteFile(existing, []byte("PermitRootLogin yes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	edit, err := SetDirective(existing, "PermitRootLogin", " ", "no")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit.Mode = 0600
+	blacklist, err := EnsureLines(created, "blacklist cramfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := []*Action{{CheckID: "P3", Edits: []FileEdit{edit, blacklist}}}
+
+	backupDir := filepath.Join(dir, "backups")
+	var out strings.Builder
+	results := New(backupDir, true, &out).Apply(actions)
+	if results[0].Status != StatusDryRun || !strings.Contains(out.String(), "+PermitRootLogin no") {
+		t.Fatalf("dry run: status %s, output %q", results[0].Status, out.String())
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "PermitRootLogin yes\n" {
+		t.Fatal("dry run modified the file")
+	}
+
+	r := New(backupDir, false, nil)
+	results = r.Apply(actions)
+	if results[0].Status != StatusApplied {
+		t.Fatalf("apply: status %s, error %s", results[0].Status, results[0].Error)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "PermitRootLogin no\n" {
+		t.Fatalf("file not updated: %q", data)
+	}
+	if info, _ := os.Stat(existing); info.Mode().Perm() != 0600 {
+		t.Fatalf("mode not updated: %v", info.Mode())
+	}
+
+	if err := r.Rollback(results[0].RunID); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "PermitRootLogin yes\n" {
+		t.Fatalf("file not restored: %q", data)
+	}
+	if info, _ := os.Stat(existing); info.Mode().Perm() != 0644 {
+		t.Fatalf("mode not restored: %v", info.Mode())
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Fatal("created file should be removed on rollback")
+	}
+}
+
+func TestRollbackCommands(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sysctl.conf")
+	fixed, rolledBack := filepath.Join(dir, "fixed"), filepath.Join(dir, "rolled-back")
+	edit, err := EnsureLines(path, "net.ipv6.conf.all.disable_ipv6 = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	action := &Action{
+		CheckID:          "P12",
+		Edits:            []FileEdit{edit},
+		PostCommands:     [][]string{{"touch", fixed}},
+		RollbackCommands: [][]string{{"touch", rolledBack}},
+	}
+
+	r := New(filepath.Join(dir, "backups"), false, nil)
+	results := r.Apply([]*Action{action})
+	if results[0].Status != StatusApplied {
+		t.Fatalf("apply: status %s, error %s", results[0].Status, results[0].Error)
+	}
+	if _, err := os.Stat(rolledBack); !os.IsNotExist(err) {
+		t.Fatal("rollback commands ran on apply")
+	}
+	if err := os.Remove(fixed); err != nil {
+		t.Fatalf("post commands did not run: %v", err)
+	}
+
+	if err := r.Rollback(results[0].RunID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(rolledBack); err != nil {
+		t.Fatalf("rollback commands did not run: %v", err)
+	}
+	if _, err := os.Stat(fixed); !os.IsNotExist(err) {
+		t.Fatal("post commands replayed on rollback")
+	}
+}
+
+func TestSysctlRollsBackRunningValues(t *testing.T) {
+	procSys = t.TempDir()
+	defer func() { procSys = "/proc/sys" }()
+	if err := os.MkdirAll(filepath.Join(procSys, "net/ipv6/conf/all"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procSys, "net/ipv6/conf/all/disable_ipv6"), []byte("0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	action, err := Sysctl("P12", map[string]string{
+		"net.ipv6.conf.all.disable_ipv6":     "1",
+		"net.ipv6.conf.default.disable_ipv6": "1",
+	}, "net.ipv6.conf.all.disable_ipv6", "net.ipv6.conf.default.disable_ipv6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(action.PostCommands) != 2 {
+		t.Fatalf("post commands = %q", action.PostCommands)
+	}
+	// default cannot be read, so it has no rollback command
+	want := [][]string{{"sysctl", "-w", "net.ipv6.conf.all.disable_ipv6=0"}}
+	if fmt.Sprint(action.RollbackCommands) != fmt.Sprint(want) {
+		t.Fatalf("rollback commands = %q, want %q", action.RollbackCommands, want)
+	}
+}
+
+func TestPendingResults(t *testing.T) {
+	dir := t.TempDir()
+	if err := QueueResults(dir, []Result{{CheckID: "P3"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := QueueResults(dir, []Result{{CheckID: "P4"}}); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := PendingResults(dir)
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("pending = %v, %v", pending, err)
+	}
+	if err := ClearPending(dir); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := PendingResults(dir); len(pending) != 0 {
+		t.Fatal("pending results not cleared")
+	}
+}
@@ -0,0 +1,141 @@
+// Package remoteconfig applies policies pushed by the backend over the local
+// config file. The last accepted policy is persisted in the state directory
+// so it survives restarts and an older signed document cannot be replayed.
+package remoteconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/visiblaze/sec-agent/agent/internal/config"
+	"github.com/visiblaze/sec-agent/pkg/policy"
+)
+
+const fileName = "policy.json"
+
+// ErrDisabled is returned when no remote_policy.public_key is configured.
+var ErrDisabled = errors.New("remote policy is disabled: no public key configured")
+
+// Load applies the persisted policy over base. It returns base unchanged and
+// a nil document when remote policy is disabled or none has been stored.
+func Load(base *config.Config) (*config.Config, *policy.Document, error) {
+	if base.RemotePolicy.PublicKey == "" {
+		return base, nil, nil
+	}
+	signed, err := readSigned(base.StateDir)
+	if err != nil || signed == nil {
+		return base, nil, err
+	}
+	doc, err := verify(base, signed)
+	if err != nil {
+		return base, nil, err
+	}
+	merged, err := base.WithPolicy(&doc.Policy)
+	if err != nil {
+		return base, nil, err
+	}
+	return merged, doc, nil
+}
+
+// Apply verifies signed for hostID, merges it over base and persists it. The
+// returned document is nil when signed carries the same policy version that
+// is already stored, in which case nothing changes.
+func Apply(base *config.Config, signed *policy.Signed, hostID string) (*config.Config, *policy.Document, error) {
+	if base.RemotePolicy.PublicKey == "" {
+		return nil, nil, ErrDisabled
+	}
+	doc, err := verify(base, signed)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc.HostID != hostID {
+		return nil, nil, fmt.Errorf("policy was issued for host %s, not %s", doc.HostID, hostID)
+	}
+
+	if stored, err := readSigned(base.StateDir); err == nil && stored != nil {
+		if prev, err := verify(base, stored); err == nil {
+			if issuedAt(doc).Before(issuedAt(prev)) {
+				return nil, nil, fmt.Errorf("policy issued at %s is older than the applied one (%s)", doc.IssuedAt, prev.IssuedAt)
+			}
+			if prev.Policy.ID == doc.Policy.ID && prev.Policy.Version == doc.Policy.Version {
+				return nil, nil, nil
+			}
+		}
+	}
+
+	merged, err := base.WithPolicy(&doc.Policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeSigned(base.StateDir, signed); err != nil {
+		return nil, nil, err
+	}
+	return merged, doc, nil
+}
+
+func verify(cfg *config.Config, signed *policy.Signed) (*policy.Document, error) {
+	pub, err := policy.ParsePublicKey(cfg.RemotePolicy.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := signed.Verify(pub)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Policy.Validate(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func issuedAt(doc *policy.Document) time.Time {
+	t, _ := time.Parse(time.RFC3339, doc.IssuedAt)
+	return t
+}
+
+func readSigned(stateDir string) (*policy.Signed, error) {
+	b, err := os.ReadFile(filepath.Join(stateDir, fileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+	var signed policy.Signed
+	if err := json.Unmarshal(b, &signed); err != nil {
+		return nil, fmt.Errorf("parse stored policy: %w", err)
+	}
+	return &signed, nil
+}
+
+// writeSigned replaces the stored policy atomically. It is written compact:
+// indenting would reformat the signed document and break its signature.
+func writeSigned(stateDir string, signed *policy.Signed) error {
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	b, err := json.Marshal(signed)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(stateDir, ".policy-*")
+	if err != nil {
+		return fmt.Errorf("write policy: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write policy: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write policy: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(stateDir, fileName)); err != nil {
+		return fmt.Errorf("write policy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package remoteconfig
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/visiblaze/sec-agent/agent/internal/config"
+	"github.com/visiblaze/sec-agent/pkg/policy"
+)
+
+func testConfig(t *testing.T, pub ed25519.PublicKey) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	yaml := "api_base_url: https://api.example.com\napi_key: k\nstate_dir: " + dir + "\n" +
+		"remote_policy:\n  public_key: " + base64.StdEncoding.EncodeToString(pub) + "\n"
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestApplyAndLoad(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	base := testConfig(t, pub)
+	now := time.Now()
+
+	p := policy.Policy{ID: "prod", Version: 1, CollectionIntervalMinutes: 5, Profile: "level1-server", LogLevel: "debug"}
+	signed, _ := policy.Sign(priv, p, "h1", now)
+	merged, doc, err := Apply(base, signed, "h1")
+	if err != nil || doc == nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if merged.CollectionIntervalMinutes != 5 || merged.Checks.Profile != "level1-server" || merged.LogLevel != "debug" {
+		t.Errorf("merged = %+v", merged)
+	}
+	if base.CollectionIntervalMinutes != 15 {
+		t.Errorf("base config modified")
+	}
+
+	// The same version again is not a change
+	again, _ := policy.Sign(priv, p, "h1", now.Add(time.Minute))
+	if _, doc, err := Apply(base, again, "h1"); err != nil || doc != nil {
+		t.Errorf("unchanged policy: doc=%v err=%v", doc, err)
+	}
+
+	loaded, doc, err := Load(base)
+	if err != nil || doc == nil || loaded.CollectionIntervalMinutes != 5 {
+		t.Fatalf("Load: %v %v", doc, err)
+	}
+}
+
+func TestApplyRejects(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	base := testConfig(t, pub)
+	now := time.Now()
+
+	current, _ := policy.Sign(priv, policy.Policy{ID: "prod", Version: 2}, "h1", now)
+	if _, _, err := Apply(base, current, "h1"); err != nil {
+		t.Fatal(err)
+	}
+
+	older, _ := policy.Sign(priv, policy.Policy{ID: "prod", Version: 1}, "h1", now.Add(-time.Hour))
+	if _, _, err := Apply(base, older, "h1"); err == nil {
+		t.Error("older policy applied")
+	}
+
+	other, _ := policy.Sign(priv, policy.Policy{ID: "prod", Version: 3}, "h2", now)
+	if _, _, err := Apply(base, other, "h1"); err == nil {
+		t.Error("policy for another host applied")
+	}
+
+	_, wrongKey, _ := ed25519.GenerateKey(nil)
+	forged, _ := policy.Sign(wrongKey, policy.Policy{ID: "prod", Version: 4}, "h1", now)
+	if _, _, err := Apply(base, forged, "h1"); err == nil {
+		t.Error("policy signed with another key applied")
+	}
+
+	invalid, _ := policy.Sign(priv, policy.Policy{ID: "prod", Version: 5, EnabledChecks: []string{"P99"}}, "h1", now)
+	if _, _, err := Apply(base, invalid, "h1"); err == nil {
+		t.Error("policy with unknown check applied")
+	}
+}
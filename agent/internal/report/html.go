@@ -0,0 +1,75 @@
+package report
+
+import (
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/visiblaze/sec-agent/agent/internal/ingest"
+)
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"evidence": evidenceLines,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>CIS report: {{.Host.Hostname}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #1f2933; }
+h1 { margin-bottom: 0.2em; }
+.meta { color: #52606d; margin-bottom: 1.5em; }
+.summary span { display: inline-block; padding: 0.4em 0.8em; margin-right: 0.5em; border-radius: 4px; font-weight: 600; }
+table { border-collapse: collapse; width: 100%; margin-top: 1.5em; }
+th, td { text-align: left; padding: 0.5em; border-bottom: 1px solid #e4e7eb; vertical-align: top; }
+pre { margin: 0; white-space: pre-wrap; font-size: 0.85em; }
+.pass { background: #e3f9e5; color: #207227; }
+.fail { background: #ffe3e3; color: #a61b1b; }
+.manual, .other { background: #fff3c4; color: #8d2b0b; }
+</style>
+</head>
+<body>
+<h1>CIS compliance report</h1>
+<div class="meta">
+{{.Host.Hostname}} ({{.Host.HostID}}) &middot; {{.Host.OSID}} {{.Host.OSVersion}} &middot; kernel {{.Host.Kernel}} &middot; agent {{.Host.AgentVersion}}<br>
+{{len .Packages}} packages &middot; generated {{.Generated}}
+</div>
+<div class="summary">
+<span class="pass">{{.Summary.Pass}} pass</span>
+<span class="fail">{{.Summary.Fail}} fail</span>
+<span class="manual">{{.Summary.Manual}} manual</span>
+<span>score {{.Summary.Score}}%</span>
+</div>
+<table>
+<tr><th>Check</th><th>Title</th><th>Status</th><th>Evidence</th><th>Checked</th></tr>
+{{range .CISResults}}<tr>
+<td>{{.CheckID}}</td>
+<td>{{.Title}}</td>
+<td><span class="{{.Status}}">{{.Status}}</span></td>
+<td><pre>{{range evidence .Evidence}}{{.}}
+{{end}}</pre></td>
+<td>{{.Timestamp}}</td>
+</tr>
+{{end}}</table>
+{{if .Remediations}}<h2>Remediation</h2>
+<table>
+<tr><th>Check</th><th>Status</th><th>Description</th><th>Files</th><th>Error</th></tr>
+{{range .Remediations}}<tr><td>{{.CheckID}}</td><td>{{.Status}}</td><td>{{.Description}}</td><td>{{range .Files}}{{.}}<br>{{end}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// HTML renders a standalone report with inline styles, suitable for
+// attaching to a ticket.
+func HTML(w io.Writer, p *ingest.Payload) error {
+	return htmlTemplate.Execute(w, struct {
+		*ingest.Payload
+		Summary   Summary
+		Generated string
+	}{
+		Payload:   p,
+		Summary:   Summarize(p.CISResults),
+		Generated: time.Now().UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,109 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/visiblaze/sec-agent/agent/internal/ingest"
+)
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Hostname   string          `xml:"hostname,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// JUnit renders CIS results as JUnit XML so CI pipelines can fail a build on
+// compliance regressions. Failed checks are failures, manual checks are
+// skipped and any other status is an error.
+func JUnit(w io.Writer, p *ingest.Payload) error {
+	suite := junitSuite{
+		Name:     "cis." + p.Host.Hostname,
+		Hostname: p.Host.Hostname,
+		Properties: []junitProperty{
+			{Name: "host_id", Value: p.Host.HostID},
+			{Name: "os", Value: p.Host.OSID + " " + p.Host.OSVersion},
+			{Name: "agent_version", Value: p.Host.AgentVersion},
+		},
+	}
+
+	for _, r := range p.CISResults {
+		evidence := strings.Join(evidenceLines(r.Evidence), "\n")
+		tc := junitCase{
+			Name:      fmt.Sprintf("%s %s", r.CheckID, r.Title),
+			Classname: "cis." + r.CheckID,
+			SystemOut: evidence,
+		}
+		switch r.Status {
+		case "pass":
+		case "fail":
+			tc.Failure = &junitMessage{Message: r.Title + " failed", Type: "cis", Body: evidence}
+			suite.Failures++
+		case "manual":
+			tc.Skipped = &junitMessage{Message: "manual review required"}
+			suite.Skipped++
+		default:
+			tc.Error = &junitMessage{Message: "check status " + r.Status, Type: r.Status, Body: evidence}
+			suite.Errors++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Tests = len(suite.Cases)
+
+	doc := junitSuites{
+		Name:     "visiblaze-cis",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Skipped:  suite.Skipped,
+		Suites:   []junitSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
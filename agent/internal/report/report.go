@@ -0,0 +1,120 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/visiblaze/sec-agent/agent/internal/cis"
+	"github.com/visiblaze/sec-agent/agent/internal/ingest"
+)
+
+// Formats lists the supported report formats in the order shown to users.
+var Formats = []string{"table", "html", "junit", "sarif", "json", "cyclonedx", "spdx"}
+
+// Render writes p to w in the given format.
+func Render(w io.Writer, format string, p *ingest.Payload) error {
+	switch format {
+	case "table":
+		return Table(w, p)
+	case "html":
+		return HTML(w, p)
+	case "junit":
+		return JUnit(w, p)
+	case "sarif":
+		return SARIF(w, p)
+	case "cyclonedx", "spdx":
+		return SBOM(w, format, p)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	default:
+		return fmt.Errorf("unsupported format %q (want %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+// Load reads a saved payload, such as the output of `collect -output json`
+// or a file written by the mock server. An API Gateway style envelope with
+// the payload in a string "body" field is unwrapped.
+func Load(path string) (*ingest.Payload, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read payload: %w", err)
+	}
+
+	var envelope struct {
+		Host json.RawMessage `json:"host"`
+		Body string          `json:"body"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("parse payload: %w", err)
+	}
+	if envelope.Host == nil && strings.HasPrefix(strings.TrimSpace(envelope.Body), "{") {
+		data = []byte(envelope.Body)
+	}
+
+	var p ingest.Payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse payload: %w", err)
+	}
+	if p.Host == nil {
+		return nil, fmt.Errorf("parse payload: %s has no host section", path)
+	}
+	return &p, nil
+}
+
+// Summary counts check results by status.
+type Summary struct {
+	Total  int
+	Pass   int
+	Fail   int
+	Manual int
+	Other  int
+}
+
+// Score is the percentage of decided checks that passed.
+func (s Summary) Score() int {
+	decided := s.Pass + s.Fail
+	if decided == 0 {
+		return 0
+	}
+	return s.Pass * 100 / decided
+}
+
+func Summarize(results []*cis.CheckResult) Summary {
+	var s Summary
+	for _, r := range results {
+		s.Total++
+		switch r.Status {
+		case "pass":
+			s.Pass++
+		case "fail":
+			s.Fail++
+		case "manual":
+			s.Manual++
+		default:
+			s.Other++
+		}
+	}
+	return s
+}
+
+// evidenceLines flattens evidence into sorted "key: value" lines.
+func evidenceLines(evidence map[string]interface{}) []string {
+	keys := make([]string, 0, len(evidence))
+	for k := range evidence {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := strings.TrimSpace(fmt.Sprint(evidence[k]))
+		lines = append(lines, fmt.Sprintf("%s: %s", k, v))
+	}
+	return lines
+}
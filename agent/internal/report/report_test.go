@@ -0,0 +1,99 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/visiblaze/sec-agent/agent/internal/cis"
+	"github.com/visiblaze/sec-agent/agent/internal/collect"
+	"github.com/visiblaze/sec-agent/agent/internal/ingest"
+)
+
+func samplePayload() *ingest.Payload {
+	return &ingest.Payload{
+		Host: &collect.HostInfo{HostID: "h1", Hostname: "web-1", OSID: "ubuntu", OSVersion: "22.04", AgentVersion: "0.1.0"},
+		CISResults: []*cis.CheckResult{
+			{CheckID: "P1", Title: "Password complexity enforced", Status: "pass", Evidence: map[string]interface{}{}},
+			{CheckID: "P3", Title: "Root login over SSH disabled", Status: "fail", Evidence: map[string]interface{}{"PermitRootLogin": "PermitRootLogin yes"}},
+			{CheckID: "P13", Title: "SSH authorized_keys", Status: "manual", Evidence: map[string]interface{}{"path": "/root/.ssh/authorized_keys"}},
+		},
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := JUnit(&buf, samplePayload()); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc junitSuites
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid XML: %v", err)
+	}
+	if doc.Tests != 3 || doc.Failures != 1 || doc.Skipped != 1 || doc.Errors != 0 {
+		t.Fatalf("unexpected counts: %+v", doc)
+	}
+	if !strings.Contains(buf.String(), "PermitRootLogin yes") {
+		t.Fatal("failure should include evidence")
+	}
+}
+
+func TestSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := SARIF(&buf, samplePayload()); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	results := log.Runs[0].Results
+	if len(results) != 3 || len(log.Runs[0].Tool.Driver.Rules) != 3 {
+		t.Fatalf("expected 3 results and rules, got %d and %d", len(results), len(log.Runs[0].Tool.Driver.Rules))
+	}
+	if results[1].Kind != "fail" || results[1].Level != "error" {
+		t.Fatalf("failed check: kind %s level %s", results[1].Kind, results[1].Level)
+	}
+	if results[2].Level != "none" || len(results[2].Locations) != 1 {
+		t.Fatalf("manual check: level %s locations %v", results[2].Level, results[2].Locations)
+	}
+}
+
+func TestHTMLEscapesEvidence(t *testing.T) {
+	p := samplePayload()
+	p.CISResults[1].Evidence["line"] = "<script>alert(1)</script>"
+
+	var buf bytes.Buffer
+	if err := HTML(&buf, p); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "<script>") {
+		t.Fatal("evidence must be escaped")
+	}
+	if !strings.Contains(buf.String(), "1 fail") {
+		t.Fatal("summary missing")
+	}
+}
+
+func TestLoadUnwrapsEnvelope(t *testing.T) {
+	body, _ := json.Marshal(samplePayload())
+	envelope, _ := json.Marshal(map[string]string{"path": "/ingest", "body": string(body)})
+	path := filepath.Join(t.TempDir(), "payload.json")
+	if err := os.WriteFile(path, envelope, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Host.HostID != "h1" || len(p.CISResults) != 3 {
+		t.Fatalf("unexpected payload: %+v", p)
+	}
+}
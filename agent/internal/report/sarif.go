@@ -0,0 +1,133 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/visiblaze/sec-agent/agent/internal/ingest"
+)
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool              `json:"tool"`
+	Results    []sarifResult          `json:"results"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string                 `json:"ruleId"`
+	RuleIndex  int                    `json:"ruleIndex"`
+	Kind       string                 `json:"kind"`
+	Level      string                 `json:"level"`
+	Message    sarifMessage           `json:"message"`
+	Locations  []sarifLocation        `json:"locations,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// SARIF renders CIS results as a SARIF 2.1.0 log. Every check is a rule;
+// passing checks are reported with kind "pass" so viewers can show coverage.
+// The spec requires level "none" for any kind other than "fail".
+func SARIF(w io.Writer, p *ingest.Payload) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "visiblaze-agent",
+			Version:        p.Host.AgentVersion,
+			InformationURI: "https://visiblaze.io",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+		Properties: map[string]interface{}{
+			"host_id":    p.Host.HostID,
+			"hostname":   p.Host.Hostname,
+			"os_id":      p.Host.OSID,
+			"os_version": p.Host.OSVersion,
+		},
+	}
+
+	for i, r := range p.CISResults {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               r.CheckID,
+			Name:             r.Title,
+			ShortDescription: sarifMessage{Text: r.Title},
+		})
+
+		res := sarifResult{
+			RuleID:     r.CheckID,
+			RuleIndex:  i,
+			Message:    sarifMessage{Text: r.Title + ": " + r.Status},
+			Properties: map[string]interface{}{"evidence": r.Evidence, "ts": r.Timestamp},
+		}
+		switch r.Status {
+		case "pass":
+			res.Kind, res.Level = "pass", "none"
+		case "fail":
+			res.Kind, res.Level = "fail", "error"
+		case "manual":
+			res.Kind, res.Level = "review", "none"
+		default:
+			res.Kind, res.Level = "fail", "warning"
+		}
+		if uri := evidencePath(r.Evidence); uri != "" {
+			res.Locations = []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: "file://" + uri},
+			}}}
+		}
+		run.Results = append(run.Results, res)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}})
+}
+
+// evidencePath picks a file path out of check evidence to use as the SARIF
+// location, preferring well-known keys.
+func evidencePath(evidence map[string]interface{}) string {
+	for _, key := range []string{"path", "config", "ssh_config", "authorized_keys_path"} {
+		if s, ok := evidence[key].(string); ok && strings.HasPrefix(s, "/") {
+			return s
+		}
+	}
+	return ""
+}
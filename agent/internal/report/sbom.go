@@ -0,0 +1,35 @@
+package report
+
+import (
+	"io"
+
+	"github.com/visiblaze/sec-agent/agent/internal/ingest"
+	"github.com/visiblaze/sec-agent/pkg/sbom"
+)
+
+// SBOM renders the package inventory as a CycloneDX or SPDX document.
+func SBOM(w io.Writer, format string, p *ingest.Payload) error {
+	subject := sbom.Subject{
+		HostID:    p.Host.HostID,
+		Hostname:  p.Host.Hostname,
+		OSID:      p.Host.OSID,
+		OSVersion: p.Host.OSVersion,
+	}
+	components := make([]sbom.Component, 0, len(p.Packages))
+	for _, pkg := range p.Packages {
+		components = append(components, sbom.Component{
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			Arch:    pkg.Arch,
+			Manager: pkg.Manager,
+			Source:  pkg.Source,
+		})
+	}
+
+	data, err := sbom.Generate(format, subject, components, p.Host.AgentVersion)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
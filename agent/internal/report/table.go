@@ -0,0 +1,40 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/visiblaze/sec-agent/agent/internal/ingest"
+)
+
+// Table renders a plain-text summary for terminals.
+func Table(w io.Writer, p *ingest.Payload) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Host ID:\t%s\n", p.Host.HostID)
+	fmt.Fprintf(tw, "Hostname:\t%s\n", p.Host.Hostname)
+	fmt.Fprintf(tw, "OS:\t%s %s\n", p.Host.OSID, p.Host.OSVersion)
+	fmt.Fprintf(tw, "Kernel:\t%s\n", p.Host.Kernel)
+	fmt.Fprintf(tw, "IPs:\t%s\n", strings.Join(p.Host.IPAddresses, ", "))
+	fmt.Fprintf(tw, "Packages:\t%d\n", len(p.Packages))
+	if p.Containers != nil {
+		fmt.Fprintf(tw, "Containers:\t%d running, %d images\n", len(p.Containers.Containers), len(p.Containers.Images))
+	}
+
+	s := Summarize(p.CISResults)
+	fmt.Fprintf(tw, "CIS:\t%d pass, %d fail, %d manual (score %d%%)\n\n", s.Pass, s.Fail, s.Manual, s.Score())
+
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tTITLE")
+	for _, r := range p.CISResults {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.CheckID, strings.ToUpper(r.Status), r.Title)
+	}
+
+	if len(p.Remediations) > 0 {
+		fmt.Fprintln(tw, "\nREMEDIATION\tSTATUS\tDESCRIPTION")
+		for _, r := range p.Remediations {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.CheckID, r.Status, r.Description)
+		}
+	}
+	return tw.Flush()
+}
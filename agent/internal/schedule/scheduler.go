@@ -1,80 +1,418 @@
 package schedule
 
 import (
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/visiblaze/sec-agent/agent/internal/cis"
-	"github.com/visiblaze/sec-agent/agent/internal/collect"
 	"github.com/visiblaze/sec-agent/agent/internal/config"
 	"github.com/visiblaze/sec-agent/agent/internal/ingest"
 	"github.com/visiblaze/sec-agent/agent/internal/logging"
+	"github.com/visiblaze/sec-agent/agent/internal/remediate"
+	"github.com/visiblaze/sec-agent/agent/internal/remoteconfig"
+	"github.com/visiblaze/sec-agent/agent/internal/status"
+	"github.com/visiblaze/sec-agent/pkg/policy"
 )
 
 type Scheduler struct {
-	cfg    *config.Config
-	logger *logging.Logger
-	ticker *time.Ticker
-	done   chan struct{}
+	// mu guards base, cfg and changed. base is the local config file; cfg is
+	// base with the remote policy, if any, merged over it. changed is closed
+	// and replaced whenever cfg changes so task loops reschedule.
+	mu      sync.RWMutex
+	base    *config.Config
+	cfg     *config.Config
+	changed chan struct{}
+
+	logger  *logging.Logger
+	version string
+	started time.Time
+	// ctx is cancelled by Stop to interrupt runs in progress
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopOnce sync.Once
+	// wg counts the task loops, so Stop can wait for runs to wind down
+	wg       sync.WaitGroup
+	statusMu sync.Mutex
+	enrollMu sync.Mutex
 }
 
-func New(cfg *config.Config, logger *logging.Logger) *Scheduler {
-	return &Scheduler{
-		cfg:    cfg,
-		logger: logger,
-		done:   make(chan struct{}),
+func New(cfg *config.Config, logger *logging.Logger, version string) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		ctx:     ctx,
+		cancel:  cancel,
+		base:    cfg,
+		cfg:     cfg,
+		changed: make(chan struct{}),
+		logger:  logger,
+		version: version,
+		started: time.Now(),
+		done:    make(chan struct{}),
 	}
+	s.cfg = s.withStoredPolicy(cfg)
+	s.setLogLevel()
+	return s
 }
 
-func (s *Scheduler) RunOnce() error {
-	return s.collect()
+// withStoredPolicy merges the persisted remote policy, if any, over base.
+func (s *Scheduler) withStoredPolicy(base *config.Config) *config.Config {
+	merged, doc, err := remoteconfig.Load(base)
+	if err != nil {
+		s.logger.Warnf("Ignoring stored policy: %v", err)
+		return base
+	}
+	if doc != nil {
+		s.logger.Infof("Using policy %s v%d", doc.Policy.ID, doc.Policy.Version)
+	}
+	return merged
 }
 
-func (s *Scheduler) Start() {
-	s.ticker = time.NewTicker(time.Duration(s.cfg.CollectionIntervalMinutes) * time.Minute)
-	defer s.ticker.Stop()
+// RunOnce collects everything and sends it as a single payload.
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	start := time.Now()
+	cfg, _ := s.snapshot()
+	err := s.collectAndSend(ctx, cfg)
+	s.recordStatus(cfg, "", start, err)
+	return err
+}
 
-	if err := s.collect(); err != nil {
-		s.logger.Errorf("Initial collection failed: %v", err)
+// Start runs every enabled task on its own schedule until Stop is called.
+// Tasks run in separate goroutines so a slow one, such as a filesystem walk,
+// does not delay the others.
+func (s *Scheduler) Start() {
+	cfg, _ := s.snapshot()
+	for _, t := range s.tasks() {
+		var splay time.Duration
+		if cfg.SplaySeconds > 0 {
+			splay = time.Duration(rand.Int63n(int64(cfg.SplaySeconds) * int64(time.Second)))
+		}
+		s.logger.Infof("Task %s: %s", t.name, describeSchedule(cfg, t.name, splay))
+		s.wg.Add(1)
+		go s.loop(t, splay)
 	}
+	<-s.done
+	s.wg.Wait()
+}
+
+// Stop cancels runs in progress, stops the task loops and waits for them to
+// return, so a run interrupted by the cancellation still records its status
+// and the signer's sequence before the process exits. It may be called more
+// than once.
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		close(s.done)
+	})
+	s.wg.Wait()
+}
 
+// loop runs one task whenever its schedule comes due, recomputing the next
+// run when the config changes. Each run is cancelled after the task's
+// timeout, or when the scheduler stops.
+func (s *Scheduler) loop(t task, splay time.Duration) {
+	defer s.wg.Done()
+	start := time.Now()
+	var last time.Time
 	for {
+		cfg, changed := s.snapshot()
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if at, enabled := nextRun(cfg, t.name, start, last, splay); enabled {
+			timer = time.NewTimer(time.Until(at))
+			fire = timer.C
+			s.updateTask(cfg, t.name, func(ts *status.Task) { ts.NextRun = at.UTC().Format(time.RFC3339) })
+		}
+
 		select {
-		case <-s.ticker.C:
-			if err := s.collect(); err != nil {
-				s.logger.Errorf("Scheduled collection failed: %v", err)
+		case <-fire:
+			last = time.Now()
+			cfg, _ := s.snapshot()
+			ctx, cancel := context.WithTimeout(s.ctx, taskTimeout(cfg, t.name))
+			err := t.run(ctx, cfg)
+			cancel()
+			if err != nil {
+				s.logger.Errorf("Task %s failed: %v", t.name, err)
+			} else {
+				s.logger.Debugf("Task %s complete in %s", t.name, time.Since(last).Round(time.Millisecond))
 			}
+			s.recordStatus(cfg, t.name, last, err)
+		case <-changed:
+		case <-s.done:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		select {
 		case <-s.done:
 			return
+		default:
 		}
 	}
 }
 
-func (s *Scheduler) Stop() {
-	close(s.done)
+// Reload replaces the local config with base, which must already be
+// validated, and logs what changed. Tasks pick up the new config on their
+// next run; a run in progress finishes with the config it started with.
+func (s *Scheduler) Reload(base *config.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.cfg
+	s.base = base
+	s.swapConfig(s.withStoredPolicy(base))
+
+	changes := config.Diff(prev, s.cfg)
+	if len(changes) == 0 {
+		s.logger.Infof("Config reloaded, no changes")
+		return
+	}
+	s.logger.Infof("Config reloaded: %s", strings.Join(changes, "; "))
+}
+
+// snapshot returns the current config and the channel closed when it is
+// replaced.
+func (s *Scheduler) snapshot() (*config.Config, <-chan struct{}) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg, s.changed
+}
+
+// swapConfig makes cfg current and wakes the task loops. The caller holds
+// s.mu. The ingest client is built from the current config for every send.
+func (s *Scheduler) swapConfig(cfg *config.Config) {
+	s.cfg = cfg
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.setLogLevel()
 }
 
-func (s *Scheduler) collect() error {
-	hostInfo, err := collect.GetHostInfo("0.1.0")
+// applyPolicy merges a policy from the backend over the local config. A
+// policy that fails verification or validation is logged and ignored so the
+// agent keeps running with its current settings.
+func (s *Scheduler) applyPolicy(signed *policy.Signed, hostID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.base.RemotePolicy.PublicKey == "" {
+		s.logger.Debugf("Ignoring policy from backend: %v", remoteconfig.ErrDisabled)
+		return
+	}
+	merged, doc, err := remoteconfig.Apply(s.base, signed, hostID)
 	if err != nil {
-		s.logger.Errorf("Failed to collect host info: %v", err)
-		return err
+		s.logger.Warnf("Rejected policy from backend: %v", err)
+		return
+	}
+	if doc == nil {
+		return
 	}
 
-	packages, _ := collect.CollectPackages(hostInfo.OSID)
-	cisResults := cis.RunAllChecks()
+	s.swapConfig(merged)
+	s.logger.Infof("Applied policy %s v%d (interval: %d minutes)", doc.Policy.ID, doc.Policy.Version, merged.CollectionIntervalMinutes)
+}
 
-	payload := map[string]interface{}{
-		"host":        hostInfo,
-		"packages":    packages,
-		"cis_results": cisResults,
+func (s *Scheduler) setLogLevel() {
+	if s.cfg.LogLevel == "" {
+		return
+	}
+	if err := s.logger.SetLevel(s.cfg.LogLevel); err != nil {
+		s.logger.Warnf("Ignoring log level: %v", err)
 	}
+}
 
-	client := ingest.NewClient(s.cfg, s.logger)
-	if err := client.SendPayload(payload); err != nil {
+// send posts payload, enrolling first if needed, and applies any policy the
+// backend returns.
+func (s *Scheduler) send(ctx context.Context, cfg *config.Config, payload *ingest.Payload) error {
+	client, err := s.client(ctx, cfg, payload.Host.HostID, payload.Host.Hostname)
+	if err != nil {
+		return err
+	}
+	resp, err := client.SendPayload(ctx, payload)
+	if err != nil {
 		s.logger.Errorf("Failed to send payload: %v", err)
 		return err
 	}
+	if resp.Policy != nil {
+		s.applyPolicy(resp.Policy, payload.Host.HostID)
+	}
+	return nil
+}
+
+// client builds an ingest client for cfg. Enrollment is serialized so that
+// concurrent tasks do not both spend the one-time token.
+func (s *Scheduler) client(ctx context.Context, cfg *config.Config, hostID, hostname string) (*ingest.Client, error) {
+	s.enrollMu.Lock()
+	defer s.enrollMu.Unlock()
+
+	client, err := ingest.NewClient(cfg, s.logger)
+	if err != nil {
+		s.logger.Errorf("Failed to configure ingest client: %v", err)
+		return nil, err
+	}
+	if client.Credential() == nil && cfg.EnrollmentToken != "" {
+		if err := client.Enroll(ctx, cfg.EnrollmentToken, hostID, hostname); err != nil {
+			s.logger.Errorf("Enrollment failed: %v", err)
+			return nil, err
+		}
+		s.logger.Infof("Enrolled as host %s; the enrollment token can now be removed from the config", hostID)
+	}
+	return client, nil
+}
+
+func (s *Scheduler) collectAndSend(ctx context.Context, cfg *config.Config) error {
+	payload, err := s.buildPayload(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	remediations, err := remediate.PendingResults(cfg.Remediation.BackupDir)
+	if err != nil {
+		s.logger.Warnf("Failed to load pending remediation results: %v", err)
+	}
+	payload.Remediations = remediations
+
+	if err := s.send(ctx, cfg, payload); err != nil {
+		return err
+	}
+	s.afterCISSent(ctx, cfg, payload)
 
 	s.logger.Infof("Collection complete")
 	return nil
 }
+
+// afterCISSent clears remediation results the backend now has and, when
+// enabled, fixes the failures just reported.
+func (s *Scheduler) afterCISSent(ctx context.Context, cfg *config.Config, payload *ingest.Payload) {
+	if len(payload.Remediations) > 0 {
+		if err := remediate.ClearPending(cfg.Remediation.BackupDir); err != nil {
+			s.logger.Warnf("Failed to clear pending remediation results: %v", err)
+		}
+	}
+	if cfg.Remediation.Enabled && ctx.Err() == nil {
+		s.remediate(cfg, payload.CISResults, false, nil)
+	}
+}
+
+// recordStatus updates status.json after a run. task is empty for a one-off
+// full collection; otherwise the task's own entry is updated as well and
+// the top-level error summarizes every task that is currently failing.
+func (s *Scheduler) recordStatus(cfg *config.Config, task string, start time.Time, runErr error) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	st, err := status.Load(cfg.StateDir)
+	if err != nil {
+		st = &status.State{}
+	}
+
+	st.LastRun = start.UTC().Format(time.RFC3339)
+	st.LastDurationMS = time.Since(start).Milliseconds()
+	st.AgentVersion = s.version
+	st.PID = os.Getpid()
+	st.CollectionCount++
+	if runErr == nil {
+		st.LastSuccess = st.LastRun
+	}
+
+	if task == "" {
+		st.LastError = ""
+		if runErr != nil {
+			st.LastError = runErr.Error()
+		}
+	} else {
+		ts := taskStatus(st, task)
+		ts.LastRun = st.LastRun
+		ts.LastDurationMS = st.LastDurationMS
+		ts.RunCount++
+		ts.LastError = ""
+		if runErr != nil {
+			ts.LastError = runErr.Error()
+		} else {
+			ts.LastSuccess = st.LastRun
+		}
+
+		var failing []string
+		for name, t := range st.Tasks {
+			if t.LastError != "" {
+				failing = append(failing, name+": "+t.LastError)
+			}
+		}
+		sort.Strings(failing)
+		st.LastError = strings.Join(failing, "; ")
+	}
+
+	pending, _ := remediate.PendingResults(cfg.Remediation.BackupDir)
+	st.QueueDepth = len(pending)
+
+	if err := status.Save(cfg.StateDir, st); err != nil {
+		s.logger.Warnf("Failed to save status: %v", err)
+	}
+}
+
+// updateTask applies fn to a task's status entry.
+func (s *Scheduler) updateTask(cfg *config.Config, task string, fn func(*status.Task)) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	st, err := status.Load(cfg.StateDir)
+	if err != nil {
+		return
+	}
+	fn(taskStatus(st, task))
+	if err := status.Save(cfg.StateDir, st); err != nil {
+		s.logger.Warnf("Failed to save status: %v", err)
+	}
+}
+
+func taskStatus(st *status.State, task string) *status.Task {
+	if st.Tasks == nil {
+		st.Tasks = map[string]*status.Task{}
+	}
+	if st.Tasks[task] == nil {
+		st.Tasks[task] = &status.Task{}
+	}
+	return st.Tasks[task]
+}
+
+// Remediate runs the selected checks and fixes allowlisted failures. With
+// dryRun set the planned changes are written to out as unified diffs and
+// nothing is modified.
+func (s *Scheduler) Remediate(ctx context.Context, dryRun bool, out io.Writer) []remediate.Result {
+	cfg, _ := s.snapshot()
+	results, err := s.runChecks(ctx, cfg)
+	if err != nil {
+		s.logger.Errorf("Failed to run checks: %v", err)
+		return nil
+	}
+	return s.remediate(cfg, results, dryRun, out)
+}
+
+func (s *Scheduler) remediate(cfg *config.Config, results []*cis.CheckResult, dryRun bool, out io.Writer) []remediate.Result {
+	actions, failed := cis.PlanFixes(results, cfg.Remediation.AllowedChecks)
+	if len(actions) == 0 && len(failed) == 0 {
+		return nil
+	}
+
+	r := remediate.New(cfg.Remediation.BackupDir, dryRun, out)
+	applied := append(r.Apply(actions), failed...)
+	for _, res := range applied {
+		if res.Error != "" {
+			s.logger.Errorf("Remediation of %s %s: %s", res.CheckID, res.Status, res.Error)
+		} else {
+			s.logger.Infof("Remediation of %s %s", res.CheckID, res.Status)
+		}
+	}
+
+	if !dryRun {
+		if err := remediate.QueueResults(cfg.Remediation.BackupDir, applied); err != nil {
+			s.logger.Errorf("Failed to queue remediation results: %v", err)
+		}
+	}
+	return applied
+}
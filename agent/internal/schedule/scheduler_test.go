@@ -0,0 +1,29 @@
+package schedule
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStopWaitsForRuns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{ctx: ctx, cancel: cancel, done: make(chan struct{})}
+
+	// A run that still writes its status after being cancelled
+	var finished atomic.Bool
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		<-s.ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+	}()
+
+	s.Stop()
+	if !finished.Load() {
+		t.Fatal("Stop returned before the run finished")
+	}
+	s.Stop()
+}
@@ -0,0 +1,396 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/visiblaze/sec-agent/agent/internal/cis"
+	"github.com/visiblaze/sec-agent/agent/internal/collect"
+	"github.com/visiblaze/sec-agent/agent/internal/config"
+	"github.com/visiblaze/sec-agent/agent/internal/ingest"
+	"github.com/visiblaze/sec-agent/agent/internal/remediate"
+	"github.com/visiblaze/sec-agent/agent/internal/status"
+)
+
+// Task names, as used in the schedules config and in status.
+const (
+	TaskHeartbeat = "heartbeat"
+	TaskCIS       = "cis"
+	TaskPackages  = "packages"
+	TaskApps      = "apps"
+)
+
+// DefaultHeartbeatInterval applies when schedules.heartbeat is not set. The
+// other tasks default to collection_interval_minutes.
+const DefaultHeartbeatInterval = time.Minute
+
+// Default run timeouts, when schedules.<task>.timeout is not set. A run that
+// exceeds its timeout is cancelled and recorded as failed.
+const (
+	DefaultHeartbeatTimeout = 30 * time.Second
+	DefaultTaskTimeout      = 10 * time.Minute
+)
+
+// appPackagesFile caches the last application package scan so the packages
+// task can send a complete inventory between filesystem walks.
+const appPackagesFile = "app_packages.json"
+
+type task struct {
+	name string
+	run  func(ctx context.Context, cfg *config.Config) error
+}
+
+func (s *Scheduler) tasks() []task {
+	return []task{
+		{TaskHeartbeat, s.runHeartbeat},
+		{TaskCIS, s.runCIS},
+		{TaskPackages, s.runPackages},
+		{TaskApps, s.runApps},
+	}
+}
+
+func taskSchedule(cfg *config.Config, name string) (config.TaskSchedule, time.Duration) {
+	interval := time.Duration(cfg.CollectionIntervalMinutes) * time.Minute
+	switch name {
+	case TaskHeartbeat:
+		return cfg.Schedules.Heartbeat, DefaultHeartbeatInterval
+	case TaskCIS:
+		return cfg.Schedules.CIS, interval
+	case TaskPackages:
+		return cfg.Schedules.Packages, interval
+	case TaskApps:
+		ts := cfg.Schedules.Apps
+		ts.Disabled = ts.Disabled || !cfg.AppScan.Enabled
+		return ts, interval
+	}
+	return config.TaskSchedule{Disabled: true}, 0
+}
+
+// nextRun returns when a task runs next, or false when it is disabled.
+// Interval tasks run splay after start and then every interval after the
+// previous run began. Cron tasks run at each matching time shifted by splay,
+// so a fleet sharing one expression does not report all at once.
+func nextRun(cfg *config.Config, name string, start, last time.Time, splay time.Duration) (time.Time, bool) {
+	ts, fallback := taskSchedule(cfg, name)
+	if ts.Disabled {
+		return time.Time{}, false
+	}
+	if sched, _ := ts.ParseCron(); sched != nil {
+		from := start
+		if !last.IsZero() {
+			from = last.Add(-splay)
+		}
+		return sched.Next(from).Add(splay), true
+	}
+	interval, _ := ts.ParseInterval()
+	if interval == 0 {
+		interval = fallback
+	}
+	if last.IsZero() {
+		return start.Add(splay), true
+	}
+	return last.Add(interval), true
+}
+
+// taskTimeout returns how long one run of a task may take.
+func taskTimeout(cfg *config.Config, name string) time.Duration {
+	ts, _ := taskSchedule(cfg, name)
+	if d, _ := ts.ParseTimeout(); d > 0 {
+		return d
+	}
+	if name == TaskHeartbeat {
+		return DefaultHeartbeatTimeout
+	}
+	return DefaultTaskTimeout
+}
+
+func describeSchedule(cfg *config.Config, name string, splay time.Duration) string {
+	ts, fallback := taskSchedule(cfg, name)
+	switch {
+	case ts.Disabled:
+		return "disabled"
+	case ts.Cron != "":
+		return fmt.Sprintf("cron %q, splay %s", ts.Cron, splay.Round(time.Second))
+	case ts.Interval != "":
+		return fmt.Sprintf("every %s, splay %s", ts.Interval, splay.Round(time.Second))
+	}
+	return fmt.Sprintf("every %s, splay %s", fallback, splay.Round(time.Second))
+}
+
+// runHeartbeat posts a liveness message with the outcome of the last
+// collection, and applies any policy the backend returns.
+func (s *Scheduler) runHeartbeat(ctx context.Context, cfg *config.Config) error {
+	host, err := collect.GetHostInfo(ctx, s.version)
+	if err != nil {
+		return err
+	}
+	pending, _ := remediate.PendingResults(cfg.Remediation.BackupDir)
+	hb := &ingest.Heartbeat{
+		HostID:        host.HostID,
+		Hostname:      host.Hostname,
+		AgentVersion:  s.version,
+		UptimeSeconds: int64(time.Since(s.started) / time.Second),
+		QueueDepth:    len(pending),
+	}
+	s.statusMu.Lock()
+	if st, err := status.Load(cfg.StateDir); err == nil {
+		hb.LastCollection = lastCollection(st)
+	}
+	s.statusMu.Unlock()
+
+	client, err := s.client(ctx, cfg, host.HostID, host.Hostname)
+	if err != nil {
+		return err
+	}
+	resp, err := client.SendHeartbeat(ctx, hb)
+	if err != nil {
+		s.logger.Errorf("Failed to send heartbeat: %v", err)
+		return err
+	}
+	if resp.Policy != nil {
+		s.applyPolicy(resp.Policy, host.HostID)
+	}
+	return nil
+}
+
+// lastCollection summarizes the most recently run collection task, or
+// returns nil when none has run yet.
+func lastCollection(st *status.State) *ingest.CollectionInfo {
+	var name string
+	var latest *status.Task
+	for n, t := range st.Tasks {
+		if n == TaskHeartbeat || t.LastRun == "" {
+			continue
+		}
+		if latest == nil || t.LastRun > latest.LastRun || (t.LastRun == latest.LastRun && n < name) {
+			name, latest = n, t
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+	info := &ingest.CollectionInfo{Task: name, Status: ingest.CollectionOK, At: latest.LastRun}
+	if latest.LastError != "" {
+		info.Status = ingest.CollectionFailed
+		info.Error = latest.LastError
+	}
+	return info
+}
+
+// runCIS runs the selected checks and reports them with any queued
+// remediation results. Checks that time out are reported as such; if the
+// run itself is cancelled nothing is sent.
+func (s *Scheduler) runCIS(ctx context.Context, cfg *config.Config) error {
+	host, err := s.hostInfo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	results, err := s.runChecks(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	remediations, err := remediate.PendingResults(cfg.Remediation.BackupDir)
+	if err != nil {
+		s.logger.Warnf("Failed to load pending remediation results: %v", err)
+	}
+
+	payload := &ingest.Payload{
+		Host:         host,
+		CISResults:   results,
+		Remediations: remediations,
+		Tasks:        []string{TaskCIS},
+	}
+	if err := s.send(ctx, cfg, payload); err != nil {
+		return err
+	}
+	s.afterCISSent(ctx, cfg, payload)
+	return nil
+}
+
+// runPackages sends the software inventory, including application packages
+// from the last filesystem walk.
+func (s *Scheduler) runPackages(ctx context.Context, cfg *config.Config) error {
+	host, err := s.hostInfo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	var apps []collect.Package
+	if cfg.AppScan.Enabled {
+		if apps, err = loadAppPackages(cfg.StateDir); err != nil {
+			s.logger.Warnf("Failed to load cached application packages: %v", err)
+		}
+	}
+	packages, containers, err := s.collectInventory(ctx, cfg, host.OSID, apps)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, cfg, &ingest.Payload{
+		Host:       host,
+		Packages:   packages,
+		Containers: containers,
+		Tasks:      []string{TaskPackages},
+	})
+}
+
+// runApps walks the filesystem for application packages, caches the result
+// and sends the refreshed inventory. A cancelled walk is not cached, as it
+// would replace a complete result with a partial one.
+func (s *Scheduler) runApps(ctx context.Context, cfg *config.Config) error {
+	apps := s.scanApps(ctx, cfg)
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("application package scan: %w", err)
+	}
+	if err := saveAppPackages(cfg.StateDir, apps); err != nil {
+		s.logger.Warnf("Failed to cache application packages: %v", err)
+	}
+	return s.runPackages(ctx, cfg)
+}
+
+// BuildPayload collects host info, packages and CIS results without sending
+// anything to the backend.
+func (s *Scheduler) BuildPayload(ctx context.Context) (*ingest.Payload, error) {
+	cfg, _ := s.snapshot()
+	return s.buildPayload(ctx, cfg)
+}
+
+func (s *Scheduler) buildPayload(ctx context.Context, cfg *config.Config) (*ingest.Payload, error) {
+	hostInfo, err := s.hostInfo(ctx, cfg)
+	if err != nil {
+		s.logger.Errorf("Failed to collect host info: %v", err)
+		return nil, err
+	}
+
+	var apps []collect.Package
+	if cfg.AppScan.Enabled {
+		apps = s.scanApps(ctx, cfg)
+	}
+	packages, containers, err := s.collectInventory(ctx, cfg, hostInfo.OSID, apps)
+	if err != nil {
+		return nil, err
+	}
+
+	cisResults, err := s.runChecks(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ingest.Payload{
+		Host:       hostInfo,
+		Packages:   packages,
+		CISResults: cisResults,
+		Containers: containers,
+	}, nil
+}
+
+// hostInfo collects the host's details for a payload, with the tags from
+// cfg. The tags are never nil, so removing the last one from the config
+// clears them on the backend.
+func (s *Scheduler) hostInfo(ctx context.Context, cfg *config.Config) (*collect.HostInfo, error) {
+	host, err := collect.GetHostInfo(ctx, s.version)
+	if err != nil {
+		return nil, err
+	}
+	host.Tags = append([]string{}, cfg.Tags...)
+	return host, nil
+}
+
+// collectInventory gathers OS, snap and Flatpak packages plus apps, and the
+// container inventory. It fails only when ctx ends first: an incomplete
+// inventory must not replace the one the backend has.
+func (s *Scheduler) collectInventory(ctx context.Context, cfg *config.Config, osID string, apps []collect.Package) ([]collect.Package, *collect.ContainerInventory, error) {
+	packages, err := collect.CollectPackages(ctx, osID)
+	if err != nil {
+		return nil, nil, err
+	}
+	packages = append(packages, apps...)
+	if cfg.Inventory.Snaps {
+		if snaps, err := collect.CollectSnaps(collect.SnapStateFile, collect.SnapMountDir); err == nil {
+			packages = append(packages, snaps...)
+		}
+	}
+	if cfg.Inventory.Flatpaks {
+		if flatpaks, err := collect.CollectFlatpaks(collect.FlatpakDir); err == nil {
+			packages = append(packages, flatpaks...)
+		}
+	}
+
+	var containers *collect.ContainerInventory
+	if cfg.Inventory.Containers {
+		// Most hosts run no container runtime, so a failure here is not logged
+		containers, _ = collect.CollectContainers(ctx, cfg.Inventory.ContainerSockets)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, fmt.Errorf("collect inventory: %w", err)
+	}
+	return packages, containers, nil
+}
+
+func (s *Scheduler) scanApps(ctx context.Context, cfg *config.Config) []collect.Package {
+	appPkgs, stats := collect.CollectAppPackages(ctx, collect.AppScanOptions{
+		Paths:       cfg.AppScan.Paths,
+		Exclude:     cfg.AppScan.Exclude,
+		MaxDuration: time.Duration(cfg.AppScan.MaxDurationSeconds) * time.Second,
+		MaxFiles:    cfg.AppScan.MaxFiles,
+		MaxDepth:    cfg.AppScan.MaxDepth,
+	})
+	if stats.Truncated {
+		s.logger.Warnf("Application package scan stopped early (%s) after %d files", stats.Reason, stats.FilesVisited)
+	}
+	s.logger.Infof("Found %d application packages in %d ms", len(appPkgs), stats.DurationMS)
+	return appPkgs
+}
+
+// runChecks runs the selected checks, each within its configured budget.
+// Results are discarded when ctx ends first, since the remaining checks
+// never ran.
+func (s *Scheduler) runChecks(ctx context.Context, cfg *config.Config) ([]*cis.CheckResult, error) {
+	checks, err := cis.Select(cfg.Checks.Profile, cfg.Checks.Enabled)
+	if err != nil {
+		return nil, err
+	}
+	results := cis.RunChecks(ctx, checks, cfg.Checks.Budget)
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("run checks: %w", err)
+	}
+	for _, r := range results {
+		if r.Status == cis.StatusTimeout {
+			s.logger.Warnf("Check %s timed out: %v", r.CheckID, r.Evidence["error"])
+		}
+	}
+	return results, nil
+}
+
+func loadAppPackages(stateDir string) ([]collect.Package, error) {
+	b, err := os.ReadFile(filepath.Join(stateDir, appPackagesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []collect.Package
+	if err := json.Unmarshal(b, &pkgs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", appPackagesFile, err)
+	}
+	return pkgs, nil
+}
+
+func saveAppPackages(stateDir string, pkgs []collect.Package) error {
+	b, err := json.Marshal(pkgs)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(stateDir, appPackagesFile+".tmp")
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(stateDir, appPackagesFile))
+}
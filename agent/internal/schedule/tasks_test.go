@@ -0,0 +1,70 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/visiblaze/sec-agent/agent/internal/config"
+	"github.com/visiblaze/sec-agent/agent/internal/ingest"
+	"github.com/visiblaze/sec-agent/agent/internal/status"
+)
+
+func TestNextRun(t *testing.T) {
+	cfg := &config.Config{CollectionIntervalMinutes: 15}
+	cfg.Schedules.CIS.Interval = "1h"
+	cfg.Schedules.Packages.Cron = "0 2 * * *"
+	start := time.Date(2026, 3, 1, 10, 30, 0, 0, time.Local)
+	splay := 90 * time.Second
+
+	cases := []struct {
+		task string
+		last time.Time
+		want time.Time
+	}{
+		// Interval tasks start after the splay, then repeat from the last run
+		{TaskCIS, time.Time{}, start.Add(splay)},
+		{TaskCIS, start.Add(splay), start.Add(splay + time.Hour)},
+		{TaskHeartbeat, start, start.Add(DefaultHeartbeatInterval)},
+		// Unset schedules fall back to collection_interval_minutes
+		{TaskApps, start, start.Add(15 * time.Minute)},
+		// Cron tasks wait for the next match, shifted by the splay
+		{TaskPackages, time.Time{}, time.Date(2026, 3, 2, 2, 0, 0, 0, time.Local).Add(splay)},
+		{TaskPackages, time.Date(2026, 3, 2, 2, 0, 0, 0, time.Local).Add(splay), time.Date(2026, 3, 3, 2, 0, 0, 0, time.Local).Add(splay)},
+	}
+	cfg.AppScan.Enabled = true
+	for _, c := range cases {
+		got, ok := nextRun(cfg, c.task, start, c.last, splay)
+		if !ok || !got.Equal(c.want) {
+			t.Errorf("nextRun(%s, last=%s) = %s, %v; want %s", c.task, c.last, got, ok, c.want)
+		}
+	}
+}
+
+func TestNextRunDisabled(t *testing.T) {
+	cfg := &config.Config{CollectionIntervalMinutes: 15}
+	cfg.Schedules.Heartbeat.Disabled = true
+	now := time.Now()
+
+	if _, ok := nextRun(cfg, TaskHeartbeat, now, time.Time{}, 0); ok {
+		t.Error("disabled heartbeat scheduled")
+	}
+	// The filesystem walk only runs when app_scan is enabled
+	if _, ok := nextRun(cfg, TaskApps, now, time.Time{}, 0); ok {
+		t.Error("apps scheduled with app_scan disabled")
+	}
+}
+
+func TestLastCollection(t *testing.T) {
+	st := &status.State{Tasks: map[string]*status.Task{
+		TaskHeartbeat: {LastRun: "2026-03-01T10:05:00Z"},
+		TaskCIS:       {LastRun: "2026-03-01T10:00:00Z", LastError: "api error 500"},
+		TaskPackages:  {LastRun: "2026-03-01T09:00:00Z"},
+	}}
+	got := lastCollection(st)
+	if got == nil || got.Task != TaskCIS || got.Status != ingest.CollectionFailed || got.Error != "api error 500" {
+		t.Errorf("lastCollection = %+v", got)
+	}
+	if lastCollection(&status.State{}) != nil {
+		t.Error("expected nil before any collection")
+	}
+}
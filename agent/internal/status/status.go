@@ -0,0 +1,65 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const fileName = "status.json"
+
+// State is the agent's view of its last collection, persisted so the status
+// subcommand can report on a running daemon.
+type State struct {
+	LastRun         string `json:"last_run,omitempty"`
+	LastSuccess     string `json:"last_success,omitempty"`
+	LastError       string `json:"last_error,omitempty"`
+	LastDurationMS  int64  `json:"last_duration_ms"`
+	QueueDepth      int    `json:"queue_depth"`
+	AgentVersion    string `json:"agent_version,omitempty"`
+	PID             int    `json:"pid,omitempty"`
+	CollectionCount int    `json:"collection_count"`
+	// Tasks is keyed by scheduler task name (heartbeat, cis, packages, apps)
+	Tasks map[string]*Task `json:"tasks,omitempty"`
+}
+
+// Task is the last outcome of one scheduled task.
+type Task struct {
+	LastRun        string `json:"last_run,omitempty"`
+	LastSuccess    string `json:"last_success,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+	LastDurationMS int64  `json:"last_duration_ms"`
+	NextRun        string `json:"next_run,omitempty"`
+	RunCount       int    `json:"run_count"`
+}
+
+func Load(stateDir string) (*State, error) {
+	data, err := os.ReadFile(filepath.Join(stateDir, fileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &State{}, nil
+		}
+		return nil, fmt.Errorf("read status: %w", err)
+	}
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parse status: %w", err)
+	}
+	return &st, nil
+}
+
+func Save(stateDir string, st *State) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	tmp := filepath.Join(stateDir, fileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write status: %w", err)
+	}
+	return os.Rename(tmp, filepath.Join(stateDir, fileName))
+}
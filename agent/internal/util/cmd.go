@@ -2,16 +2,29 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"os/exec"
+	"time"
 )
 
-func RunCmd(name string, args ...string) (string, error) {
-	cmd := exec.Command(name, args...)
+// cmdWaitDelay bounds how long RunCmd waits for output after the command is
+// killed, in case a child process it spawned still holds the pipes open.
+const cmdWaitDelay = 2 * time.Second
+
+// RunCmd runs name with args and returns its combined output. The command is
+// killed when ctx is done; the output gathered up to then is still returned,
+// along with ctx's error.
+func RunCmd(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = cmdWaitDelay
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = &out
 
 	err := cmd.Run()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
 	return out.String(), err
 }
 
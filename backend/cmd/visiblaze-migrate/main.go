@@ -0,0 +1,54 @@
+// Command visiblaze-migrate copies the DynamoDB tables of a deployment from
+// before tenants into the tenant-keyed tables, as one tenant's data, so
+// upgrading keeps hosts, credentials, inventories and policies, and then
+// counts the copied inventories into the software catalog. With
+// -rebuild-catalog it only recounts the catalog of the tenant's current
+// inventories. See "Upgrading to tenants" in README.md for when to run it.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/backend/internal/store/dynamo"
+)
+
+func main() {
+	legacy := dynamo.DefaultLegacyTables
+	tenant := flag.String("tenant", store.DefaultTenant, "Tenant the copied data belongs to")
+	flag.StringVar(&legacy.Hosts, "from-hosts", legacy.Hosts, "Legacy hosts table")
+	flag.StringVar(&legacy.Packages, "from-packages", legacy.Packages, "Legacy packages table")
+	flag.StringVar(&legacy.CISResults, "from-cis-results", legacy.CISResults, "Legacy CIS results table")
+	flag.StringVar(&legacy.Policies, "from-policies", legacy.Policies, "Legacy policies table")
+	catalogOnly := flag.Bool("rebuild-catalog", false, "Only recount the software catalog")
+	flag.Parse()
+	if !store.ValidTenantID(*tenant) {
+		log.Fatalf("invalid tenant %q", *tenant)
+	}
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The tenant-keyed tables are named as for the Lambda, by the *_TABLE
+	// variables or their defaults
+	s := dynamo.New(dynamodb.NewFromConfig(cfg), dynamo.TablesFromEnv()).Tenant(*tenant).(*dynamo.Store)
+	if !*catalogOnly {
+		stats, err := s.Migrate(ctx, legacy)
+		log.Printf("copied %d hosts, %d packages, %d CIS results and %d policies; assigned %d enrollment tokens",
+			stats.Hosts, stats.Packages, stats.CISResults, stats.Policies, stats.EnrollmentTokens)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := s.RebuildSoftwareCatalog(ctx); err != nil {
+		log.Fatalf("rebuild software catalog: %v", err)
+	}
+	log.Printf("rebuilt the software catalog of tenant %s", *tenant)
+}
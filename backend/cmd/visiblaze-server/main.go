@@ -0,0 +1,49 @@
+// Command visiblaze-server serves the Visiblaze API as a single binary over
+// an embedded on-disk database, for self-hosted installs and local
+// development. It runs the same handlers as the Lambda.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/visiblaze/sec-agent/backend/internal/server"
+)
+
+func main() {
+	configPath := flag.String("config", "", "Path to config file (defaults apply when unset)")
+	listen := flag.String("listen", "", "Listen address, overriding the config")
+	dataDir := flag.String("data-dir", "", "Data directory, overriding the config")
+	flag.Parse()
+
+	cfg := server.Default()
+	if *configPath != "" {
+		var err error
+		if cfg, err = server.Load(*configPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *listen != "" {
+		cfg.Listen = *listen
+	}
+	if *dataDir != "" {
+		cfg.DataDir = *dataDir
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	srv, err := server.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := srv.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
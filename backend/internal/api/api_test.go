@@ -0,0 +1,1040 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+	"github.com/visiblaze/sec-agent/backend/internal/oidc"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/liveness"
+	"github.com/visiblaze/sec-agent/pkg/policy"
+	"github.com/visiblaze/sec-agent/pkg/signing"
+	"github.com/visiblaze/sec-agent/pkg/upload"
+)
+
+const testAPIKey = "secret"
+
+func newTestServer(t *testing.T) (*Server, http.Handler) {
+	t.Helper()
+	s := &Server{
+		Store:    store.NewMemory(),
+		APIKey:   testAPIKey,
+		AuthMode: AuthAPIKey,
+		Tokens: []APIToken{
+			{Name: "admin", Role: RoleAdmin, SHA256: HashAPIToken("admin-token")},
+			{Name: "ops", Role: RoleOperator, SHA256: HashAPIToken("operator-token")},
+			{Name: "dash", Role: RoleViewer, SHA256: HashAPIToken("viewer-token")},
+		},
+		Liveness: liveness.Default,
+	}
+	return s, s.Handler()
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   map[string]interface{}
+	raw    []byte
+}
+
+func call(t *testing.T, h http.Handler, method, path string, body interface{}, headers map[string]string) response {
+	t.Helper()
+	var raw []byte
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		raw = b
+	default:
+		raw, _ = json.Marshal(b)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	resp := response{status: rec.Code, header: rec.Header(), raw: rec.Body.Bytes()}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp.body); err != nil {
+		t.Fatalf("%s %s: body is not a JSON object: %q", method, path, rec.Body.String())
+	}
+	return resp
+}
+
+var (
+	agentKeyHeaders = map[string]string{"X-API-Key": testAPIKey}
+	viewerHeaders   = map[string]string{"Authorization": "Bearer viewer-token"}
+	operatorHeaders = map[string]string{"Authorization": "Bearer operator-token"}
+	adminHeaders    = map[string]string{"Authorization": "Bearer admin-token"}
+)
+
+func testPayload(hostID string) models.IngestPayload {
+	return models.IngestPayload{
+		Host:       models.Host{HostID: hostID, Hostname: "web-1", OSID: "ubuntu", IPAddresses: []string{"10.0.0.1", " 10.0.0.1 ", ""}},
+		Packages:   []models.Package{{Name: "openssl", Version: "3.0.2", Manager: "dpkg"}},
+		CISResults: []models.CISResult{{CheckID: "1.1", Title: "tmp", Status: "fail"}},
+	}
+}
+
+func TestIngestAndQuery(t *testing.T) {
+	_, h := newTestServer(t)
+
+	if r := call(t, h, "POST", "/ingest", testPayload("host-1"), nil); r.status != http.StatusUnauthorized {
+		t.Fatalf("ingest without key: status %d", r.status)
+	}
+	if r := call(t, h, "POST", "/ingest", testPayload("host-1"), agentKeyHeaders); r.status != http.StatusOK || r.body["status"] != "ok" {
+		t.Fatalf("ingest: %d %v", r.status, r.body)
+	}
+
+	r := call(t, h, "GET", "/hosts", nil, viewerHeaders)
+	hosts, _ := r.body["hosts"].([]interface{})
+	if r.status != http.StatusOK || len(hosts) != 1 {
+		t.Fatalf("hosts: %d %v", r.status, r.body)
+	}
+	host := hosts[0].(map[string]interface{})
+	if host["status"] != liveness.Online || len(host["ip_addresses"].([]interface{})) != 1 {
+		t.Errorf("host = %v", host)
+	}
+	if r := call(t, h, "GET", "/hosts?status=missing", nil, viewerHeaders); len(r.body["hosts"].([]interface{})) != 0 {
+		t.Errorf("missing hosts = %v", r.body["hosts"])
+	}
+	if r := call(t, h, "GET", "/hosts?status=bogus", nil, viewerHeaders); r.status != http.StatusBadRequest {
+		t.Errorf("invalid status filter: %d", r.status)
+	}
+
+	r = call(t, h, "GET", "/hosts/host-1", nil, viewerHeaders)
+	if r.status != http.StatusOK || len(r.body["cis_results"].([]interface{})) != 1 {
+		t.Errorf("host detail: %d %v", r.status, r.body)
+	}
+	if r := call(t, h, "GET", "/hosts/host-1/packages", nil, viewerHeaders); len(r.body["packages"].([]interface{})) != 1 {
+		t.Errorf("host packages: %d %v", r.status, r.body)
+	}
+	for _, path := range []string{"/hosts/nope", "/hosts/nope/packages"} {
+		if r := call(t, h, "GET", path, nil, viewerHeaders); r.status != http.StatusNotFound {
+			t.Errorf("%s: %d", path, r.status)
+		}
+	}
+	if r := call(t, h, "GET", "/apps", nil, viewerHeaders); len(r.body["packages"].([]interface{})) != 1 {
+		t.Errorf("apps = %v", r.body)
+	}
+	if r := call(t, h, "GET", "/cis-results", nil, viewerHeaders); len(r.body["cis_results"].([]interface{})) != 1 {
+		t.Errorf("cis-results = %v", r.body)
+	}
+
+	// A heartbeat-only task payload leaves the inventory alone
+	partial := testPayload("host-1")
+	partial.Packages = nil
+	partial.Tasks = []string{models.SectionCIS}
+	call(t, h, "POST", "/ingest", partial, agentKeyHeaders)
+	if r := call(t, h, "GET", "/hosts/host-1/packages", nil, viewerHeaders); len(r.body["packages"].([]interface{})) != 1 {
+		t.Errorf("partial payload replaced packages: %v", r.body["packages"])
+	}
+}
+
+func TestListPaging(t *testing.T) {
+	_, h := newTestServer(t)
+	for _, id := range []string{"host-1", "host-2", "host-3"} {
+		call(t, h, "POST", "/ingest", testPayload(id), agentKeyHeaders)
+	}
+
+	r := call(t, h, "GET", "/hosts?limit=2", nil, viewerHeaders)
+	next, _ := r.body["next_token"].(string)
+	if len(r.body["hosts"].([]interface{})) != 2 || next == "" {
+		t.Fatalf("first page: %v", r.body)
+	}
+	r = call(t, h, "GET", "/hosts?limit=2&next_token="+next, nil, viewerHeaders)
+	if hosts := r.body["hosts"].([]interface{}); len(hosts) != 1 || r.body["next_token"] != nil {
+		t.Errorf("last page: %v", r.body)
+	}
+
+	r = call(t, h, "GET", "/apps?name=openssl&host_id=host-2", nil, viewerHeaders)
+	pkgs := r.body["packages"].([]interface{})
+	if len(pkgs) != 1 || pkgs[0].(map[string]interface{})["host_id"] != "host-2" {
+		t.Errorf("apps by name and host: %v", r.body)
+	}
+	if r := call(t, h, "GET", "/cis-results?check_id=1.1&status=pass", nil, viewerHeaders); len(r.body["cis_results"].([]interface{})) != 0 {
+		t.Errorf("passing 1.1 = %v", r.body)
+	}
+
+	for _, path := range []string{"/hosts?limit=0", "/apps?limit=1001", "/cis-results?limit=x", "/hosts?next_token=%25%25"} {
+		if r := call(t, h, "GET", path, nil, viewerHeaders); r.status != http.StatusBadRequest {
+			t.Errorf("%s: status %d", path, r.status)
+		}
+	}
+}
+
+func TestListHostsByStatus(t *testing.T) {
+	s, h := newTestServer(t)
+	for _, id := range []string{"a-1", "a-2", "a-3", "a-4"} {
+		call(t, h, "POST", "/ingest", testPayload(id), agentKeyHeaders)
+	}
+	st := s.Store.Tenant(store.DefaultTenant)
+	for _, id := range []string{"b-1", "b-2"} {
+		st.UpsertHost(context.Background(), store.HostUpdate{Host: models.Host{HostID: id}, SeenAt: time.Now().AddDate(0, -1, 0)})
+	}
+
+	// The online hosts fill the store's first pages
+	var got []string
+	token := ""
+	for pages := 0; ; pages++ {
+		r := call(t, h, "GET", "/hosts?status=missing&limit=1&next_token="+token, nil, viewerHeaders)
+		hosts := r.body["hosts"].([]interface{})
+		next, _ := r.body["next_token"].(string)
+		if len(hosts) == 0 && next != "" {
+			t.Fatalf("empty page with a next token: %v", r.body)
+		}
+		for _, host := range hosts {
+			got = append(got, host.(map[string]interface{})["host_id"].(string))
+		}
+		if next == "" {
+			break
+		}
+		if pages > 2 {
+			t.Fatal("pagination does not end")
+		}
+		token = next
+	}
+	if strings.Join(got, ",") != "b-1,b-2" {
+		t.Errorf("missing hosts = %v", got)
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	_, h := newTestServer(t)
+	for i, id := range []string{"host-1", "host-2", "host-3"} {
+		p := testPayload(id)
+		p.Host.Hostname = []string{"web-1", "db-1", "web-2"}[i]
+		p.Host.AgentVersion = []string{"1.2.0", "1.2.0", "1.3.0"}[i]
+		if i == 2 {
+			p.Host.OSID = "rhel"
+			p.Packages = append(p.Packages, models.Package{Name: "requests", Version: "2.31.0", Manager: "pip"})
+			p.CISResults[0].Status = "pass"
+		}
+		call(t, h, "POST", "/ingest", p, agentKeyHeaders)
+	}
+
+	ids := func(r response, key, field string) string {
+		var out []string
+		for _, it := range r.body[key].([]interface{}) {
+			out = append(out, it.(map[string]interface{})[field].(string))
+		}
+		return strings.Join(out, ",")
+	}
+	for path, want := range map[string]string{
+		"/hosts?hostname=web":                          "host-1,host-3",
+		"/hosts?agent_version=1.2.0&os_id=ubuntu":      "host-1,host-2",
+		"/hosts?sort=-hostname":                        "host-3,host-1,host-2",
+		"/hosts?last_seen_before=2000-01-01T00:00:00Z": "",
+		"/hosts?last_seen_before=2999-01-01T00:00:00Z": "host-1,host-2,host-3",
+	} {
+		if got := ids(call(t, h, "GET", path, nil, viewerHeaders), "hosts", "host_id"); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if got := ids(call(t, h, "GET", "/apps?manager=pip&version=2.31.0", nil, viewerHeaders), "packages", "host_id"); got != "host-3" {
+		t.Errorf("pip packages on %q", got)
+	}
+	if got := ids(call(t, h, "GET", "/apps?sort=-name&limit=1", nil, viewerHeaders), "packages", "name"); got != "requests" {
+		t.Errorf("last package by name = %q", got)
+	}
+	if got := ids(call(t, h, "GET", "/cis-results?status=fail&sort=-host_id", nil, viewerHeaders), "cis_results", "host_id"); got != "host-2,host-1" {
+		t.Errorf("failing hosts = %q", got)
+	}
+
+	for _, path := range []string{
+		"/hosts?os=ubuntu",
+		"/hosts?os_id=a&os_id=b",
+		"/hosts?last_seen_before=yesterday",
+		"/hosts?sort=kernel",
+		"/apps?sort=--name",
+		"/cis-results?status=failed",
+	} {
+		if r := call(t, h, "GET", path, nil, viewerHeaders); r.status != http.StatusBadRequest {
+			t.Errorf("%s: status %d", path, r.status)
+		}
+	}
+}
+
+func TestSoftwareCatalog(t *testing.T) {
+	_, h := newTestServer(t)
+	for i, version := range []string{"3.0.2", "3.0.2", "3.0.13"} {
+		p := testPayload(fmt.Sprintf("host-%d", i+1))
+		p.Packages = []models.Package{
+			{Name: "openssl", Version: version, Arch: "amd64", Manager: "dpkg"},
+			{Name: "openssl", Version: version, Arch: "i386", Manager: "dpkg"},
+		}
+		if i == 0 {
+			p.Packages = append(p.Packages, models.Package{Name: "openssl", Version: "0.1", Manager: "pip"})
+		}
+		call(t, h, "POST", "/ingest", p, agentKeyHeaders)
+	}
+
+	r := call(t, h, "GET", "/software?sort=-host_count", nil, viewerHeaders)
+	var body struct {
+		Software []models.SoftwareEntry `json:"software"`
+	}
+	json.Unmarshal(r.raw, &body)
+	if r.status != http.StatusOK || len(body.Software) != 2 {
+		t.Fatalf("catalog: %d %s", r.status, r.raw)
+	}
+	dpkg := body.Software[0]
+	if dpkg.Manager != "dpkg" || dpkg.HostCount != 3 || len(dpkg.Versions) != 2 ||
+		dpkg.Versions[0] != (models.SoftwareVersion{Version: "3.0.2", HostCount: 2}) {
+		t.Errorf("dpkg openssl = %+v", dpkg)
+	}
+
+	r = call(t, h, "GET", "/software/hosts?name=openssl&manager=dpkg&version=3.0.13", nil, viewerHeaders)
+	var drill struct {
+		Hosts []models.SoftwareHost `json:"hosts"`
+	}
+	json.Unmarshal(r.raw, &drill)
+	if len(drill.Hosts) != 1 || drill.Hosts[0].HostID != "host-3" || drill.Hosts[0].Hostname != "web-1" ||
+		fmt.Sprint(drill.Hosts[0].Arches) != "[amd64 i386]" || fmt.Sprint(drill.Hosts[0].Versions) != "[3.0.13]" {
+		t.Errorf("hosts on 3.0.13 = %s", r.raw)
+	}
+	r = call(t, h, "GET", "/software/hosts?name=openssl&sort=-version&limit=2", nil, viewerHeaders)
+	json.Unmarshal(r.raw, &drill)
+	if len(drill.Hosts) != 2 || drill.Hosts[0].HostID != "host-2" || drill.Hosts[1].HostID != "host-1" || r.body["next_token"] == nil {
+		t.Errorf("first page by version = %s", r.raw)
+	}
+	r = call(t, h, "GET", "/software/hosts?name=openssl&sort=-version&limit=2&next_token="+r.body["next_token"].(string), nil, viewerHeaders)
+	json.Unmarshal(r.raw, &drill)
+	if len(drill.Hosts) != 2 || drill.Hosts[0].HostID != "host-3" || drill.Hosts[1].Manager != "pip" {
+		t.Errorf("second page by version = %s", r.raw)
+	}
+	if r := call(t, h, "GET", "/software/hosts?version=1", nil, viewerHeaders); r.status != http.StatusBadRequest {
+		t.Errorf("drill-down without name: %d", r.status)
+	}
+}
+
+// TestOpenAPISpec checks the spec against the routes and list parameters.
+func TestOpenAPISpec(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name   string `yaml:"name"`
+				In     string `yaml:"in"`
+				Schema struct {
+					Enum []string `yaml:"enum"`
+				} `yaml:"schema"`
+				Ref string `yaml:"$ref"`
+			} `yaml:"parameters"`
+		} `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	_, h := newTestServer(t)
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			url := strings.NewReplacer("{hostId}", "h", "{uploadId}", "u", "{part}", "1", "{groupId}", "g").Replace(path)
+			req := httptest.NewRequest(strings.ToUpper(method), url, nil)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if strings.Contains(rec.Body.String(), `"Not found"`) {
+				t.Errorf("%s %s is documented but not routed", method, path)
+			}
+		}
+	}
+
+	for path, list := range map[string]struct {
+		params, sorts []string
+	}{
+		"/hosts":                   {hostParams, store.HostSortFields},
+		"/apps":                    {packageParams, store.PackageSortFields},
+		"/cis-results":             {cisParams, store.CISSortFields},
+		"/hosts/{hostId}/packages": {hostPackageParams, store.PackageSortFields},
+		"/software":                {softwareParams, softwareSortFields},
+		"/software/hosts":          {softwareHostParams, softwareHostSortFields},
+	} {
+		var names, sorts []string
+		for _, p := range spec.Paths[path]["get"].Parameters {
+			switch {
+			case p.Name == "sort":
+				sorts = p.Schema.Enum
+			case p.In == "query":
+				names = append(names, p.Name)
+			}
+		}
+		wantSorts := slices.Clone(list.sorts)
+		for _, f := range list.sorts {
+			wantSorts = append(wantSorts, "-"+f)
+		}
+		if !slices.Equal(names, list.params) {
+			t.Errorf("%s documents %v, handler accepts %v", path, names, list.params)
+		}
+		if !slices.Equal(sorts, wantSorts) {
+			t.Errorf("%s documents sort %v, want %v", path, sorts, wantSorts)
+		}
+	}
+
+	r := httptest.NewRecorder()
+	h.ServeHTTP(r, httptest.NewRequest("GET", "/openapi.yaml", nil))
+	if r.Code != http.StatusOK || r.Header().Get("Content-Type") != "application/yaml" {
+		t.Errorf("GET /openapi.yaml: %d %s", r.Code, r.Header().Get("Content-Type"))
+	}
+}
+
+func TestHostDetail(t *testing.T) {
+	_, h := newTestServer(t)
+	p := testPayload("host-1")
+	p.CISResults = []models.CISResult{
+		{CheckID: "P1", Status: "fail", Timestamp: "2026-01-01T00:00:00Z"},
+		{CheckID: "P2", Status: "pass", Timestamp: "2026-01-01T00:00:00Z"},
+		{CheckID: "P3", Status: "pass", Timestamp: "2026-01-01T00:00:00Z"},
+		{CheckID: "P4", Status: "manual", Timestamp: "2026-01-01T00:00:00Z"},
+	}
+	call(t, h, "POST", "/ingest", p, agentKeyHeaders)
+
+	p.CISResults[1].Status = "fail"
+	for i := range p.CISResults {
+		p.CISResults[i].Timestamp = "2026-01-02T00:00:00Z"
+	}
+	p.Remediations = []models.RemediationResult{{RunID: "r1", CheckID: "P2", Status: "failed", Error: "read-only"}}
+	call(t, h, "POST", "/ingest", p, agentKeyHeaders)
+
+	r := call(t, h, "GET", "/hosts/host-1", nil, viewerHeaders)
+	var body struct {
+		Summary       models.HostSummary    `json:"summary"`
+		CISResults    []models.CISResult    `json:"cis_results"`
+		FailingChecks []models.FailingCheck `json:"failing_checks"`
+		Packages      json.RawMessage       `json:"packages"`
+	}
+	if err := json.Unmarshal(r.raw, &body); err != nil || r.status != http.StatusOK {
+		t.Fatalf("host detail: %d %s", r.status, r.raw)
+	}
+	if body.Packages != nil {
+		t.Error("host detail still carries packages")
+	}
+	sum := body.Summary
+	if sum.Packages != 1 || sum.Checks != 4 || sum.ByStatus["fail"] != 2 || sum.ComplianceScore == nil || *sum.ComplianceScore != 33 {
+		t.Errorf("summary = %+v", sum)
+	}
+	p1, p2 := body.CISResults[0], body.CISResults[1]
+	if p1.PreviousStatus != "" || p1.StatusChangedAt != "2026-01-01T00:00:00Z" {
+		t.Errorf("unchanged P1 = %+v", p1)
+	}
+	if p2.PreviousStatus != "pass" || p2.StatusChangedAt != "2026-01-02T00:00:00Z" {
+		t.Errorf("regressed P2 = %+v", p2)
+	}
+	if len(body.FailingChecks) != 2 || body.FailingChecks[0].Remediation != nil ||
+		body.FailingChecks[1].Remediation == nil || body.FailingChecks[1].Remediation.RunID != "r1" {
+		t.Errorf("failing checks = %+v", body.FailingChecks)
+	}
+}
+
+// failingPackages is a store whose package writes fail.
+type failingPackages struct{ *store.Memory }
+
+func (f failingPackages) Tenant(id string) store.Store {
+	return failingPackages{f.Memory.Tenant(id).(*store.Memory)}
+}
+
+func (failingPackages) ReplacePackages(context.Context, string, []models.Package) error {
+	return errors.New("throttled")
+}
+
+func TestIngestStoreFailure(t *testing.T) {
+	s, h := newTestServer(t)
+	s.Store = failingPackages{store.NewMemory()}
+	h = s.Handler()
+
+	// The agent must see the failure so it sends the payload again
+	r := call(t, h, "POST", "/ingest", testPayload("host-1"), agentKeyHeaders)
+	if r.status != http.StatusInternalServerError {
+		t.Fatalf("ingest with failing store: %d %v", r.status, r.body)
+	}
+	// Payloads without packages are unaffected
+	partial := testPayload("host-1")
+	partial.Tasks = []string{models.SectionCIS}
+	if r := call(t, h, "POST", "/ingest", partial, agentKeyHeaders); r.status != http.StatusOK {
+		t.Fatalf("cis-only ingest: %d %v", r.status, r.body)
+	}
+}
+
+func TestRouting(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.AllowedOrigins = []string{"https://dashboard.example"}
+	h := s.Handler()
+
+	r := call(t, h, "GET", "/nope", nil, nil)
+	if r.status != http.StatusNotFound || r.body["error"] != "Not found" {
+		t.Errorf("unknown route: %d %v", r.status, r.body)
+	}
+	if r := call(t, h, "GET", "/ingest", nil, nil); r.status != http.StatusNotFound {
+		t.Errorf("wrong method: %d", r.status)
+	}
+	if r := call(t, h, "GET", "/health", nil, nil); r.status != http.StatusOK || r.header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("health: %d %v", r.status, r.header)
+	}
+
+	for origin, allowed := range map[string]bool{"https://dashboard.example": true, "https://evil.example": false} {
+		req := httptest.NewRequest("OPTIONS", "/hosts", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		got := rec.Header().Get("Access-Control-Allow-Origin")
+		if rec.Code != http.StatusOK || (got == origin) != allowed || (rec.Header().Get("Access-Control-Allow-Headers") != "") != allowed {
+			t.Errorf("preflight from %s: %d %v", origin, rec.Code, rec.Header())
+		}
+	}
+}
+
+func TestEnrollment(t *testing.T) {
+	s, h := newTestServer(t)
+	s.AuthMode = AuthHost
+
+	r := call(t, h, "POST", "/enrollment-tokens", nil, adminHeaders)
+	token, _ := r.body["token"].(string)
+	if r.status != http.StatusOK || token == "" {
+		t.Fatalf("create token: %d %v", r.status, r.body)
+	}
+
+	r = call(t, h, "POST", "/enroll", map[string]string{"token": token, "host_id": "host-1"}, nil)
+	secret, _ := r.body["credential"].(string)
+	if r.status != http.StatusOK || secret == "" {
+		t.Fatalf("enroll: %d %v", r.status, r.body)
+	}
+	if r := call(t, h, "POST", "/enroll", map[string]string{"token": token, "host_id": "host-2"}, nil); r.status != http.StatusUnauthorized {
+		t.Errorf("token reuse: %d", r.status)
+	}
+
+	agent := map[string]string{"Authorization": "Bearer " + secret, "X-Host-ID": "host-1"}
+	if r := call(t, h, "POST", "/ingest", testPayload("host-1"), agent); r.status != http.StatusOK {
+		t.Errorf("agent ingest: %d %v", r.status, r.body)
+	}
+	if r := call(t, h, "POST", "/ingest", testPayload("host-2"), agent); r.status != http.StatusForbidden {
+		t.Errorf("ingest for another host: %d", r.status)
+	}
+	if r := call(t, h, "POST", "/ingest", testPayload("host-1"), agentKeyHeaders); r.status != http.StatusUnauthorized {
+		t.Errorf("API key ingest in host mode: %d", r.status)
+	}
+	if r := call(t, h, "POST", "/enrollment-tokens", nil, agent); r.status != http.StatusForbidden {
+		t.Errorf("agent calling admin endpoint: %d", r.status)
+	}
+
+	// The old credential stays valid until the rotated one is used
+	r = call(t, h, "POST", "/hosts/host-1/credentials/rotate", nil, agent)
+	rotated, _ := r.body["credential"].(string)
+	if r.status != http.StatusOK || rotated == "" {
+		t.Fatalf("rotate: %d %v", r.status, r.body)
+	}
+	if r := call(t, h, "POST", "/heartbeat", models.Heartbeat{HostID: "host-1"}, agent); r.status != http.StatusOK {
+		t.Errorf("heartbeat with previous credential: %d", r.status)
+	}
+	newAgent := map[string]string{"Authorization": "Bearer " + rotated, "X-Host-ID": "host-1"}
+	call(t, h, "POST", "/heartbeat", models.Heartbeat{HostID: "host-1"}, newAgent)
+	if r := call(t, h, "POST", "/heartbeat", models.Heartbeat{HostID: "host-1"}, agent); r.status != http.StatusUnauthorized {
+		t.Errorf("previous credential after new one was used: %d", r.status)
+	}
+
+	if r := call(t, h, "POST", "/hosts/host-1/credentials/revoke", nil, adminHeaders); r.status != http.StatusOK {
+		t.Fatalf("revoke: %d", r.status)
+	}
+	if r := call(t, h, "POST", "/heartbeat", models.Heartbeat{HostID: "host-1"}, newAgent); r.status != http.StatusUnauthorized {
+		t.Errorf("revoked credential: %d", r.status)
+	}
+}
+
+func TestRevokedCertificate(t *testing.T) {
+	_, h := newTestServer(t)
+	cert := &x509.Certificate{SerialNumber: big.NewInt(0xabc), Subject: pkix.Name{CommonName: "host-1"}}
+	mtls := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		h.ServeHTTP(w, r)
+	})
+
+	r := call(t, h, "POST", "/enrollment-tokens", nil, adminHeaders)
+	token, _ := r.body["token"].(string)
+	if r := call(t, h, "POST", "/enroll", map[string]string{"token": token, "host_id": "host-1"}, nil); r.status != http.StatusOK {
+		t.Fatalf("enroll: %d %v", r.status, r.body)
+	}
+	if r := call(t, mtls, "POST", "/hosts/host-1/credentials/rotate", nil, nil); r.status != http.StatusOK {
+		t.Fatalf("rotate with certificate: %d %v", r.status, r.body)
+	}
+
+	if r := call(t, h, "POST", "/hosts/host-1/certificates/revoke", map[string]string{"serial": "0A:BC"}, adminHeaders); r.status != http.StatusOK {
+		t.Fatalf("revoke certificate: %d %v", r.status, r.body)
+	}
+	if r := call(t, mtls, "POST", "/ingest", testPayload("host-1"), nil); r.status != http.StatusForbidden {
+		t.Errorf("ingest with revoked certificate: %d", r.status)
+	}
+	if r := call(t, mtls, "POST", "/hosts/host-1/credentials/rotate", nil, nil); r.status != http.StatusForbidden {
+		t.Errorf("rotate with revoked certificate: %d %v", r.status, r.body)
+	}
+}
+
+func signedHeaders(key ed25519.PrivateKey, seq uint64, body []byte) map[string]string {
+	headers := signing.Sign(key, time.Now().Unix(), seq, body).Headers()
+	headers["X-API-Key"] = testAPIKey
+	return headers
+}
+
+// enrollHost enrolls hostID with the public key of key and returns the
+// headers of its credential.
+func enrollHost(t *testing.T, h http.Handler, hostID string, key ed25519.PrivateKey) map[string]string {
+	t.Helper()
+	r := call(t, h, "POST", "/enrollment-tokens", nil, adminHeaders)
+	token, _ := r.body["token"].(string)
+	enrollment := map[string]string{"token": token, "host_id": hostID}
+	if key != nil {
+		enrollment["public_key"] = signing.EncodePublicKey(key.Public().(ed25519.PublicKey))
+	}
+	r = call(t, h, "POST", "/enroll", enrollment, nil)
+	secret, _ := r.body["credential"].(string)
+	if r.status != http.StatusOK || secret == "" {
+		t.Fatalf("enroll %s: %d %v", hostID, r.status, r.body)
+	}
+	return map[string]string{"Authorization": "Bearer " + secret, "X-Host-ID": hostID}
+}
+
+func TestSignedIngest(t *testing.T) {
+	_, h := newTestServer(t)
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	enrollHost(t, h, "host-1", key)
+	body, _ := json.Marshal(testPayload("host-1"))
+
+	if r := call(t, h, "POST", "/ingest", body, signedHeaders(key, 1, body)); r.status != http.StatusOK {
+		t.Fatalf("signed ingest: %d %v", r.status, r.body)
+	}
+	if r := call(t, h, "POST", "/ingest", body, signedHeaders(key, 1, body)); r.status != http.StatusConflict {
+		t.Errorf("replay: %d", r.status)
+	}
+	if r := call(t, h, "POST", "/ingest", body, agentKeyHeaders); r.status != http.StatusUnauthorized {
+		t.Errorf("unsigned after key registration: %d", r.status)
+	}
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	if r := call(t, h, "POST", "/ingest", body, signedHeaders(other, 2, body)); r.status != http.StatusUnauthorized {
+		t.Errorf("signed with another key: %d", r.status)
+	}
+	if r := call(t, h, "POST", "/ingest", body, signedHeaders(key, 2, body)); r.status != http.StatusOK {
+		t.Errorf("next sequence: %d %v", r.status, r.body)
+	}
+}
+
+func TestSigningKeyFirstUse(t *testing.T) {
+	s, h := newTestServer(t)
+	st := s.Store.Tenant(store.DefaultTenant)
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	body, _ := json.Marshal(testPayload("host-1"))
+
+	// The shared agent key cannot claim the signing key of host-1
+	if r := call(t, h, "POST", "/ingest", body, signedHeaders(other, 1, body)); r.status != http.StatusOK {
+		t.Fatalf("signed ingest with the agent key: %d %v", r.status, r.body)
+	}
+	if registered, _ := st.SigningKey(context.Background(), "host-1"); registered != "" {
+		t.Fatalf("agent key registered %q", registered)
+	}
+
+	agent := enrollHost(t, h, "host-1", nil)
+	signed := signing.Sign(key, time.Now().Unix(), 1, body).Headers()
+	for k, v := range agent {
+		signed[k] = v
+	}
+	if r := call(t, h, "POST", "/ingest", body, signed); r.status != http.StatusOK {
+		t.Fatalf("signed ingest with the host credential: %d %v", r.status, r.body)
+	}
+	want := signing.EncodePublicKey(key.Public().(ed25519.PublicKey))
+	if registered, _ := st.SigningKey(context.Background(), "host-1"); registered != want {
+		t.Errorf("registered key %q, want %q", registered, want)
+	}
+	if r := call(t, h, "POST", "/ingest", body, signedHeaders(other, 2, body)); r.status != http.StatusUnauthorized {
+		t.Errorf("agent key signed with another key: %d", r.status)
+	}
+}
+
+func TestSBOMIngest(t *testing.T) {
+	s, h := newTestServer(t)
+	st := s.Store.Tenant(store.DefaultTenant)
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	enrollHost(t, h, "host-1", key)
+	body, _ := json.Marshal(testPayload("host-1"))
+	if r := call(t, h, "POST", "/ingest", body, signedHeaders(key, 1, body)); r.status != http.StatusOK {
+		t.Fatalf("signed ingest: %d %v", r.status, r.body)
+	}
+
+	doc := []byte(`{"bomFormat": "CycloneDX", "components": [{"name": "curl", "version": "8.5.0"}]}`)
+	if r := call(t, h, "POST", "/ingest/sbom?host_id=host-1", doc, agentKeyHeaders); r.status != http.StatusUnauthorized {
+		t.Errorf("unsigned SBOM for a signing host: %d", r.status)
+	}
+	if r := call(t, h, "POST", "/ingest/sbom?host_id=host-1", doc, signedHeaders(key, 1, doc)); r.status != http.StatusConflict {
+		t.Errorf("replayed sequence: %d", r.status)
+	}
+	if r := call(t, h, "POST", "/ingest/sbom?host_id=host-1", doc, signedHeaders(key, 2, doc)); r.status != http.StatusOK {
+		t.Fatalf("signed SBOM: %d %v", r.status, r.body)
+	}
+	host, _ := st.GetHost(context.Background(), "host-1")
+	if host.OSID != "ubuntu" || host.AgentVersion == sbomAgentVersion || len(host.IPAddresses) != 1 {
+		t.Errorf("host details overwritten: %+v", host.Host)
+	}
+	if pkgs, _ := st.HostPackages(context.Background(), "host-1"); len(pkgs) != 1 || pkgs[0].Name != "curl" {
+		t.Errorf("packages: %+v", pkgs)
+	}
+	if r := call(t, h, "POST", "/ingest/sbom?host_id=host-1", doc, adminHeaders); r.status != http.StatusOK {
+		t.Errorf("admin SBOM: %d %v", r.status, r.body)
+	}
+
+	if r := call(t, h, "POST", "/ingest/sbom?host_id=appliance-1", doc, agentKeyHeaders); r.status != http.StatusOK {
+		t.Fatalf("SBOM for a new host: %d %v", r.status, r.body)
+	}
+	if host, _ := st.GetHost(context.Background(), "appliance-1"); host == nil || host.AgentVersion != sbomAgentVersion {
+		t.Errorf("SBOM-only host: %+v", host)
+	}
+}
+
+func TestChunkedUpload(t *testing.T) {
+	_, h := newTestServer(t)
+	body, _ := json.Marshal(testPayload("host-1"))
+	data, _ := upload.Encode(upload.EncodingGzip, body)
+	chunks := upload.Split(data, 64)
+	session := upload.Session{Parts: len(chunks), Size: int64(len(data)), SHA256: upload.Digest(data), ContentEncoding: upload.EncodingGzip}
+
+	r := call(t, h, "POST", "/ingest/uploads", session, agentKeyHeaders)
+	id, _ := r.body["upload_id"].(string)
+	if r.status != http.StatusOK || id == "" {
+		t.Fatalf("create upload: %d %v", r.status, r.body)
+	}
+	if r := call(t, h, "POST", "/ingest/uploads/"+id+"/complete", nil, agentKeyHeaders); r.status != http.StatusBadRequest {
+		t.Errorf("complete with parts missing: %d", r.status)
+	}
+	for i, chunk := range chunks {
+		if r := call(t, h, "POST", "/ingest/uploads/"+id+"/parts/"+strconv.Itoa(i+1), chunk, agentKeyHeaders); r.status != http.StatusOK {
+			t.Fatalf("part %d: %d %v", i+1, r.status, r.body)
+		}
+	}
+	// A rejected payload leaves the session open for another attempt
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	stale := signing.Sign(key, time.Now().Add(-time.Hour).Unix(), 1, body).Headers()
+	stale["X-API-Key"] = testAPIKey
+	if r := call(t, h, "POST", "/ingest/uploads/"+id+"/complete", nil, stale); r.status != http.StatusUnauthorized {
+		t.Errorf("complete with a stale signature: %d", r.status)
+	}
+	if r := call(t, h, "POST", "/ingest/uploads/"+id+"/complete", nil, agentKeyHeaders); r.status != http.StatusOK {
+		t.Fatalf("complete: %d %v", r.status, r.body)
+	}
+	if r := call(t, h, "POST", "/ingest/uploads/"+id+"/complete", nil, agentKeyHeaders); r.status != http.StatusConflict {
+		t.Errorf("second complete: %d", r.status)
+	}
+	if r := call(t, h, "GET", "/hosts/host-1", nil, viewerHeaders); r.status != http.StatusOK {
+		t.Errorf("uploaded host not stored: %d", r.status)
+	}
+}
+
+func TestPolicyDelivery(t *testing.T) {
+	s, h := newTestServer(t)
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+
+	assigned := policy.Assigned{Policy: policy.Policy{ID: "ubuntu", LogLevel: "debug"}, Assign: policy.Assignment{OSIDs: []string{"ubuntu"}}}
+	if r := call(t, h, "POST", "/policies", assigned, adminHeaders); r.status != http.StatusOK {
+		t.Fatalf("put policy: %d %v", r.status, r.body)
+	}
+	if r := call(t, h, "POST", "/ingest", testPayload("host-1"), agentKeyHeaders); r.body["policy"] != nil {
+		t.Errorf("policy delivered without a signing key: %v", r.body)
+	}
+
+	s.PolicySigningKey = key
+	r := call(t, h, "POST", "/ingest", testPayload("host-1"), agentKeyHeaders)
+	var delivered struct {
+		Policy policy.Signed `json:"policy"`
+	}
+	json.Unmarshal(r.raw, &delivered)
+	doc, err := delivered.Policy.Verify(pub)
+	if err != nil {
+		t.Fatalf("verify delivered policy: %v (%v)", err, r.body)
+	}
+	if doc.Policy.LogLevel != "debug" || doc.HostID != "host-1" {
+		t.Errorf("document = %+v", doc)
+	}
+
+	if r := call(t, h, "GET", "/agent-config?host_id=host-1", nil, agentKeyHeaders); r.status != http.StatusOK || r.body["policy"] == nil {
+		t.Errorf("agent-config: %d %v", r.status, r.body)
+	}
+}
+
+// signJWT signs an RS256 token over claims for key ID "k1".
+func signJWT(key *rsa.PrivateKey, claims map[string]interface{}) string {
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, _ := json.Marshal(claims)
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	return signed + "." + enc.EncodeToString(sig)
+}
+
+func TestAccessControl(t *testing.T) {
+	s, h := newTestServer(t)
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "k1",
+		"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(path, jwks, 0o600)
+	verifier, err := oidc.NewVerifier(oidc.Config{Issuer: "https://idp.example", Audience: "visiblaze", JWKSFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.OIDC, s.OIDCRoleClaim = verifier, "groups"
+	bearerJWT := func(groups []string, exp time.Duration) map[string]string {
+		token := signJWT(key, map[string]interface{}{
+			"iss": "https://idp.example", "aud": "visiblaze", "sub": "alice",
+			"exp": time.Now().Add(exp).Unix(), "groups": groups,
+		})
+		return map[string]string{"Authorization": "Bearer " + token}
+	}
+
+	call(t, h, "POST", "/ingest", testPayload("host-1"), agentKeyHeaders)
+	call(t, h, "POST", "/ingest", testPayload("host-2"), agentKeyHeaders)
+
+	for _, tc := range []struct {
+		name, method, path string
+		headers            map[string]string
+		status             int
+	}{
+		{"anonymous read", "GET", "/hosts", nil, http.StatusUnauthorized},
+		{"unknown token", "GET", "/hosts", map[string]string{"Authorization": "Bearer nope"}, http.StatusUnauthorized},
+		{"health is open", "GET", "/health", nil, http.StatusOK},
+		{"agent key read", "GET", "/hosts", agentKeyHeaders, http.StatusForbidden},
+		{"agent key export", "GET", "/hosts/host-1/sbom", agentKeyHeaders, http.StatusForbidden},
+		{"agent key tokens", "POST", "/enrollment-tokens", agentKeyHeaders, http.StatusForbidden},
+		{"agent key delete", "DELETE", "/hosts/host-1", agentKeyHeaders, http.StatusForbidden},
+		{"viewer read", "GET", "/hosts/host-1", viewerHeaders, http.StatusOK},
+		{"viewer ingest", "POST", "/heartbeat", viewerHeaders, http.StatusForbidden},
+		{"viewer export", "GET", "/hosts/host-1/sbom", viewerHeaders, http.StatusForbidden},
+		{"viewer policy", "POST", "/policies", viewerHeaders, http.StatusForbidden},
+		{"viewer rotate", "POST", "/hosts/host-1/credentials/rotate", viewerHeaders, http.StatusForbidden},
+		{"operator export", "GET", "/hosts/host-1/sbom", operatorHeaders, http.StatusOK},
+		{"operator tokens", "POST", "/enrollment-tokens", operatorHeaders, http.StatusOK},
+		{"operator delete", "DELETE", "/hosts/host-1", operatorHeaders, http.StatusForbidden},
+		{"operator revoke", "POST", "/hosts/host-1/credentials/revoke", operatorHeaders, http.StatusForbidden},
+		{"oidc viewer", "GET", "/hosts", bearerJWT([]string{"staff", "viewer"}, time.Hour), http.StatusOK},
+		{"oidc viewer export", "GET", "/hosts/host-1/sbom", bearerJWT([]string{"viewer"}, time.Hour), http.StatusForbidden},
+		{"oidc highest role", "GET", "/hosts/host-1/sbom", bearerJWT([]string{"viewer", "operator"}, time.Hour), http.StatusOK},
+		{"oidc no role", "GET", "/hosts", bearerJWT([]string{"staff"}, time.Hour), http.StatusForbidden},
+		{"oidc agent role", "POST", "/heartbeat", bearerJWT([]string{"agent"}, time.Hour), http.StatusForbidden},
+		{"oidc expired", "GET", "/hosts", bearerJWT([]string{"admin"}, -time.Hour), http.StatusUnauthorized},
+		{"oidc admin delete", "DELETE", "/hosts/host-2", bearerJWT([]string{"admin"}, time.Hour), http.StatusOK},
+		{"admin delete", "DELETE", "/hosts/host-1", adminHeaders, http.StatusOK},
+		{"deleted", "GET", "/hosts/host-1", viewerHeaders, http.StatusNotFound},
+		{"delete unknown", "DELETE", "/hosts/host-1", adminHeaders, http.StatusNotFound},
+	} {
+		if r := call(t, h, tc.method, tc.path, nil, tc.headers); r.status != tc.status {
+			t.Errorf("%s: %s %s = %d %v, want %d", tc.name, tc.method, tc.path, r.status, r.body, tc.status)
+		}
+	}
+
+	r := call(t, h, "GET", "/hosts", nil, viewerHeaders)
+	if hosts := r.body["hosts"].([]interface{}); len(hosts) != 0 {
+		t.Errorf("hosts after delete = %v", hosts)
+	}
+	if r := call(t, h, "GET", "/apps", nil, viewerHeaders); len(r.body["packages"].([]interface{})) != 0 {
+		t.Errorf("packages after delete = %v", r.body)
+	}
+
+	// With nothing configured every caller is an admin
+	open := &Server{Store: store.NewMemory(), Liveness: liveness.Default}
+	if r := call(t, open.Handler(), "DELETE", "/hosts/nope", nil, nil); r.status != http.StatusNotFound {
+		t.Errorf("open server: %d %v", r.status, r.body)
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	s, h := newTestServer(t)
+	offline := liveness.Thresholds{StaleAfter: time.Nanosecond, OfflineAfter: time.Nanosecond}
+	s.Tenants = []Tenant{{ID: "acme", AgentKey: "acme-key", Liveness: &offline}, {ID: "globex", AgentKey: "globex-key"}}
+	s.Tokens = append(s.Tokens,
+		APIToken{Name: "acme-admin", Role: RoleAdmin, Tenant: "acme", SHA256: HashAPIToken("acme-token")},
+		APIToken{Name: "globex-admin", Role: RoleAdmin, Tenant: "globex", SHA256: HashAPIToken("globex-token")},
+		APIToken{Name: "stray", Role: RoleAdmin, Tenant: "initech", SHA256: HashAPIToken("stray-token")},
+	)
+	acme := map[string]string{"Authorization": "Bearer acme-token"}
+	globex := map[string]string{"Authorization": "Bearer globex-token"}
+
+	// The same host ID reports into two tenants
+	call(t, h, "POST", "/ingest", testPayload("host-1"), map[string]string{"X-API-Key": "acme-key"})
+	other := testPayload("host-1")
+	other.Host.Hostname = "globex-1"
+	call(t, h, "POST", "/ingest", other, map[string]string{"X-API-Key": "globex-key"})
+	call(t, h, "POST", "/ingest", testPayload("host-2"), map[string]string{"X-API-Key": "globex-key"})
+
+	hosts := func(headers map[string]string) []interface{} {
+		t.Helper()
+		r := call(t, h, "GET", "/hosts", nil, headers)
+		if r.status != http.StatusOK {
+			t.Fatalf("hosts: %d %v", r.status, r.body)
+		}
+		return r.body["hosts"].([]interface{})
+	}
+	if got := hosts(acme); len(got) != 1 || got[0].(map[string]interface{})["status"] != liveness.Offline {
+		t.Errorf("acme hosts = %v", got)
+	}
+	if got := hosts(globex); len(got) != 2 {
+		t.Errorf("globex hosts = %v", got)
+	}
+	if got := hosts(adminHeaders); len(got) != 0 {
+		t.Errorf("default tenant hosts = %v", got)
+	}
+	if r := call(t, h, "GET", "/hosts/host-2", nil, acme); r.status != http.StatusNotFound {
+		t.Errorf("another tenant's host: %d", r.status)
+	}
+	if r := call(t, h, "GET", "/hosts/host-1", nil, globex); r.body["host"].(map[string]interface{})["hostname"] != "globex-1" {
+		t.Errorf("globex host-1 = %v", r.body)
+	}
+	if r := call(t, h, "DELETE", "/hosts/host-2", nil, acme); r.status != http.StatusNotFound {
+		t.Errorf("delete another tenant's host: %d", r.status)
+	}
+	if r := call(t, h, "GET", "/hosts", nil, map[string]string{"Authorization": "Bearer stray-token"}); r.status != http.StatusUnauthorized {
+		t.Errorf("token of an unknown tenant: %d", r.status)
+	}
+
+	// Enrollment tokens and credentials carry their tenant
+	r := call(t, h, "POST", "/enrollment-tokens", nil, acme)
+	token, _ := r.body["token"].(string)
+	r = call(t, h, "POST", "/enroll", map[string]string{"token": token, "host_id": "host-3"}, nil)
+	secret, _ := r.body["credential"].(string)
+	if r.status != http.StatusOK || r.body["tenant_id"] != "acme" || !strings.HasPrefix(secret, "vzh_acme.") {
+		t.Fatalf("enroll: %d %v", r.status, r.body)
+	}
+	agent := map[string]string{"Authorization": "Bearer " + secret, "X-Host-ID": "host-3"}
+	if r := call(t, h, "POST", "/heartbeat", models.Heartbeat{HostID: "host-3"}, agent); r.status != http.StatusOK {
+		t.Errorf("heartbeat: %d %v", r.status, r.body)
+	}
+	if got := hosts(acme); len(got) != 2 {
+		t.Errorf("acme hosts after enrollment = %v", got)
+	}
+	forged := map[string]string{"Authorization": "Bearer vzh_globex." + strings.TrimPrefix(secret, "vzh_acme."), "X-Host-ID": "host-3"}
+	if r := call(t, h, "POST", "/heartbeat", models.Heartbeat{HostID: "host-3"}, forged); r.status != http.StatusUnauthorized {
+		t.Errorf("credential moved to another tenant: %d", r.status)
+	}
+}
+
+func TestTagsAndGroups(t *testing.T) {
+	s, h := newTestServer(t)
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	s.PolicySigningKey = key
+
+	ingest := func(hostID, hostname string, tags []string) response {
+		p := testPayload(hostID)
+		p.Host.Hostname, p.Host.Tags = hostname, tags
+		return call(t, h, "POST", "/ingest", p, agentKeyHeaders)
+	}
+	ingest("h1", "web-1", []string{"env:prod", "env:prod"})
+	ingest("h2", "web-2", []string{"env:dev"})
+	ingest("h3", "db-1", []string{"env:prod"})
+	if r := ingest("h4", "web-4", []string{"bad tag"}); r.status != http.StatusBadRequest {
+		t.Errorf("invalid agent tag: %d %v", r.status, r.body)
+	}
+
+	// User tags sit beside the agent's and survive its next report
+	if r := call(t, h, "POST", "/hosts/h2/tags", map[string][]string{"tags": {"env:prod"}}, viewerHeaders); r.status != http.StatusForbidden {
+		t.Errorf("viewer tagging: %d", r.status)
+	}
+	if r := call(t, h, "POST", "/hosts/nope/tags", map[string][]string{"tags": {"x"}}, operatorHeaders); r.status != http.StatusNotFound {
+		t.Errorf("tagging unknown host: %d", r.status)
+	}
+	r := call(t, h, "POST", "/hosts/h2/tags", map[string][]string{"tags": {"team:web", "env:prod"}}, operatorHeaders)
+	if r.status != http.StatusOK || fmt.Sprint(r.body["host"].(map[string]interface{})["tags"]) != "[env:dev env:prod team:web]" {
+		t.Fatalf("tag h2: %d %v", r.status, r.body)
+	}
+	ingest("h2", "web-2", []string{"env:dev"})
+
+	group := map[string]interface{}{"id": "prod-web", "rules": []map[string]string{
+		{"field": "tag", "op": "eq", "value": "env:prod"},
+		{"field": "hostname", "op": "prefix", "value": "web-"},
+	}}
+	if r := call(t, h, "POST", "/groups", map[string]interface{}{"id": "prod-web"}, operatorHeaders); r.status != http.StatusBadRequest {
+		t.Errorf("group without rules: %d", r.status)
+	}
+	if r := call(t, h, "POST", "/groups", group, operatorHeaders); r.status != http.StatusOK {
+		t.Fatalf("put group: %d %v", r.status, r.body)
+	}
+	if r := call(t, h, "GET", "/groups", nil, viewerHeaders); len(r.body["groups"].([]interface{})) != 1 {
+		t.Errorf("groups = %v", r.body)
+	}
+
+	memberIDs := func(items []interface{}, key string) string {
+		var ids []string
+		for _, it := range items {
+			ids = append(ids, it.(map[string]interface{})[key].(string))
+		}
+		return fmt.Sprint(ids)
+	}
+	for path, want := range map[string]string{
+		"/hosts?group=prod-web":                       "[h1 h2]",
+		"/apps?group=prod-web":                        "[h1 h2]",
+		"/cis-results?group=prod-web":                 "[h1 h2]",
+		"/software/hosts?name=openssl&group=prod-web": "[h1 h2]",
+	} {
+		r := call(t, h, "GET", path, nil, viewerHeaders)
+		var items []interface{}
+		for _, v := range r.body {
+			if list, ok := v.([]interface{}); ok {
+				items = list
+			}
+		}
+		if got := memberIDs(items, "host_id"); r.status != http.StatusOK || got != want {
+			t.Errorf("%s = %s (%d %v), want %s", path, got, r.status, r.body, want)
+		}
+	}
+	r = call(t, h, "GET", "/software?group=prod-web", nil, viewerHeaders)
+	if sw := r.body["software"].([]interface{}); len(sw) != 1 || sw[0].(map[string]interface{})["host_count"] != 2.0 {
+		t.Errorf("software of prod-web = %v", r.body)
+	}
+	if r := call(t, h, "GET", "/apps?group=nope", nil, viewerHeaders); r.status != http.StatusBadRequest {
+		t.Errorf("unknown group: %d %v", r.status, r.body)
+	}
+	r = call(t, h, "GET", "/hosts/h1", nil, viewerHeaders)
+	if groups := r.body["host"].(map[string]interface{})["groups"]; fmt.Sprint(groups) != "[prod-web]" {
+		t.Errorf("h1 groups = %v", groups)
+	}
+
+	// Policies follow group membership
+	assigned := policy.Assigned{Policy: policy.Policy{ID: "web", LogLevel: "debug"}, Assign: policy.Assignment{Groups: []string{"prod-web"}}}
+	call(t, h, "POST", "/policies", assigned, adminHeaders)
+	if r := call(t, h, "GET", "/agent-config?host_id=h2", nil, agentKeyHeaders); r.status != http.StatusOK {
+		t.Errorf("policy for member: %d %v", r.status, r.body)
+	}
+	if r := call(t, h, "GET", "/agent-config?host_id=h3", nil, agentKeyHeaders); r.status != http.StatusNotFound {
+		t.Errorf("policy for non-member: %d %v", r.status, r.body)
+	}
+
+	if r := call(t, h, "DELETE", "/groups/prod-web", nil, operatorHeaders); r.status != http.StatusOK {
+		t.Errorf("delete group: %d", r.status)
+	}
+	if r := call(t, h, "DELETE", "/groups/prod-web", nil, operatorHeaders); r.status != http.StatusNotFound {
+		t.Errorf("delete group again: %d", r.status)
+	}
+	if r := call(t, h, "GET", "/agent-config?host_id=h2", nil, agentKeyHeaders); r.status != http.StatusNotFound {
+		t.Errorf("policy after group deleted: %d %v", r.status, r.body)
+	}
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+)
+
+// Query parameters and sort fields of the software catalog and its host
+// drill-down.
+var (
+	softwareParams         = []string{"name", "manager", "group"}
+	softwareSortFields     = []string{"name", "manager", "host_count"}
+	softwareHostParams     = []string{"name", "manager", "version", "group"}
+	softwareHostSortFields = []string{"host_id", "version"}
+)
+
+// catalog returns the software catalog entries matching q. The store keeps
+// the counts of the whole fleet; the catalog of a group is aggregated from
+// its members' inventories, so it costs a read of those.
+func (s *Server) catalog(ctx context.Context, q store.SoftwareQuery, members map[string]bool) ([]models.SoftwareEntry, error) {
+	if members == nil {
+		return s.tenantStore(ctx).SoftwareCatalog(ctx, q)
+	}
+	packages, err := s.allPackages(ctx, store.PackageQuery{HostIDs: members, Name: q.Name, Manager: q.Manager})
+	if err != nil {
+		return nil, err
+	}
+	return store.Catalog(packages), nil
+}
+
+// allPackages reads every package matching q, page by page.
+func (s *Server) allPackages(ctx context.Context, q store.PackageQuery) ([]models.Package, error) {
+	var packages []models.Package
+	q.Limit = maxLimit
+	for {
+		page, next, err := s.tenantStore(ctx).ListPackages(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, page...)
+		if next == "" {
+			return packages, nil
+		}
+		q.NextToken = next
+	}
+}
+
+func (s *Server) listSoftware(w http.ResponseWriter, r *http.Request) {
+	q, ok := parseList(w, r, softwareParams, softwareSortFields)
+	if !ok {
+		return
+	}
+	members, err := s.groupHosts(r.Context(), q.Get("group"))
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	entries, err := s.catalog(r.Context(), store.SoftwareQuery{Name: q.Get("name"), Manager: q.Get("manager")}, members)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load software catalog: "+err.Error())
+		return
+	}
+
+	rows := map[string]models.SoftwareEntry{}
+	for _, e := range entries {
+		value := e.Name
+		switch q.sort.Field {
+		case "manager":
+			value = e.Manager
+		case "host_count":
+			value = fmt.Sprintf("%010d", e.HostCount)
+		}
+		rows[store.SortKey(q.sort, value, e.Name+"\x00"+e.Manager)] = e
+	}
+	keys := make([]string, 0, len(rows))
+	for k := range rows {
+		keys = append(keys, k)
+	}
+	page, next, err := store.Page(keys, q.sort, q.limit, q.token, func(key string) models.SoftwareEntry {
+		return rows[key]
+	})
+	if err != nil {
+		writeListError(w, "software catalog", err)
+		return
+	}
+	writePage(w, "software", page, next, nil)
+}
+
+// listSoftwareHosts drills down from a catalog entry to the hosts that have
+// it, optionally at one version. Each host is listed once per manager with
+// the versions and architectures it has installed, so every package row of
+// the entry is read and the rows are paged in memory, like the catalog;
+// each host on the page is then read once.
+func (s *Server) listSoftwareHosts(w http.ResponseWriter, r *http.Request) {
+	q, ok := parseList(w, r, softwareHostParams, softwareHostSortFields)
+	if !ok {
+		return
+	}
+	if q.Get("name") == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	ctx := r.Context()
+	members, err := s.groupHosts(ctx, q.Get("group"))
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	packages, err := s.allPackages(ctx, store.PackageQuery{
+		HostIDs: members,
+		Name:    q.Get("name"),
+		Manager: q.Get("manager"),
+		Version: q.Get("version"),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load packages: "+err.Error())
+		return
+	}
+
+	byHost := map[[2]string]*models.SoftwareHost{}
+	for _, pkg := range packages {
+		hk := [2]string{pkg.HostID, pkg.Manager}
+		h := byHost[hk]
+		if h == nil {
+			h = &models.SoftwareHost{HostID: pkg.HostID, Manager: pkg.Manager, Versions: []string{}, Arches: []string{}}
+			byHost[hk] = h
+		}
+		if !slices.Contains(h.Versions, pkg.Version) {
+			h.Versions = append(h.Versions, pkg.Version)
+		}
+		if pkg.Arch != "" && !slices.Contains(h.Arches, pkg.Arch) {
+			h.Arches = append(h.Arches, pkg.Arch)
+		}
+	}
+	rows := map[string]*models.SoftwareHost{}
+	for hk, h := range byHost {
+		sort.Strings(h.Versions)
+		sort.Strings(h.Arches)
+		value := h.HostID
+		if q.sort.Field == "version" {
+			value = strings.Join(h.Versions, ",")
+		}
+		rows[store.SortKey(q.sort, value, hk[0]+"\x00"+hk[1])] = h
+	}
+	page, next, err := store.Page(slices.Collect(maps.Keys(rows)), q.sort, q.limit, q.token, func(key string) *models.SoftwareHost {
+		return rows[key]
+	})
+	if err != nil {
+		writeListError(w, "packages", err)
+		return
+	}
+
+	now := time.Now()
+	hosts := []models.SoftwareHost{}
+	seen := map[string]*store.Host{}
+	for _, h := range page {
+		host, ok := seen[h.HostID]
+		if !ok {
+			host, err = s.tenantStore(ctx).GetHost(ctx, h.HostID)
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				writeError(w, http.StatusInternalServerError, "Failed to load host: "+err.Error())
+				return
+			}
+			seen[h.HostID] = host
+		}
+		if host == nil {
+			// Pruned since its packages were read
+			continue
+		}
+		status := s.withStatus(ctx, host.Host, now)
+		h.Hostname, h.OSID, h.Status = status.Hostname, status.OSID, status.Status
+		hosts = append(hosts, *h)
+	}
+	writePage(w, "hosts", hosts, next, nil)
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/credential"
+	"github.com/visiblaze/sec-agent/pkg/signing"
+)
+
+const (
+	defaultTokenTTL = 24 * time.Hour
+	maxTokenTTL     = 30 * 24 * time.Hour
+)
+
+// createEnrollmentToken issues a one-time enrollment token. The token is
+// returned once and only its hash is stored.
+func (s *Server) createEnrollmentToken(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		TTLHours int    `json:"ttl_hours"`
+		Note     string `json:"note"`
+	}
+	raw, err := readBody(r)
+	if err == nil && len(raw) > 0 {
+		err = json.Unmarshal(raw, &body)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	ttl := defaultTokenTTL
+	if body.TTLHours > 0 {
+		ttl = time.Duration(body.TTLHours) * time.Hour
+	}
+	if ttl > maxTokenTTL {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("ttl_hours must be at most %d", int(maxTokenTTL.Hours())))
+		return
+	}
+
+	token, err := credential.NewToken(secretScope(tenantID(r.Context())))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	now := time.Now().UTC()
+	expires := now.Add(ttl)
+
+	err = s.tenantStore(r.Context()).CreateEnrollmentToken(r.Context(), store.EnrollmentToken{
+		Hash:      credential.Hash(token),
+		CreatedAt: now,
+		ExpiresAt: expires,
+		Note:      body.Note,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to store token: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"token":      token,
+		"expires_at": expires.Format(time.RFC3339),
+	})
+}
+
+// enroll exchanges a one-time enrollment token for a credential bound to the
+// agent's host_id, in the tenant the token was issued for. A host that
+// already holds a credential must have it revoked before it can enroll
+// again. The signing key registered at enrollment replaces any earlier one,
+// and the sequence restarts with it.
+func (s *Server) enroll(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token     string `json:"token"`
+		HostID    string `json:"host_id"`
+		Hostname  string `json:"hostname"`
+		PublicKey string `json:"public_key"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	if body.Token == "" || body.HostID == "" {
+		writeError(w, http.StatusBadRequest, "token and host_id are required")
+		return
+	}
+	if body.PublicKey != "" {
+		if _, err := signing.DecodePublicKey(body.PublicKey); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid public_key")
+			return
+		}
+	}
+
+	tenant := secretTenant(body.Token)
+	if _, ok := s.tenant(tenant); !ok {
+		writeError(w, http.StatusUnauthorized, "enrollment token is invalid, expired or already used")
+		return
+	}
+	secret, err := credential.NewSecret(secretScope(tenant))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate credential")
+		return
+	}
+	now := time.Now().UTC()
+
+	err = s.Store.Tenant(tenant).Enroll(r.Context(), store.Enrollment{
+		TokenHash:      credential.Hash(body.Token),
+		HostID:         body.HostID,
+		Hostname:       body.Hostname,
+		CredentialHash: credential.Hash(secret),
+		PublicKey:      body.PublicKey,
+		At:             now,
+	})
+	switch {
+	case errors.Is(err, store.ErrTokenInvalid):
+		writeError(w, http.StatusUnauthorized, "enrollment token is invalid, expired or already used")
+	case errors.Is(err, store.ErrAlreadyEnrolled):
+		writeError(w, http.StatusConflict, "host is already enrolled; revoke its credential first")
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to enroll host: "+err.Error())
+	default:
+		writeCredential(w, tenant, body.HostID, secret, now)
+	}
+}
+
+// rotateCredential issues a new credential for an enrolled host. It may be
+// called by the host's own agent, unless its certificate is revoked, or by
+// an admin; the latter is meant for a suspected compromise and invalidates
+// the old credential at once.
+func (s *Server) rotateCredential(w http.ResponseWriter, r *http.Request) {
+	hostID := r.PathValue("hostId")
+	_, isAgent := AgentFrom(r.Context())
+	if isAgent && !s.authorizeHost(w, r, hostID) {
+		return
+	}
+	if !isAgent && !authorize(w, r, PermHosts) {
+		return
+	}
+
+	secret, err := credential.NewSecret(secretScope(tenantID(r.Context())))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate credential")
+		return
+	}
+	now := time.Now().UTC()
+
+	err = s.tenantStore(r.Context()).RotateCredential(r.Context(), hostID, credential.Hash(secret), now, isAgent)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "host is not enrolled")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to rotate credential: "+err.Error())
+		return
+	}
+	writeCredential(w, tenantID(r.Context()), hostID, secret, now)
+}
+
+// revokeCredential removes a host's credential. The agent is locked out
+// until it is enrolled again with a new token.
+func (s *Server) revokeCredential(w http.ResponseWriter, r *http.Request) {
+	err := s.tenantStore(r.Context()).RevokeCredential(r.Context(), r.PathValue("hostId"), time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "host not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to revoke credential: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+func writeCredential(w http.ResponseWriter, tenant, hostID, secret string, issuedAt time.Time) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"tenant_id":  tenant,
+		"host_id":    hostID,
+		"credential": secret,
+		"issued_at":  issuedAt.Format(time.RFC3339),
+	})
+}
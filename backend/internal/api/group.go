@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/policy"
+)
+
+// maxTags caps the tags a host's agent reports, and those users assign.
+const maxTags = 50
+
+// normalizeTags checks tags and returns them sorted, without duplicates and
+// never nil.
+func normalizeTags(tags []string) ([]string, error) {
+	tags = append([]string{}, store.UnionTags(tags)...)
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("%d tags: at most %d are allowed", len(tags), maxTags)
+	}
+	for _, t := range tags {
+		if !policy.ValidTag(t) {
+			return nil, fmt.Errorf("invalid tag %q: want up to 128 letters, digits and _.:=/-", t)
+		}
+	}
+	return tags, nil
+}
+
+// setHostTags replaces the tags users assigned to a host. The tags its
+// agent reports are kept apart and are not affected.
+func (s *Server) setHostTags(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	tags, err := normalizeTags(body.Tags)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	hostID := r.PathValue("hostId")
+	host, err := s.tenantStore(ctx).SetUserTags(ctx, hostID, tags)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "host not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to store tags: "+err.Error())
+		return
+	}
+	groups, err := s.tenantStore(ctx).ListGroups(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load groups: "+err.Error())
+		return
+	}
+	log.Printf("Host %s tagged %v by %s", hostID, tags, principalName(r))
+
+	view := s.withStatus(ctx, host.Host, time.Now())
+	view.Groups = store.MemberOf(groups, &view)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"host": view})
+}
+
+// putGroup creates or replaces a group. Its membership changes at once, for
+// listings and for the policies assigned to it.
+func (s *Server) putGroup(w http.ResponseWriter, r *http.Request) {
+	var g store.Group
+	if !decodeJSON(w, r, &g) {
+		return
+	}
+	if err := g.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	stored, err := s.tenantStore(r.Context()).PutGroup(r.Context(), g, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to store group: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, stored)
+}
+
+func (s *Server) listGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := s.tenantStore(r.Context()).ListGroups(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load groups: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"groups": groups})
+}
+
+// deleteGroup removes a group. Policies still assigned to it no longer match
+// its former members.
+func (s *Server) deleteGroup(w http.ResponseWriter, r *http.Request) {
+	err := s.tenantStore(r.Context()).DeleteGroup(r.Context(), r.PathValue("groupId"))
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "group not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete group: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// errUnknownGroup is returned for a group that does not exist.
+var errUnknownGroup = errors.New("unknown group")
+
+// findGroup returns the group id among groups.
+func findGroup(groups []store.Group, id string) (*store.Group, error) {
+	for i := range groups {
+		if groups[i].ID == id {
+			return &groups[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", errUnknownGroup, id)
+}
+
+// groupHosts returns the IDs of the members of group id, or nil when id is
+// empty. It reads every host of the tenant.
+func (s *Server) groupHosts(ctx context.Context, id string) (map[string]bool, error) {
+	if id == "" {
+		return nil, nil
+	}
+	groups, err := s.tenantStore(ctx).ListGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	g, err := findGroup(groups, id)
+	if err != nil {
+		return nil, err
+	}
+	hosts, _, err := s.tenantStore(ctx).ListHosts(ctx, store.HostQuery{Group: g})
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		members[h.HostID] = true
+	}
+	return members, nil
+}
+
+// writeGroupError answers a failed group lookup: 400 for an unknown group,
+// 500 otherwise.
+func writeGroupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUnknownGroup) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "Failed to load group: "+err.Error())
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+)
+
+// heartbeat records an agent heartbeat on the host. Like an ingest, it
+// answers with the host's current policy, if any.
+func (s *Server) heartbeat(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid body: "+err.Error())
+		return
+	}
+
+	var hb models.Heartbeat
+	if err := json.Unmarshal(body, &hb); err != nil || hb.HostID == "" {
+		writeError(w, http.StatusBadRequest, "Invalid heartbeat: host_id is required")
+		return
+	}
+
+	if !s.authorizeHost(w, r, hb.HostID) {
+		return
+	}
+	if !s.verifySignature(w, r, hb.HostID, body) {
+		return
+	}
+
+	if _, err := s.tenantStore(r.Context()).RecordHeartbeat(r.Context(), hb, time.Now()); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to store heartbeat: "+err.Error())
+		return
+	}
+	s.writeIngestResponse(w, r, hb.HostID)
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/visiblaze/sec-agent/backend/internal/oidc"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/certid"
+	"github.com/visiblaze/sec-agent/pkg/credential"
+)
+
+// Agent is the host an authenticated caller speaks for, proven either by a
+// client certificate (CertSerial set) or by a per-host credential.
+type Agent struct {
+	HostID     string
+	CertSerial string
+}
+
+type agentKey struct{}
+
+// WithAgent records the caller's host identity so ingest handlers can bind
+// writes to it.
+func WithAgent(ctx context.Context, agent Agent) context.Context {
+	return context.WithValue(ctx, agentKey{}, agent)
+}
+
+// AgentFrom returns the host identity attached by WithAgent.
+func AgentFrom(ctx context.Context) (Agent, bool) {
+	agent, ok := ctx.Value(agentKey{}).(Agent)
+	return agent, ok
+}
+
+type clientCertKey struct{}
+
+// WithClientCertPEM attaches a client certificate that a proxy in front of
+// the API has already verified, such as an API Gateway custom domain with
+// mutual TLS.
+func WithClientCertPEM(ctx context.Context, pem string) context.Context {
+	return context.WithValue(ctx, clientCertKey{}, pem)
+}
+
+// clientIdentity returns the identity in the caller's verified client
+// certificate, from a fronting proxy or from the server's own TLS handshake.
+func clientIdentity(r *http.Request) (certid.Identity, bool, error) {
+	if pem, _ := r.Context().Value(clientCertKey{}).(string); pem != "" {
+		id, err := certid.FromPEM(pem)
+		return id, true, err
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		id, err := certid.FromCertificate(r.TLS.VerifiedChains[0][0])
+		return id, true, err
+	}
+	return certid.Identity{}, false, nil
+}
+
+// authenticate identifies the caller and attaches its Principal. Agents
+// prove a host identity with a verified client certificate, or with an
+// enrolled credential sent as a bearer token alongside X-Host-ID; a tenant's
+// shared agent key in X-API-Key stands in for any of its hosts. Users send
+// an API token or, when OIDC is configured, an identity provider's JWT as a
+// bearer token. The tenant comes from the certificate, the credential, the
+// agent key, the API token or the JWT's tenant claim, and must be
+// configured. With no agent key, API tokens or OIDC configured every caller
+// is an admin of the default tenant, which suits only local development.
+func (s *Server) authenticate(r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	if id, ok, err := clientIdentity(r); ok {
+		if err != nil {
+			return ctx, err
+		}
+		ctx = WithAgent(ctx, Agent{HostID: id.HostID, CertSerial: id.Serial})
+		tenant := id.Tenant
+		if tenant == "" {
+			tenant = store.DefaultTenant
+		}
+		return s.withPrincipal(ctx, Principal{Name: id.HostID, Role: RoleAgent, Tenant: tenant})
+	}
+
+	secret, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if hostID := r.Header.Get("X-Host-ID"); bearer && hostID != "" {
+		tenant := secretTenant(secret)
+		if _, ok := s.tenant(tenant); !ok {
+			return ctx, fmt.Errorf("unknown tenant %q", tenant)
+		}
+		valid, err := s.authenticateCredential(ctx, s.Store.Tenant(tenant), hostID, secret)
+		if err != nil {
+			return ctx, err
+		}
+		if !valid {
+			return ctx, fmt.Errorf("invalid credential for host %s", hostID)
+		}
+		ctx = WithAgent(ctx, Agent{HostID: hostID})
+		return WithPrincipal(ctx, Principal{Name: hostID, Role: RoleAgent, Tenant: tenant}), nil
+	}
+
+	if !s.AuthConfigured() {
+		return WithPrincipal(ctx, Principal{Name: "anonymous", Role: RoleAdmin, Tenant: store.DefaultTenant}), nil
+	}
+
+	switch {
+	case bearer && s.OIDC != nil && oidc.LooksLikeJWT(secret):
+		claims, err := s.OIDC.Verify(ctx, secret)
+		if err != nil {
+			return ctx, err
+		}
+		roleClaim, tenantClaim := s.OIDCRoleClaim, s.OIDCTenantClaim
+		if roleClaim == "" {
+			roleClaim = DefaultOIDCRoleClaim
+		}
+		if tenantClaim == "" {
+			tenantClaim = DefaultOIDCTenantClaim
+		}
+		tenant := store.DefaultTenant
+		switch tenants := claims.Strings(tenantClaim); len(tenants) {
+		case 0:
+		case 1:
+			tenant = tenants[0]
+		default:
+			return ctx, fmt.Errorf("token names %d tenants", len(tenants))
+		}
+		sub, _ := claims["sub"].(string)
+		return s.withPrincipal(ctx, Principal{Name: sub, Role: highestRole(claims.Strings(roleClaim)), Tenant: tenant})
+	case bearer:
+		token, ok := s.apiToken(secret)
+		if !ok {
+			return ctx, errors.New("unknown API token")
+		}
+		tenant := token.Tenant
+		if tenant == "" {
+			tenant = store.DefaultTenant
+		}
+		return s.withPrincipal(ctx, Principal{Name: token.Name, Role: token.Role, Tenant: tenant})
+	}
+
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		return ctx, errors.New("no credentials")
+	}
+	tenant, ok := s.agentKeyTenant(key)
+	if !ok {
+		return ctx, errors.New("invalid API key")
+	}
+	return WithPrincipal(ctx, Principal{Name: "agent key", Role: RoleAgent, Tenant: tenant}), nil
+}
+
+// AuthConfigured reports whether any way for callers to authenticate is
+// configured.
+func (s *Server) AuthConfigured() bool {
+	if s.APIKey != "" || len(s.Tokens) > 0 || s.OIDC != nil {
+		return true
+	}
+	for _, t := range s.Tenants {
+		if t.AgentKey != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// agentKeyTenant returns the tenant whose agent key is key, comparing every
+// key in constant time.
+func (s *Server) agentKeyTenant(key string) (string, bool) {
+	found := ""
+	keys := map[string]string{store.DefaultTenant: s.APIKey}
+	for _, t := range s.Tenants {
+		if t.ID != store.DefaultTenant {
+			keys[t.ID] = t.AgentKey
+		}
+	}
+	for tenant, k := range keys {
+		if k != "" && subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			found = tenant
+		}
+	}
+	return found, found != ""
+}
+
+// withPrincipal attaches p, provided its tenant is configured.
+func (s *Server) withPrincipal(ctx context.Context, p Principal) (context.Context, error) {
+	if _, ok := s.tenant(p.Tenant); !ok {
+		return ctx, fmt.Errorf("unknown tenant %q", p.Tenant)
+	}
+	return WithPrincipal(ctx, p), nil
+}
+
+// authenticateCredential checks a per-host credential presented by an agent
+// against st, the store of the tenant the credential names. After an agent
+// rotates its own credential the previous one stays valid until the new one
+// is first used, so a rotation response lost in transit does not lock the
+// host out.
+func (s *Server) authenticateCredential(ctx context.Context, st store.Store, hostID, secret string) (bool, error) {
+	cred, err := st.Credential(ctx, hostID)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case credential.Matches(secret, cred.Hash):
+		if cred.PreviousHash != "" {
+			if err := st.PromoteCredential(ctx, hostID, cred.Hash); err != nil {
+				log.Printf("Failed to drop previous credential for host %s: %v", hostID, err)
+			}
+		}
+		return true, nil
+	case credential.Matches(secret, cred.PreviousHash):
+		return true, nil
+	}
+	return false, nil
+}
+
+// authorizeHost rejects writes for hostID when the caller authenticated as a
+// different host, or with a certificate revoked for this host. Callers
+// without a host identity (the shared agent key, admins) are not restricted.
+// It writes the error response and returns false when the request must be
+// rejected.
+func (s *Server) authorizeHost(w http.ResponseWriter, r *http.Request, hostID string) bool {
+	agent, ok := AgentFrom(r.Context())
+	if !ok {
+		return true
+	}
+	if agent.HostID != hostID {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("credentials are not valid for host %s", hostID))
+		return false
+	}
+	if agent.CertSerial == "" {
+		return true
+	}
+
+	revoked, err := s.tenantStore(r.Context()).CertificateRevoked(r.Context(), hostID, agent.CertSerial)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check certificate revocation")
+		return false
+	}
+	if revoked {
+		writeError(w, http.StatusForbidden, "certificate revoked")
+		return false
+	}
+	return true
+}
+
+// revokeCertificate adds a certificate serial to the host's revocation list.
+// Only that host's agent is affected; the rest of the fleet keeps working.
+func (s *Server) revokeCertificate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Serial string `json:"serial"`
+	}
+	if b, err := readBody(r); err != nil || json.Unmarshal(b, &body) != nil || body.Serial == "" {
+		writeError(w, http.StatusBadRequest, "serial is required")
+		return
+	}
+
+	err := s.tenantStore(r.Context()).RevokeCertificate(r.Context(), r.PathValue("hostId"), certid.NormalizeSerial(body.Serial))
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "host not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to revoke certificate: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// deleteHost forgets a decommissioned host. Its credential goes with it, so
+// an agent still running there must enroll again; with the shared agent key
+// it would simply reappear on its next report.
+func (s *Server) deleteHost(w http.ResponseWriter, r *http.Request) {
+	hostID := r.PathValue("hostId")
+	err := s.tenantStore(r.Context()).DeleteHost(r.Context(), hostID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "host not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete host: "+err.Error())
+		return
+	}
+	log.Printf("Host %s deleted by %s", hostID, principalName(r))
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
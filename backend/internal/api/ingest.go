@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/upload"
+)
+
+func (s *Server) ingest(w http.ResponseWriter, r *http.Request) {
+	raw, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid body: "+err.Error())
+		return
+	}
+
+	encoding := r.Header.Get("Content-Encoding")
+	if !upload.IsSupported(encoding) {
+		unsupportedEncoding(w, encoding)
+		return
+	}
+	body, err := upload.Decode(encoding, raw)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.ingestBody(w, r, body)
+}
+
+// ingestBody parses, authorizes, verifies and stores an uncompressed agent
+// payload, then answers with the host's policy. r supplies the signature
+// headers.
+func (s *Server) ingestBody(w http.ResponseWriter, r *http.Request, body []byte) {
+	if hostID, ok := s.storeBody(w, r, body); ok {
+		s.writeIngestResponse(w, r, hostID)
+	}
+}
+
+// storeBody is ingestBody without the response on success. It returns the
+// payload's host ID, or writes the error response and returns false.
+func (s *Server) storeBody(w http.ResponseWriter, r *http.Request, body []byte) (string, bool) {
+	var payload models.IngestPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return "", false
+	}
+
+	if !s.authorizeHost(w, r, payload.Host.HostID) {
+		return "", false
+	}
+	if payload.Host.Tags != nil {
+		tags, err := normalizeTags(payload.Host.Tags)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid host tags: "+err.Error())
+			return "", false
+		}
+		payload.Host.Tags = tags
+	}
+	if !s.verifySignature(w, r, payload.Host.HostID, body) {
+		return "", false
+	}
+
+	if err := s.storePayload(r.Context(), &payload); err != nil {
+		log.Printf("Failed to store payload for host %s: %v", payload.Host.HostID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to store payload: "+err.Error())
+		return "", false
+	}
+	return payload.Host.HostID, true
+}
+
+// unsupportedEncoding answers with 415 and, per RFC 7694, the codings that
+// are accepted so the agent can fall back.
+func unsupportedEncoding(w http.ResponseWriter, encoding string) {
+	w.Header().Set("Accept-Encoding", strings.Join(upload.Supported, ", "))
+	writeError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported content encoding %q", encoding))
+}
+
+// storePayload upserts the host and replaces its package inventory and CIS
+// results, each a full collection by the agent. Payloads from a single
+// agent task only carry some of these and leave the rest untouched. Any
+// failure is returned so the caller answers with an error and the agent
+// sends the payload again; the writes are idempotent. It is shared by the JSON and SBOM ingest paths;
+// callers must have authorized the write with authorizeHost.
+func (s *Server) storePayload(ctx context.Context, payload *models.IngestPayload) error {
+	update := store.HostUpdate{
+		Host:         payload.Host,
+		SeenAt:       time.Now(),
+		Remediations: payload.Remediations,
+	}
+	update.Host.IPAddresses = uniqueStrings(payload.Host.IPAddresses)
+	if payload.Includes(models.SectionPackages) {
+		update.Containers = payload.Containers
+	}
+	if err := s.tenantStore(ctx).UpsertHost(ctx, update); err != nil {
+		return fmt.Errorf("host: %w", err)
+	}
+
+	hostID := payload.Host.HostID
+	if payload.Includes(models.SectionPackages) {
+		if err := s.tenantStore(ctx).ReplacePackages(ctx, hostID, payload.Packages); err != nil {
+			return fmt.Errorf("packages: %w", err)
+		}
+	}
+	if payload.Includes(models.SectionCIS) {
+		if err := s.tenantStore(ctx).ReplaceCISResults(ctx, hostID, payload.CISResults); err != nil {
+			return fmt.Errorf("CIS results: %w", err)
+		}
+	}
+	return nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		result = append(result, v)
+	}
+	return result
+}
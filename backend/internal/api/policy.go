@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/policy"
+)
+
+// putPolicy creates or replaces a policy and its assignment. Every write
+// bumps the version so agents can tell the policy changed.
+func (s *Server) putPolicy(w http.ResponseWriter, r *http.Request) {
+	var body policy.Assigned
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	body.Policy.Version = 0
+	if err := body.Policy.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stored, err := s.tenantStore(r.Context()).PutPolicy(r.Context(), body, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to store policy: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, stored)
+}
+
+func (s *Server) listPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := s.tenantStore(r.Context()).ListPolicies(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load policies: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"policies": policies})
+}
+
+// agentConfig returns the signed policy for the calling host. Agents
+// normally receive it with every ingest response; this endpoint lets them
+// fetch it without sending a payload.
+func (s *Server) agentConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	hostID := r.URL.Query().Get("host_id")
+	if agent, ok := AgentFrom(ctx); ok && hostID == "" {
+		hostID = agent.HostID
+	}
+	if hostID == "" {
+		writeError(w, http.StatusBadRequest, "host_id is required")
+		return
+	}
+	if !s.authorizeHost(w, r, hostID) {
+		return
+	}
+
+	host, err := s.tenantStore(ctx).GetHost(ctx, hostID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "Host not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load host: "+err.Error())
+		return
+	}
+
+	signed, err := s.hostPolicy(ctx, &host.Host)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to resolve policy: "+err.Error())
+		return
+	}
+	if signed == nil {
+		writeError(w, http.StatusNotFound, "No policy assigned")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"policy": signed})
+}
+
+// hostPolicy resolves and signs the policy for a host from its OS, tags and
+// groups. It returns nil when signing is not configured or no policy
+// matches.
+func (s *Server) hostPolicy(ctx context.Context, host *models.Host) (*policy.Signed, error) {
+	if s.PolicySigningKey == nil {
+		return nil, nil
+	}
+
+	policies, err := s.tenantStore(ctx).ListPolicies(ctx)
+	if err != nil || len(policies) == 0 {
+		return nil, err
+	}
+	groups, err := s.tenantStore(ctx).ListGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p := policy.Resolve(policies, host.OSID, host.Tags, store.MemberOf(groups, host))
+	if p == nil {
+		return nil, nil
+	}
+	return policy.Sign(s.PolicySigningKey, *p, host.HostID, time.Now())
+}
+
+// writeIngestResponse answers an agent after a successful ingest or
+// heartbeat, carrying its policy when one is assigned.
+func (s *Server) writeIngestResponse(w http.ResponseWriter, r *http.Request, hostID string) {
+	body := map[string]interface{}{"status": "ok"}
+	// The payload is already stored, so a policy lookup failure must not
+	// make the agent retry it
+	if signed, err := s.ingestPolicy(r.Context(), hostID); err != nil {
+		log.Printf("Failed to resolve policy for host %s: %v", hostID, err)
+	} else if signed != nil {
+		body["policy"] = signed
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// ingestPolicy looks up the stored host, with its tags, only when there is
+// a policy to resolve.
+func (s *Server) ingestPolicy(ctx context.Context, hostID string) (*policy.Signed, error) {
+	if s.PolicySigningKey == nil {
+		return nil, nil
+	}
+	host, err := s.tenantStore(ctx).GetHost(ctx, hostID)
+	if err != nil {
+		return nil, err
+	}
+	return s.hostPolicy(ctx, &host.Host)
+}
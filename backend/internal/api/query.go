@@ -0,0 +1,353 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/liveness"
+)
+
+// List endpoints return defaultLimit items per page unless the caller asks
+// for up to maxLimit with ?limit=, and continue with ?next_token=.
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// Query parameters each list endpoint accepts besides limit, next_token and
+// sort. openapi.yaml documents the same set.
+var (
+	hostParams    = []string{"os_id", "agent_version", "hostname", "tag", "group", "last_seen_before", "status"}
+	packageParams = []string{"host_id", "group", "name", "version", "manager"}
+	// hostPackageParams filter GET /hosts/{hostId}/packages
+	hostPackageParams = []string{"name", "version", "manager"}
+	cisParams         = []string{"host_id", "group", "check_id", "status"}
+)
+
+// cisStatuses are the statuses agents report for a check.
+var cisStatuses = []string{"pass", "fail", "manual", "error", "timeout"}
+
+// listRequest is a validated list query.
+type listRequest struct {
+	url.Values
+	limit int
+	token string
+	sort  store.Sort
+}
+
+// parseList checks the query string against params and sortFields, answering
+// 400 for an unknown parameter, a repeated one, or a bad limit or sort.
+// sort is a field name, prefixed with "-" for descending order.
+func parseList(w http.ResponseWriter, r *http.Request, params, sortFields []string) (*listRequest, bool) {
+	q := r.URL.Query()
+	for name, values := range q {
+		if !slices.Contains(params, name) && name != "limit" && name != "next_token" && name != "sort" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown parameter %q: want one of %s, limit, next_token, sort", name, strings.Join(params, ", ")))
+			return nil, false
+		}
+		if len(values) > 1 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("parameter %q given more than once", name))
+			return nil, false
+		}
+	}
+
+	req := &listRequest{Values: q, limit: defaultLimit, token: q.Get("next_token")}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxLimit))
+			return nil, false
+		}
+		req.limit = n
+	}
+	if v := q.Get("sort"); v != "" {
+		req.sort = store.Sort{Field: strings.TrimPrefix(v, "-"), Desc: strings.HasPrefix(v, "-")}
+		if !slices.Contains(sortFields, req.sort.Field) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid sort %q: want one of %s, optionally prefixed with -", v, strings.Join(sortFields, ", ")))
+			return nil, false
+		}
+	}
+	return req, true
+}
+
+// writeListError answers a failed List call: 400 for a token the store did
+// not issue, 500 otherwise.
+func writeListError(w http.ResponseWriter, what string, err error) {
+	if errors.Is(err, store.ErrInvalidToken) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "Failed to load "+what+": "+err.Error())
+}
+
+// writePage writes items under key, with next_token when more follow.
+func writePage(w http.ResponseWriter, key string, items interface{}, next string, extra map[string]interface{}) {
+	body := map[string]interface{}{key: items}
+	for k, v := range extra {
+		body[k] = v
+	}
+	if next != "" {
+		body["next_token"] = next
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// withStatus sets the host's liveness status as of now, by the thresholds of
+// the caller's tenant. A host is last heard from at its latest heartbeat or
+// full payload.
+func (s *Server) withStatus(ctx context.Context, host models.Host, now time.Time) models.Host {
+	host.Status = s.liveness(ctx).Status(liveness.LastContact(host.LastSeen, host.LastHeartbeat), now)
+	return host
+}
+
+func (s *Server) listHosts(w http.ResponseWriter, r *http.Request) {
+	// status is online, stale, offline, or missing for stale and offline
+	filter := r.URL.Query().Get("status")
+	if !liveness.ValidFilter(filter) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid status %q: want online, stale, offline or missing", filter))
+		return
+	}
+
+	q, ok := parseList(w, r, hostParams, store.HostSortFields)
+	if !ok {
+		return
+	}
+	var before time.Time
+	if v := q.Get("last_seen_before"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid last_seen_before %q: want an RFC 3339 time", v))
+			return
+		}
+		before = t
+	}
+	groups, err := s.tenantStore(r.Context()).ListGroups(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load groups: "+err.Error())
+		return
+	}
+	var group *store.Group
+	if id := q.Get("group"); id != "" {
+		if group, err = findGroup(groups, id); err != nil {
+			writeGroupError(w, err)
+			return
+		}
+	}
+
+	query := store.HostQuery{
+		OSID:           q.Get("os_id"),
+		AgentVersion:   q.Get("agent_version"),
+		HostnamePrefix: q.Get("hostname"),
+		Tag:            q.Get("tag"),
+		Group:          group,
+		LastSeenBefore: before,
+		Sort:           q.sort,
+		Limit:          q.limit,
+		NextToken:      q.token,
+	}
+	// The status filter applies after the store has paged, so pages are
+	// read until limit hosts match or the hosts run out
+	now := time.Now()
+	hosts := []models.Host{}
+	var next string
+	for {
+		stored, token, err := s.tenantStore(r.Context()).ListHosts(r.Context(), query)
+		if err != nil {
+			writeListError(w, "hosts", err)
+			return
+		}
+		for _, host := range stored {
+			host = s.withStatus(r.Context(), host, now)
+			host.Groups = store.MemberOf(groups, &host)
+			if liveness.Matches(filter, host.Status) {
+				hosts = append(hosts, host)
+			}
+		}
+		next = token
+		if next == "" || len(hosts) >= q.limit {
+			break
+		}
+		query.Limit = q.limit - len(hosts)
+		query.NextToken = next
+	}
+	writePage(w, "hosts", hosts, next, map[string]interface{}{"liveness": s.liveness(r.Context()).JSON()})
+}
+
+// getHost loads the host named in the path, answering 404 or 500 when it
+// cannot.
+func (s *Server) getHost(w http.ResponseWriter, r *http.Request) (*store.Host, bool) {
+	host, err := s.tenantStore(r.Context()).GetHost(r.Context(), r.PathValue("hostId"))
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "host not found")
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load host: "+err.Error())
+		return nil, false
+	}
+	return host, true
+}
+
+// hostDetail returns the host with a summary of its latest results and its
+// failing checks. Packages are paged separately by hostPackages, since a
+// host's inventory alone can outgrow a Lambda response.
+func (s *Server) hostDetail(w http.ResponseWriter, r *http.Request) {
+	host, ok := s.getHost(w, r)
+	if !ok {
+		return
+	}
+	cis, err := s.tenantStore(r.Context()).HostCISResults(r.Context(), host.HostID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load CIS results: "+err.Error())
+		return
+	}
+	groups, err := s.tenantStore(r.Context()).ListGroups(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load groups: "+err.Error())
+		return
+	}
+	view := s.withStatus(r.Context(), host.Host, time.Now())
+	view.Groups = store.MemberOf(groups, &view)
+
+	remediations := host.Remediations
+	if remediations == nil {
+		remediations = []models.RemediationResult{}
+	}
+	containers := models.ContainerInventory{Images: []models.ContainerImage{}, Containers: []models.Container{}}
+	if host.Containers != nil {
+		containers = *host.Containers
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"host":           view,
+		"summary":        summarize(host.PackageCount, cis),
+		"cis_results":    cis,
+		"failing_checks": failingChecks(cis, remediations),
+		"containers":     containers,
+		"remediations":   remediations,
+	})
+}
+
+// summarize counts a host's checks by status and scores them.
+func summarize(packages int, cis []models.CISResult) models.HostSummary {
+	sum := models.HostSummary{Packages: packages, Checks: len(cis), ByStatus: map[string]int{}}
+	for _, r := range cis {
+		sum.ByStatus[r.Status]++
+	}
+	if decided := sum.ByStatus["pass"] + sum.ByStatus["fail"]; decided > 0 {
+		score := sum.ByStatus["pass"] * 100 / decided
+		sum.ComplianceScore = &score
+	}
+	return sum
+}
+
+// failingChecks returns the failing results, each with the latest
+// remediation result for its check.
+func failingChecks(cis []models.CISResult, remediations []models.RemediationResult) []models.FailingCheck {
+	failing := []models.FailingCheck{}
+	for _, r := range cis {
+		if r.Status != "fail" {
+			continue
+		}
+		fc := models.FailingCheck{CISResult: r}
+		for i := range remediations {
+			if strings.EqualFold(remediations[i].CheckID, r.CheckID) {
+				fc.Remediation = &remediations[i]
+			}
+		}
+		failing = append(failing, fc)
+	}
+	return failing
+}
+
+// hostPackages pages through one host's current inventory.
+func (s *Server) hostPackages(w http.ResponseWriter, r *http.Request) {
+	q, ok := parseList(w, r, hostPackageParams, store.PackageSortFields)
+	if !ok {
+		return
+	}
+	host, ok := s.getHost(w, r)
+	if !ok {
+		return
+	}
+	packages, next, err := s.tenantStore(r.Context()).ListPackages(r.Context(), store.PackageQuery{
+		HostID:    host.HostID,
+		Name:      q.Get("name"),
+		Version:   q.Get("version"),
+		Manager:   q.Get("manager"),
+		Sort:      q.sort,
+		Limit:     q.limit,
+		NextToken: q.token,
+	})
+	if err != nil {
+		writeListError(w, "packages", err)
+		return
+	}
+	writePage(w, "packages", packages, next, nil)
+}
+
+func (s *Server) listPackages(w http.ResponseWriter, r *http.Request) {
+	q, ok := parseList(w, r, packageParams, store.PackageSortFields)
+	if !ok {
+		return
+	}
+	members, err := s.groupHosts(r.Context(), q.Get("group"))
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	packages, next, err := s.tenantStore(r.Context()).ListPackages(r.Context(), store.PackageQuery{
+		HostID:    q.Get("host_id"),
+		HostIDs:   members,
+		Name:      q.Get("name"),
+		Version:   q.Get("version"),
+		Manager:   q.Get("manager"),
+		Sort:      q.sort,
+		Limit:     q.limit,
+		NextToken: q.token,
+	})
+	if err != nil {
+		writeListError(w, "packages", err)
+		return
+	}
+	writePage(w, "packages", packages, next, nil)
+}
+
+func (s *Server) listCISResults(w http.ResponseWriter, r *http.Request) {
+	q, ok := parseList(w, r, cisParams, store.CISSortFields)
+	if !ok {
+		return
+	}
+	if status := q.Get("status"); status != "" && !slices.Contains(cisStatuses, status) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid status %q: want one of %s", status, strings.Join(cisStatuses, ", ")))
+		return
+	}
+	members, err := s.groupHosts(r.Context(), q.Get("group"))
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	results, next, err := s.tenantStore(r.Context()).ListCISResults(r.Context(), store.CISQuery{
+		HostID:    q.Get("host_id"),
+		HostIDs:   members,
+		CheckID:   q.Get("check_id"),
+		Status:    q.Get("status"),
+		Sort:      q.sort,
+		Limit:     q.limit,
+		NextToken: q.token,
+	})
+	if err != nil {
+		writeListError(w, "CIS results", err)
+		return
+	}
+	writePage(w, "cis_results", results, next, nil)
+}
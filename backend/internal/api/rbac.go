@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// Role is what a caller may do. Dashboard users are viewers, operators or
+// admins; agents, whether identified per host or by the shared agent key,
+// may only report.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+	RoleAgent    Role = "agent"
+)
+
+// Permission guards a group of routes.
+type Permission string
+
+const (
+	PermIngest   Permission = "ingest"   // report inventories, heartbeats and results; fetch policy
+	PermRead     Permission = "read"     // hosts, packages, CIS results, software, policies, groups
+	PermExport   Permission = "export"   // SBOM export
+	PermPolicies Permission = "policies" // create and replace policies
+	PermTags     Permission = "tags"     // tag hosts and manage groups
+	PermEnroll   Permission = "enroll"   // issue enrollment tokens
+	PermHosts    Permission = "hosts"    // delete hosts, revoke and reset their credentials
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleViewer:   {PermRead},
+	RoleOperator: {PermRead, PermExport, PermPolicies, PermTags, PermEnroll},
+	RoleAdmin:    {PermIngest, PermRead, PermExport, PermPolicies, PermTags, PermEnroll, PermHosts},
+	RoleAgent:    {PermIngest},
+}
+
+// userRoles are the roles an API token or OIDC token may carry, least
+// privileged first.
+var userRoles = []Role{RoleViewer, RoleOperator, RoleAdmin}
+
+// ValidUserRole reports whether r may be given to an API token.
+func ValidUserRole(r Role) bool {
+	return slices.Contains(userRoles, r)
+}
+
+// Principal is an authenticated caller.
+type Principal struct {
+	// Name identifies the caller in logs: an API token's name, an OIDC
+	// subject, or the host an agent speaks for.
+	Name string
+	Role Role
+	// Tenant is the only tenant whose data the caller may reach.
+	Tenant string
+}
+
+// Can reports whether p holds perm.
+func (p Principal) Can(perm Permission) bool {
+	return slices.Contains(rolePermissions[p.Role], perm)
+}
+
+type principalKey struct{}
+
+// WithPrincipal records the authenticated caller.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller attached by WithPrincipal.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// APIToken is a long-lived bearer token for dashboard users and scripts.
+// Only the SHA-256 of the token is configured, so the configuration does
+// not hold the secret. A token without a tenant belongs to the default
+// tenant.
+type APIToken struct {
+	Name   string `json:"name" yaml:"name"`
+	Role   Role   `json:"role" yaml:"role"`
+	Tenant string `json:"tenant,omitempty" yaml:"tenant,omitempty"`
+	SHA256 string `json:"sha256" yaml:"sha256"`
+}
+
+// HashAPIToken returns the hex SHA-256 configured for token.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiToken returns the configured token matching secret.
+func (s *Server) apiToken(secret string) (APIToken, bool) {
+	hash := []byte(HashAPIToken(secret))
+	for _, t := range s.Tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(t.SHA256)) == 1 {
+			return t, true
+		}
+	}
+	return APIToken{}, false
+}
+
+// DefaultOIDCRoleClaim is the claim read for a user's roles when
+// Server.OIDCRoleClaim is empty.
+const DefaultOIDCRoleClaim = "roles"
+
+// highestRole returns the most privileged user role among values, the role
+// claim of an OIDC token, or "" when it names none.
+func highestRole(values []string) Role {
+	role := Role("")
+	for _, r := range userRoles {
+		if slices.Contains(values, string(r)) {
+			role = r
+		}
+	}
+	return role
+}
+
+// authorize checks that the caller holds perm, writing a 403 and returning
+// false when it does not.
+func authorize(w http.ResponseWriter, r *http.Request, perm Permission) bool {
+	p, _ := PrincipalFrom(r.Context())
+	if p.Can(perm) {
+		return true
+	}
+	role := p.Role
+	if role == "" {
+		role = "no role"
+	}
+	writeError(w, http.StatusForbidden, fmt.Sprintf("%s may not %s", role, permissionVerbs[perm]))
+	return false
+}
+
+var permissionVerbs = map[Permission]string{
+	PermIngest:   "report host data",
+	PermRead:     "read fleet data",
+	PermExport:   "export host data",
+	PermPolicies: "manage policies",
+	PermTags:     "tag hosts or manage groups",
+	PermEnroll:   "issue enrollment tokens",
+	PermHosts:    "manage hosts",
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/sbom"
+	"github.com/visiblaze/sec-agent/pkg/signing"
+)
+
+// sbomExport returns a host's package inventory as CycloneDX (default) or
+// SPDX JSON, selected with ?format=.
+func (s *Server) sbomExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = sbom.FormatCycloneDX
+	}
+
+	host, ok := s.getHost(w, r)
+	if !ok {
+		return
+	}
+	packages, err := s.tenantStore(r.Context()).HostPackages(r.Context(), host.HostID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load packages: "+err.Error())
+		return
+	}
+
+	var components []sbom.Component
+	for _, pkg := range packages {
+		components = append(components, sbom.Component{
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			Arch:    pkg.Arch,
+			Manager: pkg.Manager,
+			Source:  pkg.Source,
+		})
+	}
+
+	subject := sbom.Subject{HostID: host.HostID, Hostname: host.Hostname, OSID: host.OSID, OSVersion: host.OSVersion}
+	body, err := sbom.Generate(format, subject, components, host.AgentVersion)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// sbomAgentVersion marks hosts known only from SBOM documents.
+const sbomAgentVersion = "sbom"
+
+// sbomIngest accepts a CycloneDX or SPDX document in place of an agent
+// payload, for hosts that cannot run the agent. host_id and hostname may be
+// given as query parameters and override the document metadata. Only the
+// package inventory of a host that reports through the agent is replaced;
+// its host details stay as the agent sent them.
+func (s *Server) sbomIngest(w http.ResponseWriter, r *http.Request) {
+	raw, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid body: "+err.Error())
+		return
+	}
+	subject, components, err := sbom.Parse(raw)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	if v := query.Get("host_id"); v != "" {
+		subject.HostID = v
+	}
+	if v := query.Get("hostname"); v != "" {
+		subject.Hostname = v
+	}
+	if subject.HostID == "" {
+		writeError(w, http.StatusBadRequest, "host_id is required (query parameter or document metadata)")
+		return
+	}
+	if subject.Hostname == "" {
+		subject.Hostname = subject.HostID
+	}
+
+	if !s.authorizeHost(w, r, subject.HostID) || !s.authorizeSBOM(w, r, subject.HostID, raw) {
+		return
+	}
+
+	packages := make([]models.Package, 0, len(components))
+	for _, c := range components {
+		packages = append(packages, models.Package{
+			Name:    c.Name,
+			Version: c.Version,
+			Arch:    c.Arch,
+			Manager: c.Manager,
+			Source:  c.Source,
+		})
+	}
+
+	ctx := r.Context()
+	host, err := s.tenantStore(ctx).GetHost(ctx, subject.HostID)
+	switch {
+	case errors.Is(err, store.ErrNotFound) || (err == nil && host.AgentVersion == sbomAgentVersion):
+		err = s.storePayload(ctx, &models.IngestPayload{
+			Host: models.Host{
+				HostID:       subject.HostID,
+				Hostname:     subject.Hostname,
+				OSID:         subject.OSID,
+				OSVersion:    subject.OSVersion,
+				AgentVersion: sbomAgentVersion,
+			},
+			Packages: packages,
+			Tasks:    []string{models.SectionPackages},
+		})
+	case err == nil:
+		err = s.tenantStore(ctx).ReplacePackages(ctx, subject.HostID, packages)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to store payload: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "ok",
+		"host_id":  subject.HostID,
+		"packages": len(packages),
+	})
+}
+
+// authorizeSBOM keeps SBOM ingest from bypassing payload signing. Documents
+// signed like agent payloads are verified the same way, sequence included.
+// Unsigned ones are only taken from admins, or for hosts with neither a
+// registered signing key nor a credential while signatures are optional.
+func (s *Server) authorizeSBOM(w http.ResponseWriter, r *http.Request, hostID string, body []byte) bool {
+	if r.Header.Get(signing.HeaderSignature) != "" {
+		return s.verifySignature(w, r, hostID, body)
+	}
+	if p, _ := PrincipalFrom(r.Context()); p.Role == RoleAdmin {
+		return true
+	}
+	cred, err := s.tenantStore(r.Context()).Credential(r.Context(), hostID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load credential")
+		return false
+	}
+	if cred.Hash != "" {
+		writeError(w, http.StatusUnauthorized, "host is enrolled: SBOMs for it must be signed or sent by an admin")
+		return false
+	}
+	return s.verifySignature(w, r, hostID, body)
+}
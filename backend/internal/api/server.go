@@ -0,0 +1,216 @@
+// Package api is the Visiblaze HTTP API: agent ingest, enrollment, policy
+// delivery and the dashboard queries. It serves plain net/http over a
+// store.Tenants, so the Lambda (through package apigw) and the standalone
+// server run the same handlers.
+package api
+
+import (
+	"crypto/ed25519"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/oidc"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/liveness"
+)
+
+// Agent authentication modes. Per-host identities (client certificates,
+// enrolled credentials) are honoured in both; the mode decides whether the
+// shared agent key may still ingest on behalf of any host.
+const (
+	AuthAPIKey = "api_key" // shared agent key may ingest (default)
+	AuthHost   = "host"    // ingest requires a client certificate or enrolled credential
+)
+
+// maxBodySize matches API Gateway's payload limit; larger payloads go
+// through multi-part uploads.
+const maxBodySize = 10 << 20
+
+// openAPISpec describes every route below; keep it in step with them.
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// Server serves the API from Store, keeping each tenant's data in its own
+// partition.
+type Server struct {
+	Store store.Tenants
+	// Tenants are the tenants besides store.DefaultTenant, which always
+	// exists; an entry for it sets its name and settings.
+	Tenants []Tenant
+	// APIKey is the default tenant's shared agent key. Agent keys may only
+	// report, and in AuthAPIKey mode stand in for agents without a host
+	// identity.
+	APIKey   string
+	AuthMode string
+	// Tokens are the API tokens users may send as bearer tokens.
+	Tokens []APIToken
+	// OIDC, when set, accepts an identity provider's JWTs as bearer tokens.
+	// The user's role is read from OIDCRoleClaim (DefaultOIDCRoleClaim when
+	// empty) and the tenant from OIDCTenantClaim (DefaultOIDCTenantClaim).
+	OIDC            *oidc.Verifier
+	OIDCRoleClaim   string
+	OIDCTenantClaim string
+	// AllowedOrigins are the browser origins, such as the dashboard's, that
+	// may call the API cross-origin.
+	AllowedOrigins []string
+	// RequireSignatures rejects unsigned ingest payloads even from hosts
+	// that have not registered a signing key yet. Tenants may override it.
+	RequireSignatures bool
+	// PolicySigningKey signs policies delivered to agents. When nil,
+	// policies can still be managed but none are delivered.
+	PolicySigningKey ed25519.PrivateKey
+	// Liveness decides when hosts are reported stale and offline. Tenants
+	// may override it.
+	Liveness liveness.Thresholds
+}
+
+// Handler returns the API with CORS, authentication and authorization
+// applied.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	perms := map[string]Permission{}
+	// handle routes pattern to h for callers holding perm; "" leaves the
+	// route open
+	handle := func(pattern string, perm Permission, h http.HandlerFunc) {
+		mux.HandleFunc(pattern, h)
+		perms[pattern] = perm
+	}
+
+	// Enrollment is authenticated by the one-time token in the body
+	handle("POST /enroll", "", s.enroll)
+	handle("GET /health", "", s.health)
+	handle("GET /openapi.yaml", "", s.openAPI)
+
+	handle("POST /ingest", PermIngest, s.ingest)
+	handle("POST /ingest/{$}", PermIngest, s.ingest)
+	handle("POST /heartbeat", PermIngest, s.heartbeat)
+	handle("POST /ingest/uploads", PermIngest, s.createUpload)
+	handle("POST /ingest/uploads/{uploadId}/parts/{part}", PermIngest, s.uploadPart)
+	handle("POST /ingest/uploads/{uploadId}/complete", PermIngest, s.completeUpload)
+	handle("POST /ingest/sbom", PermIngest, s.sbomIngest)
+	handle("GET /agent-config", PermIngest, s.agentConfig)
+	// Agents rotate their own credential; admins may reset any host's
+	handle("POST /hosts/{hostId}/credentials/rotate", PermIngest, s.rotateCredential)
+
+	handle("GET /hosts", PermRead, s.listHosts)
+	handle("GET /hosts/{hostId}", PermRead, s.hostDetail)
+	handle("GET /hosts/{hostId}/packages", PermRead, s.hostPackages)
+	handle("GET /apps", PermRead, s.listPackages)
+	handle("GET /cis-results", PermRead, s.listCISResults)
+	handle("GET /software", PermRead, s.listSoftware)
+	handle("GET /software/hosts", PermRead, s.listSoftwareHosts)
+	handle("GET /policies", PermRead, s.listPolicies)
+	handle("GET /groups", PermRead, s.listGroups)
+	handle("GET /hosts/{hostId}/sbom", PermExport, s.sbomExport)
+
+	handle("POST /policies", PermPolicies, s.putPolicy)
+	handle("POST /hosts/{hostId}/tags", PermTags, s.setHostTags)
+	handle("POST /groups", PermTags, s.putGroup)
+	handle("DELETE /groups/{groupId}", PermTags, s.deleteGroup)
+	handle("POST /enrollment-tokens", PermEnroll, s.createEnrollmentToken)
+	handle("DELETE /hosts/{hostId}", PermHosts, s.deleteHost)
+	handle("POST /hosts/{hostId}/certificates/revoke", PermHosts, s.revokeCertificate)
+	handle("POST /hosts/{hostId}/credentials/revoke", PermHosts, s.revokeCredential)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Type", "application/json")
+		if origin := r.Header.Get("Origin"); origin != "" && slices.Contains(s.AllowedOrigins, origin) {
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Methods", "GET,POST,DELETE,OPTIONS")
+			h.Set("Access-Control-Allow-Headers", "Content-Type,Content-Encoding,X-API-Key,Authorization,X-Host-ID,X-Visiblaze-Timestamp,X-Visiblaze-Sequence,X-Visiblaze-Signature,X-Visiblaze-Public-Key")
+		}
+		h.Add("Vary", "Origin")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			writeError(w, http.StatusNotFound, "Not found")
+			return
+		}
+
+		if perm := perms[pattern]; perm != "" {
+			ctx, err := s.authenticate(r)
+			if err != nil {
+				log.Printf("Authentication failed for %s %s: %v", r.Method, r.URL.Path, err)
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			r = r.WithContext(ctx)
+			if !authorize(w, r, perm) {
+				return
+			}
+
+			path := r.URL.Path
+			if _, isAgent := AgentFrom(ctx); !isAgent && s.AuthMode == AuthHost && (strings.HasPrefix(path, "/ingest") || path == "/heartbeat") {
+				writeError(w, http.StatusUnauthorized, "per-host credential or client certificate required")
+				return
+			}
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// principalName names the caller for logs.
+func principalName(r *http.Request) string {
+	if p, ok := PrincipalFrom(r.Context()); ok {
+		return fmt.Sprintf("%s (%s, tenant %s)", p.Name, p.Role, p.Tenant)
+	}
+	return "unauthenticated caller"
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "ok",
+		"time":   time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *Server) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPISpec)
+}
+
+// readBody returns the request body; API Gateway bodies arrive already
+// decoded by apigw.
+func readBody(r *http.Request) ([]byte, error) {
+	return io.ReadAll(r.Body)
+}
+
+// decodeJSON parses the request body into v, writing a 400 and returning
+// false when it is not valid JSON.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := readBody(r)
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, _ := json.Marshal(v)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// writeError writes the {"error": msg} body every failure shares.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/signing"
+)
+
+// verifySignature checks the payload signature against the host's registered
+// public key and advances the host's sequence number, so each signed payload
+// is accepted at most once. A host without a registered key has the key it
+// signs with recorded on first use, but only when the caller proves it is
+// that host with a credential or client certificate: anyone holding the
+// shared agent key could otherwise claim the key of a host that has not
+// signed yet. Their signatures are still checked, but neither the key nor
+// the sequence is recorded until the host enrolls with a key. After
+// registration, unsigned payloads for the host are refused. The signature
+// and body digest are kept on the host as an audit trail. It writes the
+// error response and returns false when the payload must not be stored.
+func (s *Server) verifySignature(w http.ResponseWriter, r *http.Request, hostID string, body []byte) bool {
+	env, err := signing.ParseHeaders(r.Header.Get)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	registered, err := s.tenantStore(r.Context()).SigningKey(r.Context(), hostID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load signing key")
+		return false
+	}
+
+	_, isHost := AgentFrom(r.Context())
+	unregistered := registered == "" && !isHost
+	if env != nil && unregistered && s.requireSignatures(r.Context()) {
+		writeError(w, http.StatusUnauthorized, "no signing key registered for host; enroll it with its public key")
+		return false
+	}
+	if env == nil {
+		if registered != "" || s.requireSignatures(r.Context()) {
+			writeError(w, http.StatusUnauthorized, "payload signature required")
+			return false
+		}
+		return true
+	}
+
+	keyStr := registered
+	if keyStr == "" {
+		keyStr = env.PublicKey
+	}
+	pub, err := signing.DecodePublicKey(keyStr)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "no valid signing key for host")
+		return false
+	}
+	if err := env.Verify(pub, body, time.Now()); err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return false
+	}
+	if unregistered {
+		// Checked for staleness, but the key proves nothing about the host
+		return true
+	}
+
+	sig := store.Signature{
+		Sequence:  env.Sequence,
+		Signature: env.Signature,
+		Message:   string(signing.Message(env.Timestamp, env.Sequence, body)),
+	}
+	if registered == "" {
+		sig.PublicKey = keyStr
+	}
+	err = s.tenantStore(r.Context()).AcceptSignature(r.Context(), hostID, sig)
+	if errors.Is(err, store.ErrConflict) {
+		writeError(w, http.StatusConflict, "payload sequence already seen (replay)")
+		return false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to record payload sequence")
+		return false
+	}
+	return true
+}
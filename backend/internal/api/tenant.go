@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/credential"
+	"github.com/visiblaze/sec-agent/pkg/liveness"
+)
+
+// Tenant is a business unit whose hosts and users are isolated from every
+// other tenant's. Each caller authenticates into one tenant, and handlers
+// only reach that tenant's partition of the store.
+type Tenant struct {
+	ID   string
+	Name string
+	// AgentKey is the tenant's shared agent key. The default tenant's is
+	// Server.APIKey.
+	AgentKey string
+	// RequireSignatures and Liveness, when set, override the Server's.
+	RequireSignatures *bool
+	Liveness          *liveness.Thresholds
+}
+
+// DefaultOIDCTenantClaim is the claim read for a user's tenant when
+// Server.OIDCTenantClaim is empty. Tokens without it belong to the default
+// tenant.
+const DefaultOIDCTenantClaim = "tenant"
+
+// tenant returns the configured tenant id. The default tenant always
+// exists.
+func (s *Server) tenant(id string) (Tenant, bool) {
+	for _, t := range s.Tenants {
+		if t.ID == id {
+			if id == store.DefaultTenant {
+				t.AgentKey = s.APIKey
+			}
+			return t, true
+		}
+	}
+	if id == store.DefaultTenant {
+		return Tenant{ID: id, AgentKey: s.APIKey}, true
+	}
+	return Tenant{}, false
+}
+
+// tenantID returns the tenant the caller authenticated into.
+func tenantID(ctx context.Context) string {
+	if p, ok := PrincipalFrom(ctx); ok && p.Tenant != "" {
+		return p.Tenant
+	}
+	return store.DefaultTenant
+}
+
+// tenantStore returns the store of the caller's tenant.
+func (s *Server) tenantStore(ctx context.Context) store.Store {
+	return s.Store.Tenant(tenantID(ctx))
+}
+
+// requireSignatures reports whether the caller's tenant rejects unsigned
+// payloads.
+func (s *Server) requireSignatures(ctx context.Context) bool {
+	if t, _ := s.tenant(tenantID(ctx)); t.RequireSignatures != nil {
+		return *t.RequireSignatures
+	}
+	return s.RequireSignatures
+}
+
+// liveness returns the caller's tenant's liveness thresholds.
+func (s *Server) liveness(ctx context.Context) liveness.Thresholds {
+	if t, _ := s.tenant(tenantID(ctx)); t.Liveness != nil {
+		return *t.Liveness
+	}
+	return s.Liveness
+}
+
+// secretScope is the tenant written into the tokens and credentials issued
+// for tenant: none for the default tenant, whose secrets keep the format
+// they had before tenants.
+func secretScope(tenant string) string {
+	if tenant == store.DefaultTenant {
+		return ""
+	}
+	return tenant
+}
+
+// secretTenant returns the tenant a token or credential was issued for.
+func secretTenant(secret string) string {
+	if t := credential.Tenant(secret); t != "" {
+		return t
+	}
+	return store.DefaultTenant
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/upload"
+)
+
+const (
+	// maxPartSize keeps each part, with its keys, inside one DynamoDB item
+	maxPartSize = 350 * 1024
+	uploadTTL   = time.Hour
+)
+
+// createUpload opens a multi-part upload session.
+func (s *Server) createUpload(w http.ResponseWriter, r *http.Request) {
+	var session upload.Session
+	if !decodeJSON(w, r, &session) {
+		return
+	}
+	if !upload.IsSupported(session.ContentEncoding) {
+		unsupportedEncoding(w, session.ContentEncoding)
+		return
+	}
+	if err := session.Validate(maxPartSize); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	session.ContentEncoding = upload.Normalize(session.ContentEncoding)
+
+	agent, _ := AgentFrom(r.Context())
+	u := store.Upload{
+		ID:        uuid.New().String(),
+		Session:   session,
+		Owner:     agent.HostID,
+		ExpiresAt: time.Now().Add(uploadTTL),
+	}
+	if err := s.tenantStore(r.Context()).CreateUpload(r.Context(), u); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to open upload: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"upload_id":     u.ID,
+		"expires_at":    u.ExpiresAt.UTC().Format(time.RFC3339),
+		"max_part_size": maxPartSize,
+	})
+}
+
+// uploadPart stores one part of an open session. Re-sending a part replaces
+// it, so a part can be retried after a network error.
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.openUpload(w, r)
+	if !ok {
+		return
+	}
+
+	part, err := strconv.Atoi(r.PathValue("part"))
+	if err != nil || part < 1 || part > u.Parts {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("part must be between 1 and %d", u.Parts))
+		return
+	}
+	data, err := readBody(r)
+	if err != nil || len(data) == 0 || len(data) > maxPartSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("part body must be 1 to %d bytes", maxPartSize))
+		return
+	}
+
+	if err := s.tenantStore(r.Context()).PutUploadPart(r.Context(), u.ID, part, data, u.ExpiresAt); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to store part: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "part": part})
+}
+
+// completeUpload reassembles a session and ingests it. Host data is written
+// only after every part is present and the body matches the declared size
+// and digest. The session is closed and its parts deleted only once the
+// payload is stored, so a failed ingest can be completed again.
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.openUpload(w, r)
+	if !ok {
+		return
+	}
+
+	parts, err := s.tenantStore(r.Context()).UploadParts(r.Context(), u.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load parts: "+err.Error())
+		return
+	}
+	data, err := u.Assemble(parts)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	body, err := upload.Decode(u.ContentEncoding, data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hostID, ok := s.storeBody(w, r, body)
+	if !ok {
+		return
+	}
+
+	// The payload is stored; a session left open only lingers until it
+	// expires, and completing it twice is stopped by the signature sequence.
+	err = s.tenantStore(r.Context()).CompleteUpload(r.Context(), u.ID, time.Now())
+	if err == nil {
+		err = s.tenantStore(r.Context()).DeleteUploadParts(r.Context(), u.ID, u.Parts)
+	}
+	if err != nil && !errors.Is(err, store.ErrConflict) {
+		log.Printf("Failed to close upload %s: %v", u.ID, err)
+	}
+	s.writeIngestResponse(w, r, hostID)
+}
+
+// openUpload returns the open session named in the path, if the caller may
+// write to it.
+func (s *Server) openUpload(w http.ResponseWriter, r *http.Request) (*store.Upload, bool) {
+	u, err := s.tenantStore(r.Context()).GetUpload(r.Context(), r.PathValue("uploadId"))
+	// Expired sessions may not have been cleaned up yet
+	if errors.Is(err, store.ErrNotFound) || (err == nil && time.Now().After(u.ExpiresAt)) {
+		writeError(w, http.StatusNotFound, "upload not found or expired")
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load upload: "+err.Error())
+		return nil, false
+	}
+	if u.Completed {
+		writeError(w, http.StatusConflict, "upload already completed")
+		return nil, false
+	}
+	agent, _ := AgentFrom(r.Context())
+	if u.Owner != agent.HostID {
+		writeError(w, http.StatusForbidden, "upload belongs to another caller")
+		return nil, false
+	}
+	return u, true
+}
@@ -0,0 +1,122 @@
+// Package apigw runs an http.Handler behind API Gateway HTTP APIs (payload
+// format 2.0), so the Lambda serves the same handlers as the standalone
+// server.
+package apigw
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/visiblaze/sec-agent/backend/internal/api"
+)
+
+// Handler adapts h to a Lambda handler for API Gateway events.
+func Handler(h http.Handler) func(context.Context, events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return func(ctx context.Context, event events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		req, err := Request(ctx, event)
+		if err != nil {
+			return events.APIGatewayV2HTTPResponse{
+				StatusCode: http.StatusBadRequest,
+				Headers:    map[string]string{"Content-Type": "application/json"},
+				Body:       fmt.Sprintf(`{"error":%q}`, err.Error()),
+			}, nil
+		}
+		w := newResponseWriter()
+		h.ServeHTTP(w, req)
+		return w.response(), nil
+	}
+}
+
+// Request converts an API Gateway event to an http.Request. The stage prefix
+// is stripped from the path, a base64 body is decoded, and a client
+// certificate verified by a mutual TLS custom domain is attached with
+// api.WithClientCertPEM.
+func Request(ctx context.Context, event events.APIGatewayV2HTTPRequest) (*http.Request, error) {
+	path := event.RawPath
+	if stage := event.RequestContext.Stage; stage != "" && stage != "$default" {
+		if trimmed, ok := strings.CutPrefix(path, "/"+stage); ok && trimmed != "" {
+			path = trimmed
+		}
+	}
+
+	body := []byte(event.Body)
+	if event.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(event.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body encoding: %w", err)
+		}
+		body = decoded
+	}
+
+	if pem := event.RequestContext.Authentication.ClientCert.ClientCertPem; pem != "" {
+		ctx = api.WithClientCertPEM(ctx, pem)
+	}
+
+	u := &url.URL{Path: path, RawQuery: event.RawQueryString}
+	req, err := http.NewRequestWithContext(ctx, event.RequestContext.HTTP.Method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range event.Headers {
+		req.Header.Set(name, value)
+	}
+	if len(event.Cookies) > 0 {
+		req.Header.Set("Cookie", strings.Join(event.Cookies, "; "))
+	}
+	req.Host = event.RequestContext.DomainName
+	req.RemoteAddr = event.RequestContext.HTTP.SourceIP
+	req.RequestURI = u.RequestURI()
+	return req, nil
+}
+
+// responseWriter buffers a response for the Lambda result.
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseWriter() *responseWriter {
+	return &responseWriter{header: http.Header{}}
+}
+
+func (w *responseWriter) Header() http.Header { return w.header }
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (w *responseWriter) response() events.APIGatewayV2HTTPResponse {
+	resp := events.APIGatewayV2HTTPResponse{
+		StatusCode: w.status,
+		Headers:    make(map[string]string, len(w.header)),
+	}
+	if resp.StatusCode == 0 {
+		resp.StatusCode = http.StatusOK
+	}
+	for name, values := range w.header {
+		resp.Headers[name] = strings.Join(values, ",")
+	}
+	if utf8.Valid(w.body.Bytes()) {
+		resp.Body = w.body.String()
+	} else {
+		resp.Body = base64.StdEncoding.EncodeToString(w.body.Bytes())
+		resp.IsBase64Encoded = true
+	}
+	return resp
+}
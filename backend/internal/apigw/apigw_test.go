@@ -0,0 +1,92 @@
+package apigw
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func event(method, path, stage string) events.APIGatewayV2HTTPRequest {
+	e := events.APIGatewayV2HTTPRequest{RawPath: path}
+	e.RequestContext.Stage = stage
+	e.RequestContext.HTTP.Method = method
+	return e
+}
+
+func TestRequest(t *testing.T) {
+	e := event("POST", "/prod/ingest", "prod")
+	e.RawQueryString = "limit=5"
+	e.Body = base64.StdEncoding.EncodeToString([]byte(`{"host_id":"h"}`))
+	e.IsBase64Encoded = true
+	e.Headers = map[string]string{"x-api-key": "secret"}
+	e.Cookies = []string{"a=1", "b=2"}
+
+	req, err := Request(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Path != "/ingest" || req.URL.Query().Get("limit") != "5" {
+		t.Errorf("url = %s", req.URL)
+	}
+	if req.Header.Get("X-Api-Key") != "secret" {
+		t.Errorf("header = %v", req.Header)
+	}
+	if c, err := req.Cookie("b"); err != nil || c.Value != "2" {
+		t.Errorf("cookie b = %v, %v", c, err)
+	}
+	if body, _ := io.ReadAll(req.Body); string(body) != `{"host_id":"h"}` {
+		t.Errorf("body = %q", body)
+	}
+
+	// The default stage is not part of the path
+	req, _ = Request(context.Background(), event("GET", "/health", "$default"))
+	if req.URL.Path != "/health" {
+		t.Errorf("default stage path = %s", req.URL.Path)
+	}
+
+	e = event("POST", "/ingest", "")
+	e.Body, e.IsBase64Encoded = "%%%", true
+	if _, err := Request(context.Background(), e); err == nil {
+		t.Error("invalid base64 body accepted")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Accept")
+		switch r.URL.Path {
+		case "/binary":
+			w.Write([]byte{0x1f, 0x8b, 0xff})
+		default:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"status":"ok"}`))
+		}
+	}))
+
+	resp, err := h(context.Background(), event("POST", "/text", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated || resp.Body != `{"status":"ok"}` || resp.IsBase64Encoded {
+		t.Errorf("text response = %+v", resp)
+	}
+	if resp.Headers["Vary"] != "Origin,Accept" {
+		t.Errorf("headers = %v", resp.Headers)
+	}
+
+	resp, _ = h(context.Background(), event("GET", "/binary", ""))
+	if resp.StatusCode != http.StatusOK || !resp.IsBase64Encoded || resp.Body != base64.StdEncoding.EncodeToString([]byte{0x1f, 0x8b, 0xff}) {
+		t.Errorf("binary response = %+v", resp)
+	}
+
+	e := event("POST", "/text", "")
+	e.Body, e.IsBase64Encoded = "%%%", true
+	if resp, _ = h(context.Background(), e); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad body status = %d", resp.StatusCode)
+	}
+}
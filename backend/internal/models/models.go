@@ -0,0 +1,192 @@
+package models
+
+type Host struct {
+	HostID       string   `json:"host_id"`
+	Hostname     string   `json:"hostname"`
+	OSID         string   `json:"os_id"`
+	OSVersion    string   `json:"os_version"`
+	Kernel       string   `json:"kernel"`
+	IPAddresses  []string `json:"ip_addresses"`
+	AgentVersion string   `json:"agent_version"`
+	// Tags label the host, such as "env:prod" or "team:web". Agents report
+	// the static tags of their config, and omit them to leave the stored
+	// ones unchanged; read back, Tags also holds UserTags.
+	Tags []string `json:"tags,omitempty"`
+	// UserTags are the tags assigned through the API; ignored on ingest
+	UserTags []string `json:"user_tags,omitempty"`
+	// Groups are the dynamic groups the host belongs to, set by the API
+	// when hosts are read back; ignored on ingest
+	Groups []string `json:"groups,omitempty"`
+
+	// Liveness, set when hosts are read back; ignored on ingest
+	FirstSeen      string          `json:"first_seen,omitempty"`
+	LastSeen       string          `json:"last_seen,omitempty"`
+	LastHeartbeat  string          `json:"last_heartbeat,omitempty"`
+	Status         string          `json:"status,omitempty"`
+	UptimeSeconds  int64           `json:"uptime_seconds,omitempty"`
+	QueueDepth     int             `json:"queue_depth,omitempty"`
+	LastCollection *CollectionInfo `json:"last_collection,omitempty"`
+	// PackageCount is the size of the current package inventory, set when
+	// hosts are read back
+	PackageCount int `json:"package_count"`
+}
+
+// Heartbeat is the liveness message agents post to /heartbeat between full
+// collections.
+type Heartbeat struct {
+	HostID         string          `json:"host_id"`
+	Hostname       string          `json:"hostname"`
+	AgentVersion   string          `json:"agent_version"`
+	UptimeSeconds  int64           `json:"uptime_seconds"`
+	QueueDepth     int             `json:"queue_depth"`
+	LastCollection *CollectionInfo `json:"last_collection,omitempty"`
+}
+
+// CollectionInfo is the outcome of an agent's most recent collection task.
+type CollectionInfo struct {
+	Task   string `json:"task"`
+	Status string `json:"status"`
+	At     string `json:"at"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Package struct {
+	// HostID is set on packages listed across hosts; ignored on ingest
+	HostID      string `json:"host_id,omitempty"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Arch        string `json:"arch"`
+	Manager     string `json:"manager"`
+	Source      string `json:"source"`
+	InstalledAt string `json:"installed_at"`
+}
+
+type CISResult struct {
+	// HostID is set on results listed across hosts; ignored on ingest
+	HostID    string                 `json:"host_id,omitempty"`
+	CheckID   string                 `json:"check_id"`
+	Title     string                 `json:"title"`
+	Status    string                 `json:"status"`
+	Evidence  map[string]interface{} `json:"evidence"`
+	Timestamp string                 `json:"ts"`
+
+	// History, set when results are read back; ignored on ingest.
+	// PreviousStatus is the status before the last change, empty if the
+	// check has never changed, and StatusChangedAt when that change (or the
+	// first report) happened.
+	PreviousStatus  string `json:"previous_status,omitempty"`
+	StatusChangedAt string `json:"status_changed_at,omitempty"`
+}
+
+// SoftwareEntry is one distinct package, by name and manager, in the fleet
+// software catalog.
+type SoftwareEntry struct {
+	Name      string            `json:"name"`
+	Manager   string            `json:"manager"`
+	HostCount int               `json:"host_count"`
+	Versions  []SoftwareVersion `json:"versions"`
+}
+
+// SoftwareVersion is one installed version of a catalog entry.
+type SoftwareVersion struct {
+	Version   string `json:"version"`
+	HostCount int    `json:"host_count"`
+}
+
+// SoftwareHost is a host with a catalog entry installed, with every version
+// and architecture of it the host has.
+type SoftwareHost struct {
+	HostID   string   `json:"host_id"`
+	Hostname string   `json:"hostname"`
+	OSID     string   `json:"os_id"`
+	Status   string   `json:"status,omitempty"`
+	Versions []string `json:"versions"`
+	Arches   []string `json:"arches"`
+	Manager  string   `json:"manager"`
+}
+
+// HostSummary condenses a host's latest results for its detail view.
+type HostSummary struct {
+	Packages int `json:"packages"`
+	Checks   int `json:"checks"`
+	// ByStatus counts checks by their latest status
+	ByStatus map[string]int `json:"by_status"`
+	// ComplianceScore is the percentage of passing checks among those that
+	// passed or failed; nil when none has
+	ComplianceScore *int `json:"compliance_score"`
+}
+
+// FailingCheck is a failing CIS result with the host's last remediation
+// attempt for the check, if any.
+type FailingCheck struct {
+	CISResult
+	Remediation *RemediationResult `json:"remediation,omitempty"`
+}
+
+type RemediationResult struct {
+	RunID       string   `json:"run_id"`
+	CheckID     string   `json:"check_id"`
+	Description string   `json:"description"`
+	Status      string   `json:"status"`
+	Files       []string `json:"files"`
+	Diff        string   `json:"diff,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	Timestamp   string   `json:"ts"`
+}
+
+type ContainerImage struct {
+	ID          string   `json:"id"`
+	RepoTags    []string `json:"repo_tags"`
+	RepoDigests []string `json:"repo_digests"`
+	SizeBytes   int64    `json:"size_bytes"`
+	Created     string   `json:"created,omitempty"`
+	Runtime     string   `json:"runtime"`
+}
+
+type Container struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Image   string            `json:"image"`
+	ImageID string            `json:"image_id"`
+	State   string            `json:"state"`
+	Status  string            `json:"status,omitempty"`
+	Created string            `json:"created,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Runtime string            `json:"runtime"`
+}
+
+type ContainerInventory struct {
+	Images     []ContainerImage `json:"images"`
+	Containers []Container      `json:"containers"`
+}
+
+type IngestPayload struct {
+	Host         Host                `json:"host"`
+	Packages     []Package           `json:"packages"`
+	CISResults   []CISResult         `json:"cis_results"`
+	Containers   *ContainerInventory `json:"containers,omitempty"`
+	Remediations []RemediationResult `json:"remediations,omitempty"`
+	// Tasks lists the sections a scheduled agent task collected; only those
+	// are written. Empty means a full snapshot.
+	Tasks []string `json:"tasks,omitempty"`
+}
+
+// Ingest sections, as named in IngestPayload.Tasks.
+const (
+	SectionHeartbeat = "heartbeat"
+	SectionCIS       = "cis"
+	SectionPackages  = "packages"
+)
+
+// Includes reports whether the payload carries section.
+func (p *IngestPayload) Includes(section string) bool {
+	if len(p.Tasks) == 0 {
+		return true
+	}
+	for _, t := range p.Tasks {
+		if t == section {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+// Package oidc verifies OpenID Connect bearer tokens: JWTs signed with RS256
+// or ES256 by a key from the issuer's JSON Web Key Set.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config names the issuer whose tokens are accepted and where its keys are.
+type Config struct {
+	Issuer   string
+	Audience string
+	// JWKSURL is fetched on first use, again when a token names a key it
+	// does not have (at most once a minute), and hourly. JWKSFile is read
+	// once instead, which suits air-gapped installs and tests.
+	JWKSURL  string
+	JWKSFile string
+}
+
+// Tokens are accepted this long past their expiry, and before their
+// not-before time, to absorb clock skew.
+const leeway = time.Minute
+
+const (
+	minRefresh = time.Minute
+	maxKeyAge  = time.Hour
+)
+
+// Claims are a verified token's payload.
+type Claims map[string]interface{}
+
+// Strings returns claim name as a list, whether the token carries a single
+// string or an array of them.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Verifier checks tokens against Config. It is safe for concurrent use.
+type Verifier struct {
+	cfg    Config
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// NewVerifier checks cfg and, for a JWKSFile, loads the keys.
+func NewVerifier(cfg Config) (*Verifier, error) {
+	if cfg.Issuer == "" || cfg.Audience == "" {
+		return nil, errors.New("oidc: issuer and audience are required")
+	}
+	if (cfg.JWKSURL == "") == (cfg.JWKSFile == "") {
+		return nil, errors.New("oidc: set exactly one of the JWKS URL and file")
+	}
+	v := &Verifier{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}, now: time.Now}
+	if cfg.JWKSFile != "" {
+		data, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("oidc: read JWKS: %w", err)
+		}
+		if v.keys, err = ParseKeySet(data); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// LooksLikeJWT reports whether a bearer token has the three dot-separated
+// parts of a JWT, as opposed to an opaque API token or credential.
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && strings.HasPrefix(token, "eyJ")
+}
+
+// Verify checks token's signature, issuer, audience and validity period and
+// returns its claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("oidc: malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("oidc: header: %w", err)
+	}
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("oidc: malformed signature")
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("oidc: claims: %w", err)
+	}
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: issuer %q is not trusted", iss)
+	}
+	if !slices.Contains(claims.Strings("aud"), v.cfg.Audience) {
+		return nil, errors.New("oidc: token is not for this audience")
+	}
+	now := v.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("oidc: token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return nil, errors.New("oidc: token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("oidc: token not valid yet")
+	}
+	return claims, nil
+}
+
+// key returns the key with kid, or the only key when the token names none,
+// refetching the key set when it is stale or lacks the key.
+func (v *Verifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.cfg.JWKSURL != "" {
+		age := v.now().Sub(v.fetched)
+		_, known := v.keys[kid]
+		if v.keys == nil || age > maxKeyAge || (!known && kid != "" && age > minRefresh) {
+			keys, err := v.fetch(ctx)
+			if err != nil && v.keys == nil {
+				return nil, err
+			}
+			if err == nil {
+				v.keys, v.fetched = keys, v.now()
+			}
+		}
+	}
+
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, nil
+		}
+	}
+	key, ok := v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (v *Verifier) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.JWKSURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: fetch JWKS: %w", err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: fetch JWKS: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: fetch JWKS: %w", err)
+	}
+	return ParseKeySet(data)
+}
+
+// ParseKeySet reads the RSA and P-256 signing keys of a JWKS document by key
+// ID. Other keys are skipped.
+func ParseKeySet(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("oidc: parse JWKS: %w", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.Kty == "RSA":
+			n, errN := decodeInt(k.N)
+			e, errE := decodeInt(k.E)
+			if errN != nil || errE != nil || !e.IsInt64() {
+				return nil, fmt.Errorf("oidc: parse JWKS: bad RSA key %q", k.Kid)
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case k.Kty == "EC" && k.Crv == "P-256":
+			x, errX := decodeInt(k.X)
+			y, errY := decodeInt(k.Y)
+			if errX != nil || errY != nil || !onP256(x, y) {
+				return nil, fmt.Errorf("oidc: parse JWKS: bad EC key %q", k.Kid)
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("oidc: JWKS has no usable signing keys")
+	}
+	return keys, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			break
+		}
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) != nil {
+			return errors.New("oidc: bad signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			break
+		}
+		if len(sig) != 64 {
+			return errors.New("oidc: bad signature")
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, digest[:], r, s) {
+			return errors.New("oidc: bad signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("oidc: algorithm %q does not match the signing key", alg)
+}
+
+// onP256 reports whether (x, y) is a valid P-256 point.
+func onP256(x, y *big.Int) bool {
+	if x.BitLen() > 256 || y.BitLen() > 256 {
+		return false
+	}
+	point := make([]byte, 65)
+	point[0] = 4
+	x.FillBytes(point[1:33])
+	y.FillBytes(point[33:])
+	_, err := ecdh.P256().NewPublicKey(point)
+	return err == nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("bad integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,162 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding
+
+func rsaJWK(kid string, k *rsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "n": b64.EncodeToString(k.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(k.E)).Bytes())}
+}
+
+func ecJWK(kid string, k *ecdsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64.EncodeToString(k.X.FillBytes(make([]byte, 32))), "y": b64.EncodeToString(k.Y.FillBytes(make([]byte, 32)))}
+}
+
+func keySet(keys ...map[string]string) []byte {
+	b, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	return b
+}
+
+// sign makes a JWT over claims with key, RS256 for RSA keys and ES256 for EC.
+func sign(t *testing.T, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(path, keySet(rsaJWK("r1", &rsaKey.PublicKey), ecJWK("e1", &ecKey.PublicKey)), 0o600)
+
+	v, err := NewVerifier(Config{Issuer: "https://idp.example", Audience: "visiblaze", JWKSFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	claims := func(edit func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss": "https://idp.example", "aud": []string{"other", "visiblaze"},
+			"exp": now.Add(time.Hour).Unix(), "sub": "alice", "roles": "operator",
+		}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+
+	for name, token := range map[string]string{
+		"rsa": sign(t, "r1", rsaKey, claims(nil)),
+		"ec":  sign(t, "e1", ecKey, claims(nil)),
+	} {
+		c, err := v.Verify(context.Background(), token)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got := c.Strings("roles"); len(got) != 1 || got[0] != "operator" {
+			t.Errorf("%s: roles = %v", name, got)
+		}
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	good := sign(t, "r1", rsaKey, claims(nil))
+	parts := strings.Split(good, ".")
+	tampered := parts[0] + "." + b64.EncodeToString([]byte(`{"iss":"https://idp.example","aud":"visiblaze","exp":9999999999,"roles":"admin"}`)) + "." + parts[2]
+	none := b64.EncodeToString([]byte(`{"alg":"none","kid":"r1"}`)) + "." + parts[1] + "."
+	for name, token := range map[string]string{
+		"expired":      sign(t, "r1", rsaKey, claims(func(c map[string]interface{}) { c["exp"] = now.Add(-time.Hour).Unix() })),
+		"no expiry":    sign(t, "r1", rsaKey, claims(func(c map[string]interface{}) { delete(c, "exp") })),
+		"not yet":      sign(t, "r1", rsaKey, claims(func(c map[string]interface{}) { c["nbf"] = now.Add(time.Hour).Unix() })),
+		"issuer":       sign(t, "r1", rsaKey, claims(func(c map[string]interface{}) { c["iss"] = "https://evil.example" })),
+		"audience":     sign(t, "r1", rsaKey, claims(func(c map[string]interface{}) { c["aud"] = "other" })),
+		"unknown key":  sign(t, "r9", rsaKey, claims(nil)),
+		"wrong key":    sign(t, "r1", otherKey, claims(nil)),
+		"alg mismatch": sign(t, "e1", rsaKey, claims(nil)),
+		"tampered":     tampered,
+		"alg none":     none,
+		"not a token":  "abc",
+	} {
+		if _, err := v.Verify(context.Background(), token); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	var current atomic.Value
+	current.Store(keySet(rsaJWK("old", &oldKey.PublicKey)))
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(current.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	v, err := NewVerifier(Config{Issuer: "iss", Audience: "aud", JWKSURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Now()
+	v.now = func() time.Time { return clock }
+	claims := map[string]interface{}{"iss": "iss", "aud": "aud", "exp": clock.Add(24 * time.Hour).Unix()}
+
+	if _, err := v.Verify(context.Background(), sign(t, "old", oldKey, claims)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The issuer rotates; an unknown key refetches, but not more than once a
+	// minute
+	current.Store(keySet(rsaJWK("new", &newKey.PublicKey)))
+	if _, err := v.Verify(context.Background(), sign(t, "new", newKey, claims)); err == nil {
+		t.Error("refetched within a minute of the last fetch")
+	}
+	clock = clock.Add(2 * time.Minute)
+	if _, err := v.Verify(context.Background(), sign(t, "new", newKey, claims)); err != nil {
+		t.Errorf("after rotation: %v", err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("fetched %d times, want 2", n)
+	}
+}
@@ -0,0 +1,363 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/visiblaze/sec-agent/backend/internal/api"
+	"github.com/visiblaze/sec-agent/backend/internal/oidc"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/liveness"
+)
+
+// Config is the visiblaze-server configuration file.
+type Config struct {
+	Listen    string          `yaml:"listen"`
+	DataDir   string          `yaml:"data_dir"`
+	TLS       TLSConfig       `yaml:"tls"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Policy    PolicyConfig    `yaml:"policy"`
+	Retention RetentionConfig `yaml:"retention"`
+	Liveness  LivenessConfig  `yaml:"liveness"`
+	CORS      CORSConfig      `yaml:"cors"`
+	Tenants   []TenantConfig  `yaml:"tenants"`
+}
+
+// TLSConfig enables HTTPS when CertFile and KeyFile are set. Agent client
+// certificates are verified against ClientCAFile; without
+// RequireClientCert, clients without one are still accepted so API keys and
+// enrolled credentials keep working.
+type TLSConfig struct {
+	CertFile          string `yaml:"cert_file"`
+	KeyFile           string `yaml:"key_file"`
+	ClientCAFile      string `yaml:"client_ca_file"`
+	RequireClientCert bool   `yaml:"require_client_cert"`
+}
+
+// AuthConfig controls how callers authenticate. The default tenant's shared
+// agent key is APIKey, or the contents of APIKeyFile, and may only report.
+// Users authenticate with Tokens or through OIDC. With no key, tokens or
+// OIDC set any caller is accepted as an admin of the default tenant.
+type AuthConfig struct {
+	Mode              string         `yaml:"mode"`
+	APIKey            string         `yaml:"api_key"`
+	APIKeyFile        string         `yaml:"api_key_file"`
+	RequireSignatures bool           `yaml:"require_signatures"`
+	Tokens            []api.APIToken `yaml:"tokens"`
+	OIDC              OIDCConfig     `yaml:"oidc"`
+}
+
+// OIDCConfig accepts JWTs from an identity provider when Issuer is set.
+// Users' roles are read from RoleClaim, "roles" by default, and their tenant
+// from TenantClaim, "tenant" by default.
+type OIDCConfig struct {
+	Issuer      string `yaml:"issuer"`
+	Audience    string `yaml:"audience"`
+	JWKSURL     string `yaml:"jwks_url"`
+	JWKSFile    string `yaml:"jwks_file"`
+	RoleClaim   string `yaml:"role_claim"`
+	TenantClaim string `yaml:"tenant_claim"`
+}
+
+// TenantConfig declares a tenant besides the default one, or, with ID
+// "default", names the default tenant and overrides its settings. Each
+// tenant's agents report with their own APIKey (or APIKeyFile); the default
+// tenant's is auth.api_key. RequireSignatures and Liveness, when set,
+// override the top-level settings for the tenant's hosts.
+type TenantConfig struct {
+	ID                string         `yaml:"id"`
+	Name              string         `yaml:"name"`
+	APIKey            string         `yaml:"api_key"`
+	APIKeyFile        string         `yaml:"api_key_file"`
+	RequireSignatures *bool          `yaml:"require_signatures"`
+	Liveness          LivenessConfig `yaml:"liveness"`
+}
+
+// CORSConfig lists the browser origins, such as the dashboard's, allowed to
+// call the API.
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// PolicyConfig locates the Ed25519 key that signs policies delivered to
+// agents. The key is generated on first start when the file does not exist.
+type PolicyConfig struct {
+	SigningKeyFile string `yaml:"signing_key_file"`
+}
+
+// RetentionConfig bounds how long data is kept. Hosts not heard from for
+// HostDays are removed with their packages and results; zero keeps them
+// forever. Expired enrollment tokens and upload sessions are always removed.
+type RetentionConfig struct {
+	HostDays     int    `yaml:"host_days"`
+	PruneEvery   string `yaml:"prune_every"`
+	pruneEvery   time.Duration
+	hostDuration time.Duration
+}
+
+// LivenessConfig overrides when hosts are reported stale and offline, as
+// durations such as 5m or 1h.
+type LivenessConfig struct {
+	StaleAfter   string `yaml:"stale_after"`
+	OfflineAfter string `yaml:"offline_after"`
+}
+
+// Default returns the configuration used when no file is given.
+func Default() *Config {
+	return &Config{
+		Listen:  ":3001",
+		DataDir: "/var/lib/visiblaze-server",
+		Auth:    AuthConfig{Mode: api.AuthAPIKey},
+		Retention: RetentionConfig{
+			PruneEvery: "1h",
+		},
+	}
+}
+
+// Load reads the configuration at path over the defaults.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	cfg := Default()
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration and resolves derived settings. It must
+// be called before the configuration is used.
+func (c *Config) Validate() error {
+	if c.Listen == "" {
+		return fmt.Errorf("listen is required")
+	}
+	if c.DataDir == "" {
+		return fmt.Errorf("data_dir is required")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+	}
+	if c.TLS.CertFile == "" && (c.TLS.ClientCAFile != "" || c.TLS.RequireClientCert) {
+		return fmt.Errorf("tls.client_ca_file and tls.require_client_cert need tls.cert_file")
+	}
+	if c.TLS.RequireClientCert && c.TLS.ClientCAFile == "" {
+		return fmt.Errorf("tls.require_client_cert needs tls.client_ca_file")
+	}
+	switch c.Auth.Mode {
+	case api.AuthAPIKey, api.AuthHost:
+	default:
+		return fmt.Errorf("auth.mode must be %s or %s", api.AuthAPIKey, api.AuthHost)
+	}
+	if c.Auth.APIKey != "" && c.Auth.APIKeyFile != "" {
+		return fmt.Errorf("set only one of auth.api_key and auth.api_key_file")
+	}
+	if err := c.validateTenants(); err != nil {
+		return err
+	}
+	if err := c.Auth.validateTokens(c.tenantIDs()); err != nil {
+		return err
+	}
+	if o := c.Auth.OIDC; o != (OIDCConfig{}) {
+		if o.Issuer == "" || o.Audience == "" {
+			return fmt.Errorf("auth.oidc needs issuer and audience")
+		}
+		if (o.JWKSURL == "") == (o.JWKSFile == "") {
+			return fmt.Errorf("set exactly one of auth.oidc.jwks_url and auth.oidc.jwks_file")
+		}
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("cors.allowed_origins: %q is not an origin such as https://dashboard.example.com", origin)
+		}
+	}
+	if c.Retention.HostDays < 0 {
+		return fmt.Errorf("retention.host_days must not be negative")
+	}
+	c.Retention.hostDuration = time.Duration(c.Retention.HostDays) * 24 * time.Hour
+	d, err := time.ParseDuration(c.Retention.PruneEvery)
+	if err != nil || d < time.Minute {
+		return fmt.Errorf("retention.prune_every must be a duration of at least 1m")
+	}
+	c.Retention.pruneEvery = d
+	if _, err := c.Thresholds(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Thresholds returns the liveness thresholds with the overrides applied.
+func (c *Config) Thresholds() (liveness.Thresholds, error) {
+	return c.Liveness.apply(liveness.Default, "liveness")
+}
+
+// apply returns base with l's overrides applied; prefix names l in errors.
+func (l LivenessConfig) apply(base liveness.Thresholds, prefix string) (liveness.Thresholds, error) {
+	t := base
+	for name, field := range map[string]struct {
+		value string
+		dst   *time.Duration
+	}{
+		prefix + ".stale_after":   {l.StaleAfter, &t.StaleAfter},
+		prefix + ".offline_after": {l.OfflineAfter, &t.OfflineAfter},
+	} {
+		if field.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field.value)
+		if err != nil {
+			return t, fmt.Errorf("%s: invalid duration %q", name, field.value)
+		}
+		*field.dst = d
+	}
+	if err := t.Validate(); err != nil {
+		return t, fmt.Errorf("%s: %w", prefix, err)
+	}
+	return t, nil
+}
+
+func (c *Config) validateTenants() error {
+	ids := map[string]bool{}
+	for i, t := range c.Tenants {
+		if !store.ValidTenantID(t.ID) {
+			return fmt.Errorf("tenants[%d]: id %q must be lower case letters, digits and dashes", i, t.ID)
+		}
+		if ids[t.ID] {
+			return fmt.Errorf("tenants: duplicate id %q", t.ID)
+		}
+		ids[t.ID] = true
+		if t.APIKey != "" && t.APIKeyFile != "" {
+			return fmt.Errorf("tenants %s: set only one of api_key and api_key_file", t.ID)
+		}
+		if t.ID == store.DefaultTenant && (t.APIKey != "" || t.APIKeyFile != "") {
+			return fmt.Errorf("tenants %s: the default tenant's agent key is auth.api_key", t.ID)
+		}
+		if _, err := t.Liveness.apply(liveness.Default, "tenants "+t.ID+" liveness"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tenantIDs returns every configured tenant, the default one included.
+func (c *Config) tenantIDs() map[string]bool {
+	ids := map[string]bool{store.DefaultTenant: true}
+	for _, t := range c.Tenants {
+		ids[t.ID] = true
+	}
+	return ids
+}
+
+// APITenants returns the tenants for api.Server, reading their agent keys.
+// No two tenants may share an agent key.
+func (c *Config) APITenants() ([]api.Tenant, error) {
+	base, err := c.Thresholds()
+	if err != nil {
+		return nil, err
+	}
+	defaultKey, err := c.APIKey()
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]string{}
+	if defaultKey != "" {
+		keys[defaultKey] = store.DefaultTenant
+	}
+	var tenants []api.Tenant
+	for _, tc := range c.Tenants {
+		key, err := readKey(tc.APIKey, tc.APIKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tenants %s: %w", tc.ID, err)
+		}
+		if other, ok := keys[key]; ok && key != "" {
+			return nil, fmt.Errorf("tenants %s: agent key is also the key of tenant %s", tc.ID, other)
+		}
+		keys[key] = tc.ID
+		t := api.Tenant{ID: tc.ID, Name: tc.Name, AgentKey: key, RequireSignatures: tc.RequireSignatures}
+		if tc.Liveness != (LivenessConfig{}) {
+			thresholds, err := tc.Liveness.apply(base, "tenants "+tc.ID+" liveness")
+			if err != nil {
+				return nil, err
+			}
+			t.Liveness = &thresholds
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, nil
+}
+
+func (a *AuthConfig) validateTokens(tenants map[string]bool) error {
+	names := map[string]bool{}
+	for i, t := range a.Tokens {
+		if t.Name == "" {
+			return fmt.Errorf("auth.tokens[%d]: name is required", i)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("auth.tokens: duplicate name %q", t.Name)
+		}
+		names[t.Name] = true
+		if !api.ValidUserRole(t.Role) {
+			return fmt.Errorf("auth.tokens %s: role must be viewer, operator or admin", t.Name)
+		}
+		if t.Tenant != "" && !tenants[t.Tenant] {
+			return fmt.Errorf("auth.tokens %s: unknown tenant %q", t.Name, t.Tenant)
+		}
+		if b, err := hex.DecodeString(t.SHA256); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("auth.tokens %s: sha256 must be the hex SHA-256 of the token", t.Name)
+		}
+	}
+	return nil
+}
+
+// Verifier returns the OIDC token verifier, or nil when OIDC is not
+// configured.
+func (c *Config) Verifier() (*oidc.Verifier, error) {
+	o := c.Auth.OIDC
+	if o.Issuer == "" {
+		return nil, nil
+	}
+	return oidc.NewVerifier(oidc.Config{Issuer: o.Issuer, Audience: o.Audience, JWKSURL: o.JWKSURL, JWKSFile: o.JWKSFile})
+}
+
+// APIKey returns the shared key from auth.api_key or auth.api_key_file.
+func (c *Config) APIKey() (string, error) {
+	return readKey(c.Auth.APIKey, c.Auth.APIKeyFile)
+}
+
+// readKey returns key, or the contents of file when it is set.
+func readKey(key, file string) (string, error) {
+	if file == "" {
+		return key, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("read api key: %w", err)
+	}
+	key = strings.TrimSpace(string(b))
+	if key == "" {
+		return "", fmt.Errorf("api key file %s is empty", file)
+	}
+	return key, nil
+}
+
+// StoreDir is where the embedded database lives.
+func (c *Config) StoreDir() string {
+	return filepath.Join(c.DataDir, "db")
+}
+
+// SigningKeyPath is the policy signing key, by default in the data dir.
+func (c *Config) SigningKeyPath() string {
+	if c.Policy.SigningKeyFile != "" {
+		return c.Policy.SigningKeyFile
+	}
+	return filepath.Join(c.DataDir, "policy_key.pem")
+}
@@ -0,0 +1,226 @@
+// Package server runs the Visiblaze API as a standalone process: the
+// handlers from package api over the embedded on-disk store, served with
+// net/http and optional mutual TLS, for environments without Lambda and
+// DynamoDB.
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/api"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/policy"
+)
+
+// shutdownTimeout bounds how long in-flight requests may finish on exit.
+const shutdownTimeout = 15 * time.Second
+
+// Server is a running visiblaze-server.
+type Server struct {
+	cfg   *Config
+	store *store.Memory
+	http  *http.Server
+}
+
+// New opens the store in cfg.DataDir and prepares the API. cfg must have
+// been validated.
+func New(cfg *Config) (*Server, error) {
+	apiKey, err := cfg.APIKey()
+	if err != nil {
+		return nil, err
+	}
+	thresholds, err := cfg.Thresholds()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := cfg.Verifier()
+	if err != nil {
+		return nil, err
+	}
+	tenants, err := cfg.APITenants()
+	if err != nil {
+		return nil, err
+	}
+	key, err := loadSigningKey(cfg.SigningKeyPath())
+	if err != nil {
+		return nil, fmt.Errorf("policy signing key: %w", err)
+	}
+	tlsCfg, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	st, err := store.Open(cfg.StoreDir())
+	if err != nil {
+		return nil, err
+	}
+
+	apiServer := &api.Server{
+		Store:             st,
+		Tenants:           tenants,
+		APIKey:            apiKey,
+		AuthMode:          cfg.Auth.Mode,
+		Tokens:            cfg.Auth.Tokens,
+		OIDC:              verifier,
+		OIDCRoleClaim:     cfg.Auth.OIDC.RoleClaim,
+		OIDCTenantClaim:   cfg.Auth.OIDC.TenantClaim,
+		AllowedOrigins:    cfg.CORS.AllowedOrigins,
+		RequireSignatures: cfg.Auth.RequireSignatures,
+		PolicySigningKey:  key,
+		Liveness:          thresholds,
+	}
+	if !apiServer.AuthConfigured() {
+		log.Printf("WARNING: no auth.api_key, tenant api_key, auth.tokens or auth.oidc configured; every caller is an admin")
+	}
+	handler := apiServer.Handler()
+	return &Server{
+		cfg:   cfg,
+		store: st,
+		http: &http.Server{
+			Handler:           handler,
+			TLSConfig:         tlsCfg,
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+		},
+	}, nil
+}
+
+// Run listens on the configured address and serves until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.cfg.Listen)
+	if err != nil {
+		s.store.Close()
+		return fmt.Errorf("listen: %w", err)
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is cancelled, then drains in-flight requests
+// and closes the store.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	defer s.store.Close()
+
+	go s.prune(ctx)
+
+	errc := make(chan error, 1)
+	go func() {
+		if s.http.TLSConfig != nil {
+			errc <- s.http.ServeTLS(ln, "", "")
+		} else {
+			errc <- s.http.Serve(ln)
+		}
+	}()
+	log.Printf("visiblaze-server listening on %s (tls %t, data dir %s)", ln.Addr(), s.http.TLSConfig != nil, s.cfg.DataDir)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.http.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// prune applies the retention settings until ctx is cancelled.
+func (s *Server) prune(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Retention.pruneEvery)
+	defer ticker.Stop()
+	for {
+		n, err := s.store.Prune(ctx, time.Now(), s.cfg.Retention.hostDuration)
+		switch {
+		case err != nil:
+			log.Printf("retention: %v", err)
+		case n > 0:
+			log.Printf("retention: removed %d hosts not seen for %d days", n, s.cfg.Retention.HostDays)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newTLSConfig returns nil when TLS is not configured.
+func newTLSConfig(c TLSConfig) (*tls.Config, error) {
+	if c.CertFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load tls certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if c.ClientCAFile == "" {
+		return cfg, nil
+	}
+
+	b, err := os.ReadFile(c.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("client ca %s contains no certificates", c.ClientCAFile)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if c.RequireClientCert {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// loadSigningKey reads the policy signing key at path, generating one on
+// first start. The public key is logged so it can be pasted into the
+// agents' remote_policy.public_key.
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	var key ed25519.PrivateKey
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if key, err = policy.ParsePrivateKey(string(b)); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, os.ErrNotExist):
+		if _, key, err = ed25519.GenerateKey(rand.Reader); err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	log.Printf("policy public key:\n%s", policy.PublicKeyPEM(key.Public().(ed25519.PublicKey)))
+	return key, nil
+}
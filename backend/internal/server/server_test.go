@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/api"
+)
+
+var testTokenHash = api.HashAPIToken("viewer-token")
+
+func TestValidate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		edit func(*Config)
+		err  string
+	}{
+		"defaults":         {func(c *Config) {}, ""},
+		"cert without key": {func(c *Config) { c.TLS.CertFile = "c.pem" }, "set together"},
+		"client ca without tls": {
+			func(c *Config) { c.TLS.ClientCAFile = "ca.pem" }, "need tls.cert_file",
+		},
+		"require cert without ca": {
+			func(c *Config) { c.TLS = TLSConfig{CertFile: "c", KeyFile: "k", RequireClientCert: true} }, "client_ca_file",
+		},
+		"auth mode": {func(c *Config) { c.Auth.Mode = "open" }, "auth.mode"},
+		"two keys":  {func(c *Config) { c.Auth.APIKey, c.Auth.APIKeyFile = "k", "f" }, "only one"},
+		"token without name": {
+			func(c *Config) { c.Auth.Tokens = []api.APIToken{{Role: api.RoleViewer, SHA256: testTokenHash}} }, "name is required",
+		},
+		"agent token": {
+			func(c *Config) {
+				c.Auth.Tokens = []api.APIToken{{Name: "a", Role: api.RoleAgent, SHA256: testTokenHash}}
+			}, "role must be",
+		},
+		"plain token": {
+			func(c *Config) { c.Auth.Tokens = []api.APIToken{{Name: "a", Role: api.RoleAdmin, SHA256: "s3cret"}} }, "hex SHA-256",
+		},
+		"duplicate token": {
+			func(c *Config) {
+				t := api.APIToken{Name: "a", Role: api.RoleAdmin, SHA256: testTokenHash}
+				c.Auth.Tokens = []api.APIToken{t, t}
+			}, "duplicate",
+		},
+		"oidc without audience": {func(c *Config) { c.Auth.OIDC = OIDCConfig{Issuer: "https://idp", JWKSFile: "k"} }, "audience"},
+		"oidc two key sets": {
+			func(c *Config) {
+				c.Auth.OIDC = OIDCConfig{Issuer: "i", Audience: "a", JWKSFile: "k", JWKSURL: "https://idp/keys"}
+			}, "exactly one",
+		},
+		"origin with path":  {func(c *Config) { c.CORS.AllowedOrigins = []string{"https://dash.example/app"} }, "not an origin"},
+		"negative days":     {func(c *Config) { c.Retention.HostDays = -1 }, "host_days"},
+		"prune too often":   {func(c *Config) { c.Retention.PruneEvery = "10s" }, "prune_every"},
+		"bad liveness":      {func(c *Config) { c.Liveness.StaleAfter = "soon" }, "stale_after"},
+		"offline not after": {func(c *Config) { c.Liveness.StaleAfter, c.Liveness.OfflineAfter = "1h", "5m" }, "liveness"},
+		"tenants":           {func(c *Config) { c.Tenants = []TenantConfig{{ID: "acme", APIKey: "k"}, {ID: "default", Name: "HQ"}} }, ""},
+		"tenant id":         {func(c *Config) { c.Tenants = []TenantConfig{{ID: "Acme Corp"}} }, "lower case"},
+		"duplicate tenant":  {func(c *Config) { c.Tenants = []TenantConfig{{ID: "acme"}, {ID: "acme"}} }, "duplicate id"},
+		"default tenant key": {
+			func(c *Config) { c.Tenants = []TenantConfig{{ID: "default", APIKey: "k"}} }, "auth.api_key",
+		},
+		"tenant liveness": {
+			func(c *Config) {
+				c.Tenants = []TenantConfig{{ID: "acme", Liveness: LivenessConfig{StaleAfter: "soon"}}}
+			}, "tenants acme liveness",
+		},
+		"token tenant": {
+			func(c *Config) {
+				c.Auth.Tokens = []api.APIToken{{Name: "a", Role: api.RoleAdmin, Tenant: "acme", SHA256: testTokenHash}}
+			}, "unknown tenant",
+		},
+	} {
+		cfg := Default()
+		tc.edit(cfg)
+		err := cfg.Validate()
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: got %v, want error containing %q", name, err, tc.err)
+		}
+	}
+}
+
+func TestLoadExamples(t *testing.T) {
+	for _, name := range []string{"config.example.yaml", "config.local.yaml", "config.tenants.yaml"} {
+		cfg, err := Load(filepath.Join("..", "..", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestAPIKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_key")
+	os.WriteFile(path, []byte("s3cret\n"), 0o600)
+	cfg := Default()
+	cfg.Auth.APIKeyFile = path
+	if key, err := cfg.APIKey(); err != nil || key != "s3cret" {
+		t.Errorf("key = %q, %v", key, err)
+	}
+	os.WriteFile(path, []byte("\n"), 0o600)
+	if _, err := cfg.APIKey(); err == nil {
+		t.Error("empty key file accepted")
+	}
+}
+
+func TestAPITenants(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.APIKey = "hq-key"
+	cfg.Liveness.OfflineAfter = "2h"
+	cfg.Tenants = []TenantConfig{
+		{ID: "acme", APIKey: "acme-key", Liveness: LivenessConfig{StaleAfter: "10m"}},
+		{ID: "globex", APIKey: "globex-key"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := cfg.APITenants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tenants) != 2 || tenants[0].AgentKey != "acme-key" || tenants[1].Liveness != nil {
+		t.Fatalf("tenants = %+v", tenants)
+	}
+	if l := tenants[0].Liveness; l.StaleAfter != 10*time.Minute || l.OfflineAfter != 2*time.Hour {
+		t.Errorf("acme liveness = %+v", l)
+	}
+
+	cfg.Tenants[1].APIKey = "hq-key"
+	if _, err := cfg.APITenants(); err == nil || !strings.Contains(err.Error(), "tenant default") {
+		t.Errorf("shared agent key: %v", err)
+	}
+}
+
+// start serves a server over dataDir on a free port and returns its URL and
+// a function that stops it.
+func start(t *testing.T, dataDir string) (string, func()) {
+	t.Helper()
+	cfg := Default()
+	cfg.DataDir = dataDir
+	cfg.Auth.APIKey = "k"
+	cfg.Auth.Tokens = []api.APIToken{{Name: "dashboard", Role: api.RoleViewer, SHA256: testTokenHash}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, ln) }()
+	return "http://" + ln.Addr().String(), func() {
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("serve: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("server did not stop")
+		}
+	}
+}
+
+func TestServePersists(t *testing.T) {
+	dataDir := t.TempDir()
+	url, stop := start(t, dataDir)
+
+	req, _ := http.NewRequest("POST", url+"/ingest", strings.NewReader(
+		`{"host":{"host_id":"host-1","hostname":"web-1"},"packages":[{"name":"bash","version":"5.1"}]}`))
+	req.Header.Set("X-API-Key", "k")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ingest status = %d", resp.StatusCode)
+	}
+	stop()
+
+	if _, err := os.Stat(filepath.Join(dataDir, "policy_key.pem")); err != nil {
+		t.Errorf("policy key not generated: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "db", "snapshot.json")); err != nil {
+		t.Errorf("no snapshot after shutdown: %v", err)
+	}
+
+	url, stop = start(t, dataDir)
+	defer stop()
+	req, _ = http.NewRequest("GET", url+"/hosts/host-1", nil)
+	req.Header.Set("Authorization", "Bearer viewer-token")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Host struct {
+			Hostname     string `json:"hostname"`
+			PackageCount int    `json:"package_count"`
+		} `json:"host"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK || body.Host.Hostname != "web-1" || body.Host.PackageCount != 1 {
+		t.Errorf("after restart: status %d, %+v", resp.StatusCode, body)
+	}
+}
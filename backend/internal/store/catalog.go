@@ -0,0 +1,74 @@
+package store
+
+import (
+	"sort"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+)
+
+// SoftwareQuery selects entries of the software catalog.
+type SoftwareQuery struct {
+	Name    string
+	Manager string
+}
+
+// Matches reports whether the entry name and manager pass q.
+func (q SoftwareQuery) Matches(name, manager string) bool {
+	return (q.Name == "" || name == q.Name) && (q.Manager == "" || manager == q.Manager)
+}
+
+// Catalog aggregates packages, with their HostID set, into one entry per
+// name and manager. Hosts are counted once per entry and once per version
+// however many architectures they have installed.
+func Catalog(packages []models.Package) []models.SoftwareEntry {
+	type versionKey struct{ name, manager, version string }
+	entryHosts := map[[2]string]map[string]bool{}
+	versionHosts := map[versionKey]map[string]bool{}
+	for _, pkg := range packages {
+		ek := [2]string{pkg.Name, pkg.Manager}
+		vk := versionKey{pkg.Name, pkg.Manager, pkg.Version}
+		if entryHosts[ek] == nil {
+			entryHosts[ek] = map[string]bool{}
+		}
+		if versionHosts[vk] == nil {
+			versionHosts[vk] = map[string]bool{}
+		}
+		entryHosts[ek][pkg.HostID] = true
+		versionHosts[vk][pkg.HostID] = true
+	}
+
+	byEntry := map[[2]string]*models.SoftwareEntry{}
+	for ek, hosts := range entryHosts {
+		byEntry[ek] = &models.SoftwareEntry{Name: ek[0], Manager: ek[1], HostCount: len(hosts)}
+	}
+	for vk, hosts := range versionHosts {
+		e := byEntry[[2]string{vk.name, vk.manager}]
+		e.Versions = append(e.Versions, models.SoftwareVersion{Version: vk.version, HostCount: len(hosts)})
+	}
+	entries := make([]models.SoftwareEntry, 0, len(byEntry))
+	for _, e := range byEntry {
+		entries = append(entries, *e)
+	}
+	SortCatalog(entries)
+	return entries
+}
+
+// SortCatalog orders entries by name and manager, and the versions of each
+// with the most widely installed first.
+func SortCatalog(entries []models.SoftwareEntry) {
+	for _, e := range entries {
+		sort.Slice(e.Versions, func(i, j int) bool {
+			a, b := e.Versions[i], e.Versions[j]
+			if a.HostCount != b.HostCount {
+				return a.HostCount > b.HostCount
+			}
+			return a.Version < b.Version
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Manager < entries[j].Manager
+	})
+}
@@ -0,0 +1,322 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// On disk a store is a directory holding a snapshot of every tenant's data
+// and a journal of the records changed since. Every change is appended to
+// the journal and synced before the call returns; when the journal grows
+// past compactAfter it is folded into a new snapshot. Journal entries carry
+// the full new value of a record, so replaying an entry twice is harmless
+// and a crash between writing a snapshot and truncating the journal loses
+// nothing.
+const (
+	snapshotFile = "snapshot.json"
+	journalFile  = "journal.log"
+)
+
+// compactAfter is the journal size that triggers a new snapshot.
+var compactAfter int64 = 8 << 20
+
+// Tables name the record kinds in the journal.
+const (
+	tableHosts    = "hosts"
+	tablePackages = "packages"
+	tableCIS      = "cis_results"
+	tableTokens   = "enrollment_tokens"
+	tableUploads  = "uploads"
+	tableParts    = "upload_parts"
+	tablePolicies = "policies"
+	tableGroups   = "groups"
+)
+
+// change is one record written by a mutation. A nil value deletes the
+// record. For tableParts, part 0 with a nil value deletes every part of the
+// upload.
+type change struct {
+	table string
+	key   string
+	part  int
+	value any
+}
+
+type journalEntry struct {
+	// Tenant is empty in entries written before tenants, which belong to
+	// DefaultTenant.
+	Tenant string          `json:"n,omitempty"`
+	Table  string          `json:"t"`
+	Key    string          `json:"k"`
+	Part   int             `json:"p,omitempty"`
+	Value  json.RawMessage `json:"v,omitempty"`
+}
+
+// snapshot is the snapshot file. Snapshots written before tenants hold the
+// fields of DefaultTenant's memoryData instead.
+type snapshot struct {
+	Tenants map[string]*memoryData `json:"tenants"`
+}
+
+// disk is the persistence of a Memory opened with Open.
+type disk struct {
+	dir     string
+	journal *os.File
+	size    int64
+}
+
+// Open returns a Store persisted in dir, creating the directory if needed
+// and loading the snapshot and journal already there. Only one process may
+// open a directory at a time. Call Close to compact the journal on exit.
+func Open(dir string) (*Memory, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create store dir: %w", err)
+	}
+	db := &memoryDB{tenants: map[string]*memoryData{}}
+	b, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	default:
+		if db.tenants, err = parseSnapshot(b); err != nil {
+			return nil, fmt.Errorf("parse snapshot: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	size, err := db.replay(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	db.disk = &disk{dir: dir, journal: f, size: size}
+	m := db.store(DefaultTenant)
+	if size > 0 {
+		if err := m.compact(); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func parseSnapshot(b []byte) (map[string]*memoryData, error) {
+	var snap snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return nil, err
+	}
+	if snap.Tenants == nil {
+		var legacy memoryData
+		if err := json.Unmarshal(b, &legacy); err != nil {
+			return nil, err
+		}
+		snap.Tenants = map[string]*memoryData{DefaultTenant: &legacy}
+	}
+	for _, d := range snap.Tenants {
+		d.init()
+	}
+	return snap.Tenants, nil
+}
+
+// replay applies the journal in f and returns the offset of its end. A final
+// entry cut short by a crash is discarded.
+func (db *memoryDB) replay(f *os.File) (int64, error) {
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				if err := f.Truncate(offset); err != nil {
+					return 0, fmt.Errorf("truncate journal: %w", err)
+				}
+			}
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read journal: %w", err)
+		}
+		var e journalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return 0, fmt.Errorf("journal entry at offset %d: %w", offset, err)
+		}
+		tenant := e.Tenant
+		if tenant == "" {
+			tenant = DefaultTenant
+		}
+		if err := db.store(tenant).data.apply(e); err != nil {
+			return 0, fmt.Errorf("journal entry at offset %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seek journal: %w", err)
+	}
+	return offset, nil
+}
+
+func (d *memoryData) apply(e journalEntry) error {
+	deleted := len(e.Value) == 0 || bytes.Equal(e.Value, []byte("null"))
+	switch e.Table {
+	case tableHosts:
+		return put(d.Hosts, e.Key, e.Value, deleted)
+	case tablePackages:
+		return put(d.Packages, e.Key, e.Value, deleted)
+	case tableCIS:
+		return put(d.CIS, e.Key, e.Value, deleted)
+	case tableTokens:
+		return put(d.Tokens, e.Key, e.Value, deleted)
+	case tablePolicies:
+		return put(d.Policies, e.Key, e.Value, deleted)
+	case tableGroups:
+		return put(d.Groups, e.Key, e.Value, deleted)
+	case tableUploads:
+		if deleted {
+			delete(d.Uploads, e.Key)
+			return nil
+		}
+		var u Upload
+		if err := json.Unmarshal(e.Value, &u); err != nil {
+			return err
+		}
+		rec := d.Uploads[e.Key]
+		if rec == nil {
+			rec = &uploadRecord{Data: map[int][]byte{}}
+			d.Uploads[e.Key] = rec
+		}
+		rec.Upload = u
+	case tableParts:
+		rec := d.Uploads[e.Key]
+		switch {
+		case rec == nil:
+		case deleted && e.Part == 0:
+			rec.Data = nil
+		case deleted:
+			delete(rec.Data, e.Part)
+		default:
+			var data []byte
+			if err := json.Unmarshal(e.Value, &data); err != nil {
+				return err
+			}
+			if rec.Data == nil {
+				rec.Data = map[int][]byte{}
+			}
+			rec.Data[e.Part] = data
+		}
+	default:
+		return fmt.Errorf("unknown table %q", e.Table)
+	}
+	return nil
+}
+
+func put[V any](m map[string]V, key string, raw json.RawMessage, deleted bool) error {
+	if deleted {
+		delete(m, key)
+		return nil
+	}
+	var v V
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+	m[key] = v
+	return nil
+}
+
+// commit persists the records changed by a mutation. Callers hold m.mu.
+func (m *Memory) commit(changes ...change) error {
+	if m.disk == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, c := range changes {
+		e := journalEntry{Tenant: m.tenant, Table: c.table, Key: c.key, Part: c.part}
+		if c.value != nil {
+			v, err := json.Marshal(c.value)
+			if err != nil {
+				return fmt.Errorf("encode %s %s: %w", c.table, c.key, err)
+			}
+			e.Value = v
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("encode %s %s: %w", c.table, c.key, err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	n, err := m.disk.journal.Write(buf.Bytes())
+	m.disk.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	if err := m.disk.journal.Sync(); err != nil {
+		return fmt.Errorf("sync journal: %w", err)
+	}
+	if m.disk.size > compactAfter {
+		return m.compact()
+	}
+	return nil
+}
+
+// compact writes a snapshot and empties the journal. Callers hold m.mu.
+func (m *Memory) compact() error {
+	b, err := json.Marshal(snapshot{Tenants: m.tenants})
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	path := filepath.Join(m.disk.dir, snapshotFile)
+	tmp, err := os.CreateTemp(m.disk.dir, snapshotFile+".*")
+	if err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := m.disk.journal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate journal: %w", err)
+	}
+	if _, err := m.disk.journal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek journal: %w", err)
+	}
+	m.disk.size = 0
+	return nil
+}
+
+// Close compacts the journal and releases the store's files. The store must
+// not be used afterwards. Closing a store from NewMemory does nothing.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.disk == nil {
+		return nil
+	}
+	err := m.compact()
+	if cerr := m.disk.journal.Close(); err == nil {
+		err = cerr
+	}
+	m.disk = nil
+	return err
+}
@@ -0,0 +1,131 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxBatchSize is the most requests BatchWriteItem takes in one call.
+const maxBatchSize = 25
+
+// Items DynamoDB leaves unprocessed (throttling, partition limits) are
+// resent up to maxBatchAttempts times with exponential backoff starting at
+// batchBackoff.
+var (
+	maxBatchAttempts = 8
+	batchBackoff     = 50 * time.Millisecond
+)
+
+type batchWriter interface {
+	BatchWriteItem(ctx context.Context, in *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+// batchWrite applies requests to table in batches of maxBatchSize, retrying
+// unprocessed items. Requests must not repeat a key. It fails if any request
+// is still unprocessed after the last attempt; requests already applied stay
+// applied.
+func batchWrite(ctx context.Context, client batchWriter, table string, requests []types.WriteRequest) error {
+	for start := 0; start < len(requests); start += maxBatchSize {
+		batch := requests[start:min(start+maxBatchSize, len(requests))]
+		backoff := batchBackoff
+		for attempt := 1; ; attempt++ {
+			out, err := client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{table: batch},
+			})
+			if err != nil {
+				return fmt.Errorf("batch write %s: %w", table, err)
+			}
+			batch = out.UnprocessedItems[table]
+			if len(batch) == 0 {
+				break
+			}
+			if attempt == maxBatchAttempts {
+				return fmt.Errorf("batch write %s: %d items unprocessed after %d attempts", table, len(batch), attempt)
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("batch write %s: %w", table, ctx.Err())
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, 2*time.Second)
+		}
+	}
+	return nil
+}
+
+// maxBatchGetSize is the most keys BatchGetItem takes in one call.
+const maxBatchGetSize = 100
+
+type batchGetter interface {
+	BatchGetItem(ctx context.Context, in *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+}
+
+// batchGet reads the items of keys from table with strongly consistent
+// reads, in batches of maxBatchGetSize, retrying unprocessed keys like
+// batchWrite. Items come back in no particular order and missing ones are
+// left out. projection, when not empty, selects the attributes read.
+func batchGet(ctx context.Context, client batchGetter, table string, keys []map[string]types.AttributeValue, projection string) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+	for start := 0; start < len(keys); start += maxBatchGetSize {
+		req := types.KeysAndAttributes{
+			Keys:           keys[start:min(start+maxBatchGetSize, len(keys))],
+			ConsistentRead: boolPtr(true),
+		}
+		if projection != "" {
+			req.ProjectionExpression = str(projection)
+		}
+		backoff := batchBackoff
+		for attempt := 1; ; attempt++ {
+			out, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: map[string]types.KeysAndAttributes{table: req},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("batch get %s: %w", table, err)
+			}
+			items = append(items, out.Responses[table]...)
+			next, ok := out.UnprocessedKeys[table]
+			if !ok || len(next.Keys) == 0 {
+				break
+			}
+			if attempt == maxBatchAttempts {
+				return nil, fmt.Errorf("batch get %s: %d keys unprocessed after %d attempts", table, len(next.Keys), attempt)
+			}
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("batch get %s: %w", table, ctx.Err())
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, 2*time.Second)
+			req = next
+		}
+	}
+	return items, nil
+}
+
+func putRequest(item map[string]types.AttributeValue) types.WriteRequest {
+	return types.WriteRequest{PutRequest: &types.PutRequest{Item: item}}
+}
+
+func deleteRequest(key map[string]types.AttributeValue) types.WriteRequest {
+	return types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}}
+}
+
+// queryAll runs a query to completion, following LastEvaluatedKey.
+func (s *Store) queryAll(ctx context.Context, in *dynamodb.QueryInput) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+	for {
+		out, err := s.client.Query(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, out.Items...)
+		if out.LastEvaluatedKey == nil {
+			return items, nil
+		}
+		in.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,149 @@
+package dynamo
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeBatch leaves the last unprocessed items of each call unprocessed
+// until it has been called failFor times.
+type fakeBatch struct {
+	failFor     int
+	unprocessed int
+	calls       int
+	sizes       []int
+	written     map[string]bool
+}
+
+func (f *fakeBatch) BatchWriteItem(ctx context.Context, in *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	f.calls++
+	out := &dynamodb.BatchWriteItemOutput{}
+	for table, reqs := range in.RequestItems {
+		f.sizes = append(f.sizes, len(reqs))
+		done := reqs
+		if f.calls <= f.failFor && len(reqs) >= f.unprocessed {
+			done = reqs[:len(reqs)-f.unprocessed]
+			out.UnprocessedItems = map[string][]types.WriteRequest{table: reqs[len(reqs)-f.unprocessed:]}
+		}
+		for _, r := range done {
+			f.written[attrString(r.PutRequest.Item["k"])] = true
+		}
+	}
+	return out, nil
+}
+
+func requests(n int) []types.WriteRequest {
+	var reqs []types.WriteRequest
+	for i := 0; i < n; i++ {
+		reqs = append(reqs, putRequest(map[string]types.AttributeValue{"k": &types.AttributeValueMemberS{Value: strconv.Itoa(i)}}))
+	}
+	return reqs
+}
+
+func TestBatchWrite(t *testing.T) {
+	batchBackoff = time.Millisecond
+	defer func() { batchBackoff = 50 * time.Millisecond }()
+
+	f := &fakeBatch{failFor: 2, unprocessed: 3, written: map[string]bool{}}
+	if err := batchWrite(context.Background(), f, "t", requests(60)); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.written) != 60 {
+		t.Errorf("wrote %d items, want 60", len(f.written))
+	}
+	if f.sizes[0] != maxBatchSize || f.sizes[1] != 3 {
+		t.Errorf("batch sizes = %v", f.sizes)
+	}
+
+	f = &fakeBatch{failFor: 100, unprocessed: 1, written: map[string]bool{}}
+	if err := batchWrite(context.Background(), f, "t", requests(5)); err == nil {
+		t.Error("items left unprocessed did not fail the write")
+	}
+	if f.calls != maxBatchAttempts {
+		t.Errorf("calls = %d, want %d", f.calls, maxBatchAttempts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f = &fakeBatch{failFor: 100, unprocessed: 1, written: map[string]bool{}}
+	if err := batchWrite(ctx, f, "t", requests(5)); err == nil || f.calls != 1 {
+		t.Errorf("cancelled write: %v after %d calls", err, f.calls)
+	}
+}
+
+// fakeGet returns every key asked for as an item, except that the first
+// unprocessed keys of each call stay unprocessed until it has been called
+// failFor times.
+type fakeGet struct {
+	failFor     int
+	unprocessed int
+	calls       int
+	sizes       []int
+}
+
+func (f *fakeGet) BatchGetItem(ctx context.Context, in *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	f.calls++
+	out := &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]types.AttributeValue{}}
+	for table, req := range in.RequestItems {
+		f.sizes = append(f.sizes, len(req.Keys))
+		keys := req.Keys
+		if f.calls <= f.failFor && len(keys) >= f.unprocessed {
+			out.UnprocessedKeys = map[string]types.KeysAndAttributes{table: {Keys: keys[:f.unprocessed]}}
+			keys = keys[f.unprocessed:]
+		}
+		out.Responses[table] = keys
+	}
+	return out, nil
+}
+
+func TestBatchGet(t *testing.T) {
+	batchBackoff = time.Millisecond
+	defer func() { batchBackoff = 50 * time.Millisecond }()
+
+	var keys []map[string]types.AttributeValue
+	for _, r := range requests(150) {
+		keys = append(keys, r.PutRequest.Item)
+	}
+	f := &fakeGet{failFor: 1, unprocessed: 2}
+	items, err := batchGet(context.Background(), f, "t", keys, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, it := range items {
+		got[attrString(it["k"])] = true
+	}
+	if len(items) != 150 || len(got) != 150 {
+		t.Errorf("read %d items (%d distinct), want 150", len(items), len(got))
+	}
+	if f.sizes[0] != maxBatchGetSize || f.sizes[1] != 2 || f.sizes[2] != 50 {
+		t.Errorf("batch sizes = %v", f.sizes)
+	}
+
+	f = &fakeGet{failFor: 100, unprocessed: 1}
+	if _, err := batchGet(context.Background(), f, "t", keys[:5], ""); err == nil {
+		t.Error("keys left unprocessed did not fail the read")
+	}
+	if f.calls != maxBatchAttempts {
+		t.Errorf("calls = %d, want %d", f.calls, maxBatchAttempts)
+	}
+}
+
+func TestGeneration(t *testing.T) {
+	now := time.Now()
+	older, newer := newGeneration(now), newGeneration(now.Add(time.Millisecond))
+	if older >= newer {
+		t.Errorf("generations do not sort by time: %s, %s", older, newer)
+	}
+	if ts, ok := generationTime(older); !ok || !ts.Equal(time.Unix(0, now.UnixNano())) {
+		t.Errorf("generationTime = %v, %v", ts, ok)
+	}
+	if _, ok := generationTime(""); ok {
+		t.Error("legacy generation parsed")
+	}
+}
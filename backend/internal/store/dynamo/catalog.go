@@ -0,0 +1,267 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+)
+
+// The software catalog is kept as host counts in the software table, keyed
+// by tenant_name like the packages' NameIndex: one item per manager
+// (entry_key "<manager>") counting the hosts with the package at all, and
+// one per version (entry_key "<manager>#<version>"). ReplacePackages and
+// DeleteHost add the difference between a host's old and new inventory once
+// the new one is visible, so reading the catalog is a Query of
+// CatalogIndex, whatever the size of the fleet. Adjustments that fail are
+// returned and leave the counts off until RebuildSoftwareCatalog runs.
+// Packages without a manager are counted under noManager, as entry_key is
+// a range key and cannot be empty.
+
+// noManager stands in entry_key for an empty manager.
+const noManager = "-"
+
+// catalogWorkers is how many count updates run at once.
+const catalogWorkers = 16
+
+// catalogKey is one counted item of the catalog: an entry, or one of its
+// versions.
+type catalogKey struct {
+	name, manager, version string
+	entry                  bool
+}
+
+func (k catalogKey) entryKey() string {
+	manager := k.manager
+	if manager == "" {
+		manager = noManager
+	}
+	if k.entry {
+		return manager
+	}
+	return manager + "#" + k.version
+}
+
+// catalogKeys returns the items that count a host with packages installed.
+func catalogKeys(packages []models.Package) map[catalogKey]bool {
+	keys := map[catalogKey]bool{}
+	for _, pkg := range packages {
+		keys[catalogKey{name: pkg.Name, manager: pkg.Manager, entry: true}] = true
+		keys[catalogKey{name: pkg.Name, manager: pkg.Manager, version: pkg.Version}] = true
+	}
+	return keys
+}
+
+// catalogDelta is the change in counts of a host whose inventory goes from
+// old to new.
+func catalogDelta(old, new []models.Package) map[catalogKey]int {
+	delta := map[catalogKey]int{}
+	before, after := catalogKeys(old), catalogKeys(new)
+	for k := range after {
+		if !before[k] {
+			delta[k] = 1
+		}
+	}
+	for k := range before {
+		if !after[k] {
+			delta[k] = -1
+		}
+	}
+	return delta
+}
+
+// adjustCatalog adds delta to the counts, removing items that drop to zero.
+func (s *Store) adjustCatalog(ctx context.Context, delta map[catalogKey]int) error {
+	keys := make(chan catalogKey)
+	errs := make(chan error, catalogWorkers)
+	var wg sync.WaitGroup
+	for i := 0; i < catalogWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range keys {
+				if err := s.addCount(ctx, k, delta[k]); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	var err error
+send:
+	for k := range delta {
+		select {
+		case keys <- k:
+		case err = <-errs:
+			break send
+		}
+	}
+	close(keys)
+	wg.Wait()
+	close(errs)
+	if err == nil {
+		err = <-errs
+	}
+	return err
+}
+
+func (s *Store) addCount(ctx context.Context, k catalogKey, n int) error {
+	key := map[string]types.AttributeValue{
+		"tenant_name": &types.AttributeValueMemberS{Value: s.scoped(k.name)},
+		"entry_key":   &types.AttributeValueMemberS{Value: k.entryKey()},
+	}
+	expr := "ADD host_count :n SET tenant_id = :tenant, #name = :name, manager = :manager"
+	values := map[string]types.AttributeValue{
+		":n":       &types.AttributeValueMemberN{Value: strconv.Itoa(n)},
+		":tenant":  &types.AttributeValueMemberS{Value: s.tenant},
+		":name":    &types.AttributeValueMemberS{Value: k.name},
+		":manager": &types.AttributeValueMemberS{Value: k.manager},
+	}
+	names := map[string]string{"#name": "name"}
+	if !k.entry {
+		expr += ", #version = :version"
+		values[":version"] = &types.AttributeValueMemberS{Value: k.version}
+		names["#version"] = "version"
+	}
+	out, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 str(s.tables.Software),
+		Key:                       key,
+		UpdateExpression:          str(expr),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return fmt.Errorf("count %s %s: %w", k.name, k.entryKey(), err)
+	}
+	if count, _ := strconv.Atoi(attrNumber(out.Attributes["host_count"])); count > 0 {
+		return nil
+	}
+	// Unless a host has installed it again meanwhile
+	_, err = s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                 str(s.tables.Software),
+		Key:                       key,
+		ConditionExpression:       str("host_count <= :zero"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":zero": &types.AttributeValueMemberN{Value: "0"}},
+	})
+	if err != nil && !conditionFailed(err) {
+		return fmt.Errorf("remove %s %s: %w", k.name, k.entryKey(), err)
+	}
+	return nil
+}
+
+// SoftwareCatalog reads the counts of one name, or of the whole catalog
+// from CatalogIndex.
+func (s *Store) SoftwareCatalog(ctx context.Context, q store.SoftwareQuery) ([]models.SoftwareEntry, error) {
+	in := &dynamodb.QueryInput{
+		TableName:                 str(s.tables.Software),
+		IndexName:                 str(catalogIndex),
+		KeyConditionExpression:    str("tenant_id = :tenant"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":tenant": &types.AttributeValueMemberS{Value: s.tenant}},
+	}
+	if q.Name != "" {
+		in = &dynamodb.QueryInput{
+			TableName:                 str(s.tables.Software),
+			KeyConditionExpression:    str("tenant_name = :name"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":name": &types.AttributeValueMemberS{Value: s.scoped(q.Name)}},
+		}
+	}
+	items, err := s.queryAll(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("query software catalog: %w", err)
+	}
+
+	byEntry := map[[2]string]*models.SoftwareEntry{}
+	entry := func(name, manager string) *models.SoftwareEntry {
+		ek := [2]string{name, manager}
+		if byEntry[ek] == nil {
+			byEntry[ek] = &models.SoftwareEntry{Name: name, Manager: manager}
+		}
+		return byEntry[ek]
+	}
+	for _, it := range items {
+		name, manager := attrString(it["name"]), attrString(it["manager"])
+		count, _ := strconv.Atoi(attrNumber(it["host_count"]))
+		if count <= 0 || !q.Matches(name, manager) {
+			continue
+		}
+		if _, isVersion := it["version"]; isVersion {
+			e := entry(name, manager)
+			e.Versions = append(e.Versions, models.SoftwareVersion{Version: attrString(it["version"]), HostCount: count})
+		} else {
+			entry(name, manager).HostCount = count
+		}
+	}
+	entries := make([]models.SoftwareEntry, 0, len(byEntry))
+	for _, e := range byEntry {
+		if e.HostCount > 0 {
+			entries = append(entries, *e)
+		}
+	}
+	store.SortCatalog(entries)
+	return entries, nil
+}
+
+// RebuildSoftwareCatalog recomputes the tenant's catalog counts from the
+// current inventories and replaces the stored ones, for data copied by
+// Migrate or counts left off by a failed adjustment. Ingests that adjust
+// counts while it runs may be overwritten, so run it again if the fleet
+// reported meanwhile.
+func (s *Store) RebuildSoftwareCatalog(ctx context.Context) error {
+	packages, _, err := s.ListPackages(ctx, store.PackageQuery{})
+	if err != nil {
+		return err
+	}
+
+	var writes []types.WriteRequest
+	keep := map[[2]string]bool{}
+	put := func(k catalogKey, count int) {
+		item := map[string]types.AttributeValue{
+			"tenant_name": &types.AttributeValueMemberS{Value: s.scoped(k.name)},
+			"entry_key":   &types.AttributeValueMemberS{Value: k.entryKey()},
+			"tenant_id":   &types.AttributeValueMemberS{Value: s.tenant},
+			"name":        &types.AttributeValueMemberS{Value: k.name},
+			"manager":     &types.AttributeValueMemberS{Value: k.manager},
+			"host_count":  &types.AttributeValueMemberN{Value: strconv.Itoa(count)},
+		}
+		if !k.entry {
+			item["version"] = &types.AttributeValueMemberS{Value: k.version}
+		}
+		keep[[2]string{k.name, k.entryKey()}] = true
+		writes = append(writes, putRequest(item))
+	}
+	for _, e := range store.Catalog(packages) {
+		put(catalogKey{name: e.Name, manager: e.Manager, entry: true}, e.HostCount)
+		for _, v := range e.Versions {
+			put(catalogKey{name: e.Name, manager: e.Manager, version: v.Version}, v.HostCount)
+		}
+	}
+
+	stored, err := s.queryAll(ctx, &dynamodb.QueryInput{
+		TableName:                 str(s.tables.Software),
+		IndexName:                 str(catalogIndex),
+		KeyConditionExpression:    str("tenant_id = :tenant"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":tenant": &types.AttributeValueMemberS{Value: s.tenant}},
+	})
+	if err != nil {
+		return fmt.Errorf("query software catalog: %w", err)
+	}
+	for _, it := range stored {
+		if !keep[[2]string{attrString(it["name"]), attrString(it["entry_key"])}] {
+			writes = append(writes, deleteRequest(map[string]types.AttributeValue{
+				"tenant_name": it["tenant_name"],
+				"entry_key":   it["entry_key"],
+			}))
+		}
+	}
+	if err := batchWrite(ctx, s.client, s.tables.Software, writes); err != nil {
+		return fmt.Errorf("write software catalog: %w", err)
+	}
+	return nil
+}
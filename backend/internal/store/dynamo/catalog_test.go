@@ -0,0 +1,45 @@
+package dynamo
+
+import (
+	"testing"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+)
+
+func TestCatalogDelta(t *testing.T) {
+	old := []models.Package{
+		{Name: "openssl", Version: "3.0.2", Arch: "amd64", Manager: "dpkg"},
+		{Name: "openssl", Version: "3.0.2", Arch: "i386", Manager: "dpkg"},
+		{Name: "curl", Version: "7.81", Arch: "amd64", Manager: "dpkg"},
+	}
+	new := []models.Package{
+		{Name: "openssl", Version: "3.0.13", Arch: "amd64", Manager: "dpkg"},
+		{Name: "openssl", Version: "3.0.2", Arch: "i386", Manager: "dpkg"},
+		{Name: "requests", Version: "2.31", Manager: "pip"},
+		{Name: "libfoo", Version: "1.2"},
+	}
+	got := map[string]int{}
+	for k, n := range catalogDelta(old, new) {
+		got[k.name+" "+k.entryKey()] = n
+	}
+	want := map[string]int{
+		"openssl dpkg#3.0.13": 1,
+		"curl dpkg":           -1,
+		"curl dpkg#7.81":      -1,
+		"requests pip":        1,
+		"requests pip#2.31":   1,
+		"libfoo -":            1,
+		"libfoo -#1.2":        1,
+	}
+	if len(got) != len(want) {
+		t.Errorf("delta = %v, want %v", got, want)
+	}
+	for k, n := range want {
+		if got[k] != n {
+			t.Errorf("delta[%s] = %d, want %d", k, got[k], n)
+		}
+	}
+	if d := catalogDelta(old, old); len(d) != 0 {
+		t.Errorf("unchanged inventory: delta = %v", d)
+	}
+}
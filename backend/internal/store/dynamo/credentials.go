@@ -0,0 +1,207 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+)
+
+func (s *Store) CreateEnrollmentToken(ctx context.Context, t store.EnrollmentToken) error {
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: str(s.tables.EnrollmentTokens),
+		Item: map[string]types.AttributeValue{
+			"token_hash": &types.AttributeValueMemberS{Value: t.Hash},
+			"tenant_id":  &types.AttributeValueMemberS{Value: s.tenant},
+			"created_at": &types.AttributeValueMemberS{Value: t.CreatedAt.UTC().Format(time.RFC3339)},
+			"expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(t.ExpiresAt.Unix(), 10)},
+			"note":       &types.AttributeValueMemberS{Value: t.Note},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("put token: %w", err)
+	}
+	return nil
+}
+
+// Enroll consumes the token and issues the credential in one transaction, so
+// a token is never spent without a credential being issued. Only tokens of
+// the store's tenant are accepted.
+func (s *Store) Enroll(ctx context.Context, e store.Enrollment) error {
+	issuedAt := e.At.UTC().Format(time.RFC3339)
+
+	hostExpr := "SET credential_hash = :hash, credential_issued_at = :now REMOVE previous_credential_hash, credential_revoked_at"
+	hostValues := map[string]types.AttributeValue{
+		":hash": &types.AttributeValueMemberS{Value: e.CredentialHash},
+		":now":  &types.AttributeValueMemberS{Value: issuedAt},
+	}
+	if e.Hostname != "" {
+		hostExpr = "SET hostname = if_not_exists(hostname, :hostname), " + strings.TrimPrefix(hostExpr, "SET ")
+		hostValues[":hostname"] = &types.AttributeValueMemberS{Value: e.Hostname}
+	}
+	if e.PublicKey != "" {
+		hostExpr = "SET signing_public_key = :pk, " + strings.TrimPrefix(hostExpr, "SET ") + ", last_sequence"
+		hostValues[":pk"] = &types.AttributeValueMemberS{Value: e.PublicKey}
+	}
+	hostExpr = "SET " + s.setHostIDs(hostValues, e.HostID) + ", " + strings.TrimPrefix(hostExpr, "SET ")
+
+	_, err := s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Update: &types.Update{
+				TableName:           str(s.tables.EnrollmentTokens),
+				Key:                 map[string]types.AttributeValue{"token_hash": &types.AttributeValueMemberS{Value: e.TokenHash}},
+				UpdateExpression:    str("SET used_by = :host, used_at = :now"),
+				ConditionExpression: str("attribute_exists(token_hash) AND tenant_id = :tenant AND attribute_not_exists(used_by) AND expires_at > :epoch"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":tenant": &types.AttributeValueMemberS{Value: s.tenant},
+					":host":   &types.AttributeValueMemberS{Value: e.HostID},
+					":now":    &types.AttributeValueMemberS{Value: issuedAt},
+					":epoch":  &types.AttributeValueMemberN{Value: strconv.FormatInt(e.At.Unix(), 10)},
+				},
+			}},
+			{Update: &types.Update{
+				TableName:                 str(s.tables.Hosts),
+				Key:                       s.hostKey(e.HostID),
+				UpdateExpression:          str(hostExpr),
+				ConditionExpression:       str("attribute_not_exists(credential_hash)"),
+				ExpressionAttributeValues: hostValues,
+			}},
+		},
+	})
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) && len(canceled.CancellationReasons) == 2 {
+			if code := canceled.CancellationReasons[0].Code; code != nil && *code == "ConditionalCheckFailed" {
+				return store.ErrTokenInvalid
+			}
+			if code := canceled.CancellationReasons[1].Code; code != nil && *code == "ConditionalCheckFailed" {
+				return store.ErrAlreadyEnrolled
+			}
+		}
+		return fmt.Errorf("enroll: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) Credential(ctx context.Context, hostID string) (store.Credential, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            str(s.tables.Hosts),
+		Key:                  s.hostKey(hostID),
+		ProjectionExpression: str("credential_hash, previous_credential_hash"),
+	})
+	if err != nil {
+		return store.Credential{}, fmt.Errorf("load credential: %w", err)
+	}
+	return store.Credential{
+		Hash:         attrString(out.Item["credential_hash"]),
+		PreviousHash: attrString(out.Item["previous_credential_hash"]),
+	}, nil
+}
+
+func (s *Store) PromoteCredential(ctx context.Context, hostID, hash string) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 str(s.tables.Hosts),
+		Key:                       s.hostKey(hostID),
+		UpdateExpression:          str("REMOVE previous_credential_hash"),
+		ConditionExpression:       str("credential_hash = :hash"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":hash": &types.AttributeValueMemberS{Value: hash}},
+	})
+	if err != nil && !conditionFailed(err) {
+		return fmt.Errorf("promote credential: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) RotateCredential(ctx context.Context, hostID, hash string, at time.Time, keepPrevious bool) error {
+	updateExpr := "SET credential_hash = :hash, credential_issued_at = :now REMOVE previous_credential_hash"
+	if keepPrevious {
+		updateExpr = "SET previous_credential_hash = credential_hash, credential_hash = :hash, credential_issued_at = :now"
+	}
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           str(s.tables.Hosts),
+		Key:                 s.hostKey(hostID),
+		UpdateExpression:    str(updateExpr),
+		ConditionExpression: str("attribute_exists(credential_hash)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":hash": &types.AttributeValueMemberS{Value: hash},
+			":now":  &types.AttributeValueMemberS{Value: at.UTC().Format(time.RFC3339)},
+		},
+	})
+	if conditionFailed(err) {
+		return store.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("rotate credential: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) RevokeCredential(ctx context.Context, hostID string, at time.Time) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           str(s.tables.Hosts),
+		Key:                 s.hostKey(hostID),
+		UpdateExpression:    str("SET credential_revoked_at = :now REMOVE credential_hash, previous_credential_hash"),
+		ConditionExpression: str("attribute_exists(tenant_host)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: at.UTC().Format(time.RFC3339)},
+		},
+	})
+	if conditionFailed(err) {
+		return store.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("revoke credential: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) SigningKey(ctx context.Context, hostID string) (string, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            str(s.tables.Hosts),
+		Key:                  s.hostKey(hostID),
+		ProjectionExpression: str("signing_public_key"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("load signing key: %w", err)
+	}
+	return attrString(out.Item["signing_public_key"]), nil
+}
+
+// AcceptSignature advances the sequence with a conditional write, so each
+// signed payload is accepted at most once even under concurrent requests.
+func (s *Store) AcceptSignature(ctx context.Context, hostID string, sig store.Signature) error {
+	condExpr := "attribute_not_exists(last_sequence) OR last_sequence < :seq"
+	values := map[string]types.AttributeValue{
+		":seq": &types.AttributeValueMemberN{Value: strconv.FormatUint(sig.Sequence, 10)},
+		":sig": &types.AttributeValueMemberS{Value: sig.Signature},
+		":msg": &types.AttributeValueMemberS{Value: sig.Message},
+	}
+	updateExpr := "SET " + s.setHostIDs(values, hostID) + ", last_sequence = :seq, last_signature = :sig, last_signed_message = :msg"
+	if sig.PublicKey != "" {
+		updateExpr += ", signing_public_key = :pk"
+		condExpr = "(" + condExpr + ") AND attribute_not_exists(signing_public_key)"
+		values[":pk"] = &types.AttributeValueMemberS{Value: sig.PublicKey}
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 str(s.tables.Hosts),
+		Key:                       s.hostKey(hostID),
+		UpdateExpression:          str(updateExpr),
+		ConditionExpression:       str(condExpr),
+		ExpressionAttributeValues: values,
+	})
+	if conditionFailed(err) {
+		return store.ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("record sequence: %w", err)
+	}
+	return nil
+}
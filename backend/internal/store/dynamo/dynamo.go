@@ -0,0 +1,159 @@
+// Package dynamo implements store.Store on DynamoDB, with the tables defined
+// in infra/terraform/dynamodb.tf.
+//
+// Every item belongs to a tenant. Hosts, packages and CIS results are keyed
+// by tenant_host, the tenant and host IDs joined with '#', so each host is
+// its own partition; a tenant's hosts are listed through TenantIndex.
+// Policies and groups are keyed by tenant_id first; upload IDs are stored
+// behind the same prefix as hosts; enrollment tokens record the tenant they
+// enroll into.
+package dynamo
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+)
+
+// Tables names the DynamoDB tables.
+type Tables struct {
+	Hosts            string
+	Packages         string
+	CISResults       string
+	EnrollmentTokens string
+	Uploads          string
+	Policies         string
+	Groups           string
+	Software         string
+}
+
+// DefaultTables are the table names created by infra/terraform. The tables
+// keyed by tenant have new names, so they are created next to the ones of
+// earlier versions, which cmd/visiblaze-migrate copies into them.
+var DefaultTables = Tables{
+	Hosts:            "vis_tenant_hosts",
+	Packages:         "vis_tenant_packages",
+	CISResults:       "vis_tenant_cis_results",
+	EnrollmentTokens: "vis_enrollment_tokens",
+	Uploads:          "vis_uploads",
+	Policies:         "vis_tenant_policies",
+	Groups:           "vis_groups",
+	Software:         "vis_tenant_software",
+}
+
+// TablesFromEnv returns DefaultTables with any names overridden by the
+// HOSTS_TABLE, PACKAGES_TABLE, CIS_RESULTS_TABLE, ENROLLMENT_TOKENS_TABLE,
+// UPLOADS_TABLE, POLICIES_TABLE, GROUPS_TABLE and SOFTWARE_TABLE variables
+// the Lambda is deployed with.
+func TablesFromEnv() Tables {
+	t := DefaultTables
+	for env, name := range map[string]*string{
+		"HOSTS_TABLE":             &t.Hosts,
+		"PACKAGES_TABLE":          &t.Packages,
+		"CIS_RESULTS_TABLE":       &t.CISResults,
+		"ENROLLMENT_TOKENS_TABLE": &t.EnrollmentTokens,
+		"UPLOADS_TABLE":           &t.Uploads,
+		"POLICIES_TABLE":          &t.Policies,
+		"GROUPS_TABLE":            &t.Groups,
+		"SOFTWARE_TABLE":          &t.Software,
+	} {
+		if v := os.Getenv(env); v != "" {
+			*name = v
+		}
+	}
+	return t
+}
+
+// Global secondary indexes for fleet-wide lookups. Their hash keys carry the
+// tenant prefix like tenant_host. The host indexes project keys only, so
+// heartbeats, which rewrite host items, never write to them.
+const (
+	tenantIndex      = "TenantIndex"      // vis_tenant_hosts by tenant_id, host_id
+	osIndex          = "OSIndex"          // vis_tenant_hosts by tenant_os, host_id
+	nameIndex        = "NameIndex"        // vis_tenant_packages by tenant_name, host_id
+	checkStatusIndex = "CheckStatusIndex" // vis_tenant_cis_results by tenant_check, status
+	catalogIndex     = "CatalogIndex"     // vis_tenant_software by tenant_id, entry_key
+)
+
+// Store is a store.Store backed by DynamoDB, reading and writing one
+// tenant's items.
+type Store struct {
+	client *dynamodb.Client
+	tables Tables
+	tenant string
+}
+
+var (
+	_ store.Store   = (*Store)(nil)
+	_ store.Tenants = (*Store)(nil)
+)
+
+// New returns the Store of store.DefaultTenant using client and tables.
+func New(client *dynamodb.Client, tables Tables) *Store {
+	return &Store{client: client, tables: tables, tenant: store.DefaultTenant}
+}
+
+// Tenant returns the Store of the tenant id.
+func (s *Store) Tenant(id string) store.Store {
+	return &Store{client: s.client, tables: s.tables, tenant: id}
+}
+
+// scoped prefixes id with the tenant.
+func (s *Store) scoped(id string) string {
+	return s.tenant + "#" + id
+}
+
+func (s *Store) hostKey(hostID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"tenant_host": &types.AttributeValueMemberS{Value: s.scoped(hostID)},
+	}
+}
+
+// setHostIDs is the SET clause for the tenant_id and host_id of a host item,
+// adding their values to values. Every update that may create the item
+// includes it, as TenantIndex and hostFromItem read them.
+func (s *Store) setHostIDs(values map[string]types.AttributeValue, hostID string) string {
+	values[":tenant_id"] = &types.AttributeValueMemberS{Value: s.tenant}
+	values[":host_id"] = &types.AttributeValueMemberS{Value: hostID}
+	return "tenant_id = :tenant_id, host_id = :host_id"
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func int32Ptr(i int) *int32 {
+	v := int32(i)
+	return &v
+}
+
+func attrString(attr types.AttributeValue) string {
+	if s, ok := attr.(*types.AttributeValueMemberS); ok {
+		return s.Value
+	}
+	return ""
+}
+
+func attrNumber(attr types.AttributeValue) string {
+	if n, ok := attr.(*types.AttributeValueMemberN); ok {
+		return n.Value
+	}
+	return ""
+}
+
+func attrStringSlice(attr types.AttributeValue) []string {
+	if ss, ok := attr.(*types.AttributeValueMemberSS); ok {
+		return ss.Value
+	}
+	if s, ok := attr.(*types.AttributeValueMemberS); ok && s.Value != "" {
+		return []string{s.Value}
+	}
+	return []string{}
+}
@@ -0,0 +1,73 @@
+package dynamo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+)
+
+// PutGroup stores the group with its rules as a JSON document. Groups come
+// back from ListGroups in group_id order, the table's sort key.
+func (s *Store) PutGroup(ctx context.Context, g store.Group, at time.Time) (store.Group, error) {
+	g.UpdatedAt = at.UTC().Format(time.RFC3339)
+	doc, _ := json.Marshal(g)
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: str(s.tables.Groups),
+		Item: map[string]types.AttributeValue{
+			"tenant_id":  &types.AttributeValueMemberS{Value: s.tenant},
+			"group_id":   &types.AttributeValueMemberS{Value: g.ID},
+			"document":   &types.AttributeValueMemberS{Value: string(doc)},
+			"updated_at": &types.AttributeValueMemberS{Value: g.UpdatedAt},
+		},
+	})
+	if err != nil {
+		return store.Group{}, fmt.Errorf("put group: %w", err)
+	}
+	return g, nil
+}
+
+func (s *Store) ListGroups(ctx context.Context) ([]store.Group, error) {
+	groups := []store.Group{}
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:                 str(s.tables.Groups),
+		KeyConditionExpression:    str("tenant_id = :tenant"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":tenant": &types.AttributeValueMemberS{Value: s.tenant}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("query groups: %w", err)
+		}
+		for _, item := range page.Items {
+			var g store.Group
+			if err := json.Unmarshal([]byte(attrString(item["document"])), &g); err != nil {
+				log.Printf("Skipping group %s: %v", attrString(item["group_id"]), err)
+				continue
+			}
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+func (s *Store) DeleteGroup(ctx context.Context, groupID string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           str(s.tables.Groups),
+		Key:                 map[string]types.AttributeValue{"tenant_id": &types.AttributeValueMemberS{Value: s.tenant}, "group_id": &types.AttributeValueMemberS{Value: groupID}},
+		ConditionExpression: str("attribute_exists(group_id)"),
+	})
+	if conditionFailed(err) {
+		return store.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("delete group: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package dynamo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+)
+
+func (s *Store) UpsertHost(ctx context.Context, u store.HostUpdate) error {
+	now := u.SeenAt.UTC().Format(time.RFC3339)
+	exprValues := map[string]types.AttributeValue{
+		":hostname":   &types.AttributeValueMemberS{Value: u.Host.Hostname},
+		":os_id":      &types.AttributeValueMemberS{Value: u.Host.OSID},
+		":tenant_os":  &types.AttributeValueMemberS{Value: s.scoped(u.Host.OSID)},
+		":os_version": &types.AttributeValueMemberS{Value: u.Host.OSVersion},
+		":kernel":     &types.AttributeValueMemberS{Value: u.Host.Kernel},
+		":agent_ver":  &types.AttributeValueMemberS{Value: u.Host.AgentVersion},
+		":last_seen":  &types.AttributeValueMemberS{Value: now},
+		":first_seen": &types.AttributeValueMemberS{Value: now},
+	}
+
+	updateExpr := "SET " + s.setHostIDs(exprValues, u.Host.HostID) + ", hostname = :hostname, os_id = :os_id, tenant_os = :tenant_os, os_version = :os_version, kernel = :kernel, agent_version = :agent_ver, last_seen = :last_seen, first_seen = if_not_exists(first_seen, :first_seen)"
+
+	var removes []string
+	if len(u.Host.IPAddresses) > 0 {
+		exprValues[":ip_addresses"] = &types.AttributeValueMemberSS{Value: u.Host.IPAddresses}
+		updateExpr += ", ip_addresses = :ip_addresses"
+	} else {
+		removes = append(removes, "ip_addresses")
+	}
+
+	// String sets cannot be empty, so no tags is no attribute
+	switch {
+	case len(u.Host.Tags) > 0:
+		exprValues[":agent_tags"] = &types.AttributeValueMemberSS{Value: u.Host.Tags}
+		updateExpr += ", agent_tags = :agent_tags"
+	case u.Host.Tags != nil:
+		removes = append(removes, "agent_tags")
+	}
+
+	if u.Containers != nil {
+		containersJSON, _ := json.Marshal(u.Containers)
+		exprValues[":containers"] = &types.AttributeValueMemberS{Value: string(containersJSON)}
+		updateExpr += ", containers = :containers"
+	}
+
+	if len(u.Remediations) > 0 {
+		remJSON, _ := json.Marshal(u.Remediations)
+		exprValues[":remediations"] = &types.AttributeValueMemberS{Value: string(remJSON)}
+		updateExpr += ", last_remediations = :remediations"
+	}
+
+	if len(removes) > 0 {
+		updateExpr += " REMOVE " + strings.Join(removes, ", ")
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 str(s.tables.Hosts),
+		Key:                       s.hostKey(u.Host.HostID),
+		UpdateExpression:          str(updateExpr),
+		ExpressionAttributeValues: exprValues,
+	})
+	if err != nil {
+		return fmt.Errorf("update host: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) RecordHeartbeat(ctx context.Context, hb models.Heartbeat, at time.Time) (*store.Host, error) {
+	now := at.UTC().Format(time.RFC3339)
+	exprValues := map[string]types.AttributeValue{
+		":now":         &types.AttributeValueMemberS{Value: now},
+		":hostname":    &types.AttributeValueMemberS{Value: hb.Hostname},
+		":agent_ver":   &types.AttributeValueMemberS{Value: hb.AgentVersion},
+		":uptime":      &types.AttributeValueMemberN{Value: strconv.FormatInt(hb.UptimeSeconds, 10)},
+		":queue_depth": &types.AttributeValueMemberN{Value: strconv.Itoa(hb.QueueDepth)},
+	}
+	updateExpr := "SET " + s.setHostIDs(exprValues, hb.HostID) + ", last_heartbeat = :now, hostname = :hostname, agent_version = :agent_ver, uptime_seconds = :uptime, queue_depth = :queue_depth, first_seen = if_not_exists(first_seen, :now)"
+	if hb.LastCollection != nil {
+		lcJSON, _ := json.Marshal(hb.LastCollection)
+		exprValues[":last_collection"] = &types.AttributeValueMemberS{Value: string(lcJSON)}
+		updateExpr += ", last_collection = :last_collection"
+	}
+
+	out, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 str(s.tables.Hosts),
+		Key:                       s.hostKey(hb.HostID),
+		UpdateExpression:          str(updateExpr),
+		ExpressionAttributeValues: exprValues,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("update host: %w", err)
+	}
+	return hostFromItem(out.Attributes), nil
+}
+
+func (s *Store) GetHost(ctx context.Context, hostID string) (*store.Host, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: str(s.tables.Hosts),
+		Key:       s.hostKey(hostID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get host: %w", err)
+	}
+	if out.Item == nil {
+		return nil, store.ErrNotFound
+	}
+	return hostFromItem(out.Item), nil
+}
+
+// ListHosts reads the host keys from TenantIndex, or from OSIndex for an OS,
+// and then the items of each page of keys.
+func (s *Store) ListHosts(ctx context.Context, q store.HostQuery) ([]models.Host, string, error) {
+	in := &dynamodb.QueryInput{
+		TableName:                 str(s.tables.Hosts),
+		IndexName:                 str(tenantIndex),
+		KeyConditionExpression:    str("tenant_id = :tenant"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":tenant": &types.AttributeValueMemberS{Value: s.tenant}},
+	}
+	keyAttrs := []string{"tenant_host", "tenant_id", "host_id"}
+	if q.OSID != "" {
+		in = &dynamodb.QueryInput{
+			TableName:                 str(s.tables.Hosts),
+			IndexName:                 str(osIndex),
+			KeyConditionExpression:    str("tenant_os = :os"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":os": &types.AttributeValueMemberS{Value: s.scoped(q.OSID)}},
+		}
+		keyAttrs = []string{"tenant_host", "tenant_os", "host_id"}
+	}
+	matches := func(it attrMap) (bool, error) { return q.Matches(hostFromItem(it)), nil }
+	items, next, err := list(ctx, q.Sort, q.Limit, q.NextToken, keyAttrs, s.withHosts(s.queryPages(in), ""), matches)
+	if err != nil {
+		return nil, "", fmt.Errorf("list hosts: %w", err)
+	}
+
+	hosts := []models.Host{}
+	for _, item := range items {
+		hosts = append(hosts, hostFromItem(item).Host)
+	}
+	return hosts, next, nil
+}
+
+// withHosts replaces the host keys read by fetch from a keys-only index with
+// the host items, reading projection of them (everything when empty). Hosts
+// deleted since the index was read are left out.
+func (s *Store) withHosts(fetch fetchFunc, projection string) fetchFunc {
+	return func(ctx context.Context, start attrMap, limit *int32) ([]attrMap, attrMap, error) {
+		keys, last, err := fetch(ctx, start, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		hosts, err := s.getHosts(ctx, keys, projection)
+		return hosts, last, err
+	}
+}
+
+// getHosts reads the host items of keys, which only need their tenant_host,
+// in the order of keys. The other attributes of each key are copied into its
+// item, so that tokens built from an item resume the index the key came
+// from even if the host has changed since.
+func (s *Store) getHosts(ctx context.Context, keys []attrMap, projection string) ([]attrMap, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if projection != "" {
+		projection = "tenant_host, tenant_id, host_id, " + projection
+	}
+	tableKeys := make([]map[string]types.AttributeValue, len(keys))
+	for i, k := range keys {
+		tableKeys[i] = map[string]types.AttributeValue{"tenant_host": k["tenant_host"]}
+	}
+	items, err := batchGet(ctx, s.client, s.tables.Hosts, tableKeys, projection)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]attrMap, len(items))
+	for _, it := range items {
+		byKey[attrString(it["tenant_host"])] = it
+	}
+	hosts := make([]attrMap, 0, len(items))
+	for _, k := range keys {
+		if it, ok := byKey[attrString(k["tenant_host"])]; ok {
+			for name, v := range k {
+				it[name] = v
+			}
+			hosts = append(hosts, it)
+		}
+	}
+	return hosts, nil
+}
+
+// DeleteHost removes the host's packages and CIS results before the host
+// itself, so a failed call can be retried. Its packages leave the catalog
+// counts once they are deleted, so a retry does not count them out twice;
+// if counting them out fails, the host is still deleted and the error is
+// returned, as the counts then need RebuildSoftwareCatalog.
+func (s *Store) DeleteHost(ctx context.Context, hostID string) error {
+	installed, err := s.HostPackages(ctx, hostID)
+	if err != nil {
+		return err
+	}
+	if err := s.deleteGenerations(ctx, hostID, func(string) bool { return true }); err != nil {
+		return fmt.Errorf("delete packages: %w", err)
+	}
+	counted := s.adjustCatalog(ctx, catalogDelta(installed, nil))
+	results, err := s.queryAll(ctx, &dynamodb.QueryInput{
+		TableName:              str(s.tables.CISResults),
+		KeyConditionExpression: str("tenant_host = :host"),
+		ProjectionExpression:   str("tenant_host, check_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":host": &types.AttributeValueMemberS{Value: s.scoped(hostID)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("query CIS results: %w", err)
+	}
+	deletes := make([]types.WriteRequest, 0, len(results))
+	for _, item := range results {
+		deletes = append(deletes, deleteRequest(item))
+	}
+	if err := batchWrite(ctx, s.client, s.tables.CISResults, deletes); err != nil {
+		return fmt.Errorf("delete CIS results: %w", err)
+	}
+
+	_, err = s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           str(s.tables.Hosts),
+		Key:                 s.hostKey(hostID),
+		ConditionExpression: str("attribute_exists(tenant_host)"),
+	})
+	if conditionFailed(err) {
+		return store.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("delete host: %w", err)
+	}
+	if counted != nil {
+		return fmt.Errorf("count out packages, rebuild the software catalog: %w", counted)
+	}
+	return nil
+}
+
+func (s *Store) RevokeCertificate(ctx context.Context, hostID, serial string) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 str(s.tables.Hosts),
+		Key:                       s.hostKey(hostID),
+		UpdateExpression:          str("ADD revoked_cert_serials :serial"),
+		ConditionExpression:       str("attribute_exists(tenant_host)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":serial": &types.AttributeValueMemberSS{Value: []string{serial}}},
+	})
+	if conditionFailed(err) {
+		return store.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("revoke certificate: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) CertificateRevoked(ctx context.Context, hostID, serial string) (bool, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            str(s.tables.Hosts),
+		Key:                  s.hostKey(hostID),
+		ProjectionExpression: str("revoked_cert_serials"),
+	})
+	if err != nil {
+		return false, fmt.Errorf("get host: %w", err)
+	}
+	for _, revoked := range attrStringSlice(out.Item["revoked_cert_serials"]) {
+		if revoked == serial {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) SetUserTags(ctx context.Context, hostID string, tags []string) (*store.Host, error) {
+	in := &dynamodb.UpdateItemInput{
+		TableName:           str(s.tables.Hosts),
+		Key:                 s.hostKey(hostID),
+		UpdateExpression:    str("REMOVE user_tags"),
+		ConditionExpression: str("attribute_exists(tenant_host)"),
+		ReturnValues:        types.ReturnValueAllNew,
+	}
+	if len(tags) > 0 {
+		in.UpdateExpression = str("SET user_tags = :tags")
+		in.ExpressionAttributeValues = map[string]types.AttributeValue{":tags": &types.AttributeValueMemberSS{Value: tags}}
+	}
+	out, err := s.client.UpdateItem(ctx, in)
+	if conditionFailed(err) {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("set user tags: %w", err)
+	}
+	return hostFromItem(out.Attributes), nil
+}
+
+// hostFromItem decodes a vis_tenant_hosts item. Liveness status is left to the
+// caller.
+func hostFromItem(item map[string]types.AttributeValue) *store.Host {
+	host := &store.Host{
+		Host: models.Host{
+			HostID:        attrString(item["host_id"]),
+			Hostname:      attrString(item["hostname"]),
+			OSID:          attrString(item["os_id"]),
+			OSVersion:     attrString(item["os_version"]),
+			Kernel:        attrString(item["kernel"]),
+			IPAddresses:   attrStringSlice(item["ip_addresses"]),
+			AgentVersion:  attrString(item["agent_version"]),
+			FirstSeen:     attrString(item["first_seen"]),
+			LastSeen:      attrString(item["last_seen"]),
+			LastHeartbeat: attrString(item["last_heartbeat"]),
+			UserTags:      attrStringSlice(item["user_tags"]),
+		},
+		AgentTags: attrStringSlice(item["agent_tags"]),
+	}
+	host.Tags = store.UnionTags(host.AgentTags, host.UserTags)
+	host.UptimeSeconds, _ = strconv.ParseInt(attrNumber(item["uptime_seconds"]), 10, 64)
+	host.QueueDepth, _ = strconv.Atoi(attrNumber(item["queue_depth"]))
+	host.PackageCount, _ = strconv.Atoi(attrNumber(item["package_count"]))
+	if lc := attrString(item["last_collection"]); lc != "" {
+		var info models.CollectionInfo
+		if json.Unmarshal([]byte(lc), &info) == nil {
+			host.LastCollection = &info
+		}
+	}
+	if remJSON := attrString(item["last_remediations"]); remJSON != "" {
+		json.Unmarshal([]byte(remJSON), &host.Remediations)
+	}
+	if containersJSON := attrString(item["containers"]); containersJSON != "" {
+		var containers models.ContainerInventory
+		if json.Unmarshal([]byte(containersJSON), &containers) == nil {
+			host.Containers = &containers
+		}
+	}
+	return host
+}
+
+func conditionFailed(err error) bool {
+	var condErr *types.ConditionalCheckFailedException
+	return errors.As(err, &condErr)
+}
@@ -0,0 +1,434 @@
+package dynamo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+)
+
+// Package inventories are stored as generations. ReplacePackages writes the
+// new rows under a fresh generation, then points the host's
+// package_generation at it, then deletes the previous generation, so readers
+// see either the old inventory or the new one and never a mix. Rows written
+// before generations existed have no generation attribute and count as
+// generation "".
+//
+// The pointer only moves if it still holds the generation read at the
+// start; an ingest that loses that race removes its own rows and leaves the
+// winner's in place. Rows of generations older than generationGrace, left by
+// an ingest that died before cleaning up, are removed by the next one.
+const generationGrace = 15 * time.Minute
+
+// newGeneration returns a generation ID that sorts by creation time.
+func newGeneration(now time.Time) string {
+	return fmt.Sprintf("%020d", now.UnixNano())
+}
+
+func generationTime(gen string) (time.Time, bool) {
+	ns, err := strconv.ParseInt(gen, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ns), true
+}
+
+// packageGeneration returns the host's current package generation.
+func (s *Store) packageGeneration(ctx context.Context, hostID string) (string, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            str(s.tables.Hosts),
+		Key:                  s.hostKey(hostID),
+		ProjectionExpression: str("package_generation"),
+		ConsistentRead:       boolPtr(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("get package generation: %w", err)
+	}
+	return attrString(out.Item["package_generation"]), nil
+}
+
+// ReplacePackages also adds the difference between the replaced inventory
+// and packages to the catalog counts, once the switch has made packages
+// current. Only the ingest that switched adjusts them, so concurrent ingests
+// do not count a host twice. A failed adjustment fails the call, though the
+// new inventory stays current.
+func (s *Store) ReplacePackages(ctx context.Context, hostID string, packages []models.Package) error {
+	prev, err := s.packageGeneration(ctx, hostID)
+	if err != nil {
+		return err
+	}
+	old, err := s.queryAll(ctx, s.generationQuery(hostID, prev))
+	if err != nil {
+		return fmt.Errorf("query packages: %w", err)
+	}
+	old = slices.DeleteFunc(old, func(it attrMap) bool { return attrString(it["generation"]) != prev })
+	now := time.Now()
+	gen := newGeneration(now)
+
+	// Later duplicates win, as they did when each row was a separate put
+	rows := map[string]models.Package{}
+	for _, pkg := range packages {
+		rows[packageKey(pkg)] = pkg
+	}
+	var puts []types.WriteRequest
+	for key, pkg := range rows {
+		puts = append(puts, putRequest(map[string]types.AttributeValue{
+			"tenant_host": &types.AttributeValueMemberS{Value: s.scoped(hostID)},
+			"pkg_key":     &types.AttributeValueMemberS{Value: gen + "#" + key},
+			"tenant_id":   &types.AttributeValueMemberS{Value: s.tenant},
+			"host_id":     &types.AttributeValueMemberS{Value: hostID},
+			"tenant_name": &types.AttributeValueMemberS{Value: s.scoped(pkg.Name)},
+			"generation":  &types.AttributeValueMemberS{Value: gen},
+			"name":        &types.AttributeValueMemberS{Value: pkg.Name},
+			"version":     &types.AttributeValueMemberS{Value: pkg.Version},
+			"arch":        &types.AttributeValueMemberS{Value: pkg.Arch},
+			"manager":     &types.AttributeValueMemberS{Value: pkg.Manager},
+			"source":      &types.AttributeValueMemberS{Value: pkg.Source},
+		}))
+	}
+	if err := batchWrite(ctx, s.client, s.tables.Packages, puts); err != nil {
+		s.deleteGenerations(ctx, hostID, func(g string) bool { return g == gen })
+		return fmt.Errorf("write packages: %w", err)
+	}
+
+	cond := "attribute_not_exists(package_generation)"
+	values := map[string]types.AttributeValue{
+		":gen":   &types.AttributeValueMemberS{Value: gen},
+		":count": &types.AttributeValueMemberN{Value: strconv.Itoa(len(rows))},
+	}
+	if prev != "" {
+		cond = "package_generation = :prev"
+		values[":prev"] = &types.AttributeValueMemberS{Value: prev}
+	}
+	_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 str(s.tables.Hosts),
+		Key:                       s.hostKey(hostID),
+		UpdateExpression:          str("SET " + s.setHostIDs(values, hostID) + ", package_generation = :gen, package_count = :count"),
+		ConditionExpression:       str(cond),
+		ExpressionAttributeValues: values,
+	})
+	if conditionFailed(err) {
+		// A concurrent ingest switched generations first; its inventory stands
+		return s.deleteGenerations(ctx, hostID, func(g string) bool { return g == gen })
+	}
+	if err != nil {
+		s.deleteGenerations(ctx, hostID, func(g string) bool { return g == gen })
+		return fmt.Errorf("switch package generation: %w", err)
+	}
+
+	counted := s.adjustCatalog(ctx, catalogDelta(packagesFromItems(old), slices.Collect(maps.Values(rows))))
+
+	// The new inventory is visible; failing to collect the old one only
+	// leaves rows for the next ingest to remove
+	if err := s.deleteGenerations(ctx, hostID, func(g string) bool {
+		if g == gen {
+			return false
+		}
+		t, ok := generationTime(g)
+		return g == prev || !ok || now.Sub(t) > generationGrace
+	}); err != nil {
+		log.Printf("collect old packages for host %s: %v", hostID, err)
+	}
+	if counted != nil {
+		// The ADDs already applied cannot be told apart from the others, so
+		// a retried ingest cannot repair them; fail it for the operator
+		return fmt.Errorf("count packages, rebuild the software catalog: %w", counted)
+	}
+	return nil
+}
+
+// deleteGenerations removes the host's package rows whose generation matches.
+func (s *Store) deleteGenerations(ctx context.Context, hostID string, match func(gen string) bool) error {
+	items, err := s.queryAll(ctx, &dynamodb.QueryInput{
+		TableName:              str(s.tables.Packages),
+		KeyConditionExpression: str("tenant_host = :host"),
+		ProjectionExpression:   str("tenant_host, pkg_key, generation"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":host": &types.AttributeValueMemberS{Value: s.scoped(hostID)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("query packages: %w", err)
+	}
+	var deletes []types.WriteRequest
+	for _, item := range items {
+		if match(attrString(item["generation"])) {
+			deletes = append(deletes, deleteRequest(map[string]types.AttributeValue{
+				"tenant_host": item["tenant_host"],
+				"pkg_key":     item["pkg_key"],
+			}))
+		}
+	}
+	return batchWrite(ctx, s.client, s.tables.Packages, deletes)
+}
+
+func (s *Store) HostPackages(ctx context.Context, hostID string) ([]models.Package, error) {
+	packages, _, err := s.ListPackages(ctx, store.PackageQuery{HostID: hostID})
+	return packages, err
+}
+
+// ListPackages reads one host's partition, the name index, or the
+// partitions of the tenant's hosts one after the other, returning rows of
+// each host's current generation only. The generations come with the hosts
+// of the walk, and are read in batches for the hosts the name index turns
+// up.
+func (s *Store) ListPackages(ctx context.Context, q store.PackageQuery) ([]models.Package, string, error) {
+	generations := map[string]string{}
+	current := func(it attrMap) (bool, error) {
+		if !q.Matches(packageFromItem(it)) {
+			return false, nil
+		}
+		gen, ok := generations[attrString(it["host_id"])]
+		return ok && attrString(it["generation"]) == gen, nil
+	}
+
+	keyAttrs := []string{"tenant_host", "pkg_key"}
+	var fetch fetchFunc
+	switch {
+	case q.HostID != "":
+		gen, err := s.packageGeneration(ctx, q.HostID)
+		if err != nil {
+			return nil, "", err
+		}
+		generations[q.HostID] = gen
+		fetch = s.queryPages(s.generationQuery(q.HostID, gen))
+	case q.Name != "":
+		fetch = s.withGenerations(s.queryPages(&dynamodb.QueryInput{
+			TableName:                 str(s.tables.Packages),
+			IndexName:                 str(nameIndex),
+			KeyConditionExpression:    str("tenant_name = :name"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":name": &types.AttributeValueMemberS{Value: s.scoped(q.Name)}},
+		}), generations)
+		keyAttrs = append(keyAttrs, "tenant_name", "host_id")
+	default:
+		fetch = s.hostWalk("package_generation", outside(q.HostIDs), func(host attrMap) *dynamodb.QueryInput {
+			hostID, gen := attrString(host["host_id"]), attrString(host["package_generation"])
+			generations[hostID] = gen
+			return s.generationQuery(hostID, gen)
+		})
+	}
+
+	items, next, err := list(ctx, q.Sort, q.Limit, q.NextToken, keyAttrs, fetch, current)
+	if err != nil {
+		return nil, "", fmt.Errorf("list packages: %w", err)
+	}
+	return packagesFromItems(items), next, nil
+}
+
+// generationQuery reads the host's package rows of generation gen, or the
+// whole partition for the rows written before generations.
+func (s *Store) generationQuery(hostID, gen string) *dynamodb.QueryInput {
+	in := &dynamodb.QueryInput{
+		TableName:              str(s.tables.Packages),
+		KeyConditionExpression: str("tenant_host = :host"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":host": &types.AttributeValueMemberS{Value: s.scoped(hostID)},
+		},
+	}
+	if gen != "" {
+		in.KeyConditionExpression = str("tenant_host = :host AND begins_with(pkg_key, :gen)")
+		in.ExpressionAttributeValues[":gen"] = &types.AttributeValueMemberS{Value: gen + "#"}
+	}
+	return in
+}
+
+// withGenerations records in generations the current package generation of
+// the hosts of each page fetch reads that it does not hold yet. Hosts that no
+// longer exist are left out, so their rows match no generation.
+func (s *Store) withGenerations(fetch fetchFunc, generations map[string]string) fetchFunc {
+	return func(ctx context.Context, start attrMap, limit *int32) ([]attrMap, attrMap, error) {
+		items, last, err := fetch(ctx, start, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		var keys []attrMap
+		seen := map[string]bool{}
+		for _, it := range items {
+			hostID := attrString(it["host_id"])
+			if _, ok := generations[hostID]; !ok && !seen[hostID] {
+				seen[hostID] = true
+				keys = append(keys, s.hostKey(hostID))
+			}
+		}
+		hosts, err := s.getHosts(ctx, keys, "package_generation")
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, host := range hosts {
+			generations[attrString(host["host_id"])] = attrString(host["package_generation"])
+		}
+		return items, last, nil
+	}
+}
+
+// ReplaceCISResults upserts the latest result per check, carrying over each
+// check's status history from the result it replaces, and deletes the
+// results of checks the run no longer includes.
+func (s *Store) ReplaceCISResults(ctx context.Context, hostID string, results []models.CISResult) error {
+	stored, err := s.HostCISResults(ctx, hostID)
+	if err != nil {
+		return err
+	}
+	previous := map[string]*models.CISResult{}
+	for i := range stored {
+		previous[stored[i].CheckID] = &stored[i]
+	}
+
+	byCheck := map[string]types.WriteRequest{}
+	for _, result := range results {
+		store.CarryStatus(&result, previous[result.CheckID])
+		evJSON, _ := json.Marshal(result.Evidence)
+		item := map[string]types.AttributeValue{
+			"tenant_host":       &types.AttributeValueMemberS{Value: s.scoped(hostID)},
+			"check_id":          &types.AttributeValueMemberS{Value: result.CheckID},
+			"tenant_id":         &types.AttributeValueMemberS{Value: s.tenant},
+			"host_id":           &types.AttributeValueMemberS{Value: hostID},
+			"tenant_check":      &types.AttributeValueMemberS{Value: s.scoped(result.CheckID)},
+			"title":             &types.AttributeValueMemberS{Value: result.Title},
+			"status":            &types.AttributeValueMemberS{Value: result.Status},
+			"evidence":          &types.AttributeValueMemberS{Value: string(evJSON)},
+			"last_ts":           &types.AttributeValueMemberS{Value: result.Timestamp},
+			"status_changed_at": &types.AttributeValueMemberS{Value: result.StatusChangedAt},
+		}
+		if result.PreviousStatus != "" {
+			item["previous_status"] = &types.AttributeValueMemberS{Value: result.PreviousStatus}
+		}
+		byCheck[result.CheckID] = putRequest(item)
+	}
+	writes := make([]types.WriteRequest, 0, len(byCheck))
+	for _, req := range byCheck {
+		writes = append(writes, req)
+	}
+	for checkID := range previous {
+		if _, ok := byCheck[checkID]; !ok {
+			writes = append(writes, deleteRequest(map[string]types.AttributeValue{
+				"tenant_host": &types.AttributeValueMemberS{Value: s.scoped(hostID)},
+				"check_id":    &types.AttributeValueMemberS{Value: checkID},
+			}))
+		}
+	}
+	if err := batchWrite(ctx, s.client, s.tables.CISResults, writes); err != nil {
+		return fmt.Errorf("write CIS results: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) HostCISResults(ctx context.Context, hostID string) ([]models.CISResult, error) {
+	results, _, err := s.ListCISResults(ctx, store.CISQuery{HostID: hostID})
+	return results, err
+}
+
+// ListCISResults reads one host's partition, the check/status index, or
+// the partitions of the tenant's hosts one after the other.
+func (s *Store) ListCISResults(ctx context.Context, q store.CISQuery) ([]models.CISResult, string, error) {
+	matches := func(it attrMap) (bool, error) { return q.Matches(cisResultFromItem(it)), nil }
+
+	keyAttrs := []string{"tenant_host", "check_id"}
+	var fetch fetchFunc
+	switch {
+	case q.HostID != "":
+		fetch = s.queryPages(&dynamodb.QueryInput{
+			TableName:              str(s.tables.CISResults),
+			KeyConditionExpression: str("tenant_host = :host"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":host": &types.AttributeValueMemberS{Value: s.scoped(q.HostID)},
+			},
+		})
+	case q.CheckID != "":
+		in := &dynamodb.QueryInput{
+			TableName:                 str(s.tables.CISResults),
+			IndexName:                 str(checkStatusIndex),
+			KeyConditionExpression:    str("tenant_check = :check"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":check": &types.AttributeValueMemberS{Value: s.scoped(q.CheckID)}},
+		}
+		if q.Status != "" {
+			in.KeyConditionExpression = str("tenant_check = :check AND #status = :status")
+			in.ExpressionAttributeNames = map[string]string{"#status": "status"}
+			in.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{Value: q.Status}
+		}
+		fetch = s.queryPages(in)
+		keyAttrs = append(keyAttrs, "tenant_check", "status")
+	default:
+		fetch = s.hostWalk("", outside(q.HostIDs), func(host attrMap) *dynamodb.QueryInput {
+			return &dynamodb.QueryInput{
+				TableName:                 str(s.tables.CISResults),
+				KeyConditionExpression:    str("tenant_host = :host"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{":host": host["tenant_host"]},
+			}
+		})
+	}
+
+	items, next, err := list(ctx, q.Sort, q.Limit, q.NextToken, keyAttrs, fetch, matches)
+	if err != nil {
+		return nil, "", fmt.Errorf("list CIS results: %w", err)
+	}
+	return cisResultsFromItems(items), next, nil
+}
+
+// packageKey is the sort key for a package row. OS packages keep the
+// original name#arch key; language ecosystem packages can have several
+// versions installed side by side, so the manager and version are included.
+func packageKey(pkg models.Package) string {
+	switch pkg.Manager {
+	case "dpkg", "rpm", "apk", "":
+		return fmt.Sprintf("%s#%s", pkg.Name, pkg.Arch)
+	default:
+		return fmt.Sprintf("%s:%s#%s", pkg.Manager, pkg.Name, pkg.Version)
+	}
+}
+
+func packagesFromItems(items []attrMap) []models.Package {
+	packages := []models.Package{}
+	for _, item := range items {
+		packages = append(packages, packageFromItem(item))
+	}
+	return packages
+}
+
+func packageFromItem(item attrMap) models.Package {
+	return models.Package{
+		HostID:  attrString(item["host_id"]),
+		Name:    attrString(item["name"]),
+		Version: attrString(item["version"]),
+		Arch:    attrString(item["arch"]),
+		Manager: attrString(item["manager"]),
+		Source:  attrString(item["source"]),
+	}
+}
+
+func cisResultsFromItems(items []attrMap) []models.CISResult {
+	results := []models.CISResult{}
+	for _, item := range items {
+		results = append(results, cisResultFromItem(item))
+	}
+	return results
+}
+
+func cisResultFromItem(item attrMap) models.CISResult {
+	var evidence map[string]interface{}
+	json.Unmarshal([]byte(attrString(item["evidence"])), &evidence)
+	if evidence == nil {
+		evidence = map[string]interface{}{}
+	}
+	return models.CISResult{
+		HostID:    attrString(item["host_id"]),
+		CheckID:   attrString(item["check_id"]),
+		Title:     attrString(item["title"]),
+		Status:    attrString(item["status"]),
+		Evidence:  evidence,
+		Timestamp: attrString(item["last_ts"]),
+
+		PreviousStatus:  attrString(item["previous_status"]),
+		StatusChangedAt: attrString(item["status_changed_at"]),
+	}
+}
@@ -0,0 +1,158 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// LegacyTables names the tables of versions before tenants, keyed by host_id
+// or policy_id alone.
+type LegacyTables struct {
+	Hosts      string
+	Packages   string
+	CISResults string
+	Policies   string
+}
+
+// DefaultLegacyTables are the table names earlier versions of
+// infra/terraform created.
+var DefaultLegacyTables = LegacyTables{
+	Hosts:      "vis_hosts",
+	Packages:   "vis_packages",
+	CISResults: "vis_cis_results",
+	Policies:   "vis_policies",
+}
+
+// MigrateStats counts the items Migrate copied or updated.
+type MigrateStats struct {
+	Hosts, Packages, CISResults, Policies, EnrollmentTokens int
+}
+
+// Migrate copies the items of the legacy tables into the tenant's tables of
+// s, adding the tenant keys, and assigns the tenant to enrollment tokens
+// that have none. Host items keep their credentials, signing keys and
+// package generation, so agents carry on without enrolling again. The legacy
+// tables are only read; running Migrate again copies them again, replacing
+// the earlier copies.
+func (s *Store) Migrate(ctx context.Context, from LegacyTables) (MigrateStats, error) {
+	var stats MigrateStats
+	for _, t := range []struct {
+		from, to string
+		convert  func(attrMap) attrMap
+		count    *int
+	}{
+		{from.Hosts, s.tables.Hosts, s.legacyHost, &stats.Hosts},
+		{from.Packages, s.tables.Packages, s.legacyPackage, &stats.Packages},
+		{from.CISResults, s.tables.CISResults, s.legacyCISResult, &stats.CISResults},
+		{from.Policies, s.tables.Policies, s.legacyPolicy, &stats.Policies},
+	} {
+		n, err := s.copyTable(ctx, t.from, t.to, t.convert)
+		*t.count = n
+		if err != nil {
+			return stats, fmt.Errorf("copy %s to %s: %w", t.from, t.to, err)
+		}
+	}
+
+	n, err := s.adoptEnrollmentTokens(ctx)
+	stats.EnrollmentTokens = n
+	if err != nil {
+		return stats, fmt.Errorf("assign enrollment tokens: %w", err)
+	}
+	return stats, nil
+}
+
+// copyTable scans from and writes each item, converted, to to.
+func (s *Store) copyTable(ctx context.Context, from, to string, convert func(attrMap) attrMap) (int, error) {
+	fetch := s.scanPages(&dynamodb.ScanInput{TableName: str(from)})
+	copied := 0
+	var start attrMap
+	for {
+		items, last, err := fetch(ctx, start, nil)
+		if err != nil {
+			return copied, err
+		}
+		puts := make([]types.WriteRequest, 0, len(items))
+		for _, it := range items {
+			puts = append(puts, putRequest(convert(it)))
+		}
+		if err := batchWrite(ctx, s.client, to, puts); err != nil {
+			return copied, err
+		}
+		copied += len(puts)
+		if last == nil {
+			return copied, nil
+		}
+		start = last
+	}
+}
+
+// adoptEnrollmentTokens assigns the tenant to the enrollment tokens created
+// before tenants, which Enroll would otherwise refuse.
+func (s *Store) adoptEnrollmentTokens(ctx context.Context) (int, error) {
+	fetch := s.scanPages(&dynamodb.ScanInput{
+		TableName:            str(s.tables.EnrollmentTokens),
+		FilterExpression:     str("attribute_not_exists(tenant_id)"),
+		ProjectionExpression: str("token_hash"),
+	})
+	adopted := 0
+	var start attrMap
+	for {
+		items, last, err := fetch(ctx, start, nil)
+		if err != nil {
+			return adopted, err
+		}
+		for _, it := range items {
+			_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName:                 str(s.tables.EnrollmentTokens),
+				Key:                       attrMap{"token_hash": it["token_hash"]},
+				UpdateExpression:          str("SET tenant_id = :tenant"),
+				ConditionExpression:       str("attribute_exists(token_hash) AND attribute_not_exists(tenant_id)"),
+				ExpressionAttributeValues: attrMap{":tenant": &types.AttributeValueMemberS{Value: s.tenant}},
+			})
+			if conditionFailed(err) {
+				// Used up by TTL or adopted concurrently
+				continue
+			}
+			if err != nil {
+				return adopted, err
+			}
+			adopted++
+		}
+		if last == nil {
+			return adopted, nil
+		}
+		start = last
+	}
+}
+
+func (s *Store) legacyHost(it attrMap) attrMap {
+	hostID := attrString(it["host_id"])
+	it["tenant_host"] = &types.AttributeValueMemberS{Value: s.scoped(hostID)}
+	it["tenant_id"] = &types.AttributeValueMemberS{Value: s.tenant}
+	if osID := attrString(it["os_id"]); osID != "" {
+		it["tenant_os"] = &types.AttributeValueMemberS{Value: s.scoped(osID)}
+	}
+	return it
+}
+
+func (s *Store) legacyPackage(it attrMap) attrMap {
+	it["tenant_host"] = &types.AttributeValueMemberS{Value: s.scoped(attrString(it["host_id"]))}
+	it["tenant_id"] = &types.AttributeValueMemberS{Value: s.tenant}
+	it["tenant_name"] = &types.AttributeValueMemberS{Value: s.scoped(attrString(it["name"]))}
+	return it
+}
+
+func (s *Store) legacyCISResult(it attrMap) attrMap {
+	it["tenant_host"] = &types.AttributeValueMemberS{Value: s.scoped(attrString(it["host_id"]))}
+	it["tenant_id"] = &types.AttributeValueMemberS{Value: s.tenant}
+	it["tenant_check"] = &types.AttributeValueMemberS{Value: s.scoped(attrString(it["check_id"]))}
+	return it
+}
+
+func (s *Store) legacyPolicy(it attrMap) attrMap {
+	it["tenant_id"] = &types.AttributeValueMemberS{Value: s.tenant}
+	return it
+}
@@ -0,0 +1,34 @@
+package dynamo
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestLegacyItems(t *testing.T) {
+	s := &Store{tenant: "acme"}
+	s3 := func(v string) types.AttributeValue { return &types.AttributeValueMemberS{Value: v} }
+
+	host := s.legacyHost(attrMap{"host_id": s3("h1"), "os_id": s3("ubuntu"), "credential_hash": s3("x")})
+	for name, want := range map[string]string{"tenant_host": "acme#h1", "tenant_id": "acme", "tenant_os": "acme#ubuntu", "credential_hash": "x"} {
+		if got := attrString(host[name]); got != want {
+			t.Errorf("host %s = %q, want %q", name, got, want)
+		}
+	}
+	if h := hostFromItem(host); h.HostID != "h1" || h.OSID != "ubuntu" {
+		t.Errorf("copied host = %+v", h)
+	}
+
+	pkg := s.legacyPackage(attrMap{"host_id": s3("h1"), "pkg_key": s3("g#openssl#amd64"), "name": s3("openssl")})
+	if attrString(pkg["tenant_host"]) != "acme#h1" || attrString(pkg["tenant_name"]) != "acme#openssl" || attrString(pkg["pkg_key"]) != "g#openssl#amd64" {
+		t.Errorf("package = %v", pkg)
+	}
+	cis := s.legacyCISResult(attrMap{"host_id": s3("h1"), "check_id": s3("P3")})
+	if attrString(cis["tenant_host"]) != "acme#h1" || attrString(cis["tenant_check"]) != "acme#P3" {
+		t.Errorf("CIS result = %v", cis)
+	}
+	if p := s.legacyPolicy(attrMap{"policy_id": s3("base")}); attrString(p["tenant_id"]) != "acme" {
+		t.Errorf("policy = %v", p)
+	}
+}
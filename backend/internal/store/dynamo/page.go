@@ -0,0 +1,230 @@
+package dynamo
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+)
+
+// attrMap is a DynamoDB item or key.
+type attrMap = map[string]types.AttributeValue
+
+// fetchFunc reads one DynamoDB page starting after start, returning its
+// items and LastEvaluatedKey.
+type fetchFunc func(ctx context.Context, start attrMap, limit *int32) ([]attrMap, attrMap, error)
+
+// paginate fills a page of up to limit items (all when limit is 0) that
+// pass keep, fetching as many DynamoDB pages as that takes. The next token
+// encodes keyAttrs of the last item returned, which must include the table
+// and, when querying one, the index key attributes, so the next page starts
+// right after it even when the last DynamoDB page was only partly used.
+func paginate(ctx context.Context, limit int, token string, keyAttrs []string, fetch fetchFunc, keep func(attrMap) (bool, error)) ([]attrMap, string, error) {
+	start, err := decodeToken(token)
+	if err != nil {
+		return nil, "", err
+	}
+	var pageLimit *int32
+	if limit > 0 {
+		pageLimit = int32Ptr(limit)
+	}
+
+	var out []attrMap
+	for {
+		items, last, err := fetch(ctx, start, pageLimit)
+		if err != nil {
+			return nil, "", err
+		}
+		for i, it := range items {
+			if keep != nil {
+				ok, err := keep(it)
+				if err != nil {
+					return nil, "", err
+				}
+				if !ok {
+					continue
+				}
+			}
+			out = append(out, it)
+			if limit > 0 && len(out) == limit {
+				if i == len(items)-1 && last == nil {
+					return out, "", nil
+				}
+				return out, encodeToken(it, keyAttrs), nil
+			}
+		}
+		if last == nil {
+			return out, "", nil
+		}
+		start = last
+	}
+}
+
+// list pages through fetch in key order, or, when s names a field, reads
+// every item that passes keep and pages over them sorted in memory:
+// DynamoDB only returns items in key order, so each sorted page costs a
+// read of everything that matches.
+func list(ctx context.Context, s store.Sort, limit int, token string, keyAttrs []string, fetch fetchFunc, keep func(attrMap) (bool, error)) ([]attrMap, string, error) {
+	if s.Field == "" {
+		return paginate(ctx, limit, token, keyAttrs, fetch, keep)
+	}
+	items, _, err := paginate(ctx, 0, "", keyAttrs, fetch, keep)
+	if err != nil {
+		return nil, "", err
+	}
+	rows := map[string]attrMap{}
+	for _, it := range items {
+		natural := make([]string, len(keyAttrs))
+		for i, name := range keyAttrs {
+			natural[i] = attrString(it[name])
+		}
+		rows[store.SortKey(s, attrString(it[s.Field]), strings.Join(natural, "\x00"))] = it
+	}
+	return store.Page(slices.Collect(maps.Keys(rows)), s, limit, token, func(key string) attrMap {
+		return rows[key]
+	})
+}
+
+// Tokens are the key attributes as base64 JSON. Every key attribute in these
+// tables is a string.
+func encodeToken(it attrMap, keyAttrs []string) string {
+	key := map[string]string{}
+	for _, name := range keyAttrs {
+		key[name] = attrString(it[name])
+	}
+	b, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeToken(token string) (attrMap, error) {
+	if token == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, store.ErrInvalidToken
+	}
+	var key map[string]string
+	if err := json.Unmarshal(b, &key); err != nil || len(key) == 0 {
+		return nil, store.ErrInvalidToken
+	}
+	start := attrMap{}
+	for name, value := range key {
+		start[name] = &types.AttributeValueMemberS{Value: value}
+	}
+	return start, nil
+}
+
+func (s *Store) queryPages(in *dynamodb.QueryInput) fetchFunc {
+	return func(ctx context.Context, start attrMap, limit *int32) ([]attrMap, attrMap, error) {
+		in.ExclusiveStartKey, in.Limit = start, limit
+		out, err := s.client.Query(ctx, in)
+		if err != nil {
+			return nil, nil, err
+		}
+		return out.Items, out.LastEvaluatedKey, nil
+	}
+}
+
+// hostBatch is how many hosts hostWalk reads from TenantIndex at a time.
+const hostBatch = 100
+
+// hostWalk returns a fetchFunc over the tenant's hosts in host ID order and,
+// host by host, the items of the query partition builds for the host, which
+// reads its partition. Hosts that skip, when not nil, rejects are not read.
+// projection names the host attributes partition needs besides the keys,
+// read with one BatchGetItem per hostBatch hosts; when empty, partition gets
+// the index keys only.
+//
+// A page holds the items of one host. Between two hosts the start key is
+// {"after_host": id}, which only hostWalk reads; tokens are always built
+// from items, whose keys say which host to resume.
+func (s *Store) hostWalk(projection string, skip func(hostID string) bool, partition func(host attrMap) *dynamodb.QueryInput) fetchFunc {
+	return func(ctx context.Context, start attrMap, limit *int32) ([]attrMap, attrMap, error) {
+		cond := "tenant_id = :tenant"
+		values := map[string]types.AttributeValue{":tenant": &types.AttributeValueMemberS{Value: s.tenant}}
+		var from attrMap
+		switch {
+		case start == nil:
+		case start["after_host"] != nil:
+			cond += " AND host_id > :host"
+			values[":host"] = start["after_host"]
+		default:
+			cond += " AND host_id >= :host"
+			values[":host"] = &types.AttributeValueMemberS{Value: strings.TrimPrefix(attrString(start["tenant_host"]), s.tenant+"#")}
+			from = start
+		}
+		out, err := s.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:                 str(s.tables.Hosts),
+			IndexName:                 str(tenantIndex),
+			KeyConditionExpression:    str(cond),
+			ExpressionAttributeValues: values,
+			Limit:                     int32Ptr(hostBatch),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		hosts := out.Items
+		if skip != nil {
+			hosts = slices.DeleteFunc(hosts, func(k attrMap) bool { return skip(attrString(k["host_id"])) })
+		}
+		if projection != "" {
+			if hosts, err = s.getHosts(ctx, hosts, projection); err != nil {
+				return nil, nil, err
+			}
+		}
+		for i, host := range hosts {
+			in := partition(host)
+			if from != nil && attrString(from["tenant_host"]) == attrString(host["tenant_host"]) {
+				in.ExclusiveStartKey = from
+			}
+			from = nil
+			in.Limit = limit
+			page, err := s.client.Query(ctx, in)
+			if err != nil {
+				return nil, nil, err
+			}
+			if page.LastEvaluatedKey != nil {
+				return page.Items, page.LastEvaluatedKey, nil
+			}
+			if len(page.Items) > 0 {
+				if i == len(hosts)-1 && out.LastEvaluatedKey == nil {
+					return page.Items, nil, nil
+				}
+				return page.Items, attrMap{"after_host": host["host_id"]}, nil
+			}
+		}
+		if out.LastEvaluatedKey == nil {
+			return nil, nil, nil
+		}
+		return nil, attrMap{"after_host": out.LastEvaluatedKey["host_id"]}, nil
+	}
+}
+
+// outside returns a hostWalk skip func for the hosts not in hostIDs, or nil
+// to read every host when hostIDs is nil.
+func outside(hostIDs map[string]bool) func(hostID string) bool {
+	if hostIDs == nil {
+		return nil
+	}
+	return func(hostID string) bool { return !hostIDs[hostID] }
+}
+
+func (s *Store) scanPages(in *dynamodb.ScanInput) fetchFunc {
+	return func(ctx context.Context, start attrMap, limit *int32) ([]attrMap, attrMap, error) {
+		in.ExclusiveStartKey, in.Limit = start, limit
+		out, err := s.client.Scan(ctx, in)
+		if err != nil {
+			return nil, nil, err
+		}
+		return out.Items, out.LastEvaluatedKey, nil
+	}
+}
@@ -0,0 +1,106 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+)
+
+// fakeTable serves rows k=0..n-1 in pages of pageSize, like DynamoDB's Limit
+// and LastEvaluatedKey.
+func fakeTable(n, pageSize int) fetchFunc {
+	return func(ctx context.Context, start attrMap, limit *int32) ([]attrMap, attrMap, error) {
+		from := 0
+		if start != nil {
+			from, _ = strconv.Atoi(attrString(start["k"]))
+			from++
+		}
+		size := pageSize
+		if limit != nil && int(*limit) < size {
+			size = int(*limit)
+		}
+		var items []attrMap
+		for i := from; i < n && len(items) < size; i++ {
+			items = append(items, attrMap{"k": &types.AttributeValueMemberS{Value: strconv.Itoa(i)}})
+		}
+		var last attrMap
+		if len(items) > 0 && from+len(items) < n {
+			last = items[len(items)-1]
+		}
+		return items, last, nil
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	ctx := context.Background()
+	even := func(it attrMap) (bool, error) {
+		n, _ := strconv.Atoi(attrString(it["k"]))
+		return n%2 == 0, nil
+	}
+
+	// Filtered pages are filled from several DynamoDB pages and resume
+	// right after the last item returned
+	var got []string
+	token := ""
+	for calls := 0; ; calls++ {
+		items, next, err := paginate(ctx, 4, token, []string{"k"}, fakeTable(20, 3), even)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, it := range items {
+			got = append(got, attrString(it["k"]))
+		}
+		if next == "" {
+			break
+		}
+		if calls > 5 {
+			t.Fatal("pagination does not end")
+		}
+		token = next
+	}
+	if len(got) != 10 || got[0] != "0" || got[9] != "18" {
+		t.Errorf("items = %v", got)
+	}
+
+	items, next, _ := paginate(ctx, 0, "", []string{"k"}, fakeTable(7, 3), nil)
+	if len(items) != 7 || next != "" {
+		t.Errorf("unlimited = %d items, next %q", len(items), next)
+	}
+	items, next, _ = paginate(ctx, 5, "", []string{"k"}, fakeTable(5, 10), nil)
+	if len(items) != 5 || next != "" {
+		t.Errorf("exact last page = %d items, next %q", len(items), next)
+	}
+
+	if _, _, err := paginate(ctx, 5, "not-a-token!", []string{"k"}, fakeTable(5, 10), nil); !errors.Is(err, store.ErrInvalidToken) {
+		t.Errorf("bad token: got %v", err)
+	}
+}
+
+func TestListSorted(t *testing.T) {
+	ctx := context.Background()
+	desc := store.Sort{Field: "k", Desc: true}
+
+	var got []string
+	token := ""
+	for {
+		items, next, err := list(ctx, desc, 3, token, []string{"k"}, fakeTable(7, 2), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, it := range items {
+			got = append(got, attrString(it["k"]))
+		}
+		if token = next; token == "" {
+			break
+		}
+	}
+	if strings.Join(got, ",") != "6,5,4,3,2,1,0" {
+		t.Errorf("sorted = %v", got)
+	}
+}
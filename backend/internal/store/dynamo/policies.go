@@ -0,0 +1,78 @@
+package dynamo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/visiblaze/sec-agent/pkg/policy"
+)
+
+// PutPolicy bumps the version atomically with ADD, so concurrent writers
+// each get a distinct version.
+func (s *Store) PutPolicy(ctx context.Context, p policy.Assigned, at time.Time) (policy.Assigned, error) {
+	p.Policy.Version = 0
+	policyJSON, _ := json.Marshal(p.Policy)
+	assignJSON, _ := json.Marshal(p.Assign)
+	out, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        str(s.tables.Policies),
+		Key:              map[string]types.AttributeValue{"tenant_id": &types.AttributeValueMemberS{Value: s.tenant}, "policy_id": &types.AttributeValueMemberS{Value: p.Policy.ID}},
+		UpdateExpression: str("SET #doc = :doc, assign = :assign, updated_at = :now ADD version :one"),
+		ExpressionAttributeNames: map[string]string{
+			"#doc": "document",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":doc":    &types.AttributeValueMemberS{Value: string(policyJSON)},
+			":assign": &types.AttributeValueMemberS{Value: string(assignJSON)},
+			":now":    &types.AttributeValueMemberS{Value: at.UTC().Format(time.RFC3339)},
+			":one":    &types.AttributeValueMemberN{Value: "1"},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		return policy.Assigned{}, fmt.Errorf("update policy: %w", err)
+	}
+	return policyFromItem(out.Attributes)
+}
+
+func (s *Store) ListPolicies(ctx context.Context) ([]policy.Assigned, error) {
+	policies := []policy.Assigned{}
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:                 str(s.tables.Policies),
+		KeyConditionExpression:    str("tenant_id = :tenant"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":tenant": &types.AttributeValueMemberS{Value: s.tenant}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("query policies: %w", err)
+		}
+		for _, item := range page.Items {
+			p, err := policyFromItem(item)
+			if err != nil {
+				log.Printf("Skipping policy %s: %v", attrString(item["policy_id"]), err)
+				continue
+			}
+			policies = append(policies, p)
+		}
+	}
+	return policies, nil
+}
+
+func policyFromItem(item map[string]types.AttributeValue) (policy.Assigned, error) {
+	var p policy.Assigned
+	if err := json.Unmarshal([]byte(attrString(item["document"])), &p.Policy); err != nil {
+		return p, fmt.Errorf("parse document: %w", err)
+	}
+	if err := json.Unmarshal([]byte(attrString(item["assign"])), &p.Assign); err != nil {
+		return p, fmt.Errorf("parse assignment: %w", err)
+	}
+	p.Policy.Version, _ = strconv.ParseInt(attrNumber(item["version"]), 10, 64)
+	return p, nil
+}
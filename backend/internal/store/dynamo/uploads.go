@@ -0,0 +1,151 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/pkg/upload"
+)
+
+// Upload sessions live in the uploads table keyed by (upload_id, part), with
+// the upload ID prefixed by the tenant. Part 0 holds the session
+// description; parts 1..n hold the body. Items expire via TTL, so abandoned
+// sessions clean themselves up.
+
+func (s *Store) CreateUpload(ctx context.Context, u store.Upload) error {
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: str(s.tables.Uploads),
+		Item: map[string]types.AttributeValue{
+			"upload_id":        &types.AttributeValueMemberS{Value: s.scoped(u.ID)},
+			"part":             &types.AttributeValueMemberN{Value: "0"},
+			"parts":            &types.AttributeValueMemberN{Value: strconv.Itoa(u.Parts)},
+			"size":             &types.AttributeValueMemberN{Value: strconv.FormatInt(u.Size, 10)},
+			"sha256":           &types.AttributeValueMemberS{Value: u.SHA256},
+			"content_encoding": &types.AttributeValueMemberS{Value: u.ContentEncoding},
+			"owner":            &types.AttributeValueMemberS{Value: u.Owner},
+			"expires_at":       &types.AttributeValueMemberN{Value: strconv.FormatInt(u.ExpiresAt.Unix(), 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("put upload: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetUpload(ctx context.Context, uploadID string) (*store.Upload, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      str(s.tables.Uploads),
+		Key:            s.uploadKey(uploadID, 0),
+		ConsistentRead: boolPtr(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get upload: %w", err)
+	}
+	if out.Item == nil {
+		return nil, store.ErrNotFound
+	}
+
+	parts, _ := strconv.Atoi(attrNumber(out.Item["parts"]))
+	size, _ := strconv.ParseInt(attrNumber(out.Item["size"]), 10, 64)
+	expiresAt, _ := strconv.ParseInt(attrNumber(out.Item["expires_at"]), 10, 64)
+	return &store.Upload{
+		ID: uploadID,
+		Session: upload.Session{
+			Parts:           parts,
+			Size:            size,
+			SHA256:          attrString(out.Item["sha256"]),
+			ContentEncoding: attrString(out.Item["content_encoding"]),
+		},
+		Owner:     attrString(out.Item["owner"]),
+		ExpiresAt: time.Unix(expiresAt, 0),
+		Completed: attrString(out.Item["completed_at"]) != "",
+	}, nil
+}
+
+func (s *Store) PutUploadPart(ctx context.Context, uploadID string, part int, data []byte, expires time.Time) error {
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: str(s.tables.Uploads),
+		Item: map[string]types.AttributeValue{
+			"upload_id":  &types.AttributeValueMemberS{Value: s.scoped(uploadID)},
+			"part":       &types.AttributeValueMemberN{Value: strconv.Itoa(part)},
+			"data":       &types.AttributeValueMemberB{Value: data},
+			"expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(expires.Unix(), 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("put part: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) UploadParts(ctx context.Context, uploadID string) ([][]byte, error) {
+	var parts [][]byte
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := s.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              str(s.tables.Uploads),
+			KeyConditionExpression: str("upload_id = :id AND part > :zero"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":id":   &types.AttributeValueMemberS{Value: s.scoped(uploadID)},
+				":zero": &types.AttributeValueMemberN{Value: "0"},
+			},
+			ConsistentRead:    boolPtr(true),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("query parts: %w", err)
+		}
+		for _, item := range out.Items {
+			if b, ok := item["data"].(*types.AttributeValueMemberB); ok {
+				parts = append(parts, b.Value)
+			}
+		}
+		if out.LastEvaluatedKey == nil {
+			return parts, nil
+		}
+		startKey = out.LastEvaluatedKey
+	}
+}
+
+func (s *Store) CompleteUpload(ctx context.Context, uploadID string, at time.Time) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 str(s.tables.Uploads),
+		Key:                       s.uploadKey(uploadID, 0),
+		UpdateExpression:          str("SET completed_at = :now"),
+		ConditionExpression:       str("attribute_not_exists(completed_at)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":now": &types.AttributeValueMemberS{Value: at.UTC().Format(time.RFC3339)}},
+	})
+	if conditionFailed(err) {
+		return store.ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("complete upload: %w", err)
+	}
+	return nil
+}
+
+// DeleteUploadParts is best effort: parts left behind expire via TTL.
+func (s *Store) DeleteUploadParts(ctx context.Context, uploadID string, parts int) error {
+	deletes := make([]types.WriteRequest, 0, parts)
+	for n := 1; n <= parts; n++ {
+		deletes = append(deletes, deleteRequest(s.uploadKey(uploadID, n)))
+	}
+	if err := batchWrite(ctx, s.client, s.tables.Uploads, deletes); err != nil {
+		log.Printf("delete parts of upload %s: %v", uploadID, err)
+	}
+	return nil
+}
+
+func (s *Store) uploadKey(uploadID string, part int) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"upload_id": &types.AttributeValueMemberS{Value: s.scoped(uploadID)},
+		"part":      &types.AttributeValueMemberN{Value: strconv.Itoa(part)},
+	}
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+)
+
+// Group is a dynamic set of hosts: those that match every one of its Rules.
+// Membership is evaluated whenever hosts are read, so it follows the hosts'
+// attributes and tags as they change.
+type Group struct {
+	ID          string `json:"id"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Rules       []Rule `json:"rules"`
+	UpdatedAt   string `json:"updated_at,omitempty"`
+}
+
+// Rule tests one host attribute: Field compared with Value by Op. On the
+// fields that hold several values, tag and ip_address, eq, prefix and glob
+// hold when any value matches and ne when none is equal. glob takes shell
+// patterns as path.Match does.
+type Rule struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+// The fields and operators rules may use.
+var (
+	RuleFields = []string{"hostname", "os_id", "os_version", "kernel", "agent_version", "ip_address", "tag"}
+	RuleOps    = []string{"eq", "ne", "prefix", "glob"}
+)
+
+var groupIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Validate checks the group's ID and rules.
+func (g Group) Validate() error {
+	if !groupIDPattern.MatchString(g.ID) {
+		return fmt.Errorf("invalid group id %q: want lower case letters, digits, _ and -", g.ID)
+	}
+	if len(g.Rules) == 0 {
+		return errors.New("a group needs at least one rule")
+	}
+	for i, r := range g.Rules {
+		if !slices.Contains(RuleFields, r.Field) {
+			return fmt.Errorf("rule %d: invalid field %q: want one of %s", i+1, r.Field, strings.Join(RuleFields, ", "))
+		}
+		if !slices.Contains(RuleOps, r.Op) {
+			return fmt.Errorf("rule %d: invalid op %q: want one of %s", i+1, r.Op, strings.Join(RuleOps, ", "))
+		}
+		if _, err := path.Match(r.Value, ""); r.Op == "glob" && err != nil {
+			return fmt.Errorf("rule %d: invalid pattern %q", i+1, r.Value)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether h, with its Tags set, belongs to the group.
+func (g Group) Matches(h *models.Host) bool {
+	for _, r := range g.Rules {
+		if !r.matches(h) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Rule) matches(h *models.Host) bool {
+	var values []string
+	switch r.Field {
+	case "hostname":
+		values = []string{h.Hostname}
+	case "os_id":
+		values = []string{h.OSID}
+	case "os_version":
+		values = []string{h.OSVersion}
+	case "kernel":
+		values = []string{h.Kernel}
+	case "agent_version":
+		values = []string{h.AgentVersion}
+	case "ip_address":
+		values = h.IPAddresses
+	case "tag":
+		values = h.Tags
+	}
+	if r.Op == "ne" {
+		return !slices.Contains(values, r.Value)
+	}
+	for _, v := range values {
+		switch r.Op {
+		case "eq":
+			if v == r.Value {
+				return true
+			}
+		case "prefix":
+			if strings.HasPrefix(v, r.Value) {
+				return true
+			}
+		case "glob":
+			if ok, _ := path.Match(r.Value, v); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MemberOf returns the IDs of the groups h belongs to, in the order of
+// groups.
+func MemberOf(groups []Group, h *models.Host) []string {
+	var ids []string
+	for _, g := range groups {
+		if g.Matches(h) {
+			ids = append(ids, g.ID)
+		}
+	}
+	return ids
+}
+
+// UnionTags returns the tags in any of lists, sorted and without
+// duplicates.
+func UnionTags(lists ...[]string) []string {
+	var tags []string
+	for _, l := range lists {
+		tags = append(tags, l...)
+	}
+	sort.Strings(tags)
+	return slices.Compact(tags)
+}
@@ -0,0 +1,744 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+	"github.com/visiblaze/sec-agent/pkg/liveness"
+	"github.com/visiblaze/sec-agent/pkg/policy"
+)
+
+// Memory is a Store held in memory. Opened with Open, it is also persisted
+// to a directory on disk, which is enough for a single server and for local
+// development. A Memory is the store of DefaultTenant; Tenant returns the
+// stores of the others, which share its lock and its directory.
+type Memory struct {
+	*memoryDB
+	tenant string
+	data   *memoryData
+}
+
+// memoryDB is every tenant's data.
+type memoryDB struct {
+	mu      sync.Mutex
+	tenants map[string]*memoryData
+	disk    *disk
+}
+
+var (
+	_ Store   = (*Memory)(nil)
+	_ Tenants = (*Memory)(nil)
+)
+
+// memoryData is one tenant's data.
+type memoryData struct {
+	Hosts    map[string]*hostRecord                 `json:"hosts"`
+	Packages map[string][]models.Package            `json:"packages"`
+	CIS      map[string]map[string]models.CISResult `json:"cis_results"`
+	Tokens   map[string]*tokenRecord                `json:"enrollment_tokens"`
+	Uploads  map[string]*uploadRecord               `json:"uploads"`
+	Policies map[string]policy.Assigned             `json:"policies"`
+	Groups   map[string]Group                       `json:"groups"`
+}
+
+type hostRecord struct {
+	Host
+	Credential          Credential `json:"credential"`
+	CredentialIssuedAt  string     `json:"credential_issued_at,omitempty"`
+	CredentialRevokedAt string     `json:"credential_revoked_at,omitempty"`
+	RevokedCertSerials  []string   `json:"revoked_cert_serials,omitempty"`
+	SigningKey          string     `json:"signing_public_key,omitempty"`
+	LastSequence        *uint64    `json:"last_sequence,omitempty"`
+	LastSignature       string     `json:"last_signature,omitempty"`
+	LastSignedMessage   string     `json:"last_signed_message,omitempty"`
+}
+
+type tokenRecord struct {
+	EnrollmentToken
+	UsedBy string `json:"used_by,omitempty"`
+	UsedAt string `json:"used_at,omitempty"`
+}
+
+type uploadRecord struct {
+	Upload
+	Data map[int][]byte `json:"data,omitempty"`
+}
+
+// NewMemory returns an empty Store that is lost when the process exits.
+func NewMemory() *Memory {
+	db := &memoryDB{tenants: map[string]*memoryData{}}
+	return db.store(DefaultTenant)
+}
+
+// Tenant returns the store of the tenant id.
+func (m *Memory) Tenant(id string) Store {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.store(id)
+}
+
+// store returns the Memory of tenant, creating its data if needed. Callers
+// hold mu, or have db to themselves.
+func (db *memoryDB) store(tenant string) *Memory {
+	d, ok := db.tenants[tenant]
+	if !ok {
+		d = &memoryData{}
+		d.init()
+		db.tenants[tenant] = d
+	}
+	return &Memory{memoryDB: db, tenant: tenant, data: d}
+}
+
+func (d *memoryData) init() {
+	if d.Hosts == nil {
+		d.Hosts = map[string]*hostRecord{}
+	}
+	if d.Packages == nil {
+		d.Packages = map[string][]models.Package{}
+	}
+	if d.CIS == nil {
+		d.CIS = map[string]map[string]models.CISResult{}
+	}
+	if d.Tokens == nil {
+		d.Tokens = map[string]*tokenRecord{}
+	}
+	if d.Uploads == nil {
+		d.Uploads = map[string]*uploadRecord{}
+	}
+	if d.Policies == nil {
+		d.Policies = map[string]policy.Assigned{}
+	}
+	if d.Groups == nil {
+		d.Groups = map[string]Group{}
+	}
+}
+
+// host returns the record for hostID, creating it if needed.
+func (m *Memory) host(hostID string) *hostRecord {
+	rec, ok := m.data.Hosts[hostID]
+	if !ok {
+		rec = &hostRecord{Host: Host{Host: models.Host{HostID: hostID}}}
+		m.data.Hosts[hostID] = rec
+	}
+	return rec
+}
+
+// hostChange records the current state of hostID.
+func (m *Memory) hostChange(hostID string) change {
+	return change{table: tableHosts, key: hostID, value: m.data.Hosts[hostID]}
+}
+
+// uploadChange records the current state of uploadID, without its parts.
+func (m *Memory) uploadChange(uploadID string) change {
+	c := change{table: tableUploads, key: uploadID}
+	if rec, ok := m.data.Uploads[uploadID]; ok {
+		c.value = rec.Upload
+	}
+	return c
+}
+
+// view copies rec for a caller, with its package count and tags.
+func (m *Memory) view(rec *hostRecord) *Host {
+	h := rec.Host
+	h.PackageCount = len(m.data.Packages[rec.HostID])
+	h.IPAddresses = slices.Clone(h.IPAddresses)
+	h.AgentTags = slices.Clone(h.AgentTags)
+	h.UserTags = slices.Clone(h.UserTags)
+	h.Tags = UnionTags(h.AgentTags, h.UserTags)
+	h.Remediations = slices.Clone(h.Remediations)
+	return &h
+}
+
+func (m *Memory) UpsertHost(ctx context.Context, u HostUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec := m.host(u.Host.HostID)
+	seen := u.SeenAt.UTC().Format(time.RFC3339)
+	rec.Hostname = u.Host.Hostname
+	rec.OSID = u.Host.OSID
+	rec.OSVersion = u.Host.OSVersion
+	rec.Kernel = u.Host.Kernel
+	rec.AgentVersion = u.Host.AgentVersion
+	rec.IPAddresses = slices.Clone(u.Host.IPAddresses)
+	if u.Host.Tags != nil {
+		rec.AgentTags = slices.Clone(u.Host.Tags)
+	}
+	rec.LastSeen = seen
+	if rec.FirstSeen == "" {
+		rec.FirstSeen = seen
+	}
+	if u.Containers != nil {
+		rec.Containers = u.Containers
+	}
+	if len(u.Remediations) > 0 {
+		rec.Remediations = slices.Clone(u.Remediations)
+	}
+	return m.commit(m.hostChange(u.Host.HostID))
+}
+
+func (m *Memory) RecordHeartbeat(ctx context.Context, hb models.Heartbeat, at time.Time) (*Host, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec := m.host(hb.HostID)
+	now := at.UTC().Format(time.RFC3339)
+	rec.LastHeartbeat = now
+	rec.Hostname = hb.Hostname
+	rec.AgentVersion = hb.AgentVersion
+	rec.UptimeSeconds = hb.UptimeSeconds
+	rec.QueueDepth = hb.QueueDepth
+	if rec.FirstSeen == "" {
+		rec.FirstSeen = now
+	}
+	if hb.LastCollection != nil {
+		lc := *hb.LastCollection
+		rec.LastCollection = &lc
+	}
+	if err := m.commit(m.hostChange(hb.HostID)); err != nil {
+		return nil, err
+	}
+	return m.view(rec), nil
+}
+
+func (m *Memory) GetHost(ctx context.Context, hostID string) (*Host, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.data.Hosts[hostID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return m.view(rec), nil
+}
+
+func (m *Memory) ListHosts(ctx context.Context, q HostQuery) ([]models.Host, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rows := map[string]*Host{}
+	for id, rec := range m.data.Hosts {
+		if h := m.view(rec); q.Matches(h) {
+			rows[SortKey(q.Sort, hostSortValue(h, q.Sort.Field), id)] = h
+		}
+	}
+	return Page(slices.Collect(maps.Keys(rows)), q.Sort, q.Limit, q.NextToken, func(key string) models.Host {
+		return rows[key].Host
+	})
+}
+
+func (m *Memory) DeleteHost(ctx context.Context, hostID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.Hosts[hostID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.data.Hosts, hostID)
+	delete(m.data.Packages, hostID)
+	delete(m.data.CIS, hostID)
+	return m.commit(
+		change{table: tableHosts, key: hostID},
+		change{table: tablePackages, key: hostID},
+		change{table: tableCIS, key: hostID},
+	)
+}
+
+func (m *Memory) RevokeCertificate(ctx context.Context, hostID, serial string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.data.Hosts[hostID]
+	if !ok {
+		return ErrNotFound
+	}
+	if !slices.Contains(rec.RevokedCertSerials, serial) {
+		rec.RevokedCertSerials = append(rec.RevokedCertSerials, serial)
+	}
+	return m.commit(m.hostChange(hostID))
+}
+
+func (m *Memory) CertificateRevoked(ctx context.Context, hostID, serial string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.data.Hosts[hostID]
+	return ok && slices.Contains(rec.RevokedCertSerials, serial), nil
+}
+
+func (m *Memory) SetUserTags(ctx context.Context, hostID string, tags []string) (*Host, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.data.Hosts[hostID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	rec.UserTags = slices.Clone(tags)
+	if err := m.commit(m.hostChange(hostID)); err != nil {
+		return nil, err
+	}
+	return m.view(rec), nil
+}
+
+func (m *Memory) CreateEnrollmentToken(ctx context.Context, t EnrollmentToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Expired tokens are dropped here, standing in for DynamoDB's TTL
+	changes := m.pruneTokens(t.CreatedAt)
+	m.data.Tokens[t.Hash] = &tokenRecord{EnrollmentToken: t}
+	return m.commit(append(changes, change{table: tableTokens, key: t.Hash, value: m.data.Tokens[t.Hash]})...)
+}
+
+func (m *Memory) Enroll(ctx context.Context, e Enrollment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tok, ok := m.data.Tokens[e.TokenHash]
+	if !ok || tok.UsedBy != "" || !e.At.Before(tok.ExpiresAt) {
+		return ErrTokenInvalid
+	}
+	if rec, ok := m.data.Hosts[e.HostID]; ok && rec.Credential.Hash != "" {
+		return ErrAlreadyEnrolled
+	}
+
+	at := e.At.UTC().Format(time.RFC3339)
+	tok.UsedBy = e.HostID
+	tok.UsedAt = at
+
+	rec := m.host(e.HostID)
+	if rec.Hostname == "" {
+		rec.Hostname = e.Hostname
+	}
+	rec.Credential = Credential{Hash: e.CredentialHash}
+	rec.CredentialIssuedAt = at
+	rec.CredentialRevokedAt = ""
+	if e.PublicKey != "" {
+		rec.SigningKey = e.PublicKey
+		rec.LastSequence = nil
+	}
+	return m.commit(change{table: tableTokens, key: e.TokenHash, value: tok}, m.hostChange(e.HostID))
+}
+
+func (m *Memory) Credential(ctx context.Context, hostID string) (Credential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rec, ok := m.data.Hosts[hostID]; ok {
+		return rec.Credential, nil
+	}
+	return Credential{}, nil
+}
+
+func (m *Memory) PromoteCredential(ctx context.Context, hostID, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.data.Hosts[hostID]
+	if !ok || rec.Credential.Hash != hash || rec.Credential.PreviousHash == "" {
+		return nil
+	}
+	rec.Credential.PreviousHash = ""
+	return m.commit(m.hostChange(hostID))
+}
+
+func (m *Memory) RotateCredential(ctx context.Context, hostID, hash string, at time.Time, keepPrevious bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.data.Hosts[hostID]
+	if !ok || rec.Credential.Hash == "" {
+		return ErrNotFound
+	}
+	previous := ""
+	if keepPrevious {
+		previous = rec.Credential.Hash
+	}
+	rec.Credential = Credential{Hash: hash, PreviousHash: previous}
+	rec.CredentialIssuedAt = at.UTC().Format(time.RFC3339)
+	return m.commit(m.hostChange(hostID))
+}
+
+func (m *Memory) RevokeCredential(ctx context.Context, hostID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.data.Hosts[hostID]
+	if !ok {
+		return ErrNotFound
+	}
+	rec.Credential = Credential{}
+	rec.CredentialRevokedAt = at.UTC().Format(time.RFC3339)
+	return m.commit(m.hostChange(hostID))
+}
+
+func (m *Memory) SigningKey(ctx context.Context, hostID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rec, ok := m.data.Hosts[hostID]; ok {
+		return rec.SigningKey, nil
+	}
+	return "", nil
+}
+
+func (m *Memory) AcceptSignature(ctx context.Context, hostID string, sig Signature) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec := m.data.Hosts[hostID]
+	if rec != nil {
+		if rec.LastSequence != nil && *rec.LastSequence >= sig.Sequence {
+			return ErrConflict
+		}
+		if sig.PublicKey != "" && rec.SigningKey != "" {
+			return ErrConflict
+		}
+	}
+
+	rec = m.host(hostID)
+	seq := sig.Sequence
+	rec.LastSequence = &seq
+	rec.LastSignature = sig.Signature
+	rec.LastSignedMessage = sig.Message
+	if sig.PublicKey != "" {
+		rec.SigningKey = sig.PublicKey
+	}
+	return m.commit(m.hostChange(hostID))
+}
+
+func (m *Memory) ReplacePackages(ctx context.Context, hostID string, packages []models.Package) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data.Packages[hostID] = slices.Clone(packages)
+	return m.commit(change{table: tablePackages, key: hostID, value: m.data.Packages[hostID]})
+}
+
+func (m *Memory) HostPackages(ctx context.Context, hostID string) ([]models.Package, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.Package{}, m.data.Packages[hostID]...), nil
+}
+
+func (m *Memory) ListPackages(ctx context.Context, q PackageQuery) ([]models.Package, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Keys order packages by host, then name; the index keeps duplicates apart
+	rows := map[string]models.Package{}
+	for hostID, packages := range m.data.Packages {
+		if q.HostID != "" && hostID != q.HostID {
+			continue
+		}
+		for i, pkg := range packages {
+			pkg.HostID = hostID
+			if !q.Matches(pkg) {
+				continue
+			}
+			natural := fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%06d", hostID, pkg.Name, pkg.Manager, pkg.Version, i)
+			rows[SortKey(q.Sort, packageSortValue(pkg, q.Sort.Field), natural)] = pkg
+		}
+	}
+	return Page(slices.Collect(maps.Keys(rows)), q.Sort, q.Limit, q.NextToken, func(key string) models.Package {
+		return rows[key]
+	})
+}
+
+// SoftwareCatalog aggregates the inventories on every call; they are held
+// in memory, so that reads nothing from disk.
+func (m *Memory) SoftwareCatalog(ctx context.Context, q SoftwareQuery) ([]models.SoftwareEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var packages []models.Package
+	for hostID, installed := range m.data.Packages {
+		for _, pkg := range installed {
+			if q.Matches(pkg.Name, pkg.Manager) {
+				pkg.HostID = hostID
+				packages = append(packages, pkg)
+			}
+		}
+	}
+	return Catalog(packages), nil
+}
+
+func (m *Memory) ReplaceCISResults(ctx context.Context, hostID string, results []models.CISResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous := m.data.CIS[hostID]
+	byCheck := map[string]models.CISResult{}
+	for _, r := range results {
+		if r.Evidence == nil {
+			r.Evidence = map[string]interface{}{}
+		}
+		var old *models.CISResult
+		if prev, ok := previous[r.CheckID]; ok {
+			old = &prev
+		}
+		CarryStatus(&r, old)
+		byCheck[r.CheckID] = r
+	}
+	m.data.CIS[hostID] = byCheck
+	return m.commit(change{table: tableCIS, key: hostID, value: byCheck})
+}
+
+func (m *Memory) HostCISResults(ctx context.Context, hostID string) ([]models.CISResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	results := []models.CISResult{}
+	byCheck := m.data.CIS[hostID]
+	for _, id := range sortedKeys(byCheck) {
+		results = append(results, byCheck[id])
+	}
+	return results, nil
+}
+
+func (m *Memory) ListCISResults(ctx context.Context, q CISQuery) ([]models.CISResult, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rows := map[string]models.CISResult{}
+	for hostID, byCheck := range m.data.CIS {
+		if q.HostID != "" && hostID != q.HostID {
+			continue
+		}
+		for checkID, r := range byCheck {
+			r.HostID = hostID
+			if q.Matches(r) {
+				rows[SortKey(q.Sort, cisSortValue(r, q.Sort.Field), hostID+"\x00"+checkID)] = r
+			}
+		}
+	}
+	return Page(slices.Collect(maps.Keys(rows)), q.Sort, q.Limit, q.NextToken, func(key string) models.CISResult {
+		return rows[key]
+	})
+}
+
+func (m *Memory) CreateUpload(ctx context.Context, u Upload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changes := m.pruneUploads(time.Now())
+	m.data.Uploads[u.ID] = &uploadRecord{Upload: u, Data: map[int][]byte{}}
+	return m.commit(append(changes, m.uploadChange(u.ID))...)
+}
+
+func (m *Memory) GetUpload(ctx context.Context, uploadID string) (*Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.data.Uploads[uploadID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	u := rec.Upload
+	return &u, nil
+}
+
+func (m *Memory) PutUploadPart(ctx context.Context, uploadID string, part int, data []byte, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.data.Uploads[uploadID]
+	if !ok {
+		return ErrNotFound
+	}
+	if rec.Data == nil {
+		rec.Data = map[int][]byte{}
+	}
+	rec.Data[part] = slices.Clone(data)
+	return m.commit(change{table: tableParts, key: uploadID, part: part, value: rec.Data[part]})
+}
+
+func (m *Memory) UploadParts(ctx context.Context, uploadID string) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.data.Uploads[uploadID]
+	if !ok {
+		return nil, nil
+	}
+	var parts [][]byte
+	for _, n := range sortedKeys(rec.Data) {
+		parts = append(parts, rec.Data[n])
+	}
+	return parts, nil
+}
+
+func (m *Memory) CompleteUpload(ctx context.Context, uploadID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.data.Uploads[uploadID]
+	if !ok {
+		return ErrNotFound
+	}
+	if rec.Completed {
+		return ErrConflict
+	}
+	rec.Completed = true
+	return m.commit(m.uploadChange(uploadID))
+}
+
+func (m *Memory) DeleteUploadParts(ctx context.Context, uploadID string, parts int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rec, ok := m.data.Uploads[uploadID]; ok {
+		rec.Data = nil
+	}
+	return m.commit(change{table: tableParts, key: uploadID})
+}
+
+func (m *Memory) PutPolicy(ctx context.Context, p policy.Assigned, at time.Time) (policy.Assigned, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p.Policy.Version = m.data.Policies[p.Policy.ID].Policy.Version + 1
+	m.data.Policies[p.Policy.ID] = p
+	if err := m.commit(change{table: tablePolicies, key: p.Policy.ID, value: p}); err != nil {
+		return policy.Assigned{}, err
+	}
+	return p, nil
+}
+
+func (m *Memory) ListPolicies(ctx context.Context) ([]policy.Assigned, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	policies := []policy.Assigned{}
+	for _, id := range sortedKeys(m.data.Policies) {
+		policies = append(policies, m.data.Policies[id])
+	}
+	return policies, nil
+}
+
+func (m *Memory) PutGroup(ctx context.Context, g Group, at time.Time) (Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g.Rules = slices.Clone(g.Rules)
+	g.UpdatedAt = at.UTC().Format(time.RFC3339)
+	m.data.Groups[g.ID] = g
+	if err := m.commit(change{table: tableGroups, key: g.ID, value: g}); err != nil {
+		return Group{}, err
+	}
+	return g, nil
+}
+
+func (m *Memory) ListGroups(ctx context.Context) ([]Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	groups := []Group{}
+	for _, id := range sortedKeys(m.data.Groups) {
+		g := m.data.Groups[id]
+		g.Rules = slices.Clone(g.Rules)
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func (m *Memory) DeleteGroup(ctx context.Context, groupID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.Groups[groupID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.data.Groups, groupID)
+	return m.commit(change{table: tableGroups, key: groupID})
+}
+
+// Prune removes hosts not heard from within retention, with their packages
+// and CIS results, and expired enrollment tokens and upload sessions, in
+// every tenant. A removed host must enroll again. Hosts are kept forever
+// when retention is zero. Prune reports how many hosts were removed.
+func (m *Memory) Prune(ctx context.Context, now time.Time, retention time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for _, tenant := range sortedKeys(m.tenants) {
+		n, err := m.store(tenant).prune(now, retention)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// prune does the work of Prune for one tenant. Callers hold m.mu.
+func (m *Memory) prune(now time.Time, retention time.Duration) (int, error) {
+	changes := append(m.pruneTokens(now), m.pruneUploads(now)...)
+	removed := 0
+	for id, rec := range m.data.Hosts {
+		if retention <= 0 {
+			break
+		}
+		last := liveness.LastContact(rec.LastSeen, rec.LastHeartbeat, rec.CredentialIssuedAt)
+		if last.IsZero() || now.Sub(last) <= retention {
+			continue
+		}
+		delete(m.data.Hosts, id)
+		delete(m.data.Packages, id)
+		delete(m.data.CIS, id)
+		changes = append(changes,
+			change{table: tableHosts, key: id},
+			change{table: tablePackages, key: id},
+			change{table: tableCIS, key: id})
+		removed++
+	}
+	if len(changes) == 0 {
+		return 0, nil
+	}
+	return removed, m.commit(changes...)
+}
+
+// pruneTokens drops tokens expired at now. Callers hold m.mu and commit the
+// returned changes.
+func (m *Memory) pruneTokens(now time.Time) []change {
+	var changes []change
+	for hash, tok := range m.data.Tokens {
+		if now.After(tok.ExpiresAt) {
+			delete(m.data.Tokens, hash)
+			changes = append(changes, change{table: tableTokens, key: hash})
+		}
+	}
+	return changes
+}
+
+// pruneUploads drops upload sessions expired at now. Callers hold m.mu and
+// commit the returned changes.
+func (m *Memory) pruneUploads(now time.Time) []change {
+	var changes []change
+	for id, rec := range m.data.Uploads {
+		if now.After(rec.ExpiresAt) {
+			delete(m.data.Uploads, id)
+			changes = append(changes, change{table: tableUploads, key: id})
+		}
+	}
+	return changes
+}
+
+func sortedKeys[K string | int, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
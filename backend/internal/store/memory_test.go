@@ -0,0 +1,527 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+	"github.com/visiblaze/sec-agent/pkg/policy"
+)
+
+func TestEnroll(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := time.Now()
+	m.CreateEnrollmentToken(ctx, EnrollmentToken{Hash: "t1", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	m.CreateEnrollmentToken(ctx, EnrollmentToken{Hash: "t2", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	m.CreateEnrollmentToken(ctx, EnrollmentToken{Hash: "old", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)})
+
+	enroll := func(token, hostID string) error {
+		return m.Enroll(ctx, Enrollment{TokenHash: token, HostID: hostID, Hostname: "web-1", CredentialHash: "h-" + token, At: now})
+	}
+	if err := enroll("missing", "host-1"); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("unknown token: got %v", err)
+	}
+	if err := enroll("old", "host-1"); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("expired token: got %v", err)
+	}
+	if err := enroll("t1", "host-1"); err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	if err := enroll("t1", "host-2"); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("reused token: got %v", err)
+	}
+	// A failed enrollment must not spend the token
+	if err := enroll("t2", "host-1"); !errors.Is(err, ErrAlreadyEnrolled) {
+		t.Fatalf("enrolled host: got %v", err)
+	}
+	if err := enroll("t2", "host-2"); err != nil {
+		t.Fatalf("token spent by refused enrollment: %v", err)
+	}
+
+	cred, _ := m.Credential(ctx, "host-1")
+	if cred.Hash != "h-t1" {
+		t.Errorf("credential = %+v", cred)
+	}
+	host, err := m.GetHost(ctx, "host-1")
+	if err != nil || host.Hostname != "web-1" {
+		t.Errorf("host = %+v, %v", host, err)
+	}
+}
+
+func TestRotateCredential(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := time.Now()
+	if err := m.RotateCredential(ctx, "host-1", "new", now, true); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("rotate unenrolled: got %v", err)
+	}
+
+	m.CreateEnrollmentToken(ctx, EnrollmentToken{Hash: "t", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	m.Enroll(ctx, Enrollment{TokenHash: "t", HostID: "host-1", CredentialHash: "a", At: now})
+
+	m.RotateCredential(ctx, "host-1", "b", now, true)
+	if cred, _ := m.Credential(ctx, "host-1"); cred != (Credential{Hash: "b", PreviousHash: "a"}) {
+		t.Fatalf("after agent rotation: %+v", cred)
+	}
+	m.PromoteCredential(ctx, "host-1", "a")
+	if cred, _ := m.Credential(ctx, "host-1"); cred.PreviousHash != "a" {
+		t.Fatalf("promote with stale hash dropped previous: %+v", cred)
+	}
+	m.PromoteCredential(ctx, "host-1", "b")
+	if cred, _ := m.Credential(ctx, "host-1"); cred != (Credential{Hash: "b"}) {
+		t.Fatalf("after promote: %+v", cred)
+	}
+
+	m.RotateCredential(ctx, "host-1", "c", now, false)
+	if cred, _ := m.Credential(ctx, "host-1"); cred != (Credential{Hash: "c"}) {
+		t.Fatalf("after admin rotation: %+v", cred)
+	}
+	m.RevokeCredential(ctx, "host-1", now)
+	if cred, _ := m.Credential(ctx, "host-1"); cred != (Credential{}) {
+		t.Fatalf("after revoke: %+v", cred)
+	}
+}
+
+func TestAcceptSignature(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	if err := m.AcceptSignature(ctx, "host-1", Signature{Sequence: 5, PublicKey: "k1"}); err != nil {
+		t.Fatalf("first signature: %v", err)
+	}
+	if key, _ := m.SigningKey(ctx, "host-1"); key != "k1" {
+		t.Fatalf("key = %q", key)
+	}
+	for _, seq := range []uint64{5, 4} {
+		if err := m.AcceptSignature(ctx, "host-1", Signature{Sequence: seq}); !errors.Is(err, ErrConflict) {
+			t.Errorf("sequence %d: got %v, want ErrConflict", seq, err)
+		}
+	}
+	if err := m.AcceptSignature(ctx, "host-1", Signature{Sequence: 9, PublicKey: "k2"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("second key registration: got %v", err)
+	}
+	if err := m.AcceptSignature(ctx, "host-1", Signature{Sequence: 6}); err != nil {
+		t.Errorf("next sequence: %v", err)
+	}
+}
+
+func TestUploads(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := time.Now()
+
+	m.CreateUpload(ctx, Upload{ID: "u1", Owner: "host-1", ExpiresAt: now.Add(time.Hour)})
+	m.PutUploadPart(ctx, "u1", 2, []byte("b"), now)
+	m.PutUploadPart(ctx, "u1", 1, []byte("a"), now)
+	parts, _ := m.UploadParts(ctx, "u1")
+	if len(parts) != 2 || string(parts[0]) != "a" || string(parts[1]) != "b" {
+		t.Fatalf("parts = %q", parts)
+	}
+	if err := m.CompleteUpload(ctx, "u1", now); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if err := m.CompleteUpload(ctx, "u1", now); !errors.Is(err, ErrConflict) {
+		t.Fatalf("second complete: got %v", err)
+	}
+	if _, err := m.GetUpload(ctx, "u2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown upload: got %v", err)
+	}
+}
+
+func TestOpenPersists(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "db")
+
+	m, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: "host-1", Hostname: "web-1", OSID: "ubuntu"}, SeenAt: time.Now()})
+	m.ReplacePackages(ctx, "host-1", []models.Package{{Name: "openssl", Version: "3.0.2"}})
+	m.ReplaceCISResults(ctx, "host-1", []models.CISResult{{CheckID: "1.1", Status: "pass"}})
+	m.AcceptSignature(ctx, "host-1", Signature{Sequence: 3, PublicKey: "k"})
+	m.CreateUpload(ctx, Upload{ID: "u1", Owner: "host-1", ExpiresAt: time.Now().Add(time.Hour)})
+	m.PutUploadPart(ctx, "u1", 1, []byte("a"), time.Now())
+	m.PutPolicy(ctx, policy.Assigned{Policy: policy.Policy{ID: "p"}}, time.Now())
+	m.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: "host-2"}, SeenAt: time.Now()})
+	m.ReplacePackages(ctx, "host-2", []models.Package{{Name: "bash"}})
+	if err := m.DeleteHost(ctx, "host-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteHost(ctx, "host-2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("delete twice: %v", err)
+	}
+	stored, _ := m.PutPolicy(ctx, policy.Assigned{Policy: policy.Policy{ID: "p"}}, time.Now())
+	if stored.Policy.Version != 2 {
+		t.Fatalf("policy version = %d, want 2", stored.Policy.Version)
+	}
+
+	check := func(m *Memory) {
+		t.Helper()
+		host, err := m.GetHost(ctx, "host-1")
+		if err != nil || host.Hostname != "web-1" || host.FirstSeen == "" {
+			t.Fatalf("host = %+v, %v", host, err)
+		}
+		if pkgs, _ := m.HostPackages(ctx, "host-1"); len(pkgs) != 1 || pkgs[0].Name != "openssl" {
+			t.Errorf("packages = %+v", pkgs)
+		}
+		if results, _ := m.HostCISResults(ctx, "host-1"); len(results) != 1 || results[0].Evidence == nil {
+			t.Errorf("cis results = %+v", results)
+		}
+		if err := m.AcceptSignature(ctx, "host-1", Signature{Sequence: 3}); !errors.Is(err, ErrConflict) {
+			t.Errorf("sequence not persisted: got %v", err)
+		}
+		if parts, _ := m.UploadParts(ctx, "u1"); len(parts) != 1 || string(parts[0]) != "a" {
+			t.Errorf("upload parts = %q", parts)
+		}
+		if policies, _ := m.ListPolicies(ctx); len(policies) != 1 || policies[0].Policy.Version != 2 {
+			t.Errorf("policies = %+v", policies)
+		}
+		if _, err := m.GetHost(ctx, "host-2"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleted host: %v", err)
+		}
+		if pkgs, _ := m.HostPackages(ctx, "host-2"); len(pkgs) != 0 {
+			t.Errorf("deleted host's packages = %+v", pkgs)
+		}
+	}
+
+	// Reopened without Close, the state comes from the journal alone
+	m2, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(m2)
+	if err := m2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, journalFile)); err != nil || fi.Size() != 0 {
+		t.Fatalf("journal after close: %v, %v", fi, err)
+	}
+
+	m3, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m3.Close()
+	check(m3)
+}
+
+func TestTenants(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// A snapshot from before tenants belongs to the default tenant
+	os.WriteFile(filepath.Join(dir, snapshotFile), []byte(`{"hosts":{"old":{"host_id":"old","hostname":"legacy"}}}`), 0o600)
+	m, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host, err := m.GetHost(ctx, "old"); err != nil || host.Hostname != "legacy" {
+		t.Fatalf("legacy host = %+v, %v", host, err)
+	}
+
+	acme, globex := m.Tenant("acme"), m.Tenant("globex")
+	acme.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: "host-1", Hostname: "acme-web"}, SeenAt: time.Now()})
+	acme.ReplacePackages(ctx, "host-1", []models.Package{{Name: "openssl"}})
+	globex.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: "host-1", Hostname: "globex-db"}, SeenAt: time.Now()})
+	acme.PutPolicy(ctx, policy.Assigned{Policy: policy.Policy{ID: "p"}}, time.Now())
+	acme.CreateEnrollmentToken(ctx, EnrollmentToken{Hash: "t", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)})
+
+	check := func(m *Memory) {
+		t.Helper()
+		acme, globex := m.Tenant("acme"), m.Tenant("globex")
+		if host, err := acme.GetHost(ctx, "host-1"); err != nil || host.Hostname != "acme-web" || host.PackageCount != 1 {
+			t.Errorf("acme host = %+v, %v", host, err)
+		}
+		if host, err := globex.GetHost(ctx, "host-1"); err != nil || host.Hostname != "globex-db" || host.PackageCount != 0 {
+			t.Errorf("globex host = %+v, %v", host, err)
+		}
+		if hosts, _, _ := globex.ListHosts(ctx, HostQuery{}); len(hosts) != 1 {
+			t.Errorf("globex hosts = %+v", hosts)
+		}
+		if hosts, _, _ := m.ListHosts(ctx, HostQuery{}); len(hosts) != 1 || hosts[0].HostID != "old" {
+			t.Errorf("default hosts = %+v", hosts)
+		}
+		if pkgs, _, _ := globex.ListPackages(ctx, PackageQuery{}); len(pkgs) != 0 {
+			t.Errorf("globex packages = %+v", pkgs)
+		}
+		if policies, _ := globex.ListPolicies(ctx); len(policies) != 0 {
+			t.Errorf("globex policies = %+v", policies)
+		}
+		err := globex.Enroll(ctx, Enrollment{TokenHash: "t", HostID: "host-2", CredentialHash: "c", At: time.Now()})
+		if !errors.Is(err, ErrTokenInvalid) {
+			t.Errorf("enroll with another tenant's token: %v", err)
+		}
+	}
+	check(m)
+
+	m2, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(m2)
+	m2.Close()
+	m3, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m3.Close()
+	check(m3)
+}
+
+func TestOpenDiscardsTornEntry(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	m, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: "host-1"}, SeenAt: time.Now()})
+	f, _ := os.OpenFile(filepath.Join(dir, journalFile), os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"t":"hosts","k":"host-2","v":{"host_id"`)
+	f.Close()
+
+	m, err = Open(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer m.Close()
+	if _, err := m.GetHost(ctx, "host-1"); err != nil {
+		t.Errorf("host-1: %v", err)
+	}
+	if _, err := m.GetHost(ctx, "host-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("torn host-2: got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, journalFile), []byte("garbage\n{}\n"), 0o600)
+	if _, err := Open(dir); err == nil {
+		t.Error("corrupt journal accepted")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := time.Now()
+
+	m.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: "old"}, SeenAt: now.Add(-48 * time.Hour)})
+	m.ReplacePackages(ctx, "old", []models.Package{{Name: "bash"}})
+	m.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: "recent"}, SeenAt: now.Add(-48 * time.Hour)})
+	m.RecordHeartbeat(ctx, models.Heartbeat{HostID: "recent"}, now.Add(-time.Hour))
+	m.CreateEnrollmentToken(ctx, EnrollmentToken{Hash: "t", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)})
+
+	if n, err := m.Prune(ctx, now, 0); err != nil || n != 0 {
+		t.Fatalf("prune without retention = %d, %v", n, err)
+	}
+	if err := m.Enroll(ctx, Enrollment{TokenHash: "t", HostID: "x", At: now.Add(-90 * time.Minute)}); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("expired token survived prune: %v", err)
+	}
+
+	if n, err := m.Prune(ctx, now, 24*time.Hour); err != nil || n != 1 {
+		t.Fatalf("prune = %d, %v", n, err)
+	}
+	if _, err := m.GetHost(ctx, "old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("old host kept: %v", err)
+	}
+	if pkgs, _ := m.HostPackages(ctx, "old"); len(pkgs) != 0 {
+		t.Errorf("old packages kept: %+v", pkgs)
+	}
+	if _, err := m.GetHost(ctx, "recent"); err != nil {
+		t.Errorf("recent host removed: %v", err)
+	}
+}
+
+func TestReplaceCISResults(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	m.ReplaceCISResults(ctx, "host-1", []models.CISResult{{CheckID: "P1", Status: "fail"}, {CheckID: "P2", Status: "fail"}})
+	// P2 was dropped from the enabled checks
+	if err := m.ReplaceCISResults(ctx, "host-1", []models.CISResult{{CheckID: "P1", Status: "pass"}}); err != nil {
+		t.Fatal(err)
+	}
+	results, _ := m.HostCISResults(ctx, "host-1")
+	if len(results) != 1 || results[0].CheckID != "P1" || results[0].Status != "pass" || results[0].PreviousStatus != "fail" {
+		t.Errorf("results = %+v", results)
+	}
+}
+
+func TestListPages(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	for _, id := range []string{"h3", "h1", "h2", "h4"} {
+		os := "ubuntu"
+		if id == "h4" {
+			os = "rhel"
+		}
+		m.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: id, OSID: os}, SeenAt: time.Now()})
+		m.ReplacePackages(ctx, id, []models.Package{{Name: "bash"}, {Name: "openssl"}})
+		m.ReplaceCISResults(ctx, id, []models.CISResult{{CheckID: "P1", Status: "pass"}, {CheckID: "P2", Status: "fail"}})
+	}
+
+	var ids []string
+	token := ""
+	for pages := 0; ; pages++ {
+		hosts, next, err := m.ListHosts(ctx, HostQuery{OSID: "ubuntu", Limit: 2, NextToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, h := range hosts {
+			ids = append(ids, h.HostID)
+		}
+		if next == "" {
+			break
+		}
+		if pages > 3 {
+			t.Fatal("pagination does not end")
+		}
+		token = next
+	}
+	if fmt.Sprint(ids) != "[h1 h2 h3]" {
+		t.Errorf("paged hosts = %v", ids)
+	}
+
+	pkgs, next, _ := m.ListPackages(ctx, PackageQuery{Name: "openssl", Limit: 3})
+	if len(pkgs) != 3 || next == "" || pkgs[0].HostID != "h1" || pkgs[0].Name != "openssl" {
+		t.Errorf("openssl page = %+v, %q", pkgs, next)
+	}
+	pkgs, next, _ = m.ListPackages(ctx, PackageQuery{Name: "openssl", Limit: 3, NextToken: next})
+	if len(pkgs) != 1 || next != "" || pkgs[0].HostID != "h4" {
+		t.Errorf("openssl last page = %+v, %q", pkgs, next)
+	}
+
+	results, _, _ := m.ListCISResults(ctx, CISQuery{CheckID: "P2", Status: "fail"})
+	if len(results) != 4 || results[0].HostID != "h1" {
+		t.Errorf("failing P2 = %+v", results)
+	}
+	if results, _, _ := m.ListCISResults(ctx, CISQuery{HostID: "h2"}); len(results) != 2 {
+		t.Errorf("h2 results = %+v", results)
+	}
+
+	if _, _, err := m.ListHosts(ctx, HostQuery{NextToken: "%%"}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("bad token: got %v", err)
+	}
+}
+
+func TestListSorted(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	for i, name := range []string{"web-b", "db-a", "web-a", "web-c"} {
+		id := fmt.Sprintf("h%d", i)
+		m.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: id, Hostname: name}, SeenAt: time.Now()})
+	}
+	m.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: "h0", Hostname: "web-b", Tags: []string{"prod"}}, SeenAt: time.Now()})
+	m.SetUserTags(ctx, "h3", []string{"prod", "eu"})
+
+	var names []string
+	token := ""
+	for {
+		hosts, next, err := m.ListHosts(ctx, HostQuery{HostnamePrefix: "web", Sort: Sort{Field: "hostname", Desc: true}, Limit: 2, NextToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, h := range hosts {
+			names = append(names, h.Hostname)
+		}
+		if token = next; token == "" {
+			break
+		}
+	}
+	if fmt.Sprint(names) != "[web-c web-b web-a]" {
+		t.Errorf("sorted hosts = %v", names)
+	}
+
+	hosts, _, _ := m.ListHosts(ctx, HostQuery{Tag: "prod", Sort: Sort{Field: "hostname"}})
+	if len(hosts) != 2 || hosts[0].HostID != "h0" || hosts[1].HostID != "h3" {
+		t.Errorf("prod hosts = %+v", hosts)
+	}
+}
+
+func TestTagsAndGroups(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	m, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: "h1", Hostname: "web-1", OSID: "ubuntu", Tags: []string{"env:prod"}}, SeenAt: time.Now()})
+	m.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: "h2", Hostname: "web-2", OSID: "ubuntu", Tags: []string{"env:dev"}}, SeenAt: time.Now()})
+	m.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: "h3", Hostname: "db-1", OSID: "rhel", Tags: []string{"env:prod"}}, SeenAt: time.Now()})
+	for _, id := range []string{"h1", "h2", "h3"} {
+		m.ReplacePackages(ctx, id, []models.Package{{Name: "openssl"}})
+	}
+
+	// User tags survive ingests, and ingests without tags keep the agent's
+	if _, err := m.SetUserTags(ctx, "h2", []string{"team:web"}); err != nil {
+		t.Fatal(err)
+	}
+	m.UpsertHost(ctx, HostUpdate{Host: models.Host{HostID: "h2", Hostname: "web-2", OSID: "ubuntu"}, SeenAt: time.Now()})
+	h, _ := m.GetHost(ctx, "h2")
+	if fmt.Sprint(h.Tags) != "[env:dev team:web]" || fmt.Sprint(h.UserTags) != "[team:web]" {
+		t.Errorf("h2 tags = %v, user tags = %v", h.Tags, h.UserTags)
+	}
+	if _, err := m.SetUserTags(ctx, "nope", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("tagging unknown host: got %v", err)
+	}
+
+	web := Group{ID: "prod-web", Rules: []Rule{
+		{Field: "tag", Op: "eq", Value: "env:prod"},
+		{Field: "hostname", Op: "glob", Value: "web-*"},
+	}}
+	if err := web.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.PutGroup(ctx, web, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	m.Close()
+
+	m, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	groups, _ := m.ListGroups(ctx)
+	if len(groups) != 1 || groups[0].ID != "prod-web" || groups[0].UpdatedAt == "" {
+		t.Fatalf("groups after reopen = %+v", groups)
+	}
+	hosts, _, _ := m.ListHosts(ctx, HostQuery{Group: &groups[0]})
+	if len(hosts) != 1 || hosts[0].HostID != "h1" {
+		t.Errorf("prod-web members = %+v", hosts)
+	}
+	if got := MemberOf(groups, &hosts[0]); fmt.Sprint(got) != "[prod-web]" {
+		t.Errorf("h1 groups = %v", got)
+	}
+	pkgs, _, _ := m.ListPackages(ctx, PackageQuery{HostIDs: map[string]bool{"h1": true, "h3": true}})
+	if len(pkgs) != 2 || pkgs[0].HostID != "h1" || pkgs[1].HostID != "h3" {
+		t.Errorf("packages of h1 and h3 = %+v", pkgs)
+	}
+	if pkgs, _, _ := m.ListPackages(ctx, PackageQuery{HostIDs: map[string]bool{}}); len(pkgs) != 0 {
+		t.Errorf("packages of no hosts = %+v", pkgs)
+	}
+
+	if err := m.DeleteGroup(ctx, "prod-web"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteGroup(ctx, "prod-web"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second delete: got %v", err)
+	}
+
+	for _, g := range []Group{
+		{ID: "Prod", Rules: web.Rules},
+		{ID: "empty"},
+		{ID: "bad-field", Rules: []Rule{{Field: "owner", Op: "eq", Value: "x"}}},
+		{ID: "bad-op", Rules: []Rule{{Field: "os_id", Op: "like", Value: "x"}}},
+		{ID: "bad-glob", Rules: []Rule{{Field: "hostname", Op: "glob", Value: "web-["}}},
+	} {
+		if err := g.Validate(); err == nil {
+			t.Errorf("group %s: accepted", g.ID)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package store
+
+import (
+	"encoding/base64"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+)
+
+// Lists are paged. Each List method returns at most Limit items (all of
+// them when Limit is 0) and a token for the next page, empty on the last
+// one. Pass the token back as NextToken with the same filters and Sort to
+// continue. A page may hold fewer than Limit items even when more follow.
+//
+// Empty filter fields match everything.
+
+// Sort orders a list by one of the fields its query allows, descending when
+// Desc. The zero Sort keeps the store's natural order, by host and then by
+// item, which also breaks ties between equal field values.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Fields each list can be sorted by, named as in the API.
+var (
+	HostSortFields    = []string{"host_id", "hostname", "os_id", "agent_version", "last_seen"}
+	PackageSortFields = []string{"host_id", "name", "version", "manager"}
+	CISSortFields     = []string{"host_id", "check_id", "status"}
+)
+
+// HostQuery selects hosts.
+type HostQuery struct {
+	OSID           string
+	AgentVersion   string
+	HostnamePrefix string
+	Tag            string
+	// Group, when set, selects the group's members.
+	Group *Group
+	// LastSeenBefore, when set, selects hosts whose last full payload is
+	// older, including hosts that never sent one.
+	LastSeenBefore time.Time
+	Sort           Sort
+	Limit          int
+	NextToken      string
+}
+
+// Matches reports whether h passes every filter of q.
+func (q HostQuery) Matches(h *Host) bool {
+	if (q.OSID != "" && h.OSID != q.OSID) ||
+		(q.AgentVersion != "" && h.AgentVersion != q.AgentVersion) ||
+		!strings.HasPrefix(h.Hostname, q.HostnamePrefix) ||
+		(q.Tag != "" && !slices.Contains(h.Tags, q.Tag)) ||
+		(q.Group != nil && !q.Group.Matches(&h.Host)) {
+		return false
+	}
+	if !q.LastSeenBefore.IsZero() {
+		seen, err := time.Parse(time.RFC3339, h.LastSeen)
+		return err != nil || seen.Before(q.LastSeenBefore)
+	}
+	return true
+}
+
+// PackageQuery selects packages from the current inventories.
+type PackageQuery struct {
+	HostID string
+	// HostIDs, when not nil, selects the packages of these hosts only, such
+	// as the members of a group.
+	HostIDs   map[string]bool
+	Name      string
+	Version   string
+	Manager   string
+	Sort      Sort
+	Limit     int
+	NextToken string
+}
+
+// Matches reports whether pkg, with its HostID set, passes every filter of
+// q.
+func (q PackageQuery) Matches(pkg models.Package) bool {
+	return (q.HostID == "" || pkg.HostID == q.HostID) &&
+		(q.HostIDs == nil || q.HostIDs[pkg.HostID]) &&
+		(q.Name == "" || pkg.Name == q.Name) &&
+		(q.Version == "" || pkg.Version == q.Version) &&
+		(q.Manager == "" || pkg.Manager == q.Manager)
+}
+
+// CISQuery selects CIS results.
+type CISQuery struct {
+	HostID string
+	// HostIDs, when not nil, selects the results of these hosts only.
+	HostIDs   map[string]bool
+	CheckID   string
+	Status    string
+	Sort      Sort
+	Limit     int
+	NextToken string
+}
+
+// Matches reports whether r, with its HostID set, passes every filter of q.
+func (q CISQuery) Matches(r models.CISResult) bool {
+	return (q.HostID == "" || r.HostID == q.HostID) &&
+		(q.HostIDs == nil || q.HostIDs[r.HostID]) &&
+		(q.CheckID == "" || r.CheckID == q.CheckID) &&
+		(q.Status == "" || r.Status == q.Status)
+}
+
+// CarryStatus fills in r's history from old, the stored result it replaces
+// (nil for a check reported for the first time).
+func CarryStatus(r *models.CISResult, old *models.CISResult) {
+	switch {
+	case old == nil:
+		r.PreviousStatus, r.StatusChangedAt = "", r.Timestamp
+	case old.Status != r.Status:
+		r.PreviousStatus, r.StatusChangedAt = old.Status, r.Timestamp
+	default:
+		r.PreviousStatus, r.StatusChangedAt = old.PreviousStatus, old.StatusChangedAt
+	}
+}
+
+// SortKey is the key that orders an item with field value under s before
+// its natural key.
+func SortKey(s Sort, value, natural string) string {
+	if s.Field == "" {
+		return natural
+	}
+	return value + "\x00" + natural
+}
+
+// Page sorts keys as s asks and returns the page after token, mapped
+// through get. Tokens are the last key of the previous page.
+func Page[T any](keys []string, s Sort, limit int, token string, get func(key string) T) ([]T, string, error) {
+	sort.Strings(keys)
+	if s.Desc {
+		slices.Reverse(keys)
+	}
+	if token != "" {
+		b, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return nil, "", ErrInvalidToken
+		}
+		after := string(b)
+		keys = keys[sort.Search(len(keys), func(i int) bool {
+			if s.Desc {
+				return keys[i] < after
+			}
+			return keys[i] > after
+		}):]
+	}
+	next := ""
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		next = base64.RawURLEncoding.EncodeToString([]byte(keys[limit-1]))
+	}
+	items := make([]T, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, get(key))
+	}
+	return items, next, nil
+}
+
+func hostSortValue(h *Host, field string) string {
+	switch field {
+	case "hostname":
+		return h.Hostname
+	case "os_id":
+		return h.OSID
+	case "agent_version":
+		return h.AgentVersion
+	case "last_seen":
+		return h.LastSeen
+	}
+	return h.HostID
+}
+
+func packageSortValue(pkg models.Package, field string) string {
+	switch field {
+	case "name":
+		return pkg.Name
+	case "version":
+		return pkg.Version
+	case "manager":
+		return pkg.Manager
+	}
+	return pkg.HostID
+}
+
+func cisSortValue(r models.CISResult, field string) string {
+	switch field {
+	case "check_id":
+		return r.CheckID
+	case "status":
+		return r.Status
+	}
+	return r.HostID
+}
@@ -0,0 +1,245 @@
+// Package store defines where the backend keeps hosts, inventories,
+// credentials, uploads and policies, with DynamoDB (package dynamo), on-disk
+// and in-memory implementations. The API handlers only talk to Store, so the
+// same code serves Lambda and the standalone server.
+package store
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/visiblaze/sec-agent/backend/internal/models"
+	"github.com/visiblaze/sec-agent/pkg/policy"
+	"github.com/visiblaze/sec-agent/pkg/upload"
+)
+
+var (
+	// ErrNotFound is returned for a host, upload or other record that does
+	// not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a conditional write loses, such as a
+	// replayed signature sequence or an upload completed twice.
+	ErrConflict = errors.New("conflict")
+	// ErrTokenInvalid is returned by Enroll for an unknown, expired or
+	// already used enrollment token.
+	ErrTokenInvalid = errors.New("enrollment token is invalid, expired or already used")
+	// ErrAlreadyEnrolled is returned by Enroll for a host that still holds a
+	// credential.
+	ErrAlreadyEnrolled = errors.New("host is already enrolled")
+	// ErrInvalidToken is returned by the List methods for a NextToken they
+	// did not issue.
+	ErrInvalidToken = errors.New("invalid next_token")
+)
+
+// Store is everything the API persists. Implementations are safe for
+// concurrent use.
+type Store interface {
+	HostStore
+	CredentialStore
+	InventoryStore
+	UploadStore
+	PolicyStore
+	GroupStore
+}
+
+// DefaultTenant is the tenant of data written before tenants existed, and
+// of callers that are not configured with one.
+const DefaultTenant = "default"
+
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// ValidTenantID reports whether id may name a tenant: lower case letters,
+// digits and dashes, so it can be joined into keys and credentials.
+func ValidTenantID(id string) bool {
+	return tenantPattern.MatchString(id)
+}
+
+// Tenants partitions a Store by tenant. Nothing written through one tenant's
+// Store can be read or changed through another's.
+type Tenants interface {
+	// Tenant returns the Store of the tenant id, which must be valid.
+	Tenant(id string) Store
+}
+
+// Host is a stored host: its API view plus the inventory kept alongside it.
+// Liveness Status and Groups are derived by the caller and never stored.
+// Tags is derived too, as the union of AgentTags and UserTags.
+type Host struct {
+	models.Host
+	// AgentTags are the tags the host's agent last reported.
+	AgentTags    []string                   `json:"agent_tags,omitempty"`
+	Containers   *models.ContainerInventory `json:"containers,omitempty"`
+	Remediations []models.RemediationResult `json:"remediations,omitempty"`
+}
+
+// HostUpdate is what an ingest records on a host.
+type HostUpdate struct {
+	// Host carries the identity, OS and agent fields and the agent's tags;
+	// nil Tags leave the stored ones unchanged. Liveness fields and
+	// UserTags are ignored.
+	Host   models.Host
+	SeenAt time.Time
+	// Containers replaces the container inventory; nil leaves it unchanged.
+	Containers *models.ContainerInventory
+	// Remediations replaces the last remediation results; empty leaves them
+	// unchanged.
+	Remediations []models.RemediationResult
+}
+
+// HostStore keeps host records.
+type HostStore interface {
+	// UpsertHost records an ingest, creating the host on first contact.
+	UpsertHost(ctx context.Context, u HostUpdate) error
+	// RecordHeartbeat records a heartbeat, creating the host on first
+	// contact, and returns the updated host.
+	RecordHeartbeat(ctx context.Context, hb models.Heartbeat, at time.Time) (*Host, error)
+	// GetHost returns ErrNotFound for an unknown host.
+	GetHost(ctx context.Context, hostID string) (*Host, error)
+	// ListHosts returns a page of hosts and the next token.
+	ListHosts(ctx context.Context, q HostQuery) ([]models.Host, string, error)
+	// DeleteHost removes a host with its credential, package inventory and
+	// CIS results. It returns ErrNotFound for an unknown host. An agent
+	// that reports again recreates the host, without a credential.
+	DeleteHost(ctx context.Context, hostID string) error
+	// RevokeCertificate adds a certificate serial to the host's revocation
+	// list. It returns ErrNotFound for an unknown host.
+	RevokeCertificate(ctx context.Context, hostID, serial string) error
+	// CertificateRevoked reports whether serial was revoked for the host.
+	CertificateRevoked(ctx context.Context, hostID, serial string) (bool, error)
+	// SetUserTags replaces the tags assigned to the host through the API
+	// and returns the updated host. It returns ErrNotFound for an unknown
+	// host.
+	SetUserTags(ctx context.Context, hostID string, tags []string) (*Host, error)
+}
+
+// Credential holds the hashes of a host's enrolled credential. After an
+// agent rotates its own credential, PreviousHash stays valid until the new
+// one is first used.
+type Credential struct {
+	Hash         string `json:"hash,omitempty"`
+	PreviousHash string `json:"previous_hash,omitempty"`
+}
+
+// EnrollmentToken is a one-time enrollment token, stored by hash.
+type EnrollmentToken struct {
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Note      string    `json:"note,omitempty"`
+}
+
+// Enrollment exchanges an enrollment token for a host credential.
+type Enrollment struct {
+	TokenHash      string
+	HostID         string
+	Hostname       string // recorded unless the host already has one
+	CredentialHash string
+	// PublicKey, when set, replaces the host's signing key and restarts its
+	// sequence.
+	PublicKey string
+	At        time.Time
+}
+
+// Signature is an accepted payload signature, kept as an audit trail.
+type Signature struct {
+	Sequence  uint64
+	Signature string
+	Message   string
+	// PublicKey registers the host's signing key on first use. It is empty
+	// when the host already has one.
+	PublicKey string
+}
+
+// CredentialStore keeps per-host credentials, enrollment tokens and signing
+// state.
+type CredentialStore interface {
+	CreateEnrollmentToken(ctx context.Context, t EnrollmentToken) error
+	// Enroll spends the token and issues the credential atomically. It
+	// returns ErrTokenInvalid or ErrAlreadyEnrolled when either is refused.
+	Enroll(ctx context.Context, e Enrollment) error
+	// Credential returns the host's credential; it is zero for a host that
+	// is unknown or not enrolled.
+	Credential(ctx context.Context, hostID string) (Credential, error)
+	// PromoteCredential forgets the previous credential once hash, the
+	// current one, has been used. It does nothing if hash is no longer
+	// current.
+	PromoteCredential(ctx context.Context, hostID, hash string) error
+	// RotateCredential replaces the host's credential with hash. With
+	// keepPrevious the old credential stays valid until the new one is used.
+	// It returns ErrNotFound for a host that is not enrolled.
+	RotateCredential(ctx context.Context, hostID, hash string, at time.Time, keepPrevious bool) error
+	// RevokeCredential removes the host's credential. It returns ErrNotFound
+	// for an unknown host.
+	RevokeCredential(ctx context.Context, hostID string, at time.Time) error
+	// SigningKey returns the host's registered signing key, or "".
+	SigningKey(ctx context.Context, hostID string) (string, error)
+	// AcceptSignature records sig when its sequence is above the last one
+	// accepted for the host, registering sig.PublicKey if set and none is
+	// registered yet. Otherwise it returns ErrConflict.
+	AcceptSignature(ctx context.Context, hostID string, sig Signature) error
+}
+
+// InventoryStore keeps package inventories and CIS results.
+type InventoryStore interface {
+	// ReplacePackages replaces the host's package inventory.
+	ReplacePackages(ctx context.Context, hostID string, packages []models.Package) error
+	HostPackages(ctx context.Context, hostID string) ([]models.Package, error)
+	// ListPackages returns a page of packages and the next token.
+	ListPackages(ctx context.Context, q PackageQuery) ([]models.Package, string, error)
+	// SoftwareCatalog returns the entries of the software catalog of the
+	// current inventories that match q, ordered by name and manager.
+	SoftwareCatalog(ctx context.Context, q SoftwareQuery) ([]models.SoftwareEntry, error)
+	// ReplaceCISResults records the results of a full CIS run of the host,
+	// removing those of checks the run no longer includes.
+	ReplaceCISResults(ctx context.Context, hostID string, results []models.CISResult) error
+	HostCISResults(ctx context.Context, hostID string) ([]models.CISResult, error)
+	// ListCISResults returns a page of results and the next token.
+	ListCISResults(ctx context.Context, q CISQuery) ([]models.CISResult, string, error)
+}
+
+// Upload is a multi-part upload session.
+type Upload struct {
+	ID string `json:"id"`
+	upload.Session
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Completed bool      `json:"completed"`
+}
+
+// UploadStore keeps multi-part upload sessions and their parts. Expired
+// sessions may linger until cleaned up, so callers check ExpiresAt.
+type UploadStore interface {
+	CreateUpload(ctx context.Context, u Upload) error
+	// GetUpload returns ErrNotFound for an unknown session.
+	GetUpload(ctx context.Context, uploadID string) (*Upload, error)
+	// PutUploadPart stores or replaces a part, numbered from 1.
+	PutUploadPart(ctx context.Context, uploadID string, part int, data []byte, expires time.Time) error
+	// UploadParts returns the stored parts in order.
+	UploadParts(ctx context.Context, uploadID string) ([][]byte, error)
+	// CompleteUpload closes the session. It returns ErrConflict if it was
+	// already completed.
+	CompleteUpload(ctx context.Context, uploadID string, at time.Time) error
+	// DeleteUploadParts removes the part data of a completed session.
+	DeleteUploadParts(ctx context.Context, uploadID string, parts int) error
+}
+
+// PolicyStore keeps policies and their assignments.
+type PolicyStore interface {
+	// PutPolicy creates or replaces a policy, bumping its version, and
+	// returns it as stored.
+	PutPolicy(ctx context.Context, p policy.Assigned, at time.Time) (policy.Assigned, error)
+	ListPolicies(ctx context.Context) ([]policy.Assigned, error)
+}
+
+// GroupStore keeps group definitions. Membership is never stored; callers
+// evaluate it with Group.Matches.
+type GroupStore interface {
+	// PutGroup creates or replaces a group and returns it as stored.
+	PutGroup(ctx context.Context, g Group, at time.Time) (Group, error)
+	// ListGroups returns every group, ordered by ID.
+	ListGroups(ctx context.Context) ([]Group, error)
+	// DeleteGroup returns ErrNotFound for an unknown group.
+	DeleteGroup(ctx context.Context, groupID string) error
+}
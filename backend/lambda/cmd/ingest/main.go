@@ -2,99 +2,172 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 
-	"github.com/visiblaze/sec-agent/backend/lambda/internal/handlers"
+	"github.com/visiblaze/sec-agent/backend/internal/api"
+	"github.com/visiblaze/sec-agent/backend/internal/apigw"
+	"github.com/visiblaze/sec-agent/backend/internal/oidc"
+	"github.com/visiblaze/sec-agent/backend/internal/store"
+	"github.com/visiblaze/sec-agent/backend/internal/store/dynamo"
+	"github.com/visiblaze/sec-agent/pkg/liveness"
+	"github.com/visiblaze/sec-agent/pkg/policy"
 )
 
-var (
-	dynamoClient *dynamodb.Client
-	apiKey       string
-)
+var serve func(context.Context, events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error)
 
 func init() {
 	cfg, _ := config.LoadDefaultConfig(context.Background())
-	dynamoClient = dynamodb.NewFromConfig(cfg)
-	apiKey = os.Getenv("API_KEY")
-}
-
-func handler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	// Debug logging
-	log.Printf("Request received: Method=%s, RawPath=%s, Path=%s", request.RequestContext.HTTP.Method, request.RawPath, request.RequestContext.HTTP.Path)
-
-	// Strip stage prefix from path for routing
-	path := request.RawPath
-	if stage := request.RequestContext.Stage; stage != "" && stage != "$default" {
-		stagePrefix := "/" + stage
-		if len(path) > len(stagePrefix) && path[:len(stagePrefix)] == stagePrefix {
-			path = path[len(stagePrefix):]
+	server := &api.Server{
+		Store:             dynamo.New(dynamodb.NewFromConfig(cfg), dynamo.TablesFromEnv()),
+		APIKey:            os.Getenv("API_KEY"),
+		AuthMode:          os.Getenv("AUTH_MODE"),
+		RequireSignatures: os.Getenv("REQUIRE_SIGNATURES") == "true",
+		Liveness:          liveness.Default,
+	}
+	if server.AuthMode == "" {
+		server.AuthMode = api.AuthAPIKey
+	}
+	if v := os.Getenv("API_TOKENS"); v != "" {
+		if err := json.Unmarshal([]byte(v), &server.Tokens); err != nil {
+			log.Fatalf("API_TOKENS: %v", err)
+		}
+		for _, t := range server.Tokens {
+			if !api.ValidUserRole(t.Role) {
+				log.Fatalf("API_TOKENS: token %s has invalid role %q", t.Name, t.Role)
+			}
 		}
 	}
-	log.Printf("Stripped path: %s", path)
-
-	// CORS headers
-	headers := map[string]string{
-		"Content-Type":                 "application/json",
-		"Access-Control-Allow-Origin":  "*",
-		"Access-Control-Allow-Methods": "GET,POST,OPTIONS",
-		"Access-Control-Allow-Headers": "Content-Type,X-API-Key",
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		verifier, err := oidc.NewVerifier(oidc.Config{
+			Issuer:   issuer,
+			Audience: os.Getenv("OIDC_AUDIENCE"),
+			JWKSURL:  os.Getenv("OIDC_JWKS_URL"),
+		})
+		if err != nil {
+			log.Fatalf("OIDC_*: %v", err)
+		}
+		server.OIDC = verifier
+		server.OIDCRoleClaim = os.Getenv("OIDC_ROLE_CLAIM")
+		server.OIDCTenantClaim = os.Getenv("OIDC_TENANT_CLAIM")
 	}
-
-	// Handle OPTIONS
-	if request.RequestContext.HTTP.Method == "OPTIONS" {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 200,
-			Headers:    headers,
-		}, nil
+	if v := os.Getenv("ALLOWED_ORIGINS"); v != "" {
+		server.AllowedOrigins = strings.Split(v, ",")
 	}
-
-	// Validate API key for write operations
-	if request.RequestContext.HTTP.Method == "POST" {
-		log.Printf("Validating API key for POST request")
-		log.Printf("Available headers: %v", request.Headers)
-		key := request.Headers["x-api-key"]
-		log.Printf("Received API key: %s", key)
-		log.Printf("Expected API key: %s", apiKey)
-		if key != apiKey {
-			log.Printf("API key validation failed")
-			return events.APIGatewayV2HTTPResponse{
-				StatusCode: 401,
-				Headers:    headers,
-				Body:       `{"error":"Unauthorized"}`,
-			}, nil
+	if pemKey := os.Getenv("POLICY_SIGNING_KEY"); pemKey != "" {
+		key, err := policy.ParsePrivateKey(pemKey)
+		if err != nil {
+			log.Fatalf("POLICY_SIGNING_KEY: %v", err)
+		}
+		server.PolicySigningKey = key
+	}
+	for env, threshold := range map[string]*time.Duration{
+		"HOST_STALE_AFTER":   &server.Liveness.StaleAfter,
+		"HOST_OFFLINE_AFTER": &server.Liveness.OfflineAfter,
+	} {
+		if v := os.Getenv(env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				log.Fatalf("%s: %v", env, err)
+			}
+			*threshold = d
+		}
+	}
+	if err := server.Liveness.Validate(); err != nil {
+		log.Fatalf("HOST_STALE_AFTER/HOST_OFFLINE_AFTER: %v", err)
+	}
+	if v := os.Getenv("TENANTS"); v != "" {
+		tenants, err := parseTenants(v, server.Liveness)
+		if err != nil {
+			log.Fatalf("TENANTS: %v", err)
 		}
-		log.Printf("API key validation passed")
+		server.Tenants = tenants
 	}
+	known := map[string]bool{"": true, store.DefaultTenant: true}
+	for _, t := range server.Tenants {
+		known[t.ID] = true
+	}
+	for _, t := range server.Tokens {
+		if !known[t.Tenant] {
+			log.Fatalf("API_TOKENS: token %s has unknown tenant %q", t.Name, t.Tenant)
+		}
+	}
+
+	serve = apigw.Handler(logRequests(server.Handler()))
+}
 
-	// Route
-	switch {
-	case request.RequestContext.HTTP.Method == "POST" && (path == "/ingest" || path == "/ingest/"):
-		return handlers.IngestHandler(ctx, request, dynamoClient, headers)
-	case request.RequestContext.HTTP.Method == "GET" && path == "/hosts":
-		return handlers.HostsListHandler(ctx, request, dynamoClient, headers)
-	case request.RequestContext.HTTP.Method == "GET" && request.PathParameters["hostId"] != "":
-		return handlers.HostDetailHandler(ctx, request, dynamoClient, headers)
-	case request.RequestContext.HTTP.Method == "GET" && path == "/apps":
-		return handlers.PackagesHandler(ctx, request, dynamoClient, headers)
-	case request.RequestContext.HTTP.Method == "GET" && path == "/cis-results":
-		return handlers.CISResultsHandler(ctx, request, dynamoClient, headers)
-	case request.RequestContext.HTTP.Method == "GET" && path == "/health":
-		return handlers.HealthHandler(ctx, request, headers)
-	default:
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 404,
-			Headers:    headers,
-			Body:       `{"error":"Not found"}`,
-		}, nil
+// tenantEnv is one entry of the TENANTS variable, written by Terraform.
+type tenantEnv struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	APIKey            string `json:"api_key"`
+	RequireSignatures *bool  `json:"require_signatures"`
+	StaleAfter        string `json:"stale_after"`
+	OfflineAfter      string `json:"offline_after"`
+}
+
+// parseTenants decodes TENANTS, applying each tenant's liveness durations
+// over base.
+func parseTenants(v string, base liveness.Thresholds) ([]api.Tenant, error) {
+	var entries []tenantEnv
+	if err := json.Unmarshal([]byte(v), &entries); err != nil {
+		return nil, err
 	}
+	seen := map[string]bool{}
+	tenants := make([]api.Tenant, 0, len(entries))
+	for _, e := range entries {
+		switch {
+		case !store.ValidTenantID(e.ID):
+			return nil, fmt.Errorf("invalid tenant id %q", e.ID)
+		case seen[e.ID]:
+			return nil, fmt.Errorf("tenant %s listed twice", e.ID)
+		case e.ID == store.DefaultTenant && e.APIKey != "":
+			return nil, fmt.Errorf("the default tenant's agent key is API_KEY")
+		}
+		seen[e.ID] = true
+		t := api.Tenant{ID: e.ID, Name: e.Name, AgentKey: e.APIKey, RequireSignatures: e.RequireSignatures}
+		if e.StaleAfter != "" || e.OfflineAfter != "" {
+			l := base
+			for _, f := range []struct {
+				raw       string
+				threshold *time.Duration
+			}{{e.StaleAfter, &l.StaleAfter}, {e.OfflineAfter, &l.OfflineAfter}} {
+				if f.raw == "" {
+					continue
+				}
+				d, err := time.ParseDuration(f.raw)
+				if err != nil {
+					return nil, fmt.Errorf("tenant %s: %w", e.ID, err)
+				}
+				*f.threshold = d
+			}
+			if err := l.Validate(); err != nil {
+				return nil, fmt.Errorf("tenant %s: %w", e.ID, err)
+			}
+			t.Liveness = &l
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, nil
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Request received: Method=%s, Path=%s", r.Method, r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(serve)
 }
@@ -120,16 +120,16 @@ build_frontend() {
     fi
 }
 
-# Step 6: Test with mock server (local only)
+# Step 6: Test with the standalone server (local only)
 test_local() {
-    log_info "Starting mock ingest server..."
+    log_info "Starting visiblaze-server..."
     
-    cd "$REPO_ROOT/backend/mock"
+    cd "$REPO_ROOT"
     
-    go run . &
-    MOCK_PID=$!
+    go run ./backend/cmd/visiblaze-server -config backend/config.local.yaml &
+    SERVER_PID=$!
     
-    log_info "Mock server running (PID: $MOCK_PID)"
+    log_info "Server running (PID: $SERVER_PID)"
     
     sleep 2
     
@@ -155,7 +155,7 @@ test_local() {
 # Main
 case "${1:-local}" in
     local)
-        log_info "Running LOCAL deployment (mock server + frontend dev)"
+        log_info "Running LOCAL deployment (visiblaze-server + frontend dev)"
         build_agent
         test_local
         ;;
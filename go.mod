@@ -6,7 +6,10 @@ require (
 	github.com/aws/aws-lambda-go v1.50.0
 	github.com/aws/aws-sdk-go-v2/config v1.31.20
 	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.52.6
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.17.11
+	github.com/robfig/cron/v3 v3.0.1
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -24,10 +27,6 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.35.7 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.40.2 // indirect
 	github.com/aws/smithy-go v1.23.2 // indirect
+	golang.org/x/sys v0.4.0 // indirect
 )
 
-// This fixes your local handlers path
-replace github.com/visiblaze/sec-agent/backend/lambda/internal/handlers => ./backend/lambda/internal/handlers
-
-// This fixes your local models path
-replace github.com/visiblaze/sec-agent/backend/lambda/internal/models => ./backend/lambda/internal/models
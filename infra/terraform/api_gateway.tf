@@ -4,9 +4,9 @@ resource "aws_apigatewayv2_api" "main" {
   protocol_type = "HTTP"
   api_key_selection_expression = "$request.header.x-api-key"  
   cors_configuration {
-    allow_origins = ["*"]
+    allow_origins = var.allowed_origins
     allow_methods = ["GET", "POST", "PUT", "DELETE", "OPTIONS"]
-    allow_headers = ["Content-Type", "X-API-Key"]
+    allow_headers = ["Content-Type", "Content-Encoding", "X-API-Key", "Authorization", "X-Host-ID"]
     expose_headers = ["Content-Type"]
   }
 }
@@ -56,6 +56,84 @@ resource "aws_apigatewayv2_route" "ingest" {
   depends_on = [aws_apigatewayv2_integration.lambda]
 }
 
+resource "aws_apigatewayv2_route" "heartbeat" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "POST /heartbeat"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "ingest_sbom" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "POST /ingest/sbom"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "ingest_upload_create" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "POST /ingest/uploads"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "ingest_upload_part" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "POST /ingest/uploads/{uploadId}/parts/{part}"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "ingest_upload_complete" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "POST /ingest/uploads/{uploadId}/complete"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "enroll" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "POST /enroll"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "enrollment_tokens" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "POST /enrollment-tokens"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "policies_put" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "POST /policies"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "policies_list" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "GET /policies"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "groups_put" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "POST /groups"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "groups_list" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "GET /groups"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "group_delete" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "DELETE /groups/{groupId}"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "agent_config" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "GET /agent-config"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
 resource "aws_apigatewayv2_route" "hosts_list" {
   api_id       = aws_apigatewayv2_api.main.id
   route_key    = "GET /hosts"
@@ -68,6 +146,48 @@ resource "aws_apigatewayv2_route" "host_detail" {
   target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
 }
 
+resource "aws_apigatewayv2_route" "host_packages" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "GET /hosts/{hostId}/packages"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "host_tags" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "POST /hosts/{hostId}/tags"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "host_delete" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "DELETE /hosts/{hostId}"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "host_sbom" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "GET /hosts/{hostId}/sbom"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "host_cert_revoke" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "POST /hosts/{hostId}/certificates/revoke"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "host_credential_rotate" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "POST /hosts/{hostId}/credentials/rotate"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "host_credential_revoke" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "POST /hosts/{hostId}/credentials/revoke"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
 resource "aws_apigatewayv2_route" "packages" {
   api_id       = aws_apigatewayv2_api.main.id
   route_key    = "GET /apps"
@@ -80,10 +200,54 @@ resource "aws_apigatewayv2_route" "cis_results" {
   target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
 }
 
+resource "aws_apigatewayv2_route" "software" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "GET /software"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
+resource "aws_apigatewayv2_route" "software_hosts" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "GET /software/hosts"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
 resource "aws_apigatewayv2_route" "health" {
   api_id       = aws_apigatewayv2_api.main.id
   route_key    = "GET /health"
   target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
 }
 
+resource "aws_apigatewayv2_route" "openapi" {
+  api_id       = aws_apigatewayv2_api.main.id
+  route_key    = "GET /openapi.yaml"
+  target       = "integrations/${aws_apigatewayv2_integration.lambda.id}"
+}
+
 # API Key for agent auth
+
+# Optional mutual TLS custom domain. API Gateway verifies agent certificates
+# against the truststore and forwards the PEM to the Lambda, which binds it
+# to the host_id. The default execute-api endpoint should be disabled when
+# mTLS is enforced.
+resource "aws_apigatewayv2_domain_name" "mtls" {
+  count       = var.mtls_domain_name != "" ? 1 : 0
+  domain_name = var.mtls_domain_name
+
+  domain_name_configuration {
+    certificate_arn = var.mtls_certificate_arn
+    endpoint_type   = "REGIONAL"
+    security_policy = "TLS_1_2"
+  }
+
+  mutual_tls_authentication {
+    truststore_uri = var.mtls_truststore_uri
+  }
+}
+
+resource "aws_apigatewayv2_api_mapping" "mtls" {
+  count       = var.mtls_domain_name != "" ? 1 : 0
+  api_id      = aws_apigatewayv2_api.main.id
+  domain_name = aws_apigatewayv2_domain_name.mtls[0].id
+  stage       = aws_apigatewayv2_stage.prod.id
+}
@@ -1,9 +1,31 @@
+# Every table is partitioned by tenant: hosts, packages and CIS results are
+# keyed by tenant_host ("<tenant>#<host>"), so each host is its own
+# partition; policies and groups by tenant_id first; index hash keys carry
+# the tenant too. The tables keyed by tenant are named vis_tenant_* so they
+# are created next to the tables of earlier versions instead of replacing
+# them; see "Upgrading to tenants" in README.md for copying the data over.
+#
+# Tables holding credentials and inventories cannot be destroyed by an
+# apply; remove prevent_destroy first to really delete them.
+
 # Hosts Table
+# Heartbeats rewrite host items, so the indexes project keys only and are
+# not written to by them; readers fetch the items by key.
 resource "aws_dynamodb_table" "hosts" {
-  name           = "vis_hosts"
+  name           = "vis_tenant_hosts"
   billing_mode   = "PAY_PER_REQUEST"
-  hash_key       = "host_id"
-  
+  hash_key       = "tenant_host"
+
+  attribute {
+    name = "tenant_host"
+    type = "S"
+  }
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
   attribute {
     name = "host_id"
     type = "S"
@@ -14,10 +36,32 @@ resource "aws_dynamodb_table" "hosts" {
     type = "S"
   }
 
+  attribute {
+    name = "tenant_os"
+    type = "S"
+  }
+
+  # Fleet listing, and the walk over a tenant's hosts that lists their
+  # packages and CIS results
+  global_secondary_index {
+    name            = "TenantIndex"
+    hash_key        = "tenant_id"
+    range_key       = "host_id"
+    projection_type = "KEYS_ONLY"
+  }
+
   global_secondary_index {
     name            = "LastSeenIndex"
     hash_key        = "last_seen"
-    projection_type = "ALL"
+    projection_type = "KEYS_ONLY"
+  }
+
+  # Fleet listing filtered by OS ("<tenant>#<os_id>")
+  global_secondary_index {
+    name            = "OSIndex"
+    hash_key        = "tenant_os"
+    range_key       = "host_id"
+    projection_type = "KEYS_ONLY"
   }
 
   ttl {
@@ -29,18 +73,30 @@ resource "aws_dynamodb_table" "hosts" {
     enabled = true
   }
 
+  lifecycle {
+    prevent_destroy = true
+  }
+
   tags = {
     Table = "hosts"
   }
 }
 
 # Packages Table
+# Each ingest writes the host's inventory as a new generation (pkg_key is
+# "<generation>#<package>"), then points vis_tenant_hosts.package_generation at it
+# and deletes the previous one, so readers never see a partial inventory.
 resource "aws_dynamodb_table" "packages" {
-  name           = "vis_packages"
+  name           = "vis_tenant_packages"
   billing_mode   = "PAY_PER_REQUEST"
-  hash_key       = "host_id"
+  hash_key       = "tenant_host"
   range_key      = "pkg_key"
 
+  attribute {
+    name = "tenant_host"
+    type = "S"
+  }
+
   attribute {
     name = "host_id"
     type = "S"
@@ -51,10 +107,27 @@ resource "aws_dynamodb_table" "packages" {
     type = "S"
   }
 
+  attribute {
+    name = "tenant_name"
+    type = "S"
+  }
+
+  # Hosts with a given package installed ("<tenant>#<name>")
+  global_secondary_index {
+    name            = "NameIndex"
+    hash_key        = "tenant_name"
+    range_key       = "host_id"
+    projection_type = "ALL"
+  }
+
   point_in_time_recovery {
     enabled = true
   }
 
+  lifecycle {
+    prevent_destroy = true
+  }
+
   tags = {
     Table = "packages"
   }
@@ -62,13 +135,13 @@ resource "aws_dynamodb_table" "packages" {
 
 # CIS Results Table
 resource "aws_dynamodb_table" "cis_results" {
-  name           = "vis_cis_results"
+  name           = "vis_tenant_cis_results"
   billing_mode   = "PAY_PER_REQUEST"
-  hash_key       = "host_id"
+  hash_key       = "tenant_host"
   range_key      = "check_id"
 
   attribute {
-    name = "host_id"
+    name = "tenant_host"
     type = "S"
   }
 
@@ -77,11 +150,187 @@ resource "aws_dynamodb_table" "cis_results" {
     type = "S"
   }
 
+  attribute {
+    name = "tenant_check"
+    type = "S"
+  }
+
+  attribute {
+    name = "status"
+    type = "S"
+  }
+
+  # Hosts passing or failing a given check ("<tenant>#<check_id>")
+  global_secondary_index {
+    name            = "CheckStatusIndex"
+    hash_key        = "tenant_check"
+    range_key       = "status"
+    projection_type = "ALL"
+  }
+
   point_in_time_recovery {
     enabled = true
   }
 
+  lifecycle {
+    prevent_destroy = true
+  }
+
   tags = {
     Table = "cis_results"
   }
 }
+
+# Enrollment Tokens Table
+# One-time tokens are stored by SHA-256 hash with the tenant they enroll
+# into, and expire via TTL.
+resource "aws_dynamodb_table" "enrollment_tokens" {
+  name           = "vis_enrollment_tokens"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "token_hash"
+
+  attribute {
+    name = "token_hash"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  lifecycle {
+    prevent_destroy = true
+  }
+
+  tags = {
+    Table = "enrollment_tokens"
+  }
+}
+
+# Upload Sessions Table
+# Multi-part ingest uploads, keyed by "<tenant>#<upload_id>": part 0
+# describes the session, parts 1..n hold the compressed body until it is
+# reassembled. Expired sessions are removed
+# by TTL.
+resource "aws_dynamodb_table" "uploads" {
+  name           = "vis_uploads"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "upload_id"
+  range_key      = "part"
+
+  attribute {
+    name = "upload_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "part"
+    type = "N"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  tags = {
+    Table = "uploads"
+  }
+}
+
+# Policies Table
+# Agent policies with their tag/OS assignment; version increments on every
+# update.
+resource "aws_dynamodb_table" "policies" {
+  name           = "vis_tenant_policies"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "tenant_id"
+  range_key      = "policy_id"
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "policy_id"
+    type = "S"
+  }
+
+  lifecycle {
+    prevent_destroy = true
+  }
+
+  tags = {
+    Table = "policies"
+  }
+}
+
+# Groups Table
+# Host groups with the rules that select their members; membership itself
+# is evaluated on read and not stored.
+resource "aws_dynamodb_table" "groups" {
+  name           = "vis_groups"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "tenant_id"
+  range_key      = "group_id"
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "group_id"
+    type = "S"
+  }
+
+  lifecycle {
+    prevent_destroy = true
+  }
+
+  tags = {
+    Table = "groups"
+  }
+}
+
+# Software Catalog Table
+# Host counts per package name and manager (entry_key "<manager>") and per
+# version ("<manager>#<version>"), keyed by "<tenant>#<name>" and adjusted
+# by each ingest that changes a host's inventory. CatalogIndex reads a
+# tenant's whole catalog; it is written only when a count changes, which
+# heartbeats and unchanged inventories never do.
+resource "aws_dynamodb_table" "software" {
+  name           = "vis_tenant_software"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "tenant_name"
+  range_key      = "entry_key"
+
+  attribute {
+    name = "tenant_name"
+    type = "S"
+  }
+
+  attribute {
+    name = "entry_key"
+    type = "S"
+  }
+
+  attribute {
+    name = "tenant_id"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name               = "CatalogIndex"
+    hash_key           = "tenant_id"
+    range_key          = "entry_key"
+    projection_type    = "INCLUDE"
+    non_key_attributes = ["name", "manager", "version", "host_count"]
+  }
+
+  tags = {
+    Table = "software"
+  }
+}
@@ -39,15 +39,23 @@ resource "aws_iam_role_policy" "dynamodb_policy" {
           "dynamodb:Scan",
           "dynamodb:UpdateItem",
           "dynamodb:DeleteItem",
-          "dynamodb:BatchWriteItem"
+          "dynamodb:BatchWriteItem",
+          "dynamodb:BatchGetItem",
+          "dynamodb:TransactWriteItems"
         ]
         Resource = [
           aws_dynamodb_table.hosts.arn,
           aws_dynamodb_table.packages.arn,
           aws_dynamodb_table.cis_results.arn,
+          aws_dynamodb_table.enrollment_tokens.arn,
+          aws_dynamodb_table.uploads.arn,
+          aws_dynamodb_table.policies.arn,
+          aws_dynamodb_table.groups.arn,
+          aws_dynamodb_table.software.arn,
           "${aws_dynamodb_table.hosts.arn}/index/*",
           "${aws_dynamodb_table.packages.arn}/index/*",
-          "${aws_dynamodb_table.cis_results.arn}/index/*"
+          "${aws_dynamodb_table.cis_results.arn}/index/*",
+          "${aws_dynamodb_table.software.arn}/index/*"
         ]
       }
     ]
@@ -17,11 +17,34 @@ resource "aws_lambda_function" "ingest" {
 
   environment {
     variables = {
-      HOSTS_TABLE       = aws_dynamodb_table.hosts.name
-      PACKAGES_TABLE    = aws_dynamodb_table.packages.name
-      CIS_RESULTS_TABLE = aws_dynamodb_table.cis_results.name
-      API_KEY           = random_password.api_key.result
-      ENVIRONMENT       = local.stage
+      HOSTS_TABLE             = aws_dynamodb_table.hosts.name
+      PACKAGES_TABLE          = aws_dynamodb_table.packages.name
+      CIS_RESULTS_TABLE       = aws_dynamodb_table.cis_results.name
+      ENROLLMENT_TOKENS_TABLE = aws_dynamodb_table.enrollment_tokens.name
+      UPLOADS_TABLE           = aws_dynamodb_table.uploads.name
+      POLICIES_TABLE          = aws_dynamodb_table.policies.name
+      GROUPS_TABLE            = aws_dynamodb_table.groups.name
+      SOFTWARE_TABLE          = aws_dynamodb_table.software.name
+      API_KEY                 = random_password.api_key.result
+      API_TOKENS              = jsonencode(concat(
+        [{ name = "admin", role = "admin", sha256 = sha256(random_password.admin_token.result) }],
+        var.api_tokens,
+      ))
+      OIDC_ISSUER             = var.oidc_issuer
+      OIDC_AUDIENCE           = var.oidc_audience
+      OIDC_JWKS_URL           = var.oidc_jwks_url
+      OIDC_ROLE_CLAIM         = var.oidc_role_claim
+      OIDC_TENANT_CLAIM       = var.oidc_tenant_claim
+      TENANTS = jsonencode([for t in var.tenants : merge(t, {
+        api_key = random_password.tenant_api_key[t.id].result
+      })])
+      ALLOWED_ORIGINS         = join(",", var.allowed_origins)
+      ENVIRONMENT             = local.stage
+      AUTH_MODE               = var.agent_auth_mode
+      REQUIRE_SIGNATURES      = tostring(var.require_signed_payloads)
+      POLICY_SIGNING_KEY      = tls_private_key.policy_signing.private_key_pem_pkcs8
+      HOST_STALE_AFTER        = var.host_stale_after
+      HOST_OFFLINE_AFTER      = var.host_offline_after
     }
   }
 
@@ -19,3 +19,44 @@ resource "aws_ssm_parameter" "api_key" {
     Description = "API key for visiblaze agent"
   }
 }
+
+# Agent keys of the tenants besides the default one, whose key is api_key
+resource "random_password" "tenant_api_key" {
+  for_each = toset([for t in var.tenants : t.id])
+  length   = 32
+  special  = false
+}
+
+resource "aws_ssm_parameter" "tenant_api_key" {
+  for_each = random_password.tenant_api_key
+  name     = "/${local.project_name}/tenants/${each.key}/api-key"
+  type     = "SecureString"
+  value    = each.value.result
+
+  tags = {
+    Description = "API key for visiblaze agents of tenant ${each.key}"
+  }
+}
+
+# Admin API token for the dashboard and scripts. Only its SHA-256 reaches
+# the Lambda; the token itself is in SSM and the admin_token output.
+resource "random_password" "admin_token" {
+  length  = 40
+  special = false
+}
+
+resource "aws_ssm_parameter" "admin_token" {
+  name  = "/${local.project_name}/admin-token"
+  type  = "SecureString"
+  value = random_password.admin_token.result
+
+  tags = {
+    Description = "Admin API token for visiblaze"
+  }
+}
+
+# Ed25519 key that signs policies pushed to agents. Agents verify them with
+# the public key from the policy_public_key output.
+resource "tls_private_key" "policy_signing" {
+  algorithm = "ED25519"
+}
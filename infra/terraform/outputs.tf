@@ -4,7 +4,7 @@ output "api_endpoint" {
 }
 
 output "api_key" {
-  description = "API key for agent authentication"
+  description = "Shared agent key (X-API-Key); it may only report"
   value       = random_password.api_key.result
   sensitive   = true
 }
@@ -14,6 +14,28 @@ output "api_key_ssm_parameter" {
   value       = aws_ssm_parameter.api_key.name
 }
 
+output "tenant_api_keys" {
+  description = "Agent keys (X-API-Key) of the tenants besides the default one, by tenant ID"
+  value       = { for id, key in random_password.tenant_api_key : id => key.result }
+  sensitive   = true
+}
+
+output "tenant_api_key_ssm_parameters" {
+  description = "SSM Parameter paths of the tenants' agent keys, by tenant ID"
+  value       = { for id, p in aws_ssm_parameter.tenant_api_key : id => p.name }
+}
+
+output "admin_token" {
+  description = "Admin API token (Authorization: Bearer)"
+  value       = random_password.admin_token.result
+  sensitive   = true
+}
+
+output "admin_token_ssm_parameter" {
+  description = "SSM Parameter path for the admin API token"
+  value       = aws_ssm_parameter.admin_token.name
+}
+
 output "dynamodb_hosts_table" {
   description = "Hosts table name"
   value       = aws_dynamodb_table.hosts.name
@@ -33,3 +55,8 @@ output "lambda_function_name" {
   description = "Lambda function name"
   value       = aws_lambda_function.ingest.function_name
 }
+
+output "policy_public_key" {
+  description = "Public key agents use to verify pushed policies (remote_policy.public_key)"
+  value       = tls_private_key.policy_signing.public_key_pem
+}
@@ -21,3 +21,109 @@ variable "api_key_length" {
   type        = number
   default     = 32
 }
+
+variable "agent_auth_mode" {
+  description = "Who may ingest: api_key (shared key allowed) or host (client certificate or enrolled credential only)"
+  type        = string
+  default     = "api_key"
+}
+
+variable "mtls_domain_name" {
+  description = "Custom domain with mutual TLS for agents (empty disables)"
+  type        = string
+  default     = ""
+}
+
+variable "mtls_certificate_arn" {
+  description = "ACM certificate ARN for the mTLS custom domain"
+  type        = string
+  default     = ""
+}
+
+variable "mtls_truststore_uri" {
+  description = "S3 URI of the PEM bundle of CAs that issue agent certificates"
+  type        = string
+  default     = ""
+}
+
+variable "require_signed_payloads" {
+  description = "Reject unsigned ingest payloads, including from hosts without a registered signing key"
+  type        = bool
+  default     = false
+}
+
+variable "host_stale_after" {
+  description = "Time without a heartbeat or payload after which a host is reported stale (Go duration)"
+  type        = string
+  default     = "5m"
+}
+
+variable "host_offline_after" {
+  description = "Time without a heartbeat or payload after which a host is reported offline (Go duration)"
+  type        = string
+  default     = "1h"
+}
+
+variable "api_tokens" {
+  description = "Extra API tokens besides the generated admin token: name, role (viewer, operator or admin), tenant (empty for the default tenant) and the hex SHA-256 of the token"
+  type = list(object({
+    name   = string
+    role   = string
+    tenant = optional(string, "")
+    sha256 = string
+  }))
+  default = []
+}
+
+variable "tenants" {
+  description = "Tenants besides the default one. Each gets a generated agent key; require_signatures and the liveness durations override the global settings when set"
+  type = list(object({
+    id                 = string
+    name               = optional(string, "")
+    require_signatures = optional(bool)
+    stale_after        = optional(string, "")
+    offline_after      = optional(string, "")
+  }))
+  default = []
+
+  validation {
+    condition     = alltrue([for t in var.tenants : can(regex("^[a-z0-9][a-z0-9-]{0,62}$", t.id)) && t.id != "default"])
+    error_message = "Tenant IDs are lower case letters, digits and dashes, and \"default\" is taken."
+  }
+}
+
+variable "oidc_issuer" {
+  description = "OpenID Connect issuer whose JWTs are accepted as bearer tokens (empty disables)"
+  type        = string
+  default     = ""
+}
+
+variable "oidc_audience" {
+  description = "Audience the OIDC tokens must be issued for"
+  type        = string
+  default     = ""
+}
+
+variable "oidc_jwks_url" {
+  description = "URL of the OIDC issuer's JSON Web Key Set"
+  type        = string
+  default     = ""
+}
+
+variable "oidc_role_claim" {
+  description = "Token claim holding the user's roles (viewer, operator, admin)"
+  type        = string
+  default     = "roles"
+}
+
+variable "oidc_tenant_claim" {
+  description = "Token claim naming the user's tenant; users without it belong to the default tenant"
+  type        = string
+  default     = "tenant"
+}
+
+variable "allowed_origins" {
+  description = "Browser origins, such as the dashboard's, allowed to call the API"
+  type        = list(string)
+  default     = []
+}
@@ -0,0 +1,93 @@
+// Package certid maps agent client certificates to host identities. An
+// agent certificate is bound to a host either by a URI SAN of the form
+// urn:visiblaze:host:<host_id> or, failing that, by its subject common name.
+// A second URI SAN, urn:visiblaze:tenant:<tenant_id>, places the host in a
+// tenant; certificates without one belong to the default tenant.
+package certid
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	hostURIPrefix   = "urn:visiblaze:host:"
+	tenantURIPrefix = "urn:visiblaze:tenant:"
+)
+
+// Identity is the host a client certificate speaks for.
+type Identity struct {
+	HostID string
+	Serial string
+	// Tenant is "" for the default tenant.
+	Tenant string
+}
+
+// HostURI returns the URI SAN to put in a certificate issued for hostID.
+func HostURI(hostID string) string {
+	return hostURIPrefix + hostID
+}
+
+// TenantURI returns the URI SAN to put in a certificate issued for a host
+// of tenant.
+func TenantURI(tenant string) string {
+	return tenantURIPrefix + tenant
+}
+
+// FromCertificate extracts the host identity from a verified certificate.
+func FromCertificate(cert *x509.Certificate) (Identity, error) {
+	id := Identity{Serial: cert.SerialNumber.Text(16)}
+	for _, uri := range cert.URIs {
+		if tenant, ok := strings.CutPrefix(uri.String(), tenantURIPrefix); ok {
+			id.Tenant = tenant
+		}
+	}
+	for _, uri := range cert.URIs {
+		if hostID, ok := strings.CutPrefix(uri.String(), hostURIPrefix); ok && hostID != "" {
+			id.HostID = hostID
+			return id, nil
+		}
+	}
+	if cert.Subject.CommonName != "" {
+		id.HostID = cert.Subject.CommonName
+		return id, nil
+	}
+	return id, errors.New("certificate has no host identity")
+}
+
+// FromPEM parses a PEM encoded certificate, as forwarded by API Gateway, and
+// extracts its host identity. Chain verification is the caller's concern.
+func FromPEM(data string) (Identity, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return Identity{}, errors.New("invalid client certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return Identity{}, fmt.Errorf("parse client certificate: %w", err)
+	}
+	return FromCertificate(cert)
+}
+
+// NormalizeSerial converts a certificate serial written as hex, with or
+// without colons and leading zeros, to the form used in Identity.Serial.
+func NormalizeSerial(serial string) string {
+	serial = strings.ToLower(strings.ReplaceAll(serial, ":", ""))
+	serial = strings.TrimLeft(serial, "0")
+	if serial == "" {
+		return "0"
+	}
+	return serial
+}
+
+// SPKIHash returns the base64 SHA-256 of a certificate's public key info,
+// the value used for pinning.
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,77 @@
+// Package credential generates and verifies the secrets used for agent
+// enrollment. Only SHA-256 hashes of tokens and credentials are stored
+// server side.
+//
+// A secret issued for a tenant carries the tenant ID after its prefix,
+// separated by a dot (vze_acme.<random>), so the server knows where to look
+// up its hash. Secrets without one belong to the default tenant.
+package credential
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	// TokenPrefix marks one-time enrollment tokens.
+	TokenPrefix = "vze_"
+	// SecretPrefix marks per-host credentials issued at enrollment.
+	SecretPrefix = "vzh_"
+)
+
+// NewToken returns a random one-time enrollment token for tenant, which is
+// empty for the default tenant.
+func NewToken(tenant string) (string, error) {
+	return generate(TokenPrefix, tenant)
+}
+
+// NewSecret returns a random per-host credential for tenant, which is empty
+// for the default tenant.
+func NewSecret(tenant string) (string, error) {
+	return generate(SecretPrefix, tenant)
+}
+
+func generate(prefix, tenant string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate secret: %w", err)
+	}
+	if tenant != "" {
+		prefix += tenant + "."
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Tenant returns the tenant a token or credential was issued for, or "" for
+// the default tenant.
+func Tenant(secret string) string {
+	for _, prefix := range []string{TokenPrefix, SecretPrefix} {
+		if rest, ok := strings.CutPrefix(secret, prefix); ok {
+			tenant, _, found := strings.Cut(rest, ".")
+			if found {
+				return tenant
+			}
+		}
+	}
+	return ""
+}
+
+// Hash returns the hex SHA-256 of a token or credential, the form in which
+// it is stored.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches reports whether secret hashes to hash, in constant time.
+func Matches(secret, hash string) bool {
+	if secret == "" || hash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(Hash(secret)), []byte(hash)) == 1
+}
@@ -0,0 +1,96 @@
+// Package liveness derives a host's reporting status from the last time the
+// backend heard from its agent, by heartbeat or full payload.
+package liveness
+
+import (
+	"fmt"
+	"time"
+)
+
+// Host statuses. A host is online until StaleAfter has passed without
+// contact, stale until OfflineAfter, and offline from then on.
+const (
+	Online  = "online"
+	Stale   = "stale"
+	Offline = "offline"
+	// Missing is a filter, not a status: it selects hosts that have stopped
+	// reporting, whether stale or offline.
+	Missing = "missing"
+)
+
+// Thresholds configures when hosts turn stale and offline.
+type Thresholds struct {
+	StaleAfter   time.Duration `json:"-"`
+	OfflineAfter time.Duration `json:"-"`
+}
+
+// Default thresholds suit the agent's default one minute heartbeat.
+var Default = Thresholds{StaleAfter: 5 * time.Minute, OfflineAfter: time.Hour}
+
+// Validate checks that both thresholds are positive and ordered.
+func (t Thresholds) Validate() error {
+	if t.StaleAfter <= 0 || t.OfflineAfter <= 0 {
+		return fmt.Errorf("liveness thresholds must be positive")
+	}
+	if t.OfflineAfter < t.StaleAfter {
+		return fmt.Errorf("offline threshold %s is shorter than stale threshold %s", t.OfflineAfter, t.StaleAfter)
+	}
+	return nil
+}
+
+// Status returns the status of a host last heard from at last. A zero last
+// means the host never reported and is offline.
+func (t Thresholds) Status(last, now time.Time) string {
+	if last.IsZero() {
+		return Offline
+	}
+	age := now.Sub(last)
+	switch {
+	case age < t.StaleAfter:
+		return Online
+	case age < t.OfflineAfter:
+		return Stale
+	}
+	return Offline
+}
+
+// LastContact returns the latest of the given RFC 3339 timestamps, ignoring
+// empty or malformed ones.
+func LastContact(timestamps ...string) time.Time {
+	var latest time.Time
+	for _, ts := range timestamps {
+		if t, err := time.Parse(time.RFC3339, ts); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// Matches reports whether a host with status is selected by filter, which
+// is a status, Missing, or empty for all hosts.
+func Matches(filter, status string) bool {
+	switch filter {
+	case "":
+		return true
+	case Missing:
+		return status == Stale || status == Offline
+	}
+	return filter == status
+}
+
+// ValidFilter reports whether filter is accepted by Matches.
+func ValidFilter(filter string) bool {
+	switch filter {
+	case "", Online, Stale, Offline, Missing:
+		return true
+	}
+	return false
+}
+
+// JSON describes the thresholds in API responses.
+func (t Thresholds) JSON() map[string]int64 {
+	return map[string]int64{
+		"stale_after_seconds":   int64(t.StaleAfter / time.Second),
+		"offline_after_seconds": int64(t.OfflineAfter / time.Second),
+	}
+}
@@ -0,0 +1,44 @@
+package liveness
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatus(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		last time.Time
+		want string
+	}{
+		{now.Add(-30 * time.Second), Online},
+		{now.Add(-5 * time.Minute), Stale},
+		{now.Add(-59 * time.Minute), Stale},
+		{now.Add(-2 * time.Hour), Offline},
+		{time.Time{}, Offline},
+	}
+	for _, c := range cases {
+		if got := Default.Status(c.last, now); got != c.want {
+			t.Errorf("Status(%s) = %s, want %s", now.Sub(c.last), got, c.want)
+		}
+	}
+}
+
+func TestLastContact(t *testing.T) {
+	got := LastContact("2026-01-01T10:00:00Z", "", "garbage", "2026-01-01T11:00:00Z")
+	if want := time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("LastContact = %s, want %s", got, want)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	if !Matches(Missing, Stale) || !Matches(Missing, Offline) || Matches(Missing, Online) {
+		t.Error("missing should select stale and offline hosts only")
+	}
+	if !Matches("", Online) || Matches(Online, Stale) {
+		t.Error("status filter mismatch")
+	}
+	if ValidFilter("gone") {
+		t.Error("unknown filter accepted")
+	}
+}
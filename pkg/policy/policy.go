@@ -0,0 +1,221 @@
+// Package policy defines the agent policy pushed from the backend. Policies
+// are stored unsigned; on delivery the backend wraps the assigned policy in a
+// Document bound to the receiving host and signs it with Ed25519, so an agent
+// only applies settings that came from the backend, were meant for it, and
+// are not older than what it already runs.
+package policy
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LogLevels are the accepted values for Policy.LogLevel.
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// Policy holds the settings an administrator can push. Zero values leave the
+// agent's local setting unchanged.
+type Policy struct {
+	ID                        string   `json:"id"`
+	Version                   int64    `json:"version"`
+	CollectionIntervalMinutes int      `json:"collection_interval_minutes,omitempty"`
+	EnabledChecks             []string `json:"enabled_checks,omitempty"`
+	Profile                   string   `json:"profile,omitempty"`
+	ScanPaths                 []string `json:"scan_paths,omitempty"`
+	LogLevel                  string   `json:"log_level,omitempty"`
+}
+
+// Validate checks the fields that can be validated without agent context.
+func (p Policy) Validate() error {
+	if p.ID == "" {
+		return errors.New("policy id is required")
+	}
+	if p.CollectionIntervalMinutes < 0 {
+		return errors.New("collection_interval_minutes must not be negative")
+	}
+	if p.LogLevel != "" && !contains(LogLevels, p.LogLevel) {
+		return fmt.Errorf("log_level must be one of %s", strings.Join(LogLevels, ", "))
+	}
+	for _, path := range p.ScanPaths {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("scan path %q must be absolute", path)
+		}
+	}
+	return nil
+}
+
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:=/-]{0,127}$`)
+
+// ValidTag reports whether tag may label a host: up to 128 letters, digits
+// and the characters _.:=/-, such as "prod" or "env:prod".
+func ValidTag(tag string) bool {
+	return tagPattern.MatchString(tag)
+}
+
+// Assignment selects the hosts a policy applies to. A host matches when it
+// has any of Tags, belongs to any of Groups or runs any of OSIDs; an empty
+// assignment matches every host. Among matching policies the highest
+// Priority wins.
+type Assignment struct {
+	Tags     []string `json:"tags,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	OSIDs    []string `json:"os_ids,omitempty"`
+	Priority int      `json:"priority"`
+}
+
+// Matches reports whether a host with osID, tags and group memberships is
+// selected.
+func (a Assignment) Matches(osID string, tags, groups []string) bool {
+	if len(a.Tags) == 0 && len(a.Groups) == 0 && len(a.OSIDs) == 0 {
+		return true
+	}
+	if contains(a.OSIDs, osID) {
+		return true
+	}
+	for _, t := range tags {
+		if contains(a.Tags, t) {
+			return true
+		}
+	}
+	for _, g := range groups {
+		if contains(a.Groups, g) {
+			return true
+		}
+	}
+	return false
+}
+
+// Assigned is a stored policy with its assignment.
+type Assigned struct {
+	Policy Policy     `json:"policy"`
+	Assign Assignment `json:"assign"`
+}
+
+// Resolve returns the policy for a host, or nil when none matches. Ties in
+// priority go to the lexically smallest ID so the result is stable.
+func Resolve(candidates []Assigned, osID string, tags, groups []string) *Policy {
+	var matched []Assigned
+	for _, c := range candidates {
+		if c.Assign.Matches(osID, tags, groups) {
+			matched = append(matched, c)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].Assign.Priority != matched[j].Assign.Priority {
+			return matched[i].Assign.Priority > matched[j].Assign.Priority
+		}
+		return matched[i].Policy.ID < matched[j].Policy.ID
+	})
+	return &matched[0].Policy
+}
+
+// Document is the signed unit: a policy bound to one host at a point in time.
+type Document struct {
+	Policy   Policy `json:"policy"`
+	HostID   string `json:"host_id"`
+	IssuedAt string `json:"issued_at"`
+}
+
+// Signed carries a Document exactly as it was signed.
+type Signed struct {
+	Document  json.RawMessage `json:"document"`
+	Signature string          `json:"signature"`
+}
+
+// Sign binds p to hostID and signs it.
+func Sign(key ed25519.PrivateKey, p Policy, hostID string, now time.Time) (*Signed, error) {
+	doc, err := json.Marshal(Document{Policy: p, HostID: hostID, IssuedAt: now.UTC().Format(time.RFC3339)})
+	if err != nil {
+		return nil, err
+	}
+	return &Signed{Document: doc, Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, doc))}, nil
+}
+
+// Verify checks the signature and returns the document.
+func (s *Signed) Verify(pub ed25519.PublicKey) (*Document, error) {
+	sig, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil || !ed25519.Verify(pub, s.Document, sig) {
+		return nil, errors.New("policy signature does not verify")
+	}
+	var doc Document
+	if err := json.Unmarshal(s.Document, &doc); err != nil {
+		return nil, fmt.Errorf("parse policy document: %w", err)
+	}
+	if _, err := time.Parse(time.RFC3339, doc.IssuedAt); err != nil {
+		return nil, errors.New("policy document has no valid issued_at")
+	}
+	return &doc, nil
+}
+
+// ParsePrivateKey reads a PKCS#8 PEM Ed25519 key, as produced by
+// `openssl genpkey -algorithm ed25519` or Terraform's tls_private_key.
+func ParsePrivateKey(data string) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("policy signing key is not PEM")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse policy signing key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("policy signing key is not Ed25519")
+	}
+	return edKey, nil
+}
+
+// ParsePublicKey reads an Ed25519 public key given as PKIX PEM, as the
+// base64 body of such a PEM on one line, or as the base64 of the raw 32 bytes.
+func ParsePublicKey(data string) (ed25519.PublicKey, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(data)); block != nil {
+		der = block.Bytes
+	} else {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+		if err != nil {
+			return nil, errors.New("policy public key must be PEM or base64 Ed25519")
+		}
+		if len(b) == ed25519.PublicKeySize {
+			return ed25519.PublicKey(b), nil
+		}
+		der = b
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse policy public key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("policy public key is not Ed25519")
+	}
+	return edKey, nil
+}
+
+// PublicKeyPEM encodes pub as PKIX PEM for configuration files.
+func PublicKeyPEM(pub ed25519.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	candidates := []Assigned{
+		{Policy: Policy{ID: "default"}},
+		{Policy: Policy{ID: "ubuntu"}, Assign: Assignment{OSIDs: []string{"ubuntu"}, Priority: 10}},
+		{Policy: Policy{ID: "prod"}, Assign: Assignment{Tags: []string{"prod"}, Priority: 20}},
+		{Policy: Policy{ID: "alpha"}, Assign: Assignment{Tags: []string{"prod"}, Priority: 20}},
+		{Policy: Policy{ID: "web"}, Assign: Assignment{Groups: []string{"prod-web"}, Priority: 30}},
+	}
+
+	cases := []struct {
+		osID   string
+		tags   []string
+		groups []string
+		want   string
+	}{
+		{"rhel", nil, nil, "default"},
+		{"ubuntu", nil, nil, "ubuntu"},
+		{"ubuntu", []string{"prod"}, nil, "alpha"},
+		{"ubuntu", []string{"prod"}, []string{"prod-web"}, "web"},
+		{"rhel", nil, []string{"prod-db"}, "default"},
+	}
+	for _, c := range cases {
+		got := Resolve(candidates, c.osID, c.tags, c.groups)
+		if got == nil || got.ID != c.want {
+			t.Errorf("Resolve(%s, %v, %v) = %v, want %s", c.osID, c.tags, c.groups, got, c.want)
+		}
+	}
+	if got := Resolve(candidates[1:2], "rhel", nil, nil); got != nil {
+		t.Errorf("unassigned host resolved to %s", got.ID)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Policy{ID: "prod", Version: 3, CollectionIntervalMinutes: 15, LogLevel: "debug"}
+	signed, err := Sign(priv, p, "h1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := signed.Verify(pub)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if doc.HostID != "h1" || doc.Policy.Version != 3 || doc.Policy.CollectionIntervalMinutes != 15 {
+		t.Errorf("document = %+v", doc)
+	}
+
+	tampered := *signed
+	tampered.Document = []byte(strings.Replace(string(signed.Document), `"h1"`, `"h2"`, 1))
+	if _, err := tampered.Verify(pub); err == nil {
+		t.Error("tampered document verified")
+	}
+
+	other, _, _ := ed25519.GenerateKey(nil)
+	if _, err := signed.Verify(other); err == nil {
+		t.Error("document verified with the wrong key")
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	for _, in := range []string{PublicKeyPEM(pub), base64.StdEncoding.EncodeToString(pub)} {
+		got, err := ParsePublicKey(in)
+		if err != nil || !got.Equal(pub) {
+			t.Errorf("ParsePublicKey(%q) = %v", in, err)
+		}
+	}
+	if _, err := ParsePublicKey("not a key"); err == nil {
+		t.Error("garbage accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := []Policy{
+		{},
+		{ID: "x", LogLevel: "trace"},
+		{ID: "x", ScanPaths: []string{"opt"}},
+		{ID: "x", CollectionIntervalMinutes: -1},
+	}
+	for _, p := range bad {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%+v accepted", p)
+		}
+	}
+}
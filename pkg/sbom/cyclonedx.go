@@ -0,0 +1,127 @@
+package sbom
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type cdxBOM struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber,omitempty"`
+	Version      int            `json:"version"`
+	Metadata     *cdxMetadata   `json:"metadata,omitempty"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp  string        `json:"timestamp,omitempty"`
+	Tools      *cdxTools     `json:"tools,omitempty"`
+	Component  *cdxComponent `json:"component,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type       string        `json:"type"`
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// CycloneDX builds a CycloneDX 1.5 BOM for the host's components.
+func CycloneDX(subject Subject, components []Component, toolVersion string) interface{} {
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + uuid.New().String(),
+		Version:      1,
+		Metadata: &cdxMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools: &cdxTools{Components: []cdxComponent{
+				{Type: "application", Name: "visiblaze", Version: toolVersion},
+			}},
+			Component: &cdxComponent{
+				Type:    "operating-system",
+				BOMRef:  "host:" + subject.HostID,
+				Name:    subject.OSID,
+				Version: subject.OSVersion,
+			},
+			Properties: []cdxProperty{
+				{Name: "visiblaze:host_id", Value: subject.HostID},
+				{Name: "visiblaze:hostname", Value: subject.Hostname},
+			},
+		},
+		Components: make([]cdxComponent, 0, len(components)),
+	}
+
+	for _, c := range components {
+		purl := PURL(c, subject.OSID, subject.OSVersion)
+		comp := cdxComponent{
+			Type:    "library",
+			BOMRef:  purl,
+			Name:    c.Name,
+			Version: c.Version,
+			PURL:    purl,
+			Properties: []cdxProperty{
+				{Name: "visiblaze:manager", Value: c.Manager},
+			},
+		}
+		if c.Arch != "" {
+			comp.Properties = append(comp.Properties, cdxProperty{Name: "visiblaze:arch", Value: c.Arch})
+		}
+		bom.Components = append(bom.Components, comp)
+	}
+
+	return bom
+}
+
+func parseCycloneDX(bom cdxBOM) (Subject, []Component) {
+	var subject Subject
+	if m := bom.Metadata; m != nil {
+		if m.Component != nil && m.Component.Type == "operating-system" {
+			subject.OSID = m.Component.Name
+			subject.OSVersion = m.Component.Version
+		}
+		for _, p := range m.Properties {
+			switch p.Name {
+			case "visiblaze:host_id":
+				subject.HostID = p.Value
+			case "visiblaze:hostname":
+				subject.Hostname = p.Value
+			}
+		}
+	}
+
+	var components []Component
+	for _, comp := range bom.Components {
+		c := Component{Name: comp.Name, Version: comp.Version}
+		if comp.PURL != "" {
+			if parsed, distro, err := ParsePURL(comp.PURL); err == nil {
+				c.Manager, c.Arch, c.Source = parsed.Manager, parsed.Arch, parsed.Source
+				fillDistro(&subject, distro)
+			}
+		}
+		for _, p := range comp.Properties {
+			switch p.Name {
+			case "visiblaze:manager":
+				c.Manager = p.Value
+			case "visiblaze:arch":
+				c.Arch = p.Value
+			}
+		}
+		components = append(components, c)
+	}
+	return subject, components
+}
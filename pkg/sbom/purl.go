@@ -0,0 +1,238 @@
+// Package sbom converts package inventories to and from CycloneDX and SPDX
+// documents. It is shared by the agent and the backend, so it works on its
+// own Component type rather than either side's package model.
+package sbom
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Component is one installed package.
+type Component struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Arch    string `json:"arch"`
+	Manager string `json:"manager"`
+	Source  string `json:"source"`
+}
+
+// Subject identifies the host an SBOM describes.
+type Subject struct {
+	HostID    string `json:"host_id"`
+	Hostname  string `json:"hostname"`
+	OSID      string `json:"os_id"`
+	OSVersion string `json:"os_version"`
+}
+
+// purl types for OS package managers; these carry distro qualifiers
+var managerTypes = map[string]string{
+	"dpkg": "deb",
+	"rpm":  "rpm",
+	"apk":  "apk",
+}
+
+// purl types for language ecosystems, which are distro independent
+var ecosystemTypes = map[string]string{
+	"pip":   "pypi",
+	"npm":   "npm",
+	"gem":   "gem",
+	"go":    "golang",
+	"maven": "maven",
+}
+
+var purlManagers = map[string]string{
+	"deb":    "dpkg",
+	"rpm":    "rpm",
+	"apk":    "apk",
+	"pypi":   "pip",
+	"npm":    "npm",
+	"gem":    "gem",
+	"golang": "go",
+	"maven":  "maven",
+}
+
+// rpmVendors maps os-release IDs to the purl namespaces used by vulnerability
+// databases.
+var rpmVendors = map[string]string{
+	"rhel":      "redhat",
+	"centos":    "centos",
+	"fedora":    "fedora",
+	"rocky":     "rocky",
+	"almalinux": "almalinux",
+	"amzn":      "amazon",
+	"ol":        "oracle",
+	"sles":      "suse",
+	"opensuse":  "opensuse",
+}
+
+// PURL returns the package URL for c on the given distribution, e.g.
+// pkg:deb/ubuntu/bash@5.1-6ubuntu1?arch=amd64&distro=ubuntu-22.04.
+func PURL(c Component, osID, osVersion string) string {
+	if typ, ok := ecosystemTypes[c.Manager]; ok {
+		return ecosystemPURL(typ, c)
+	}
+
+	typ, ok := managerTypes[c.Manager]
+	if !ok {
+		return fmt.Sprintf("pkg:generic/%s@%s", escape(c.Name), escape(c.Version))
+	}
+
+	namespace := osID
+	switch typ {
+	case "deb":
+		if namespace != "ubuntu" && namespace != "debian" {
+			namespace = "debian"
+		}
+	case "rpm":
+		if vendor, ok := rpmVendors[osID]; ok {
+			namespace = vendor
+		}
+	case "apk":
+		namespace = "alpine"
+	}
+	if namespace == "" || namespace == "unknown" {
+		namespace = c.Source
+	}
+
+	qualifiers := map[string]string{}
+	if c.Arch != "" && c.Arch != "unknown" {
+		qualifiers["arch"] = c.Arch
+	}
+	if osID != "" && osID != "unknown" {
+		distro := osID
+		if osVersion != "" && osVersion != "unknown" {
+			distro += "-" + osVersion
+		}
+		qualifiers["distro"] = distro
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "pkg:%s/%s/%s", typ, escape(namespace), escape(c.Name))
+	if c.Version != "" {
+		sb.WriteString("@" + escape(c.Version))
+	}
+	if len(qualifiers) > 0 {
+		keys := make([]string, 0, len(qualifiers))
+		for k := range qualifiers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			if i == 0 {
+				sb.WriteByte('?')
+			} else {
+				sb.WriteByte('&')
+			}
+			sb.WriteString(k + "=" + escape(qualifiers[k]))
+		}
+	}
+	return sb.String()
+}
+
+// ecosystemPURL builds purls such as pkg:pypi/requests@2.31.0,
+// pkg:npm/%40types/node@20.1.0, pkg:golang/github.com/google/uuid@v1.6.0
+// and pkg:maven/org.slf4j/slf4j-api@2.0.9.
+func ecosystemPURL(typ string, c Component) string {
+	var path string
+	switch typ {
+	case "pypi":
+		// PEP 503 normalisation, as required by the purl spec
+		path = escape(strings.ToLower(strings.NewReplacer("_", "-", ".", "-").Replace(c.Name)))
+	case "maven":
+		group, artifact, ok := strings.Cut(c.Name, ":")
+		if ok {
+			path = escape(group) + "/" + escape(artifact)
+		} else {
+			path = escape(c.Name)
+		}
+	default:
+		// npm scopes and Go module paths are namespaces split on '/'
+		segments := strings.Split(c.Name, "/")
+		for i, seg := range segments {
+			segments[i] = escape(seg)
+		}
+		path = strings.Join(segments, "/")
+	}
+
+	purl := "pkg:" + typ + "/" + path
+	if c.Version != "" {
+		purl += "@" + escape(c.Version)
+	}
+	return purl
+}
+
+// ParsePURL extracts a component and its distro qualifier from a package URL.
+// Unknown purl types are kept with the type as the manager.
+func ParsePURL(purl string) (Component, string, error) {
+	rest, ok := strings.CutPrefix(purl, "pkg:")
+	if !ok {
+		return Component{}, "", fmt.Errorf("invalid purl %q", purl)
+	}
+
+	var query string
+	rest, query, _ = strings.Cut(rest, "?")
+	rest, _, _ = strings.Cut(rest, "#")
+
+	var version string
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		version, rest = rest[i+1:], rest[:i]
+	}
+
+	parts := strings.Split(rest, "/")
+	if len(parts) < 2 {
+		return Component{}, "", fmt.Errorf("invalid purl %q", purl)
+	}
+	typ := strings.ToLower(parts[0])
+
+	c := Component{Manager: typ, Version: unescape(version)}
+	if m, ok := purlManagers[typ]; ok {
+		c.Manager = m
+	}
+	segments := make([]string, 0, len(parts)-1)
+	for _, seg := range parts[1:] {
+		segments = append(segments, unescape(seg))
+	}
+
+	switch typ {
+	case "deb", "rpm", "apk":
+		if len(segments) > 1 {
+			c.Source = segments[0]
+		}
+		c.Name = segments[len(segments)-1]
+	case "maven":
+		c.Name = strings.Join(segments, ":")
+	default:
+		c.Name = strings.Join(segments, "/")
+	}
+
+	values, _ := url.ParseQuery(query)
+	c.Arch = values.Get("arch")
+	return c, values.Get("distro"), nil
+}
+
+// escape percent-encodes a purl segment. Unlike url.PathEscape it also
+// encodes ':' and '+', matching what scanners expect for Debian epochs and
+// versions such as 2.9.4+dfsg1.
+func escape(s string) string {
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9',
+			b == '.', b == '-', b == '_', b == '~':
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
+
+func unescape(s string) string {
+	if u, err := url.PathUnescape(s); err == nil {
+		return u
+	}
+	return s
+}
@@ -0,0 +1,79 @@
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	FormatCycloneDX = "cyclonedx"
+	FormatSPDX      = "spdx"
+)
+
+// Generate renders components as a CycloneDX or SPDX JSON document.
+func Generate(format string, subject Subject, components []Component, toolVersion string) ([]byte, error) {
+	var doc interface{}
+	switch strings.ToLower(format) {
+	case FormatCycloneDX, "cdx":
+		doc = CycloneDX(subject, components, toolVersion)
+	case FormatSPDX:
+		doc = SPDX(subject, components, toolVersion)
+	default:
+		return nil, fmt.Errorf("unsupported SBOM format %q (want cyclonedx or spdx)", format)
+	}
+
+	// purls contain '&', which the default encoder would escape as \u0026
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// Parse reads a CycloneDX or SPDX JSON document. Host identity and OS are
+// taken from document metadata where present, falling back to purl distro
+// qualifiers.
+func Parse(data []byte) (Subject, []Component, error) {
+	var probe struct {
+		BOMFormat   string `json:"bomFormat"`
+		SPDXVersion string `json:"spdxVersion"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return Subject{}, nil, fmt.Errorf("parse sbom: %w", err)
+	}
+
+	switch {
+	case probe.BOMFormat == "CycloneDX":
+		var bom cdxBOM
+		if err := json.Unmarshal(data, &bom); err != nil {
+			return Subject{}, nil, fmt.Errorf("parse cyclonedx: %w", err)
+		}
+		subject, components := parseCycloneDX(bom)
+		return subject, components, nil
+	case strings.HasPrefix(probe.SPDXVersion, "SPDX-2"):
+		var doc spdxDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return Subject{}, nil, fmt.Errorf("parse spdx: %w", err)
+		}
+		subject, components := parseSPDX(doc)
+		return subject, components, nil
+	default:
+		return Subject{}, nil, fmt.Errorf("parse sbom: not a CycloneDX or SPDX 2.x JSON document")
+	}
+}
+
+// fillDistro sets the subject OS from a purl distro qualifier such as
+// "ubuntu-22.04" when the document did not state it explicitly.
+func fillDistro(subject *Subject, distro string) {
+	if distro == "" || subject.OSID != "" {
+		return
+	}
+	id, version, _ := strings.Cut(distro, "-")
+	subject.OSID = id
+	subject.OSVersion = version
+}
@@ -0,0 +1,81 @@
+package sbom
+
+import "testing"
+
+func TestPURL(t *testing.T) {
+	cases := []struct {
+		c         Component
+		osID, ver string
+		want      string
+	}{
+		{Component{Name: "bash", Version: "5.1-6ubuntu1", Arch: "amd64", Manager: "dpkg"}, "ubuntu", "22.04",
+			"pkg:deb/ubuntu/bash@5.1-6ubuntu1?arch=amd64&distro=ubuntu-22.04"},
+		{Component{Name: "libxml2", Version: "1:2.9.4+dfsg1-3", Arch: "amd64", Manager: "dpkg"}, "debian", "12",
+			"pkg:deb/debian/libxml2@1%3A2.9.4%2Bdfsg1-3?arch=amd64&distro=debian-12"},
+		{Component{Name: "openssl", Version: "3.0.7-27.el9", Arch: "x86_64", Manager: "rpm"}, "rhel", "9.4",
+			"pkg:rpm/redhat/openssl@3.0.7-27.el9?arch=x86_64&distro=rhel-9.4"},
+		{Component{Name: "musl", Version: "1.2.4-r2", Arch: "unknown", Manager: "apk"}, "alpine", "3.18.4",
+			"pkg:apk/alpine/musl@1.2.4-r2?distro=alpine-3.18.4"},
+		{Component{Name: "Flask_Login", Version: "0.6.3", Manager: "pip"}, "ubuntu", "22.04",
+			"pkg:pypi/flask-login@0.6.3"},
+		{Component{Name: "@types/node", Version: "20.1.0", Manager: "npm"}, "ubuntu", "22.04",
+			"pkg:npm/%40types/node@20.1.0"},
+		{Component{Name: "github.com/google/uuid", Version: "v1.6.0", Manager: "go"}, "", "",
+			"pkg:golang/github.com/google/uuid@v1.6.0"},
+		{Component{Name: "org.slf4j:slf4j-api", Version: "2.0.9", Manager: "maven"}, "", "",
+			"pkg:maven/org.slf4j/slf4j-api@2.0.9"},
+	}
+	for _, tc := range cases {
+		if got := PURL(tc.c, tc.osID, tc.ver); got != tc.want {
+			t.Errorf("PURL(%s) = %s, want %s", tc.c.Name, got, tc.want)
+		}
+	}
+}
+
+func TestParsePURL(t *testing.T) {
+	c, distro, err := ParsePURL("pkg:deb/debian/libxml2@1%3A2.9.4%2Bdfsg1-3?arch=amd64&distro=debian-12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "libxml2" || c.Version != "1:2.9.4+dfsg1-3" || c.Arch != "amd64" || c.Manager != "dpkg" || distro != "debian-12" {
+		t.Fatalf("unexpected parse: %+v distro %s", c, distro)
+	}
+}
+
+func TestParseEcosystemPURL(t *testing.T) {
+	for purl, want := range map[string]Component{
+		"pkg:npm/%40types/node@20.1.0":             {Name: "@types/node", Version: "20.1.0", Manager: "npm"},
+		"pkg:maven/org.slf4j/slf4j-api@2.0.9":      {Name: "org.slf4j:slf4j-api", Version: "2.0.9", Manager: "maven"},
+		"pkg:golang/github.com/google/uuid@v1.6.0": {Name: "github.com/google/uuid", Version: "v1.6.0", Manager: "go"},
+	} {
+		got, _, err := ParsePURL(purl)
+		if err != nil || got != want {
+			t.Errorf("ParsePURL(%s) = %+v, %v", purl, got, err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	subject := Subject{HostID: "h1", Hostname: "web-1", OSID: "ubuntu", OSVersion: "22.04"}
+	components := []Component{
+		{Name: "bash", Version: "5.1-6ubuntu1", Arch: "amd64", Manager: "dpkg"},
+		{Name: "openssl", Version: "3.0.2-0ubuntu1.15", Arch: "amd64", Manager: "dpkg"},
+	}
+
+	for _, format := range []string{FormatCycloneDX, FormatSPDX} {
+		data, err := Generate(format, subject, components, "0.1.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotSubject, got, err := Parse(data)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if gotSubject != subject {
+			t.Errorf("%s: subject = %+v", format, gotSubject)
+		}
+		if len(got) != 2 || got[1].Name != "openssl" || got[1].Manager != "dpkg" || got[1].Arch != "amd64" {
+			t.Errorf("%s: components = %+v", format, got)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package sbom
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID                string            `json:"SPDXID"`
+	Name                  string            `json:"name"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	Comment               string            `json:"comment,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+	SourceInfo            string            `json:"sourceInfo,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+const spdxOSPackageID = "SPDXRef-OperatingSystem"
+
+// SPDX builds an SPDX 2.3 document. The host's operating system is the
+// described package and contains every installed component.
+func SPDX(subject Subject, components []Component, toolVersion string) interface{} {
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              "visiblaze-" + subject.Hostname,
+		DocumentNamespace: fmt.Sprintf("https://visiblaze.io/spdx/%s/%s", subject.HostID, uuid.New().String()),
+		CreationInfo: spdxCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: visiblaze-" + toolVersion},
+		},
+		Packages: []spdxPackage{{
+			SPDXID:                spdxOSPackageID,
+			Name:                  subject.OSID,
+			VersionInfo:           subject.OSVersion,
+			DownloadLocation:      "NOASSERTION",
+			PrimaryPackagePurpose: "OPERATING-SYSTEM",
+			Comment:               fmt.Sprintf("host_id=%s hostname=%s", subject.HostID, subject.Hostname),
+		}},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: spdxOSPackageID,
+		}},
+	}
+
+	for i, c := range components {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		doc.Packages = append(doc.Packages, spdxPackage{
+			SPDXID:                id,
+			Name:                  c.Name,
+			VersionInfo:           c.Version,
+			DownloadLocation:      "NOASSERTION",
+			PrimaryPackagePurpose: "LIBRARY",
+			SourceInfo:            "installed via " + c.Manager,
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  PURL(c, subject.OSID, subject.OSVersion),
+			}},
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      spdxOSPackageID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	return doc
+}
+
+func parseSPDX(doc spdxDocument) (Subject, []Component) {
+	var subject Subject
+	var components []Component
+	for _, p := range doc.Packages {
+		if p.PrimaryPackagePurpose == "OPERATING-SYSTEM" {
+			subject.OSID = p.Name
+			subject.OSVersion = p.VersionInfo
+			fmt.Sscanf(p.Comment, "host_id=%s hostname=%s", &subject.HostID, &subject.Hostname)
+			continue
+		}
+
+		c := Component{Name: p.Name, Version: p.VersionInfo}
+		for _, ref := range p.ExternalRefs {
+			if ref.ReferenceType != "purl" {
+				continue
+			}
+			if parsed, distro, err := ParsePURL(ref.ReferenceLocator); err == nil {
+				c.Manager, c.Arch, c.Source = parsed.Manager, parsed.Arch, parsed.Source
+				fillDistro(&subject, distro)
+			}
+		}
+		components = append(components, c)
+	}
+	return subject, components
+}
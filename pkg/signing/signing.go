@@ -0,0 +1,114 @@
+// Package signing defines how agents sign ingest payloads. A request carries
+// a timestamp, a per-host sequence number that only ever increases, and an
+// Ed25519 signature over both plus the SHA-256 of the body, so the backend
+// can reject tampered, stale and replayed payloads.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Request headers carrying the signature envelope.
+const (
+	HeaderTimestamp = "X-Visiblaze-Timestamp"
+	HeaderSequence  = "X-Visiblaze-Sequence"
+	HeaderSignature = "X-Visiblaze-Signature"
+	HeaderPublicKey = "X-Visiblaze-Public-Key"
+)
+
+// MaxSkew is how far a request timestamp may be from the verifier's clock.
+const MaxSkew = 5 * time.Minute
+
+var (
+	ErrStale        = errors.New("signature timestamp outside allowed window")
+	ErrBadSignature = errors.New("signature does not verify")
+)
+
+// Envelope is the signature metadata sent with a payload.
+type Envelope struct {
+	Timestamp int64
+	Sequence  uint64
+	Signature string
+	PublicKey string
+}
+
+// Message returns the bytes that are signed.
+func Message(timestamp int64, sequence uint64, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(fmt.Sprintf("visiblaze-v1\n%d\n%d\n%s", timestamp, sequence, hex.EncodeToString(sum[:])))
+}
+
+// Sign produces the envelope for body.
+func Sign(key ed25519.PrivateKey, timestamp int64, sequence uint64, body []byte) Envelope {
+	sig := ed25519.Sign(key, Message(timestamp, sequence, body))
+	return Envelope{
+		Timestamp: timestamp,
+		Sequence:  sequence,
+		Signature: base64.StdEncoding.EncodeToString(sig),
+		PublicKey: EncodePublicKey(key.Public().(ed25519.PublicKey)),
+	}
+}
+
+// Headers returns the envelope as request headers.
+func (e Envelope) Headers() map[string]string {
+	return map[string]string{
+		HeaderTimestamp: strconv.FormatInt(e.Timestamp, 10),
+		HeaderSequence:  strconv.FormatUint(e.Sequence, 10),
+		HeaderSignature: e.Signature,
+		HeaderPublicKey: e.PublicKey,
+	}
+}
+
+// ParseHeaders reads an envelope using get to look headers up. It returns
+// nil without error when the request is unsigned.
+func ParseHeaders(get func(name string) string) (*Envelope, error) {
+	sig := get(HeaderSignature)
+	if sig == "" {
+		return nil, nil
+	}
+	ts, err := strconv.ParseInt(get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", HeaderTimestamp)
+	}
+	seq, err := strconv.ParseUint(get(HeaderSequence), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", HeaderSequence)
+	}
+	return &Envelope{Timestamp: ts, Sequence: seq, Signature: sig, PublicKey: get(HeaderPublicKey)}, nil
+}
+
+// Verify checks the signature over body with pub and that the timestamp is
+// within MaxSkew of now. Sequence ordering is the caller's concern since it
+// needs per-host state.
+func (e Envelope) Verify(pub ed25519.PublicKey, body []byte, now time.Time) error {
+	skew := now.Sub(time.Unix(e.Timestamp, 0))
+	if skew > MaxSkew || skew < -MaxSkew {
+		return ErrStale
+	}
+	sig, err := base64.StdEncoding.DecodeString(e.Signature)
+	if err != nil || !ed25519.Verify(pub, Message(e.Timestamp, e.Sequence, body), sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// EncodePublicKey returns the base64 form used in headers and storage.
+func EncodePublicKey(pub ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(pub)
+}
+
+// DecodePublicKey parses a key produced by EncodePublicKey.
+func DecodePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid Ed25519 public key")
+	}
+	return ed25519.PublicKey(b), nil
+}
@@ -0,0 +1,52 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"host":{"host_id":"h1"}}`)
+	env := Sign(priv, now.Unix(), 42, body)
+
+	h := env.Headers()
+	parsed, err := ParseHeaders(func(name string) string { return h[name] })
+	if err != nil || parsed == nil {
+		t.Fatalf("ParseHeaders: %v %v", parsed, err)
+	}
+	if parsed.Sequence != 42 {
+		t.Errorf("sequence = %d", parsed.Sequence)
+	}
+	key, err := DecodePublicKey(parsed.PublicKey)
+	if err != nil || !key.Equal(pub) {
+		t.Fatalf("public key round trip failed: %v", err)
+	}
+
+	if err := parsed.Verify(pub, body, now.Add(time.Minute)); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	if err := parsed.Verify(pub, []byte(`{"host":{"host_id":"h2"}}`), now); err != ErrBadSignature {
+		t.Errorf("tampered body: got %v", err)
+	}
+	if err := parsed.Verify(pub, body, now.Add(MaxSkew+time.Second)); err != ErrStale {
+		t.Errorf("stale timestamp: got %v", err)
+	}
+	tampered := *parsed
+	tampered.Sequence++
+	if err := tampered.Verify(pub, body, now); err != ErrBadSignature {
+		t.Errorf("tampered sequence: got %v", err)
+	}
+}
+
+func TestUnsigned(t *testing.T) {
+	env, err := ParseHeaders(func(string) string { return "" })
+	if env != nil || err != nil {
+		t.Errorf("unsigned request: %v %v", env, err)
+	}
+}
@@ -0,0 +1,214 @@
+// Package upload defines request compression and the multi-part upload
+// session used for payloads too large for a single ingest request.
+//
+// A session is opened with POST /ingest/uploads, which returns an upload_id.
+// The compressed body is then sent in order as POST
+// /ingest/uploads/{id}/parts/{n} (n from 1), and POST
+// /ingest/uploads/{id}/complete reassembles the parts, checks their SHA-256
+// and ingests the result as if it had arrived in one request. Nothing is
+// stored for the host until completion succeeds.
+package upload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings understood for request bodies.
+const (
+	EncodingIdentity = "identity"
+	EncodingGzip     = "gzip"
+	EncodingZstd     = "zstd"
+)
+
+// Supported lists the codings the backend accepts, best first. It is sent
+// as Accept-Encoding with 415 responses so clients can fall back.
+var Supported = []string{EncodingZstd, EncodingGzip, EncodingIdentity}
+
+// MaxDecodedSize bounds decompressed bodies to protect the backend from
+// compression bombs.
+const MaxDecodedSize = 64 << 20
+
+// MaxParts bounds the number of parts in one session.
+const MaxParts = 1000
+
+// ErrUnsupportedEncoding is returned for a coding not in Supported.
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// ErrTooLarge is returned when a body decodes to more than MaxDecodedSize.
+var ErrTooLarge = errors.New("decoded body exceeds size limit")
+
+// Session describes an upload, as sent when it is opened.
+type Session struct {
+	Parts           int    `json:"parts"`
+	Size            int64  `json:"size"`
+	SHA256          string `json:"sha256"`
+	ContentEncoding string `json:"content_encoding"`
+}
+
+// Normalize maps an empty coding to identity and lower-cases the rest.
+func Normalize(encoding string) string {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" {
+		return EncodingIdentity
+	}
+	return encoding
+}
+
+// IsSupported reports whether encoding can be decoded.
+func IsSupported(encoding string) bool {
+	encoding = Normalize(encoding)
+	for _, e := range Supported {
+		if e == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate picks the first of preferred that appears in an Accept-Encoding
+// header value. Weights other than q=0, which excludes a coding, are
+// ignored. It returns "" when nothing matches.
+func Negotiate(acceptEncoding string, preferred []string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		accepted[name] = q > 0
+	}
+	for _, e := range preferred {
+		if accepted[Normalize(e)] {
+			return Normalize(e)
+		}
+	}
+	return ""
+}
+
+// Encode compresses data with encoding.
+func Encode(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch Normalize(encoding) {
+	case EncodingIdentity:
+		return data, nil
+	case EncodingGzip:
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case EncodingZstd:
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode decompresses data, refusing output larger than MaxDecodedSize.
+func Decode(encoding string, data []byte) ([]byte, error) {
+	var r io.Reader
+	switch Normalize(encoding) {
+	case EncodingIdentity:
+		if len(data) > MaxDecodedSize {
+			return nil, ErrTooLarge
+		}
+		return data, nil
+	case EncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	case EncodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderMaxMemory(MaxDecodedSize))
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+	}
+
+	out, err := io.ReadAll(io.LimitReader(r, MaxDecodedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", encoding, err)
+	}
+	if len(out) > MaxDecodedSize {
+		return nil, ErrTooLarge
+	}
+	return out, nil
+}
+
+// Split cuts data into parts of at most size bytes.
+func Split(data []byte, size int) [][]byte {
+	var parts [][]byte
+	for len(data) > size {
+		parts = append(parts, data[:size])
+		data = data[size:]
+	}
+	return append(parts, data)
+}
+
+// Digest returns the hex SHA-256 used in Session.SHA256.
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Validate checks a session description before it is stored.
+func (s Session) Validate(maxPartSize int) error {
+	if s.Parts < 1 || s.Parts > MaxParts {
+		return fmt.Errorf("parts must be between 1 and %d", MaxParts)
+	}
+	if s.Size < 1 || s.Size > int64(s.Parts)*int64(maxPartSize) {
+		return fmt.Errorf("size does not fit in %d parts of at most %d bytes", s.Parts, maxPartSize)
+	}
+	if len(s.SHA256) != 64 {
+		return errors.New("sha256 must be a hex SHA-256 digest")
+	}
+	if !IsSupported(s.ContentEncoding) {
+		return fmt.Errorf("%w: %s", ErrUnsupportedEncoding, s.ContentEncoding)
+	}
+	return nil
+}
+
+// Assemble joins parts and checks them against the session.
+func (s Session) Assemble(parts [][]byte) ([]byte, error) {
+	if len(parts) != s.Parts {
+		return nil, fmt.Errorf("received %d of %d parts", len(parts), s.Parts)
+	}
+	data := bytes.Join(parts, nil)
+	if int64(len(data)) != s.Size || Digest(data) != s.SHA256 {
+		return nil, errors.New("reassembled upload does not match size and sha256")
+	}
+	return data, nil
+}
@@ -0,0 +1,77 @@
+package upload
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	data := []byte(strings.Repeat(`{"name":"openssl","version":"3.0.2"}`, 1000))
+	for _, enc := range Supported {
+		encoded, err := Encode(enc, data)
+		if err != nil {
+			t.Fatalf("%s: %v", enc, err)
+		}
+		if enc != EncodingIdentity && len(encoded) >= len(data) {
+			t.Errorf("%s did not compress: %d >= %d", enc, len(encoded), len(data))
+		}
+		decoded, err := Decode(enc, encoded)
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("%s round trip failed: %v", enc, err)
+		}
+	}
+	if _, err := Encode("br", data); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("br: got %v", err)
+	}
+}
+
+func TestDecodeLimit(t *testing.T) {
+	bomb, err := Encode(EncodingGzip, make([]byte, MaxDecodedSize+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(EncodingGzip, bomb); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	prefs := []string{EncodingZstd, EncodingGzip, EncodingIdentity}
+	cases := map[string]string{
+		"zstd, gzip, identity": EncodingZstd,
+		"gzip, identity":       EncodingGzip,
+		"zstd;q=0, gzip;q=0.5": EncodingGzip,
+		"identity":             EncodingIdentity,
+		"br":                   "",
+	}
+	for header, want := range cases {
+		if got := Negotiate(header, prefs); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestSplitAssemble(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	parts := Split(data, 7)
+	if len(parts) != 3 || len(parts[2]) != 6 {
+		t.Fatalf("unexpected split: %q", parts)
+	}
+
+	s := Session{Parts: 3, Size: int64(len(data)), SHA256: Digest(data), ContentEncoding: EncodingIdentity}
+	if err := s.Validate(7); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Assemble(parts)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Assemble: %q %v", got, err)
+	}
+	if _, err := s.Assemble(parts[:2]); err == nil {
+		t.Error("missing part accepted")
+	}
+	if _, err := s.Assemble([][]byte{parts[1], parts[0], parts[2]}); err == nil {
+		t.Error("reordered parts accepted")
+	}
+}
@@ -20,10 +20,7 @@ export default function HostDetail({ hostId, onBack }: Props) {
     setLoading(true)
     fetchHostDetail(hostId)
       .then(res => {
-        // backend/mock returns host object directly
-        const data = res.data as any
-        if (data.host) setHost(data.host as Host)
-        else setHost(data as Host)
+        setHost((res.data as any).host as Host)
         setLoading(false)
       })
       .catch(err => {
@@ -52,6 +52,7 @@ export default function HostList({ onSelectHost }: Props) {
       <table className="table">
         <thead>
           <tr>
+            <th>Status</th>
             <th>Hostname</th>
             <th>OS</th>
             <th>Version</th>
@@ -63,6 +64,7 @@ export default function HostList({ onSelectHost }: Props) {
         <tbody>
           {filteredHosts.map(host => (
             <tr key={host.host_id}>
+              <td>{host.status || '-'}</td>
               <td>{host.hostname}</td>
               <td>{host.os_id}</td>
               <td>{host.os_version}</td>
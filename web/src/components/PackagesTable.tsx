@@ -12,9 +12,20 @@ export default function PackagesTable({ hostId }: Props) {
   const [loading, setLoading] = useState(true)
 
   useEffect(() => {
-    fetchPackages(hostId)
-      .then(res => {
-        setPackages(res.data.packages || [])
+    // Follow next_token so the search covers the whole inventory
+    const load = async () => {
+      const all: Package[] = []
+      let next: string | undefined
+      do {
+        const res = await fetchPackages(hostId, next)
+        all.push(...(res.data.packages || []))
+        next = res.data.next_token
+      } while (next)
+      return all
+    }
+    load()
+      .then(all => {
+        setPackages(all)
         setLoading(false)
       })
       .catch(err => {
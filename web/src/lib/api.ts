@@ -3,14 +3,22 @@ import axios, { AxiosInstance } from 'axios'
 // const apiBase = import.meta.env.VITE_API_BASE_URL || 'http://localhost:3001'
 const apiBase = 'https://kpi2ow0pna.execute-api.ap-south-1.amazonaws.com/prod'
 
+const apiToken = import.meta.env.VITE_API_TOKEN
+
 export const api: AxiosInstance = axios.create({
   baseURL: apiBase,
   headers: {
-    'Content-Type': 'application/json'
+    'Content-Type': 'application/json',
+    ...(apiToken ? { Authorization: `Bearer ${apiToken}` } : {})
   }
 })
 
 export const fetchHosts = () => api.get('/hosts')
 export const fetchHostDetail = (hostId: string) => api.get(`/hosts/${hostId}`)
-export const fetchPackages = (hostId: string) => api.get('/apps', { params: { hostId } })
-export const fetchCISResults = (hostId: string) => api.get('/cis-results', { params: { hostId } })
+export const fetchPackages = (hostId: string, nextToken?: string) =>
+  api.get(`/hosts/${hostId}/packages`, { params: { limit: 1000, next_token: nextToken } })
+export const fetchCISResults = (hostId: string) => api.get('/cis-results', { params: { host_id: hostId } })
+export const fetchSoftware = (params: { name?: string; manager?: string; sort?: string; next_token?: string } = {}) =>
+  api.get('/software', { params })
+export const fetchSoftwareHosts = (name: string, params: { manager?: string; version?: string; next_token?: string } = {}) =>
+  api.get('/software/hosts', { params: { name, ...params } })
@@ -8,6 +8,9 @@ export interface Host {
   agent_version: string
   last_seen: string
   first_seen: string
+  last_heartbeat?: string
+  status?: 'online' | 'stale' | 'offline'
+  package_count?: number
 }
 
 export interface Package {
@@ -19,12 +22,38 @@ export interface Package {
   installed_at?: string
 }
 
+export interface SoftwareEntry {
+  name: string
+  manager: string
+  host_count: number
+  versions: { version: string; host_count: number }[]
+}
+
+export interface SoftwareHost {
+  host_id: string
+  hostname: string
+  os_id: string
+  status?: 'online' | 'stale' | 'offline'
+  versions: string[]
+  arches: string[]
+  manager: string
+}
+
 export interface CISResult {
   check_id: string
   title: string
-  status: 'pass' | 'fail' | 'manual'
+  status: 'pass' | 'fail' | 'manual' | 'error' | 'timeout'
   evidence: Record<string, any>
   ts: string
+  previous_status?: string
+  status_changed_at?: string
+}
+
+export interface HostSummary {
+  packages: number
+  checks: number
+  by_status: Record<string, number>
+  compliance_score: number | null
 }
 
 export interface IngestPayload {
@@ -0,0 +1,7 @@
+/// <reference types="vite/client" />
+
+interface ImportMetaEnv {
+  // API token sent as a bearer token; a viewer token is enough for the
+  // dashboard
+  readonly VITE_API_TOKEN?: string
+}